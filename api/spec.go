@@ -0,0 +1,34 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// OpenAPISpec — OpenAPI 3.0 for streaming-service REST + WebSocket handshake.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+// Operations returns "METHOD /path" for every operation in OpenAPISpec, sorted (path params as {name}).
+func Operations() ([]string, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPISpec, &doc); err != nil {
+		return nil, err
+	}
+	var ops []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options", "trace":
+				ops = append(ops, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(ops)
+	return ops, nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"github.com/psds-microservice/streaming-service/internal/database"
+	"github.com/psds-microservice/streaming-service/internal/grpccreds"
+	"github.com/psds-microservice/streaming-service/internal/recording"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"github.com/psds-microservice/streaming-service/internal/sessionmanager"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var recordingCmd = &cobra.Command{
+	Use:   "recording",
+	Short: "Recording tools",
+}
+
+var recordingFlushAll bool
+
+var recordingFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Upload spooled recordings (RECORDING_SPOOL_DIR) to recording-service",
+	Long: `Uploads complete recordings from the local recording spool to recording-service and removes them.
+With --all, sessions that are still being spooled are uploaded too: use it only when the API is stopped.`,
+	RunE: runRecordingFlush,
+}
+
+func init() {
+	recordingFlushCmd.Flags().BoolVar(&recordingFlushAll, "all", false, "also upload incomplete sessions (API must be stopped)")
+	recordingCmd.AddCommand(recordingFlushCmd)
+	rootCmd.AddCommand(recordingCmd)
+}
+
+func runRecordingFlush(cmd *cobra.Command, args []string) error {
+	_ = godotenv.Load(".env")
+	_ = godotenv.Load("../.env")
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if cfg.RecordingSpoolDir == "off" {
+		return fmt.Errorf("recording spool is disabled (RECORDING_SPOOL_DIR=off)")
+	}
+	spool, err := recording.NewSpool(cfg.RecordingSpoolDir, cfg.RecordingSpoolMaxBytes)
+	if err != nil {
+		return fmt.Errorf("recording spool: %w", err)
+	}
+	db, err := database.Open(cfg.DSN())
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	logger, _ := zap.NewDevelopment()
+	defer logger.Sync()
+	// Results are persisted like in the API; session-manager is notified by the API's notifier queue.
+	svc := service.NewSessionService(db, cfg, nil, logger)
+	svc.SetRecordingNotifier(sessionmanager.NewNotifier(db, nil, cfg.SessionManagerNotifyMaxAttempts, logger))
+	creds, err := grpccreds.New(cfg.RecordingServiceGRPC, "recording-service", logger)
+	if err != nil {
+		return err
+	}
+	defer creds.Close()
+	client := recording.NewClient(cfg.RecordingServiceAddr, logger)
+	client.SetDialOptions(creds.DialOptions()...)
+	client.SetSpool(spool)
+	client.OnRecordingURL(svc.RecordingFinalized)
+	client.OnRecordingError(svc.RecordingFailed)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+	defer client.Close()
+	n, err := client.FlushSpool(ctx, recordingFlushAll)
+	fmt.Printf("recording: %d spooled recording(s) uploaded\n", n)
+	return err
+}
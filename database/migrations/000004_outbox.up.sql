@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  seq BIGSERIAL PRIMARY KEY,
+  id UUID NOT NULL UNIQUE,
+  event_type VARCHAR(64) NOT NULL,
+  aggregate_id UUID,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  published_at TIMESTAMP WITH TIME ZONE,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(seq) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox(published_at) WHERE published_at IS NOT NULL;
+
+-- Relay delivers at-least-once: the same event may reach the webhook sink twice.
+-- Keep the earliest delivery of each (subscription, event) so the unique index can be built.
+DELETE FROM webhook_deliveries d
+USING webhook_deliveries k
+WHERE d.subscription_id = k.subscription_id
+  AND d.event_id = k.event_id
+  AND (COALESCE(d.created_at, 'infinity'), d.id) > (COALESCE(k.created_at, 'infinity'), k.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_event ON webhook_deliveries(subscription_id, event_id);
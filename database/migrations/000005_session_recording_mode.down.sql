@@ -0,0 +1 @@
+ALTER TABLE streaming_sessions DROP COLUMN IF EXISTS recording_mode;
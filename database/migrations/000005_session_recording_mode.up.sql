@@ -0,0 +1,3 @@
+ALTER TABLE streaming_sessions
+  ADD COLUMN IF NOT EXISTS recording_mode VARCHAR(10) NOT NULL DEFAULT 'off'
+  CHECK (recording_mode IN ('off', 'on', 'paused'));
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS session_manager_notifications;
+
+ALTER TABLE streaming_sessions
+  DROP COLUMN IF EXISTS recording_error,
+  DROP COLUMN IF EXISTS recording_status,
+  DROP COLUMN IF EXISTS recording_url;
@@ -0,0 +1,20 @@
+ALTER TABLE streaming_sessions
+  ADD COLUMN IF NOT EXISTS recording_url TEXT,
+  ADD COLUMN IF NOT EXISTS recording_status VARCHAR(20) NOT NULL DEFAULT 'none'
+    CHECK (recording_status IN ('none', 'pending', 'finished', 'failed')),
+  ADD COLUMN IF NOT EXISTS recording_error TEXT;
+
+CREATE TABLE IF NOT EXISTS session_manager_notifications (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  session_id UUID NOT NULL,
+  recording_url TEXT NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'failed')),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  done_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_manager_notifications_due ON session_manager_notifications(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_session_manager_notifications_session_id ON session_manager_notifications(session_id);
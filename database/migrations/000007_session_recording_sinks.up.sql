@@ -0,0 +1,3 @@
+-- Recording sinks selected for the session (comma-separated, e.g. 'grpc,fs'); empty = all configured sinks.
+ALTER TABLE streaming_sessions
+  ADD COLUMN IF NOT EXISTS recording_sinks VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+DELETE FROM session_manager_notifications WHERE kind = 'status';
+
+ALTER TABLE session_manager_notifications
+  DROP CONSTRAINT IF EXISTS session_manager_notifications_status_check,
+  ADD CONSTRAINT session_manager_notifications_status_check
+    CHECK (status IN ('pending', 'done', 'failed')),
+  ALTER COLUMN recording_url DROP DEFAULT,
+  DROP COLUMN IF EXISTS session_status,
+  DROP COLUMN IF EXISTS target_id,
+  DROP COLUMN IF EXISTS kind;
+
+DROP INDEX IF EXISTS idx_streaming_sessions_session_manager_session_id;
+ALTER TABLE streaming_sessions DROP COLUMN IF EXISTS session_manager_session_id;
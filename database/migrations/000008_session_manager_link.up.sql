@@ -0,0 +1,15 @@
+ALTER TABLE streaming_sessions
+  ADD COLUMN IF NOT EXISTS session_manager_session_id VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_streaming_sessions_session_manager_session_id ON streaming_sessions(session_manager_session_id);
+
+-- The notification queue also carries status pushes (Control) besides SetRecordingUrl.
+ALTER TABLE session_manager_notifications
+  ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'recording_url'
+    CHECK (kind IN ('recording_url', 'status')),
+  ADD COLUMN IF NOT EXISTS target_id VARCHAR(64),
+  ADD COLUMN IF NOT EXISTS session_status VARCHAR(20),
+  ALTER COLUMN recording_url SET DEFAULT '',
+  DROP CONSTRAINT IF EXISTS session_manager_notifications_status_check,
+  ADD CONSTRAINT session_manager_notifications_status_check
+    CHECK (status IN ('pending', 'done', 'failed', 'superseded'));
@@ -0,0 +1,2 @@
+ALTER TABLE outbox DROP COLUMN IF EXISTS lease_until;
+ALTER TABLE outbox DROP COLUMN IF EXISTS lease_owner;
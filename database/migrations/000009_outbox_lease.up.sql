@@ -0,0 +1,3 @@
+-- Relays lease the head of the outbox instead of holding row locks while they publish.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS lease_owner VARCHAR(64);
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS lease_until TIMESTAMP WITH TIME ZONE;
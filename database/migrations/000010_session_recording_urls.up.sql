@@ -0,0 +1,4 @@
+-- A recording is uploaded in parts and a session can be recorded more than once (stop/start):
+-- recording_urls keeps every part in order, recording_url stays the first one.
+ALTER TABLE streaming_sessions ADD COLUMN IF NOT EXISTS recording_urls TEXT[] NOT NULL DEFAULT '{}';
+UPDATE streaming_sessions SET recording_urls = ARRAY[recording_url] WHERE recording_url IS NOT NULL;
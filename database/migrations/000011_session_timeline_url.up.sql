@@ -0,0 +1,2 @@
+-- The session's event timeline as stored next to its recording in recording-service (empty: not stored there).
+ALTER TABLE streaming_sessions ADD COLUMN IF NOT EXISTS timeline_url TEXT NOT NULL DEFAULT '';
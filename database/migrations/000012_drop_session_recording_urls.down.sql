@@ -0,0 +1,2 @@
+ALTER TABLE streaming_sessions ADD COLUMN IF NOT EXISTS recording_urls TEXT[] NOT NULL DEFAULT '{}';
+UPDATE streaming_sessions SET recording_urls = ARRAY[recording_url] WHERE recording_url IS NOT NULL;
@@ -0,0 +1,2 @@
+-- A session is recorded as one recording (resumed on a new stream after a break), so recording_url is its only URL.
+ALTER TABLE streaming_sessions DROP COLUMN IF EXISTS recording_urls;
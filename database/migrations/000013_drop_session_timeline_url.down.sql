@@ -0,0 +1 @@
+ALTER TABLE streaming_sessions ADD COLUMN IF NOT EXISTS timeline_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Timelines stay in RECORDING_TIMELINE_DIR and are served by GET /sessions/:id/timeline; recording-service only gets media.
+ALTER TABLE streaming_sessions DROP COLUMN IF EXISTS timeline_url;
@@ -3,25 +3,47 @@ package application
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/psds-microservice/streaming-service/internal/breaker"
 	"github.com/psds-microservice/streaming-service/internal/config"
 	"github.com/psds-microservice/streaming-service/internal/database"
+	"github.com/psds-microservice/streaming-service/internal/grpccreds"
+	"github.com/psds-microservice/streaming-service/internal/grpcserver"
 	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/internal/hls"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/outbox"
 	"github.com/psds-microservice/streaming-service/internal/recording"
 	"github.com/psds-microservice/streaming-service/internal/router"
+	"github.com/psds-microservice/streaming-service/internal/rtmp"
 	"github.com/psds-microservice/streaming-service/internal/service"
+	"github.com/psds-microservice/streaming-service/internal/sessionmanager"
+	"github.com/psds-microservice/streaming-service/internal/sfu"
+	"github.com/psds-microservice/streaming-service/internal/urltoken"
+	"github.com/psds-microservice/streaming-service/internal/webhook"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 // API is the HTTP + WebSocket API application.
 type API struct {
 	cfg      *config.Config
 	srv      *http.Server
-	recorder *recording.Client
+	recorder *recording.Composite // nil when recording is disabled
+	timeline *recording.Timeline  // nil when timelines are disabled
 	hub      *service.StreamHub
+	webhooks *webhook.Dispatcher
+	relay    *outbox.Relay
+	notifier *sessionmanager.Notifier // nil when SESSION_MANAGER_GRPC_ADDR is empty
+	hls      *hls.Server              // nil when HLS_ENABLED is off
+	rtmp     *rtmp.Server             // nil if RTMP_PORT=off
+	closers  []io.Closer
+	grpcSrv  *grpc.Server // nil if GRPC_PORT=off
 }
 
 // NewAPI creates the API application: validates config, runs migrations, opens DB, builds router.
@@ -45,22 +67,137 @@ func NewAPI(cfg *config.Config) (*API, error) {
 
 	hub := service.NewStreamHub(cfg.WSMaxMessageSize, logger)
 	hub.SetReadLimit(cfg.WSMaxMessageSize)
-	var recClient *recording.Client
-	if cfg.EnableRecording && cfg.RecordingServiceAddr != "" && cfg.SessionManagerGRPCAddr != "" {
-		recClient = recording.NewClient(cfg.RecordingServiceAddr, cfg.SessionManagerGRPCAddr, logger)
-		if err := recClient.Connect(context.Background()); err != nil {
-			log.Printf("warning: recording client connect failed (recording disabled): %v", err)
-			recClient = nil
-		} else {
-			hub.SetRecorder(recClient)
+	hub.SetWSOptions(service.WSOptions{
+		ReadBufferSize:   cfg.WSReadBufferSize,
+		WriteBufferSize:  cfg.WSWriteBufferSize,
+		WriteBufferPool:  cfg.WSWriteBufferPool,
+		HandshakeTimeout: time.Duration(cfg.WSHandshakeTimeout) * time.Second,
+		Compression:      cfg.WSCompression,
+		CompressionLevel: cfg.WSCompressionLevel,
+		AllowedOrigins:   cfg.WSAllowedOriginList(),
+	})
+	hub.SetInspector(service.NewContainerInspector())
+	var closers []io.Closer
+	breakers := breaker.NewRegistry(breaker.Settings{
+		FailureThreshold: uint32(cfg.BreakerFailureThreshold),
+		OpenTimeout:      time.Duration(cfg.BreakerOpenSeconds) * time.Second,
+		HalfOpenRequests: uint32(cfg.BreakerHalfOpenRequests),
+		Interval:         time.Duration(cfg.BreakerIntervalSeconds) * time.Second,
+	}, logger)
+	recorder, err := newRecorder(cfg, logger, breakers, &closers)
+	if err != nil {
+		return nil, err
+	}
+	if recorder != nil {
+		hub.SetRecorder(recorder)
+	}
+	sessionSvc := service.NewSessionService(db, cfg, hub, logger)
+	webhooks := webhook.NewDispatcher(db, time.Duration(cfg.WebhookTimeout)*time.Second, cfg.WebhookMaxAttempts, logger)
+	sink, err := newOutboxSink(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	bus := outbox.NewBus()
+	sinks := []outbox.Sink{webhooks, bus}
+	if sink != nil {
+		sinks = append(sinks, sink)
+		if c, ok := sink.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+	relay := outbox.NewRelay(db, logger, sinks...)
+	var timeline *recording.Timeline
+	if dir := cfg.TimelineDir(); recorder != nil && dir != "" {
+		timeline, err = recording.NewTimeline(dir, time.Duration(cfg.RecordingTimelineMaxAgeHours)*time.Hour, logger)
+		if err != nil {
+			return nil, fmt.Errorf("timeline: %w", err)
 		}
+		hub.SetTimeline(timeline)
+		hub.SetRecordingStates(recorder)
+		sessionSvc.SetTimelines(timeline)
+	}
+	var notifier *sessionmanager.Notifier
+	if cfg.SessionManagerGRPCAddr != "" {
+		creds, err := grpccreds.New(cfg.SessionManagerGRPC, "session-manager", logger)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, creds)
+		conn, err := sessionmanager.Dial(cfg.SessionManagerGRPCAddr, creds.DialOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("session-manager: %w", err)
+		}
+		closers = append(closers, conn)
+		notifier = sessionmanager.NewNotifier(db, conn, cfg.SessionManagerNotifyMaxAttempts, logger)
+		notifier.SetBreaker(breakers.Breaker("session-manager"))
+		sessionSvc.SetSessionManager(notifier)
+		if recorder != nil && cfg.HasRecordingBackend("grpc") {
+			sessionSvc.SetRecordingNotifier(notifier)
+		}
+	}
+	if recorder != nil {
+		recorder.OnRecordingURL(sessionSvc.RecordingFinalized)
+		recorder.OnRecordingError(sessionSvc.RecordingFailed)
+		recorder.OnStateChange(func(sessionID string, st model.RecordingState) {
+			hub.Broadcast(sessionID, model.RecordingStateEvent{Event: "recording_state", RecordingState: st})
+		})
+		recorder.SetSinkResolver(sessionSvc.RecordingSinks)
+		sessionSvc.SetRecordingStates(recorder)
+		sessionSvc.SetRecordingSinks(recorder.Names())
 	}
-	sessionSvc := service.NewSessionService(db, cfg, hub)
 	sessionHandler := handler.NewSessionHandler(sessionSvc, cfg.WSBaseURL)
 	streamWS := handler.NewStreamWSHandler(hub, sessionSvc, logger)
+	var whipSrv service.WHIPServer
+	if cfg.WebRTCEnabled {
+		rtc, err := sfu.New(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("webrtc: %w", err)
+		}
+		streamWS.SetSFU(rtc)
+		whipSrv = rtc
+		closers = append(closers, rtc)
+	}
+	whipHandler := handler.NewWHIPHandler(sessionSvc, hub, whipSrv, logger)
+	viewerHandler := handler.NewViewerHandler(sessionSvc, hub, logger)
+	if cfg.URLTokenSecret == "" {
+		logger.Warn("URL_TOKEN_SECRET is empty: signed URLs are only valid on this instance until it restarts")
+	}
+	urlTokens := urltoken.New(cfg.URLTokenSecret, time.Duration(cfg.URLTokenTTLSeconds)*time.Second)
+	snapshotHandler := handler.NewSnapshotHandler(sessionSvc, hub, urlTokens, cfg.AdminToken)
 	health := handler.NewHealthHandler()
+	health.SetBreakers(breakers)
+	admin := handler.NewAdminHandler(hub, sessionSvc, cfg.AdminToken, logger)
+	if recorder != nil {
+		admin.SetRecordingSinks(recorder)
+	}
+	webhookHandler := handler.NewWebhookHandler(webhooks, admin)
+	var hlsSrv *hls.Server
+	var packager service.HLSPackager
+	if cfg.HLSEnabled {
+		hlsSrv = hls.New(hub, hls.Settings{
+			SegmentDuration: time.Duration(cfg.HLSSegmentSeconds) * time.Second,
+			PartDuration:    time.Duration(cfg.HLSPartMillis) * time.Millisecond,
+			Window:          cfg.HLSWindow,
+			MaxBytes:        int(cfg.HLSMaxBytes),
+			Idle:            time.Duration(cfg.HLSIdleSeconds) * time.Second,
+		}, logger)
+		hlsSrv.OnViewerLeft(sessionSvc.OperatorLeft)
+		packager = hlsSrv
+	}
+	hlsHandler := handler.NewHLSHandler(sessionSvc, packager, urlTokens, logger)
 
-	r := router.New(sessionHandler, streamWS, health)
+	r := router.New(router.Handlers{
+		Sessions:  sessionHandler,
+		StreamWS:  streamWS,
+		Health:    health,
+		Admin:     admin,
+		Webhooks:  webhookHandler,
+		HLS:       hlsHandler,
+		WHIP:      whipHandler,
+		Viewers:   viewerHandler,
+		Snapshots: snapshotHandler,
+		Swagger:   handler.NewSwaggerHandler(),
+	})
 
 	srv := &http.Server{
 		Addr:              cfg.Addr(),
@@ -71,7 +208,110 @@ func NewAPI(cfg *config.Config) (*API, error) {
 		IdleTimeout:       60 * time.Second,
 	}
 
-	return &API{cfg: cfg, srv: srv, recorder: recClient, hub: hub}, nil
+	var rtmpSrv *rtmp.Server
+	if cfg.RTMPPort != "off" {
+		rtmpSrv = rtmp.New(sessionSvc, hub, cfg.RTMPFormat, logger)
+		closers = append(closers, rtmpSrv)
+	}
+
+	var grpcSrv *grpc.Server
+	if cfg.GRPCPort != "off" {
+		grpcSrv = grpcserver.NewGRPCServer(grpcserver.NewServer(sessionSvc, bus, cfg.WSBaseURL, logger))
+	}
+
+	return &API{cfg: cfg, srv: srv, recorder: recorder, timeline: timeline, hub: hub, webhooks: webhooks, relay: relay, notifier: notifier, hls: hlsSrv, rtmp: rtmpSrv, closers: closers, grpcSrv: grpcSrv}, nil
+}
+
+// stopGRPC stops gracefully, cancelling remaining streams (WatchSessionEvents) when ctx expires.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+// newRecorder builds the recording sinks listed in RECORDING_BACKEND behind a composite recorder;
+// nil when recording is disabled or no sink is available. Resources to release on shutdown are added to closers.
+func newRecorder(cfg *config.Config, logger *zap.Logger, breakers *breaker.Registry, closers *[]io.Closer) (*recording.Composite, error) {
+	if !cfg.EnableRecording {
+		return nil, nil
+	}
+	var sinks []recording.Sink
+	for _, name := range cfg.RecordingBackends() {
+		switch name {
+		case "fs":
+			r, err := recording.NewFSRecorder(cfg.RecordingFSDir, time.Duration(cfg.RecordingFSMaxAgeHours)*time.Hour, cfg.RecordingFSMaxBytes, logger)
+			if err != nil {
+				return nil, fmt.Errorf("recording: %w", err)
+			}
+			sinks = append(sinks, recording.Sink{Name: name, Recorder: r})
+		case "grpc":
+			c, err := newRecordingClient(cfg, logger, breakers, closers)
+			if err != nil {
+				return nil, fmt.Errorf("recording: %w", err)
+			}
+			if c != nil {
+				sinks = append(sinks, recording.Sink{Name: name, Recorder: c})
+			}
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return recording.NewComposite(sinks, cfg.RecordingSinkQueueSize, logger), nil
+}
+
+// newRecordingClient builds the recording-service sink; nil when it is not configured.
+func newRecordingClient(cfg *config.Config, logger *zap.Logger, breakers *breaker.Registry, closers *[]io.Closer) (*recording.Client, error) {
+	if cfg.RecordingServiceAddr == "" {
+		return nil, nil
+	}
+	creds, err := grpccreds.New(cfg.RecordingServiceGRPC, "recording-service", logger)
+	if err != nil {
+		return nil, err
+	}
+	*closers = append(*closers, creds)
+	client := recording.NewClient(cfg.RecordingServiceAddr, logger)
+	client.SetDialOptions(creds.DialOptions()...)
+	client.SetBreaker(breakers.Breaker("recording-service"))
+	if cfg.RecordingSpoolDir != "off" {
+		spool, err := recording.NewSpool(cfg.RecordingSpoolDir, cfg.RecordingSpoolMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("spool: %w", err)
+		}
+		if n, err := spool.RecoverIncomplete(); err != nil {
+			return nil, fmt.Errorf("spool: %w", err)
+		} else if n > 0 {
+			log.Printf("recording spool: %d recording(s) left by a previous run queued for upload", n)
+		}
+		client.SetSpool(spool)
+	}
+	// The connection is established in the background: while recording-service is unreachable, the first
+	// failed stream of a session moves it to the spool.
+	if err := client.Connect(context.Background()); err != nil {
+		return nil, fmt.Errorf("recording client: %w", err)
+	}
+	return client, nil
+}
+
+// newOutboxSink builds the sink selected by OUTBOX_SINK; nil for "none".
+func newOutboxSink(cfg *config.Config, logger *zap.Logger) (outbox.Sink, error) {
+	switch cfg.OutboxSink {
+	case "none":
+		return nil, nil
+	case "http":
+		return outbox.NewHTTPSink(cfg.OutboxHTTPURL, 10*time.Second), nil
+	case "nats":
+		return outbox.NewNATSSink(cfg.OutboxNATSURL, cfg.OutboxNATSSubject, cfg.OutboxNATSJetStream, 10*time.Second)
+	default:
+		return outbox.NewLogSink(logger), nil
+	}
 }
 
 // Run starts the HTTP server and blocks until ctx is cancelled; then shuts down gracefully.
@@ -85,26 +325,74 @@ func (a *API) Run(ctx context.Context) error {
 	log.Printf("HTTP server listening on %s", addr)
 	log.Printf("  Health:        %s/health", base)
 	log.Printf("  Ready:         %s/ready", base)
+	log.Printf("  Metrics:       %s/metrics", base)
 	log.Printf("  Sessions:      %s/sessions", base)
+	log.Printf("  Swagger:       %s/swagger", base)
+	log.Printf("  Admin:         %s/admin/sessions", base)
 	log.Printf("  WebSocket:     ws://%s:%s/ws/stream/:session_id/:user_id", host, a.cfg.HTTPPort)
 
 	// Set app context in hub for recording (shutdown propagation)
 	a.hub.SetContext(ctx)
+	go a.hub.ExpireSnapshots(ctx, time.Duration(a.cfg.SessionIdleTimeout)*time.Second)
+	go a.webhooks.Run(ctx)
+	go a.relay.Run(ctx)
+	if a.recorder != nil {
+		go a.recorder.Run(ctx)
+	}
+	if a.timeline != nil {
+		go a.timeline.Run(ctx)
+	}
+	if a.notifier != nil {
+		go a.notifier.Run(ctx)
+	}
+	if a.hls != nil {
+		go a.hls.Run(ctx)
+	}
 
 	go func() {
 		if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("http: %v", err)
 		}
 	}()
+	if a.grpcSrv != nil {
+		lis, err := net.Listen("tcp", a.cfg.GRPCAddr())
+		if err != nil {
+			return fmt.Errorf("grpc listen: %w", err)
+		}
+		log.Printf("gRPC server listening on %s", a.cfg.GRPCAddr())
+		go func() {
+			if err := a.grpcSrv.Serve(lis); err != nil {
+				log.Printf("grpc: %v", err)
+			}
+		}()
+	}
+	if a.rtmp != nil {
+		lis, err := net.Listen("tcp", a.cfg.RTMPAddr())
+		if err != nil {
+			return fmt.Errorf("rtmp listen: %w", err)
+		}
+		log.Printf("RTMP ingest listening on %s (format %s)", a.cfg.RTMPAddr(), a.cfg.RTMPFormat)
+		go func() {
+			if err := a.rtmp.Serve(lis); err != nil {
+				log.Printf("rtmp: %v", err)
+			}
+		}()
+	}
 
 	<-ctx.Done()
 	if a.recorder != nil {
 		_ = a.recorder.Close()
 	}
+	for _, c := range a.closers {
+		_ = c.Close()
+	}
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := a.srv.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("http shutdown: %w", err)
 	}
+	if a.grpcSrv != nil {
+		stopGRPC(shutdownCtx, a.grpcSrv)
+	}
 	return nil
 }
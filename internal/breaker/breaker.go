@@ -0,0 +1,192 @@
+// Package breaker wraps calls to downstream services (recording-service, session-manager) in circuit breakers:
+// after consecutive failures (the service unreachable or timing out) the circuit opens and calls fail fast with ErrOpen, so callers take their fallback
+// (spool, skip, retry later) instead of hammering a broken service; after a cool-down a few half-open trial
+// calls decide whether it closes again. States are exported as Prometheus metrics and reported in /ready.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrOpen is returned instead of calling the service while the circuit is open (or half-open and busy).
+var ErrOpen = errors.New("circuit breaker open")
+
+// Settings are the thresholds of a breaker.
+type Settings struct {
+	FailureThreshold uint32        // consecutive failures that open the circuit
+	OpenTimeout      time.Duration // how long the circuit stays open before half-open
+	HalfOpenRequests uint32        // trial calls allowed while half-open; all must succeed to close
+	Interval         time.Duration // closed state: failure counts reset this often; 0 never resets
+}
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "streaming_breaker_state",
+		Help: "Circuit breaker state: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "streaming_breaker_transitions_total",
+		Help: "Circuit breaker state transitions.",
+	}, []string{"name", "to"})
+	rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "streaming_breaker_rejected_total",
+		Help: "Calls rejected without reaching the service because the circuit was open.",
+	}, []string{"name"})
+	failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "streaming_breaker_failures_total",
+		Help: "Failed calls through the circuit breaker.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(stateGauge, transitions, rejected, failures)
+}
+
+// Breaker is a named circuit breaker.
+type Breaker struct {
+	name string
+	cb   *gobreaker.CircuitBreaker
+
+	mu        sync.Mutex
+	changedAt time.Time
+	lastErr   string
+}
+
+// New creates a breaker; state changes are logged once per transition.
+func New(name string, s Settings, log *zap.Logger) *Breaker {
+	b := &Breaker{name: name, changedAt: time.Now()}
+	threshold := max(s.FailureThreshold, 1)
+	b.cb = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:         name,
+		MaxRequests:  max(s.HalfOpenRequests, 1),
+		Interval:     s.Interval,
+		Timeout:      s.OpenTimeout,
+		IsSuccessful: func(err error) bool { return !failure(err) },
+		ReadyToTrip:  func(c gobreaker.Counts) bool { return c.ConsecutiveFailures >= threshold },
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			b.mu.Lock()
+			b.changedAt = time.Now()
+			lastErr := b.lastErr
+			b.mu.Unlock()
+			stateGauge.WithLabelValues(name).Set(stateValue(to))
+			transitions.WithLabelValues(name, to.String()).Inc()
+			log.Warn("circuit breaker state changed",
+				zap.String("breaker", name),
+				zap.String("from", from.String()),
+				zap.String("to", to.String()),
+				zap.String("last_error", lastErr))
+		},
+	})
+	stateGauge.WithLabelValues(name).Set(0)
+	return b
+}
+
+// Do calls fn unless the circuit is open and returns fn's error; only errors meaning the service is unavailable
+// count as failures (see failure). Returns ErrOpen when rejected.
+func (b *Breaker) Do(fn func() error) error {
+	_, err := b.cb.Execute(func() (interface{}, error) {
+		if err := fn(); err != nil {
+			if !failure(err) {
+				return nil, err
+			}
+			failures.WithLabelValues(b.name).Inc()
+			b.mu.Lock()
+			b.lastErr = err.Error()
+			b.mu.Unlock()
+			return nil, err
+		}
+		return nil, nil
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		rejected.WithLabelValues(b.name).Inc()
+		return ErrOpen
+	}
+	return err
+}
+
+// Open reports whether calls are currently rejected.
+func (b *Breaker) Open() bool {
+	return b.cb.State() == gobreaker.StateOpen
+}
+
+// State reports the breaker for /ready.
+func (b *Breaker) State() model.BreakerState {
+	counts := b.cb.Counts()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return model.BreakerState{
+		Name:                b.name,
+		State:               b.cb.State().String(),
+		ConsecutiveFailures: counts.ConsecutiveFailures,
+		Since:               b.changedAt.UTC(),
+		LastError:           b.lastErr,
+	}
+}
+
+// failure reports whether err means the service is unreachable or not answering in time: gRPC Unavailable or
+// DeadlineExceeded, or an expired context. Any other error is an answer of a working service (rejected request,
+// unknown session, ...) and does not trip the circuit.
+func failure(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func stateValue(s gobreaker.State) float64 {
+	switch s {
+	case gobreaker.StateHalfOpen:
+		return 1
+	case gobreaker.StateOpen:
+		return 2
+	}
+	return 0
+}
+
+// Registry collects the breakers of the process for /ready.
+type Registry struct {
+	settings Settings
+	log      *zap.Logger
+
+	mu       sync.Mutex
+	breakers []*Breaker
+}
+
+// NewRegistry creates a registry whose breakers share settings.
+func NewRegistry(s Settings, log *zap.Logger) *Registry {
+	return &Registry{settings: s, log: log}
+}
+
+// Breaker creates and registers a breaker named name.
+func (r *Registry) Breaker(name string) *Breaker {
+	b := New(name, r.settings, r.log)
+	r.mu.Lock()
+	r.breakers = append(r.breakers, b)
+	r.mu.Unlock()
+	return b
+}
+
+// States reports every registered breaker.
+func (r *Registry) States() []model.BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]model.BreakerState, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		out = append(out, b.State())
+	}
+	return out
+}
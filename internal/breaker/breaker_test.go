@@ -0,0 +1,43 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreakerCountsOnlyUnavailability(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenRequests: 1}, zap.NewNop())
+
+	for _, err := range []error{
+		status.Error(codes.NotFound, "no such session"),
+		status.Error(codes.InvalidArgument, "bad id"),
+		status.Error(codes.Internal, "disk full"),
+		errors.New("control rejected"),
+	} {
+		for range 3 {
+			if got := b.Do(func() error { return err }); got != err {
+				t.Fatalf("Do returned %v, want %v", got, err)
+			}
+		}
+	}
+	if b.Open() || b.State().ConsecutiveFailures != 0 {
+		t.Fatalf("answers of a working service tripped the circuit: %+v", b.State())
+	}
+
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	_ = b.Do(func() error { return unavailable })
+	_ = b.Do(func() error { return fmt.Errorf("close and recv: %w", context.DeadlineExceeded) })
+	if !b.Open() {
+		t.Fatalf("circuit closed after two unavailable calls: %+v", b.State())
+	}
+	if err := b.Do(func() error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Do while open = %v, want ErrOpen", err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -15,8 +17,13 @@ type Config struct {
 	AppEnv   string // APP_ENV
 	AppHost  string // APP_HOST
 	HTTPPort string // APP_PORT or HTTP_PORT
+	GRPCPort string // GRPC_PORT ("off" = gRPC API disabled)
 	LogLevel string // LOG_LEVEL
 
+	// RTMP ingest: encoders publish with the session's stream key as the stream name
+	RTMPPort   string // RTMP_PORT ("off" = RTMP ingest disabled; 1935 is the standard port)
+	RTMPFormat string // RTMP_FORMAT: frames relayed to operators, "flv" (tags unchanged) or "mpegts" (H.264/AAC repackaged)
+
 	// PostgreSQL (nested as in template)
 	DB struct {
 		Host     string
@@ -28,21 +35,128 @@ type Config struct {
 	}
 
 	// WebSocket
-	WSReadBufferSize  int
-	WSWriteBufferSize int
-	WSMaxMessageSize  int64
+	WSReadBufferSize   int    // WS_READ_BUFFER_SIZE: bytes; 0 reuses the HTTP server's buffers
+	WSWriteBufferSize  int    // WS_WRITE_BUFFER_SIZE
+	WSWriteBufferPool  bool   // WS_WRITE_BUFFER_POOL: write buffers are pooled between writes instead of held per connection
+	WSMaxMessageSize   int64  // WS_MAX_MESSAGE_SIZE
+	WSHandshakeTimeout int    // WS_HANDSHAKE_TIMEOUT, seconds; 0 = no limit
+	WSCompression      bool   // WS_COMPRESSION: negotiate permessage-deflate; text control frames are compressed, media frames are not
+	WSCompressionLevel int    // WS_COMPRESSION_LEVEL: flate level, -2 (Huffman only) to 9
+	WSAllowedOrigins   string // WS_ALLOWED_ORIGINS: comma-separated origins (https://app.example.com) or "*"; same-origin requests and those without Origin are always allowed
 
 	// Session
 	SessionMaxOperators int
-	SessionIdleTimeout  int // seconds
+	SessionIdleTimeout  int // SESSION_IDLE_TIMEOUT seconds: snapshots of sessions without peers are dropped after this long
 
 	// WebSocket URL returned in CreateSession (e.g. wss://stream.example.com)
 	WSBaseURL string
 
 	// Recording: copy stream to recording-service, then set URL in session-manager
-	EnableRecording        bool   // ENABLE_RECORDING
-	RecordingServiceAddr   string // RECORDING_SERVICE_ADDR (gRPC, e.g. localhost:8096)
-	SessionManagerGRPCAddr string // SESSION_MANAGER_GRPC_ADDR (e.g. localhost:8091)
+	EnableRecording                 bool             // ENABLE_RECORDING
+	RecordingBackend                string           // RECORDING_BACKEND: comma-separated sinks, grpc (recording-service) and/or fs (local directory / archive)
+	RecordingSinkQueueSize          int              // RECORDING_SINK_QUEUE_SIZE: chunks queued per sink before that sink starts dropping
+	RecordingServiceAddr            string           // RECORDING_SERVICE_ADDR (gRPC, e.g. localhost:8096)
+	RecordingServiceGRPC            GRPCClientConfig // RECORDING_SERVICE_TLS*, RECORDING_SERVICE_TOKEN*
+	SessionManagerGRPCAddr          string           // SESSION_MANAGER_GRPC_ADDR (e.g. localhost:8091)
+	SessionManagerGRPC              GRPCClientConfig // SESSION_MANAGER_TLS*, SESSION_MANAGER_TOKEN*
+	SessionManagerRequireLink       bool             // SESSION_MANAGER_REQUIRE_LINK: POST /sessions must carry session_manager_session_id
+	SessionManagerNotifyMaxAttempts int              // SESSION_MANAGER_NOTIFY_MAX_ATTEMPTS: SetRecordingUrl and status push retries before the notification is marked failed
+	RecordingSpoolDir               string           // RECORDING_SPOOL_DIR: chunks are spooled here while recording-service is down; "off" disables
+	RecordingSpoolMaxBytes          int64            // RECORDING_SPOOL_MAX_BYTES: total spool size cap
+	RecordingFSDir                  string           // RECORDING_FS_DIR (fs backend)
+	RecordingTimelineDir            string           // RECORDING_TIMELINE_DIR: session event timelines; default next to fs recordings, "off" disables
+	RecordingTimelineMaxAgeHours    int              // RECORDING_TIMELINE_MAX_AGE_HOURS: timelines not written to for this long are removed; 0 keeps them
+	RecordingFSMaxAgeHours          int              // RECORDING_FS_MAX_AGE_HOURS: finished recordings older than this are removed; 0 keeps them
+	RecordingFSMaxBytes             int64            // RECORDING_FS_MAX_BYTES: oldest recordings are removed above this total; 0 is unlimited
+
+	// WebRTC mode (binary built with -tags webrtc): the client's RTP tracks are forwarded to operators by an SFU,
+	// signaling goes over the stream WebSocket
+	WebRTCEnabled       bool   // WEBRTC_ENABLED
+	WebRTCICEServers    string // WEBRTC_ICE_SERVERS: comma-separated stun:/turn: URLs handed to the service's peer connections
+	WebRTCICEUsername   string // WEBRTC_ICE_USERNAME (turn)
+	WebRTCICECredential string // WEBRTC_ICE_CREDENTIAL (turn)
+	WebRTCUDPPortMin    int    // WEBRTC_UDP_PORT_MIN: ICE UDP port range; 0 = any port
+	WebRTCUDPPortMax    int    // WEBRTC_UDP_PORT_MAX
+	WebRTCNAT1To1IPs    string // WEBRTC_NAT_1TO1_IPS: comma-separated public IPs announced instead of the host addresses (behind 1:1 NAT)
+
+	// HLS output (GET /sessions/:id/hls/index.m3u8) of MPEG-TS or fMP4 client streams, held in memory
+	HLSEnabled        bool  // HLS_ENABLED
+	HLSSegmentSeconds int   // HLS_SEGMENT_SECONDS: target segment duration; segments are cut at keyframes
+	HLSPartMillis     int   // HLS_PART_MS: LL-HLS part duration; 0 serves plain HLS
+	HLSWindow         int   // HLS_WINDOW: segments kept and listed per session
+	HLSMaxBytes       int64 // HLS_MAX_BYTES: memory cap per session; oldest segments are dropped above it
+	HLSIdleSeconds    int   // HLS_IDLE_SECONDS: a session's packager stops (and HLS operators leave) after this long without requests
+
+	// Signed URLs for clients that cannot send X-User-ID (HLS players)
+	URLTokenSecret     string // URL_TOKEN_SECRET: HMAC key shared by all replicas; empty: a random key per process
+	URLTokenTTLSeconds int    // URL_TOKEN_TTL_SECONDS: lifetime of a signed URL
+
+	// Circuit breakers around recording-service and session-manager calls
+	BreakerFailureThreshold int // BREAKER_FAILURE_THRESHOLD: consecutive failures that open the circuit
+	BreakerOpenSeconds      int // BREAKER_OPEN_SECONDS: open time before half-open trial calls
+	BreakerHalfOpenRequests int // BREAKER_HALF_OPEN_REQUESTS: trial calls while half-open
+	BreakerIntervalSeconds  int // BREAKER_INTERVAL_SECONDS: failure counts reset this often while closed; 0 never
+
+	// Webhooks: delivery of session lifecycle events (subscriptions are managed via /admin/webhooks)
+	WebhookTimeout     int // WEBHOOK_TIMEOUT, seconds per HTTP attempt
+	WebhookMaxAttempts int // WEBHOOK_MAX_ATTEMPTS, then the delivery is marked failed
+
+	// Outbox relay: domain events are always fed to webhooks, plus to OUTBOX_SINK
+	OutboxSink          string // OUTBOX_SINK: log, http, nats or none
+	OutboxHTTPURL       string // OUTBOX_HTTP_URL (for http)
+	OutboxNATSURL       string // OUTBOX_NATS_URL (for nats, e.g. nats://localhost:4222)
+	OutboxNATSSubject   string // OUTBOX_NATS_SUBJECT: subject prefix, event type is appended
+	OutboxNATSJetStream bool   // OUTBOX_NATS_JETSTREAM: wait for JetStream PubAck
+
+	// Admin API (/admin/*): static token in X-Admin-Token; empty disables the admin API
+	AdminToken string // ADMIN_TOKEN
+}
+
+// GRPCClientConfig configures transport security of an outbound gRPC connection; keys share a prefix
+// (RECORDING_SERVICE_, SESSION_MANAGER_). Certificate, CA and token files are reloaded when they change.
+type GRPCClientConfig struct {
+	TLS        bool   // <P>TLS: false = plaintext (dev mode); default true unless APP_ENV=development
+	CAFile     string // <P>TLS_CA_FILE: CA bundle to verify the server; empty = system roots
+	CertFile   string // <P>TLS_CERT_FILE: client certificate for mTLS
+	KeyFile    string // <P>TLS_KEY_FILE: client key for mTLS
+	ServerName string // <P>TLS_SERVER_NAME: name verified in the server certificate instead of the address host
+	Token      string // <P>TOKEN: bearer token sent with every RPC
+	TokenFile  string // <P>TOKEN_FILE: bearer token read from a file (takes precedence over <P>TOKEN)
+}
+
+// loadGRPCClient reads GRPCClientConfig from env keys with the given prefix.
+func loadGRPCClient(prefix string, defaultTLS bool) GRPCClientConfig {
+	def := "false"
+	if defaultTLS {
+		def = "true"
+	}
+	tls := getEnv(prefix+"TLS", def)
+	return GRPCClientConfig{
+		TLS:        tls == "true" || tls == "1",
+		CAFile:     getEnv(prefix+"TLS_CA_FILE", ""),
+		CertFile:   getEnv(prefix+"TLS_CERT_FILE", ""),
+		KeyFile:    getEnv(prefix+"TLS_KEY_FILE", ""),
+		ServerName: getEnv(prefix+"TLS_SERVER_NAME", ""),
+		Token:      getEnv(prefix+"TOKEN", ""),
+		TokenFile:  getEnv(prefix+"TOKEN_FILE", ""),
+	}
+}
+
+// validate checks the client config; name is the env prefix used in messages.
+func (g GRPCClientConfig) validate(name string, production bool) error {
+	if (g.CertFile == "") != (g.KeyFile == "") {
+		return fmt.Errorf("config: %sTLS_CERT_FILE and %sTLS_KEY_FILE must be set together", name, name)
+	}
+	if g.TLS {
+		return nil
+	}
+	if production {
+		return fmt.Errorf("config: in production %sTLS must be enabled", name)
+	}
+	if g.CAFile != "" || g.CertFile != "" || g.ServerName != "" {
+		return fmt.Errorf("config: %sTLS_* files are set but %sTLS is off", name, name)
+	}
+	return nil
 }
 
 // parseIntEnv parses key from env; on error uses default and returns the default value.
@@ -81,6 +195,14 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	wsHandshake, err := parseIntEnv("WS_HANDSHAKE_TIMEOUT", "10")
+	if err != nil {
+		return nil, err
+	}
+	wsLevel, err := parseIntEnv("WS_COMPRESSION_LEVEL", "1")
+	if err != nil {
+		return nil, err
+	}
 	maxOps, err := parseIntEnv("SESSION_MAX_OPERATORS", "10")
 	if err != nil {
 		return nil, err
@@ -89,18 +211,107 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	whTimeout, err := parseIntEnv("WEBHOOK_TIMEOUT", "10")
+	if err != nil {
+		return nil, err
+	}
+	whAttempts, err := parseIntEnv("WEBHOOK_MAX_ATTEMPTS", "8")
+	if err != nil {
+		return nil, err
+	}
+	spoolMax, err := parseInt64Env("RECORDING_SPOOL_MAX_BYTES", "1073741824")
+	if err != nil {
+		return nil, err
+	}
+	smAttempts, err := parseIntEnv("SESSION_MANAGER_NOTIFY_MAX_ATTEMPTS", "100")
+	if err != nil {
+		return nil, err
+	}
+	sinkQueue, err := parseIntEnv("RECORDING_SINK_QUEUE_SIZE", "1024")
+	if err != nil {
+		return nil, err
+	}
+	brThreshold, err := parseIntEnv("BREAKER_FAILURE_THRESHOLD", "5")
+	if err != nil {
+		return nil, err
+	}
+	brOpen, err := parseIntEnv("BREAKER_OPEN_SECONDS", "30")
+	if err != nil {
+		return nil, err
+	}
+	brHalfOpen, err := parseIntEnv("BREAKER_HALF_OPEN_REQUESTS", "1")
+	if err != nil {
+		return nil, err
+	}
+	brInterval, err := parseIntEnv("BREAKER_INTERVAL_SECONDS", "60")
+	if err != nil {
+		return nil, err
+	}
+	rtcPortMin, err := parseIntEnv("WEBRTC_UDP_PORT_MIN", "0")
+	if err != nil {
+		return nil, err
+	}
+	rtcPortMax, err := parseIntEnv("WEBRTC_UDP_PORT_MAX", "0")
+	if err != nil {
+		return nil, err
+	}
+	hlsSegment, err := parseIntEnv("HLS_SEGMENT_SECONDS", "2")
+	if err != nil {
+		return nil, err
+	}
+	hlsPart, err := parseIntEnv("HLS_PART_MS", "500")
+	if err != nil {
+		return nil, err
+	}
+	hlsWindow, err := parseIntEnv("HLS_WINDOW", "6")
+	if err != nil {
+		return nil, err
+	}
+	hlsMaxBytes, err := parseInt64Env("HLS_MAX_BYTES", "67108864")
+	if err != nil {
+		return nil, err
+	}
+	hlsIdle, err := parseIntEnv("HLS_IDLE_SECONDS", "30")
+	if err != nil {
+		return nil, err
+	}
+	urlTokenTTL, err := parseIntEnv("URL_TOKEN_TTL_SECONDS", "14400")
+	if err != nil {
+		return nil, err
+	}
+	fsMaxAge, err := parseIntEnv("RECORDING_FS_MAX_AGE_HOURS", "168")
+	if err != nil {
+		return nil, err
+	}
+	fsMaxBytes, err := parseInt64Env("RECORDING_FS_MAX_BYTES", "10737418240")
+	if err != nil {
+		return nil, err
+	}
+	tlMaxAge, err := parseIntEnv("RECORDING_TIMELINE_MAX_AGE_HOURS", "168")
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &Config{
-		AppEnv:              getEnv("APP_ENV", "development"),
-		AppHost:             getEnv("APP_HOST", "0.0.0.0"),
-		HTTPPort:            firstEnv("APP_PORT", "HTTP_PORT", "8090"),
-		LogLevel:            getEnv("LOG_LEVEL", "info"),
-		WSReadBufferSize:    readBuf,
-		WSWriteBufferSize:   writeBuf,
-		WSMaxMessageSize:    maxMsg,
-		SessionMaxOperators: maxOps,
-		SessionIdleTimeout:  idleTO,
-		WSBaseURL:           getEnv("WS_BASE_URL", ""),
+		AppEnv:                  getEnv("APP_ENV", "development"),
+		AppHost:                 getEnv("APP_HOST", "0.0.0.0"),
+		HTTPPort:                firstEnv("APP_PORT", "HTTP_PORT", "8090"),
+		GRPCPort:                getEnv("GRPC_PORT", "9090"),
+		RTMPPort:                getEnv("RTMP_PORT", "off"),
+		RTMPFormat:              getEnv("RTMP_FORMAT", "flv"),
+		LogLevel:                getEnv("LOG_LEVEL", "info"),
+		WSReadBufferSize:        readBuf,
+		WSWriteBufferSize:       writeBuf,
+		WSMaxMessageSize:        maxMsg,
+		SessionMaxOperators:     maxOps,
+		SessionIdleTimeout:      idleTO,
+		WSBaseURL:               getEnv("WS_BASE_URL", ""),
+		WebhookTimeout:          whTimeout,
+		WebhookMaxAttempts:      whAttempts,
+		BreakerFailureThreshold: brThreshold,
+		BreakerOpenSeconds:      brOpen,
+		BreakerHalfOpenRequests: brHalfOpen,
+		BreakerIntervalSeconds:  brInterval,
 	}
 	cfg.DB.Host = getEnv("DB_HOST", "localhost")
 	cfg.DB.Port = getEnv("DB_PORT", "5432")
@@ -111,6 +322,45 @@ func Load() (*Config, error) {
 	cfg.EnableRecording = getEnv("ENABLE_RECORDING", "false") == "true" || getEnv("ENABLE_RECORDING", "false") == "1"
 	cfg.RecordingServiceAddr = getEnv("RECORDING_SERVICE_ADDR", "localhost:8096")
 	cfg.SessionManagerGRPCAddr = getEnv("SESSION_MANAGER_GRPC_ADDR", "localhost:9091")
+	cfg.RecordingServiceGRPC = loadGRPCClient("RECORDING_SERVICE_", cfg.AppEnv != "development")
+	cfg.SessionManagerGRPC = loadGRPCClient("SESSION_MANAGER_", cfg.AppEnv != "development")
+	cfg.RecordingSpoolDir = getEnv("RECORDING_SPOOL_DIR", "data/recording-spool")
+	cfg.RecordingSpoolMaxBytes = spoolMax
+	cfg.SessionManagerNotifyMaxAttempts = smAttempts
+	cfg.SessionManagerRequireLink = getEnv("SESSION_MANAGER_REQUIRE_LINK", "false") == "true" || getEnv("SESSION_MANAGER_REQUIRE_LINK", "false") == "1"
+	cfg.RecordingBackend = getEnv("RECORDING_BACKEND", "grpc")
+	cfg.RecordingSinkQueueSize = sinkQueue
+	cfg.RecordingFSDir = getEnv("RECORDING_FS_DIR", "data/recordings")
+	cfg.RecordingFSMaxAgeHours = fsMaxAge
+	cfg.RecordingFSMaxBytes = fsMaxBytes
+	cfg.RecordingTimelineDir = getEnv("RECORDING_TIMELINE_DIR", "")
+	cfg.RecordingTimelineMaxAgeHours = tlMaxAge
+	cfg.OutboxSink = getEnv("OUTBOX_SINK", "log")
+	cfg.OutboxHTTPURL = getEnv("OUTBOX_HTTP_URL", "")
+	cfg.OutboxNATSURL = getEnv("OUTBOX_NATS_URL", "nats://localhost:4222")
+	cfg.OutboxNATSSubject = getEnv("OUTBOX_NATS_SUBJECT", "psds.streaming")
+	cfg.OutboxNATSJetStream = getEnv("OUTBOX_NATS_JETSTREAM", "false") == "true" || getEnv("OUTBOX_NATS_JETSTREAM", "false") == "1"
+	cfg.WebRTCEnabled = getEnv("WEBRTC_ENABLED", "false") == "true" || getEnv("WEBRTC_ENABLED", "false") == "1"
+	cfg.WebRTCICEServers = getEnv("WEBRTC_ICE_SERVERS", "")
+	cfg.WebRTCICEUsername = getEnv("WEBRTC_ICE_USERNAME", "")
+	cfg.WebRTCICECredential = getEnv("WEBRTC_ICE_CREDENTIAL", "")
+	cfg.WebRTCUDPPortMin = rtcPortMin
+	cfg.WebRTCUDPPortMax = rtcPortMax
+	cfg.WebRTCNAT1To1IPs = getEnv("WEBRTC_NAT_1TO1_IPS", "")
+	cfg.HLSEnabled = getEnv("HLS_ENABLED", "false") == "true" || getEnv("HLS_ENABLED", "false") == "1"
+	cfg.HLSSegmentSeconds = hlsSegment
+	cfg.HLSPartMillis = hlsPart
+	cfg.HLSWindow = hlsWindow
+	cfg.HLSMaxBytes = hlsMaxBytes
+	cfg.HLSIdleSeconds = hlsIdle
+	cfg.URLTokenSecret = getEnv("URL_TOKEN_SECRET", "")
+	cfg.URLTokenTTLSeconds = urlTokenTTL
+	cfg.WSWriteBufferPool = getEnv("WS_WRITE_BUFFER_POOL", "true") == "true" || getEnv("WS_WRITE_BUFFER_POOL", "true") == "1"
+	cfg.WSHandshakeTimeout = wsHandshake
+	cfg.WSCompression = getEnv("WS_COMPRESSION", "false") == "true" || getEnv("WS_COMPRESSION", "false") == "1"
+	cfg.WSCompressionLevel = wsLevel
+	cfg.WSAllowedOrigins = getEnv("WS_ALLOWED_ORIGINS", "")
+	cfg.AdminToken = getEnv("ADMIN_TOKEN", "")
 	return cfg, nil
 }
 
@@ -128,6 +378,83 @@ func (c *Config) Validate() error {
 	if c.AppEnv == "production" && c.DB.Password == "" {
 		return errors.New("config: in production DB_PASSWORD is required")
 	}
+	if c.BreakerFailureThreshold < 1 || c.BreakerOpenSeconds < 1 || c.BreakerHalfOpenRequests < 1 || c.BreakerIntervalSeconds < 0 {
+		return errors.New("config: BREAKER_FAILURE_THRESHOLD, BREAKER_OPEN_SECONDS and BREAKER_HALF_OPEN_REQUESTS must be positive, BREAKER_INTERVAL_SECONDS must not be negative")
+	}
+	if c.SessionIdleTimeout < 1 {
+		return errors.New("config: SESSION_IDLE_TIMEOUT must be positive")
+	}
+	if c.SessionManagerRequireLink && c.SessionManagerGRPCAddr == "" {
+		return errors.New("config: SESSION_MANAGER_REQUIRE_LINK needs SESSION_MANAGER_GRPC_ADDR")
+	}
+	if err := c.RecordingServiceGRPC.validate("RECORDING_SERVICE_", c.AppEnv == "production"); err != nil {
+		return err
+	}
+	if err := c.SessionManagerGRPC.validate("SESSION_MANAGER_", c.AppEnv == "production"); err != nil {
+		return err
+	}
+	backends := c.RecordingBackends()
+	if len(backends) == 0 {
+		return errors.New("config: RECORDING_BACKEND must list at least one of grpc, fs")
+	}
+	for i, b := range backends {
+		switch b {
+		case "grpc", "fs":
+		default:
+			return fmt.Errorf("config: RECORDING_BACKEND: unknown sink %q (grpc or fs)", b)
+		}
+		if slices.Contains(backends[:i], b) {
+			return fmt.Errorf("config: RECORDING_BACKEND: sink %q listed twice", b)
+		}
+	}
+	if c.RecordingSinkQueueSize < 1 {
+		return errors.New("config: RECORDING_SINK_QUEUE_SIZE must be positive")
+	}
+	if c.WebRTCUDPPortMin != 0 || c.WebRTCUDPPortMax != 0 {
+		if c.WebRTCUDPPortMin < 1 || c.WebRTCUDPPortMax > 65535 || c.WebRTCUDPPortMin > c.WebRTCUDPPortMax {
+			return errors.New("config: WEBRTC_UDP_PORT_MIN and WEBRTC_UDP_PORT_MAX must form a port range (1-65535)")
+		}
+	}
+	if c.WSReadBufferSize < 0 || c.WSWriteBufferSize < 0 || c.WSHandshakeTimeout < 0 {
+		return errors.New("config: WS_READ_BUFFER_SIZE, WS_WRITE_BUFFER_SIZE and WS_HANDSHAKE_TIMEOUT must not be negative")
+	}
+	if c.WSCompressionLevel < -2 || c.WSCompressionLevel > 9 {
+		return fmt.Errorf("config: WS_COMPRESSION_LEVEL must be -2..9, got %d", c.WSCompressionLevel)
+	}
+	for _, o := range c.WSAllowedOriginList() {
+		if o == "*" {
+			if c.AppEnv == "production" {
+				return errors.New(`config: in production WS_ALLOWED_ORIGINS must list origins, not "*"`)
+			}
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("config: WS_ALLOWED_ORIGINS: %q is not an origin (scheme://host[:port])", o)
+		}
+	}
+	if c.RTMPFormat != "flv" && c.RTMPFormat != "mpegts" {
+		return fmt.Errorf("config: RTMP_FORMAT must be flv or mpegts, got %q", c.RTMPFormat)
+	}
+	if c.HLSEnabled {
+		if c.HLSSegmentSeconds < 1 || c.HLSWindow < 2 || c.HLSMaxBytes < 1 || c.HLSIdleSeconds < 1 {
+			return errors.New("config: HLS_SEGMENT_SECONDS, HLS_MAX_BYTES and HLS_IDLE_SECONDS must be positive, HLS_WINDOW at least 2")
+		}
+		if c.HLSPartMillis < 0 || c.HLSPartMillis >= c.HLSSegmentSeconds*1000 {
+			return errors.New("config: HLS_PART_MS must be 0 or shorter than HLS_SEGMENT_SECONDS")
+		}
+	}
+	if c.URLTokenTTLSeconds < 1 {
+		return errors.New("config: URL_TOKEN_TTL_SECONDS must be positive")
+	}
+	switch c.OutboxSink {
+	case "log", "none", "nats":
+	case "http":
+		if c.OutboxHTTPURL == "" {
+			return errors.New("config: OUTBOX_HTTP_URL is required for OUTBOX_SINK=http")
+		}
+	default:
+		return fmt.Errorf("config: OUTBOX_SINK must be log, http, nats or none, got %q", c.OutboxSink)
+	}
 	return nil
 }
 
@@ -149,6 +476,68 @@ func (c *Config) Addr() string {
 	return c.AppHost + ":" + c.HTTPPort
 }
 
+// RecordingBackends returns the sinks listed in RECORDING_BACKEND in order; the first one is the primary
+// (its URL becomes the session's recording_url).
+func (c *Config) RecordingBackends() []string {
+	return splitList(c.RecordingBackend)
+}
+
+// HasRecordingBackend reports whether RECORDING_BACKEND lists the sink.
+func (c *Config) HasRecordingBackend(name string) bool {
+	return slices.Contains(c.RecordingBackends(), name)
+}
+
+// WSAllowedOriginList returns the entries of WS_ALLOWED_ORIGINS.
+func (c *Config) WSAllowedOriginList() []string {
+	return splitList(c.WSAllowedOrigins)
+}
+
+// WebRTCICEServerList returns the URLs of WEBRTC_ICE_SERVERS.
+func (c *Config) WebRTCICEServerList() []string {
+	return splitList(c.WebRTCICEServers)
+}
+
+// WebRTCNAT1To1IPList returns the addresses of WEBRTC_NAT_1TO1_IPS.
+func (c *Config) WebRTCNAT1To1IPList() []string {
+	return splitList(c.WebRTCNAT1To1IPs)
+}
+
+// splitList splits a comma-separated value, dropping blanks.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// TimelineDir returns the directory for session timelines: RECORDING_TIMELINE_DIR, or next to the recordings
+// for the fs backend, or data/timelines; "" when disabled.
+func (c *Config) TimelineDir() string {
+	switch {
+	case c.RecordingTimelineDir == "off":
+		return ""
+	case c.RecordingTimelineDir != "":
+		return c.RecordingTimelineDir
+	case c.HasRecordingBackend("fs"):
+		return c.RecordingFSDir
+	default:
+		return "data/timelines"
+	}
+}
+
+// GRPCAddr returns listen address for gRPC server.
+func (c *Config) GRPCAddr() string {
+	return c.AppHost + ":" + c.GRPCPort
+}
+
+// RTMPAddr returns listen address for the RTMP ingest.
+func (c *Config) RTMPAddr() string {
+	return c.AppHost + ":" + c.RTMPPort
+}
+
 func firstEnv(keysAndDef ...string) string {
 	if len(keysAndDef) == 0 {
 		return ""
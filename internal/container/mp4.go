@@ -0,0 +1,256 @@
+// Package container parses the parts of fragmented MP4 (ISO BMFF) and MPEG-TS that the frame inspector
+// and the HLS packager both need: boxes, tracks and fragment timing; packets, PSI tables and PES timestamps.
+// Parsers take untrusted input and never read past the data they are given.
+package container
+
+import "encoding/binary"
+
+// SampleIsNonSync is the sample_is_non_sync_sample bit of ISO BMFF sample flags.
+const SampleIsNonSync = 0x00010000
+
+// EachBox calls fn with the type and payload of every box in b; it stops at the first box that does not fit.
+func EachBox(b []byte, fn func(typ string, payload []byte)) {
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b))
+		hdr := uint64(8)
+		if size == 1 {
+			if len(b) < 16 {
+				return
+			}
+			size, hdr = binary.BigEndian.Uint64(b[8:]), 16
+		} else if size == 0 {
+			size = uint64(len(b))
+		}
+		if size < hdr || size > uint64(len(b)) {
+			return
+		}
+		fn(string(b[4:8]), b[hdr:size])
+		b = b[size:]
+	}
+}
+
+// Track is what an init segment says about a track.
+type Track struct {
+	Timescale    uint32
+	Video        bool
+	DefaultDur   uint32 // trex default_sample_duration
+	DefaultFlags uint32 // trex default_sample_flags
+}
+
+// ParseMoov returns the tracks of a moov payload by track ID and the timing track: the first video track,
+// else the first track; 0 when there is none.
+func ParseMoov(moov []byte) (map[uint32]*Track, uint32) {
+	tracks := make(map[uint32]*Track)
+	var order []uint32
+	EachBox(moov, func(typ string, b []byte) {
+		switch typ {
+		case "trak":
+			id, t := ParseTrak(b)
+			if id == 0 {
+				return
+			}
+			tracks[id] = t
+			order = append(order, id)
+		case "mvex":
+			EachBox(b, func(typ string, trex []byte) {
+				if typ != "trex" || len(trex) < 24 {
+					return
+				}
+				if t := tracks[binary.BigEndian.Uint32(trex[4:])]; t != nil {
+					t.DefaultDur = binary.BigEndian.Uint32(trex[12:])
+					t.DefaultFlags = binary.BigEndian.Uint32(trex[20:])
+				}
+			})
+		}
+	})
+	for _, id := range order {
+		if tracks[id].Video {
+			return tracks, id
+		}
+	}
+	if len(order) > 0 {
+		return tracks, order[0]
+	}
+	return tracks, 0
+}
+
+// ParseTrak reads track_ID (tkhd), timescale (mdhd) and whether the handler is video (hdlr).
+func ParseTrak(trak []byte) (uint32, *Track) {
+	var id uint32
+	t := &Track{}
+	EachBox(trak, func(typ string, b []byte) {
+		switch typ {
+		case "tkhd":
+			if len(b) >= 24 && b[0] == 1 {
+				id = binary.BigEndian.Uint32(b[20:])
+			} else if len(b) >= 16 {
+				id = binary.BigEndian.Uint32(b[12:])
+			}
+		case "mdia":
+			EachBox(b, func(typ string, b []byte) {
+				switch typ {
+				case "mdhd":
+					if len(b) >= 24 && b[0] == 1 {
+						t.Timescale = binary.BigEndian.Uint32(b[20:])
+					} else if len(b) >= 16 {
+						t.Timescale = binary.BigEndian.Uint32(b[12:])
+					}
+				case "hdlr":
+					if len(b) >= 12 {
+						t.Video = string(b[8:12]) == "vide"
+					}
+				}
+			})
+		}
+	})
+	return id, t
+}
+
+// Fragment is what a moof says about the timing track, in the track's timescale.
+type Fragment struct {
+	Key     bool   // the first sample is a sync sample
+	Base    uint64 // decode time of the first sample (tfdt); valid when HasBase
+	HasBase bool
+	CTO     int64  // composition offset of the first sample
+	Ticks   uint64 // duration of the samples
+}
+
+// ParseMoof reads the first traf of the timing track; false when the moof has none.
+func ParseMoof(moof []byte, tracks map[uint32]*Track, timing uint32) (Fragment, bool) {
+	var f Fragment
+	found := false
+	EachBox(moof, func(typ string, traf []byte) {
+		if typ != "traf" || found {
+			return
+		}
+		var (
+			t                   *Track
+			defDur, defFlags    uint32
+			hasDefDur, hasFlags bool
+			base                uint64
+			hasBase             bool
+		)
+		EachBox(traf, func(typ string, b []byte) {
+			switch typ {
+			case "tfhd":
+				if len(b) < 8 {
+					return
+				}
+				flags := uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+				if id := binary.BigEndian.Uint32(b[4:]); id == timing {
+					t = tracks[id]
+				}
+				off := 8
+				if flags&0x01 != 0 {
+					off += 8
+				}
+				if flags&0x02 != 0 {
+					off += 4
+				}
+				if flags&0x08 != 0 && len(b) >= off+4 {
+					defDur, hasDefDur = binary.BigEndian.Uint32(b[off:]), true
+					off += 4
+				}
+				if flags&0x10 != 0 {
+					off += 4
+				}
+				if flags&0x20 != 0 && len(b) >= off+4 {
+					defFlags, hasFlags = binary.BigEndian.Uint32(b[off:]), true
+				}
+			case "tfdt":
+				if t == nil {
+					return
+				}
+				if len(b) >= 12 && b[0] == 1 {
+					base, hasBase = binary.BigEndian.Uint64(b[4:]), true
+				} else if len(b) >= 8 {
+					base, hasBase = uint64(binary.BigEndian.Uint32(b[4:])), true
+				}
+			case "trun":
+				if t == nil || len(b) < 8 {
+					return
+				}
+				if !hasDefDur {
+					defDur = t.DefaultDur
+				}
+				if !hasFlags {
+					defFlags = t.DefaultFlags
+				}
+				r := ParseTrun(b, defDur, defFlags)
+				if !found {
+					f.Key, f.CTO = r.Key, r.CTO
+					f.Base, f.HasBase = base, hasBase
+				}
+				found = true
+				f.Ticks += r.Ticks
+			}
+		})
+	})
+	return f, found
+}
+
+// Run is what a trun says: the first sample's sync flag and composition offset, and the total duration.
+type Run struct {
+	Key   bool
+	CTO   int64
+	Ticks uint64
+}
+
+// ParseTrun reads a trun payload with the track fragment's default duration and flags. Only the samples
+// that are in the box count: a forged sample count cannot make it read past the data.
+func ParseTrun(b []byte, defDur, defFlags uint32) Run {
+	if len(b) < 8 {
+		return Run{}
+	}
+	version := b[0]
+	flags := uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	count := binary.BigEndian.Uint32(b[4:])
+	off := 8
+	if flags&0x001 != 0 {
+		off += 4
+	}
+	firstFlags, hasFirst := defFlags, false
+	if flags&0x004 != 0 && len(b) >= off+4 {
+		firstFlags, hasFirst = binary.BigEndian.Uint32(b[off:]), true
+		off += 4
+	}
+	var r Run
+	size := 0 // bytes per sample entry
+	for _, f := range []uint32{0x100, 0x200, 0x400, 0x800} {
+		if flags&f != 0 {
+			size += 4
+		}
+	}
+	if size == 0 {
+		r.Ticks = uint64(count) * uint64(defDur)
+	}
+	for i := uint32(0); size > 0 && i < count && len(b) >= off+size; i++ {
+		d := defDur
+		if flags&0x100 != 0 {
+			d = binary.BigEndian.Uint32(b[off:])
+			off += 4
+		}
+		if flags&0x200 != 0 {
+			off += 4
+		}
+		if flags&0x400 != 0 {
+			if i == 0 && !hasFirst {
+				firstFlags = binary.BigEndian.Uint32(b[off:])
+			}
+			off += 4
+		}
+		if flags&0x800 != 0 {
+			if i == 0 {
+				if version == 0 {
+					r.CTO = int64(binary.BigEndian.Uint32(b[off:]))
+				} else {
+					r.CTO = int64(int32(binary.BigEndian.Uint32(b[off:])))
+				}
+			}
+			off += 4
+		}
+		r.Ticks += uint64(d)
+	}
+	r.Key = count > 0 && firstFlags&SampleIsNonSync == 0
+	return r
+}
@@ -0,0 +1,44 @@
+package container
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// trun builds a version 0 trun payload (the box header stripped, as eachBox passes it).
+func trun(flags, count uint32, fields ...uint32) []byte {
+	b := make([]byte, 8, 8+4*len(fields))
+	binary.BigEndian.PutUint32(b, flags)
+	binary.BigEndian.PutUint32(b[4:], count)
+	for _, f := range fields {
+		b = binary.BigEndian.AppendUint32(b, f)
+	}
+	return b
+}
+
+func TestParseTrun(t *testing.T) {
+	for name, tc := range map[string]struct {
+		b         []byte
+		defDur    uint32
+		defFlags  uint32
+		wantKey   bool
+		wantTicks uint64
+	}{
+		"default durations": {b: trun(0, 3), defDur: 1000, wantKey: true, wantTicks: 3000},
+		"sample durations":  {b: trun(0x100, 2, 900, 1100), defDur: 1000, wantKey: true, wantTicks: 2000},
+		"first sample flags": {
+			b: trun(0x004|0x100, 1, 0, 500), defFlags: SampleIsNonSync, wantKey: true, wantTicks: 500,
+		},
+		"non-sync first sample": {
+			b: trun(0x100|0x400, 2, 500, SampleIsNonSync, 500, 0), wantKey: false, wantTicks: 1000,
+		},
+		// a forged count must not run past the samples in the box
+		"count beyond the box": {b: trun(0x100|0x200, 0xffffffff, 700, 10, 300, 10), wantKey: true, wantTicks: 1000},
+		"truncated sample":     {b: append(trun(0x100|0x200, 2, 700, 10), 0, 0, 1), wantKey: true, wantTicks: 700},
+	} {
+		r := ParseTrun(tc.b, tc.defDur, tc.defFlags)
+		if r.Key != tc.wantKey || r.Ticks != tc.wantTicks {
+			t.Errorf("%s: ParseTrun = %v, %d; want %v, %d", name, r.Key, r.Ticks, tc.wantKey, tc.wantTicks)
+		}
+	}
+}
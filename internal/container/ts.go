@@ -0,0 +1,96 @@
+package container
+
+// MPEG-TS constants.
+const (
+	PacketSize = 188
+	SyncByte   = 0x47
+	PTSClock   = 90000   // PTS ticks per second
+	PTSWrap    = 1 << 33 // PTS values wrap around at 33 bits
+)
+
+// Packet is the header of one MPEG-TS packet.
+type Packet struct {
+	PID     int
+	PUSI    bool   // payload_unit_start_indicator
+	RAI     bool   // random_access_indicator of the adaptation field
+	Payload []byte // nil when the packet has none
+}
+
+// ParsePacket reads a PacketSize-byte packet starting with SyncByte.
+func ParsePacket(p []byte) Packet {
+	pkt := Packet{PID: int(p[1]&0x1f)<<8 | int(p[2]), PUSI: p[1]&0x40 != 0}
+	afc := p[3] >> 4 & 0x3
+	off := 4
+	if afc&0x2 != 0 {
+		afLen := int(p[4])
+		if afLen > 0 {
+			pkt.RAI = p[5]&0x40 != 0
+		}
+		off = 5 + afLen
+	}
+	if afc&0x1 != 0 && off < PacketSize {
+		pkt.Payload = p[off:]
+	}
+	return pkt
+}
+
+// PESStart reports whether payload starts a PES packet with a full header.
+func PESStart(payload []byte) bool {
+	return len(payload) >= 9 && payload[0] == 0 && payload[1] == 0 && payload[2] == 1
+}
+
+// ParsePAT returns the PMT PID of the first program of a PAT packet's payload.
+func ParsePAT(payload []byte) (int, bool) {
+	sec := PSISection(payload)
+	if len(sec) < 12 || sec[0] != 0x00 {
+		return 0, false
+	}
+	end := min(3+(int(sec[1]&0x0f)<<8|int(sec[2]))-4, len(sec))
+	for i := 8; i+4 <= end; i += 4 {
+		if program := int(sec[i])<<8 | int(sec[i+1]); program != 0 {
+			return int(sec[i+2]&0x1f)<<8 | int(sec[i+3]), true
+		}
+	}
+	return 0, false
+}
+
+// ParsePMT returns the timing stream of a PMT packet's payload: the first video stream, else the first stream.
+func ParsePMT(payload []byte) (int, bool) {
+	sec := PSISection(payload)
+	if len(sec) < 12 || sec[0] != 0x02 {
+		return 0, false
+	}
+	end := min(3+(int(sec[1]&0x0f)<<8|int(sec[2]))-4, len(sec))
+	i := 12 + (int(sec[10]&0x0f)<<8 | int(sec[11]))
+	first := -1
+	for i+5 <= end {
+		streamType := sec[i]
+		pid := int(sec[i+1]&0x1f)<<8 | int(sec[i+2])
+		if first < 0 {
+			first = pid
+		}
+		switch streamType {
+		case 0x01, 0x02, 0x10, 0x1b, 0x24: // MPEG-1/2, MPEG-4 part 2, H.264, HEVC
+			return pid, true
+		}
+		i += 5 + (int(sec[i+3]&0x0f)<<8 | int(sec[i+4]))
+	}
+	return first, first >= 0
+}
+
+// PSISection skips the pointer field of a PSI payload.
+func PSISection(payload []byte) []byte {
+	if len(payload) == 0 || 1+int(payload[0]) >= len(payload) {
+		return nil
+	}
+	return payload[1+int(payload[0]):]
+}
+
+// PESPTS returns the PTS of a PES header, -1 if absent.
+func PESPTS(pes []byte) int64 {
+	if len(pes) < 14 || pes[7]&0x80 == 0 {
+		return -1
+	}
+	b := pes[9:14]
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
@@ -6,4 +6,35 @@ import "errors"
 var (
 	ErrSessionNotFound  = errors.New("session not found")
 	ErrTooManyOperators = errors.New("session has maximum operators")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrUnknownEventType = errors.New("unknown event type")
+	ErrSessionFinished  = errors.New("session already finished")
+	ErrClientConnected  = errors.New("session client is already connected")
+
+	ErrRecordingUnavailable = errors.New("recording is not enabled on this server")
+	ErrRecordingTransition  = errors.New("recording action not allowed in the current mode")
+	ErrTimelineNotFound     = errors.New("timeline not found")
+	ErrUnknownRecordingSink = errors.New("unknown recording sink")
+
+	ErrSessionManagerNotFound     = errors.New("session-manager session not found")
+	ErrSessionManagerClosed       = errors.New("session-manager session is closed")
+	ErrSessionManagerUnavailable  = errors.New("session-manager unavailable")
+	ErrSessionManagerLinkRequired = errors.New("session_manager_session_id is required")
+
+	ErrHLSNotReady     = errors.New("hls: no segment yet")
+	ErrHLSUnsupported  = errors.New("hls: client stream is neither MPEG-TS nor fragmented MP4")
+	ErrHLSFileNotFound = errors.New("hls: segment not found")
+	ErrHLSBadRequest   = errors.New("hls: _HLS_msn is too far ahead of the live edge")
+	ErrHLSNotEnrolled  = errors.New("hls: not enrolled, POST /sessions/{id}/hls first")
+
+	ErrInvalidToken = errors.New("invalid or expired token")
+
+	ErrWebRTCNotPublishing    = errors.New("webrtc: the session client is not publishing")
+	ErrWebRTCResourceNotFound = errors.New("webrtc: resource not found")
+	ErrWebRTCBadOffer         = errors.New("webrtc: invalid SDP offer")
+	ErrWebRTCBadCandidate     = errors.New("webrtc: invalid ICE candidate")
+
+	ErrInvalidTracks = errors.New("invalid track declaration")
+	ErrTrackRole     = errors.New("only the session client declares tracks and only operators subscribe")
 )
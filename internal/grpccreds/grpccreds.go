@@ -0,0 +1,226 @@
+// Package grpccreds builds credentials for outbound gRPC connections (recording-service, session-manager):
+// TLS or mTLS with certificates reloaded on file change, an optional bearer token per RPC, or plaintext in dev mode.
+package grpccreds
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// reloadDelay debounces bursts of file events (editors and Kubernetes secret updates write several times).
+const reloadDelay = 200 * time.Millisecond
+
+// Credentials holds the current TLS config and token of one outbound connection.
+// New handshakes and RPCs pick up reloaded files; established connections keep their session.
+type Credentials struct {
+	cfg   config.GRPCClientConfig
+	name  string
+	log   *zap.Logger
+	tls   atomic.Pointer[tls.Config]
+	token atomic.Pointer[string]
+
+	watcher *fsnotify.Watcher // nil when no files are configured
+	done    chan struct{}
+}
+
+// New loads the configured files and starts watching them; name (e.g. "recording-service") is used in logs.
+func New(cfg config.GRPCClientConfig, name string, log *zap.Logger) (*Credentials, error) {
+	c := &Credentials{cfg: cfg, name: name, log: log, done: make(chan struct{})}
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("%s credentials: %w", name, err)
+	}
+	files := c.files()
+	if len(files) == 0 {
+		close(c.done)
+		return c, nil
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("%s credentials: %w", name, err)
+	}
+	// Watch directories, not files: atomic replacements (rename, Kubernetes ..data symlink swap) drop file watches.
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := w.Add(dir); err != nil {
+			_ = w.Close()
+			return nil, fmt.Errorf("%s credentials: watch %s: %w", name, dir, err)
+		}
+	}
+	c.watcher = w
+	go c.watch()
+	return c, nil
+}
+
+// DialOptions returns the transport and per-RPC credentials for grpc.NewClient.
+func (c *Credentials) DialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if c.cfg.TLS {
+		opts[0] = grpc.WithTransportCredentials(&transport{c: c})
+	}
+	if c.cfg.Token != "" || c.cfg.TokenFile != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearer{c: c}))
+	}
+	return opts
+}
+
+// Close stops watching the files.
+func (c *Credentials) Close() error {
+	if c.watcher == nil {
+		return nil
+	}
+	err := c.watcher.Close()
+	<-c.done
+	return err
+}
+
+// Reload re-reads the configured files; on error the previous credentials stay in use.
+func (c *Credentials) Reload() error {
+	if err := c.load(); err != nil {
+		return fmt.Errorf("%s credentials: %w", c.name, err)
+	}
+	return nil
+}
+
+func (c *Credentials) load() error {
+	if c.cfg.TLS {
+		tc := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.cfg.ServerName}
+		if c.cfg.CAFile != "" {
+			pem, err := os.ReadFile(c.cfg.CAFile)
+			if err != nil {
+				return fmt.Errorf("read CA bundle: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("CA bundle %s: no certificates found", c.cfg.CAFile)
+			}
+			tc.RootCAs = pool
+		}
+		if c.cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+			if err != nil {
+				return fmt.Errorf("load client certificate: %w", err)
+			}
+			tc.Certificates = []tls.Certificate{cert}
+		}
+		c.tls.Store(tc)
+	}
+	token := c.cfg.Token
+	if c.cfg.TokenFile != "" {
+		b, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("read token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	c.token.Store(&token)
+	return nil
+}
+
+// files returns the configured files that are watched for changes.
+func (c *Credentials) files() []string {
+	var out []string
+	if c.cfg.TLS {
+		for _, f := range []string{c.cfg.CAFile, c.cfg.CertFile, c.cfg.KeyFile} {
+			if f != "" {
+				out = append(out, f)
+			}
+		}
+	}
+	if c.cfg.TokenFile != "" {
+		out = append(out, c.cfg.TokenFile)
+	}
+	return out
+}
+
+func (c *Credentials) watch() {
+	defer close(c.done)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-c.watcher.Events:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			if ev.Has(fsnotify.Chmod) {
+				continue
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			c.log.Warn("grpc credentials: watch error", zap.String("target", c.name), zap.Error(err))
+		case <-timer.C:
+			if err := c.Reload(); err != nil {
+				c.log.Error("grpc credentials: reload failed, keeping previous", zap.String("target", c.name), zap.Error(err))
+				continue
+			}
+			c.log.Info("grpc credentials: reloaded", zap.String("target", c.name))
+		}
+	}
+}
+
+// transport performs each TLS handshake with the current config, so reloaded CA and client certificates
+// apply to new connections without redialing.
+type transport struct {
+	c *Credentials
+}
+
+func (t *transport) current() credentials.TransportCredentials {
+	return credentials.NewTLS(t.c.tls.Load().Clone())
+}
+
+func (t *transport) ClientHandshake(ctx context.Context, authority string, raw net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return t.current().ClientHandshake(ctx, authority, raw)
+}
+
+func (t *transport) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("grpccreds: client-only credentials")
+}
+
+func (t *transport) Info() credentials.ProtocolInfo { return t.current().Info() }
+
+func (t *transport) Clone() credentials.TransportCredentials { return &transport{c: t.c} }
+
+// OverrideServerName is deprecated in grpc; the server name comes from <P>TLS_SERVER_NAME.
+func (t *transport) OverrideServerName(string) error { return nil }
+
+// bearer sends the current token as "authorization: Bearer <token>" with every RPC.
+type bearer struct {
+	c *Credentials
+}
+
+func (b bearer) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	tok := *b.c.token.Load()
+	if tok == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + tok}, nil
+}
+
+// RequireTransportSecurity is false only in plaintext dev mode.
+func (b bearer) RequireTransportSecurity() bool { return b.c.cfg.TLS }
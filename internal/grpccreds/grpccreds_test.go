@@ -0,0 +1,231 @@
+package grpccreds
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"go.uber.org/zap"
+)
+
+// testCA issues certificates for the handshake tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for cn, usable by servers (as localhost) and clients.
+func (ca *testCA) issue(t *testing.T, cn string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mtlsServer accepts mTLS connections from clients of ca and sends the common name of each client certificate
+// to the returned channel.
+func mtlsServer(t *testing.T, ca *testCA) (string, <-chan string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, "server")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		NextProtos:   []string{"h2"}, // grpc requires ALPN
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	clients := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tc := conn.(*tls.Conn)
+			if tc.Handshake() == nil {
+				clients <- tc.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().String(), clients
+}
+
+// handshake dials addr with the credentials' transport and returns the client certificate the server saw.
+func handshake(t *testing.T, c *Credentials, addr string, clients <-chan string) string {
+	t.Helper()
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := (&transport{c: c}).ClientHandshake(ctx, "localhost", raw)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	defer conn.Close()
+	select {
+	case cn := <-clients:
+		return cn
+	case <-time.After(5 * time.Second):
+		t.Fatal("server saw no client certificate")
+		return ""
+	}
+}
+
+// eventually retries check until it returns true or 5 seconds pass.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not picked up", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCredentialsReloadRewrittenCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	addr, clients := mtlsServer(t, ca)
+	dir := t.TempDir()
+	cfg := config.GRPCClientConfig{
+		TLS:        true,
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client-key.pem"),
+		ServerName: "localhost",
+	}
+	writeFile(t, cfg.CAFile, ca.pem)
+	certPEM, keyPEM := ca.issue(t, "client-1")
+	writeFile(t, cfg.CertFile, certPEM)
+	writeFile(t, cfg.KeyFile, keyPEM)
+
+	c, err := New(cfg, "test", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	if cn := handshake(t, c, addr, clients); cn != "client-1" {
+		t.Fatalf("client certificate %q, want client-1", cn)
+	}
+
+	certPEM, keyPEM = ca.issue(t, "client-2")
+	writeFile(t, cfg.KeyFile, keyPEM)
+	writeFile(t, cfg.CertFile, certPEM)
+	eventually(t, "rewritten client certificate", func() bool {
+		return handshake(t, c, addr, clients) == "client-2"
+	})
+
+	writeFile(t, cfg.CertFile, []byte("not a certificate"))
+	if err := c.Reload(); err == nil {
+		t.Fatal("reload of a broken certificate succeeded")
+	}
+	if cn := handshake(t, c, addr, clients); cn != "client-2" {
+		t.Fatalf("client certificate %q after a failed reload, want the previous client-2", cn)
+	}
+}
+
+func TestCredentialsReloadRewrittenToken(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.GRPCClientConfig{TokenFile: filepath.Join(dir, "token")}
+	writeFile(t, cfg.TokenFile, []byte("first\n"))
+
+	c, err := New(cfg, "test", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	opts := c.DialOptions()
+	if len(opts) != 2 {
+		t.Fatalf("%d dial options, want transport and per-RPC credentials", len(opts))
+	}
+	auth := func() string {
+		md, err := bearer{c: c}.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return md["authorization"]
+	}
+	if got := auth(); got != "Bearer first" {
+		t.Fatalf("authorization %q, want Bearer first", got)
+	}
+
+	writeFile(t, cfg.TokenFile, []byte("second\n"))
+	eventually(t, "rewritten token", func() bool { return auth() == "Bearer second" })
+}
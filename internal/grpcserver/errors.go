@@ -0,0 +1,31 @@
+package grpcserver
+
+import (
+	"errors"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps errs sentinels to gRPC status codes (same mapping as HTTP codes in handlers).
+func toStatus(err error, fallback string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errs.ErrSessionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errs.ErrTooManyOperators):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, errs.ErrUnknownRecordingSink),
+		errors.Is(err, errs.ErrSessionManagerNotFound), errors.Is(err, errs.ErrSessionManagerLinkRequired):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errs.ErrSessionFinished), errors.Is(err, errs.ErrRecordingUnavailable), errors.Is(err, errs.ErrRecordingTransition),
+		errors.Is(err, errs.ErrSessionManagerClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errs.ErrSessionManagerUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, fallback)
+	}
+}
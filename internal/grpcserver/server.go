@@ -0,0 +1,252 @@
+// Package grpcserver serves the StreamingService gRPC API (pkg/streaming_service/streaming.proto).
+// It mirrors the REST handlers: same SessionServicer, same X-User-ID rules (as "x-user-id" metadata).
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/outbox"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	pb "github.com/psds-microservice/streaming-service/pkg/gen/streaming_service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventSubscriber — источник событий для WatchSessionEvents (реализует outbox.Bus).
+type EventSubscriber interface {
+	Subscribe(key string) (<-chan outbox.Message, func())
+}
+
+// Server implements pb.StreamingServiceServer.
+type Server struct {
+	pb.UnimplementedStreamingServiceServer
+	svc    service.SessionServicer
+	events EventSubscriber
+	ws     *service.WSConfig
+	log    *zap.Logger
+}
+
+// NewServer creates the gRPC service implementation.
+func NewServer(svc service.SessionServicer, events EventSubscriber, wsBaseURL string, log *zap.Logger) *Server {
+	return &Server{svc: svc, events: events, ws: &service.WSConfig{BaseURL: wsBaseURL}, log: log}
+}
+
+// NewGRPCServer builds a *grpc.Server with StreamingService, health and reflection registered.
+func NewGRPCServer(srv *Server, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	pb.RegisterStreamingServiceServer(s, srv)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	return s
+}
+
+// CreateSession mirrors POST /sessions. The caller creates sessions for itself: x-user-id must be the client_id.
+func (s *Server) CreateSession(ctx context.Context, req *pb.CreateSessionRequest) (*pb.CreateSessionResponse, error) {
+	callerID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(req.GetClientId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid client_id: must be a valid UUID")
+	}
+	if callerID != req.GetClientId() {
+		return nil, status.Error(codes.PermissionDenied, "caller is not the session client")
+	}
+	sess, err := s.svc.Create(ctx, model.CreateSessionRequest{
+		ClientID:                req.GetClientId(),
+		SessionManagerSessionID: req.GetSessionManagerSessionId(),
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to create session")
+	}
+	return &pb.CreateSessionResponse{
+		SessionId: sess.ID,
+		StreamKey: sess.StreamKey,
+		WsUrl:     s.ws.WSURL(sess.ID, req.GetClientId()),
+		Status:    string(sess.Status),
+	}, nil
+}
+
+// GetSession mirrors GET /sessions/:id.
+func (s *Server) GetSession(ctx context.Context, req *pb.GetSessionRequest) (*pb.Session, error) {
+	if err := s.authorize(ctx, req.GetSessionId()); err != nil {
+		return nil, err
+	}
+	sess, err := s.svc.Get(req.GetSessionId())
+	if err != nil {
+		return nil, toStatus(err, "failed to get session")
+	}
+	return sessionToPB(sess), nil
+}
+
+// ListSessions lists the sessions where the caller is the client or an operator.
+func (s *Server) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	callerID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st := model.SessionStatus(req.GetStatus())
+	if st != "" && !model.ValidSessionStatus(st) {
+		return nil, status.Error(codes.InvalidArgument, "invalid status: must be waiting, active or finished")
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = 50
+	}
+	if limit < 0 || limit > 500 {
+		return nil, status.Error(codes.InvalidArgument, "invalid limit: must be 1..500")
+	}
+	if req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid offset")
+	}
+	list, err := s.svc.List(callerID, st, limit, int(req.GetOffset()))
+	if err != nil {
+		return nil, toStatus(err, "failed to list sessions")
+	}
+	out := &pb.ListSessionsResponse{Sessions: make([]*pb.Session, 0, len(list))}
+	for i := range list {
+		out.Sessions = append(out.Sessions, sessionToPB(&list[i]))
+	}
+	return out, nil
+}
+
+// FinishSession mirrors DELETE /sessions/:id.
+func (s *Server) FinishSession(ctx context.Context, req *pb.FinishSessionRequest) (*pb.FinishSessionResponse, error) {
+	if err := s.authorize(ctx, req.GetSessionId()); err != nil {
+		return nil, err
+	}
+	if err := s.svc.Finish(req.GetSessionId()); err != nil {
+		return nil, toStatus(err, "failed to finish session")
+	}
+	return &pb.FinishSessionResponse{}, nil
+}
+
+// ListOperators mirrors GET /sessions/:id/operators.
+func (s *Server) ListOperators(ctx context.Context, req *pb.ListOperatorsRequest) (*pb.ListOperatorsResponse, error) {
+	if err := s.authorize(ctx, req.GetSessionId()); err != nil {
+		return nil, err
+	}
+	ops, err := s.svc.GetOperators(req.GetSessionId())
+	if err != nil {
+		return nil, toStatus(err, "failed to get operators")
+	}
+	return &pb.ListOperatorsResponse{SessionId: req.GetSessionId(), Operators: operatorsToPB(ops)}, nil
+}
+
+// WatchSessionEvents streams lifecycle events relayed from the outbox until session.finished or cancellation.
+// Events that happened before the call are not replayed. A watcher that falls behind is cut off with
+// Unavailable rather than silently missing events; it should call again and re-read the session.
+func (s *Server) WatchSessionEvents(req *pb.WatchSessionEventsRequest, stream grpc.ServerStreamingServer[pb.SessionEvent]) error {
+	if err := s.authorize(stream.Context(), req.GetSessionId()); err != nil {
+		return err
+	}
+	ch, unsubscribe := s.events.Subscribe(req.GetSessionId())
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "event stream fell behind: watch again")
+			}
+			var ev model.Event
+			if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+				s.log.Warn("grpc: bad event payload", zap.String("event_id", msg.ID), zap.Error(err))
+				continue
+			}
+			if err := stream.Send(eventToPB(&ev)); err != nil {
+				return err
+			}
+			if ev.Type == model.EventSessionFinished {
+				return nil
+			}
+		}
+	}
+}
+
+// authorize checks the session ID and that the caller is the session client or an operator (as in REST).
+func (s *Server) authorize(ctx context.Context, sessionID string) error {
+	callerID, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := validSessionID(sessionID); err != nil {
+		return err
+	}
+	ok, err := s.svc.IsClientOrOperator(sessionID, callerID)
+	if err != nil {
+		return toStatus(err, "failed to check permission")
+	}
+	if !ok {
+		return status.Error(codes.PermissionDenied, "caller is not the session client or an operator")
+	}
+	return nil
+}
+
+// callerID returns the "x-user-id" metadata value (the gRPC counterpart of the X-User-ID header).
+func callerID(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-user-id"); len(v) > 0 && v[0] != "" {
+		return v[0], nil
+	}
+	return "", status.Error(codes.Unauthenticated, "x-user-id metadata required")
+}
+
+func validSessionID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid session_id: must be a valid UUID")
+	}
+	return nil
+}
+
+func sessionToPB(sess *model.Session) *pb.Session {
+	out := &pb.Session{
+		Id:                      sess.ID,
+		ClientId:                sess.ClientID,
+		StreamKey:               sess.StreamKey,
+		Status:                  string(sess.Status),
+		Operators:               operatorsToPB(sess.Operators),
+		CreatedAt:               timestamppb.New(sess.CreatedAt),
+		RecordingMode:           string(sess.RecordingMode),
+		RecordingStatus:         string(sess.RecordingStatus),
+		RecordingUrl:            sess.RecordingURL,
+		RecordingError:          sess.RecordingError,
+		SessionManagerSessionId: sess.SessionManagerSessionID,
+	}
+	if sess.FinishedAt != nil {
+		out.FinishedAt = timestamppb.New(*sess.FinishedAt)
+	}
+	return out
+}
+
+func operatorsToPB(ops []model.Operator) []*pb.Operator {
+	out := make([]*pb.Operator, 0, len(ops))
+	for _, o := range ops {
+		out = append(out, &pb.Operator{UserId: o.UserID, ConnectedAt: timestamppb.New(o.ConnectedAt)})
+	}
+	return out
+}
+
+func eventToPB(ev *model.Event) *pb.SessionEvent {
+	return &pb.SessionEvent{
+		Id:           ev.ID,
+		Type:         string(ev.Type),
+		OccurredAt:   timestamppb.New(ev.OccurredAt),
+		SessionId:    ev.SessionID,
+		ClientId:     ev.Data.ClientID,
+		Status:       string(ev.Data.Status),
+		UserId:       ev.Data.UserID,
+		RecordingUrl: ev.Data.RecordingURL,
+	}
+}
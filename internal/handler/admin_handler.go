@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// AdminHandler handles /admin/* — live hub inspection and intervention. Every action is audit-logged.
+type AdminHandler struct {
+	hub   service.StreamHubAdmin
+	svc   service.SessionServicer
+	token string
+	id    string // admin_id in the audit log: fingerprint of token (X-User-ID is not authenticated)
+	audit *zap.Logger
+	sinks service.RecordingSinkReporter // optional: nil when recording is disabled
+}
+
+// NewAdminHandler creates the admin handler. Empty token disables the admin API (all requests get 403).
+func NewAdminHandler(hub service.StreamHubAdmin, svc service.SessionServicer, token string, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{hub: hub, svc: svc, token: token, id: tokenID(token), audit: logger.Named("audit")}
+}
+
+// tokenID identifies the holder of an admin token in the audit log without revealing the token.
+func tokenID(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+// SetRecordingSinks sets the optional recorder sink health reporter.
+func (h *AdminHandler) SetRecordingSinks(r service.RecordingSinkReporter) { h.sinks = r }
+
+// adminAuthenticated is the gin context key RequireAdmin sets once the admin token matched.
+const adminAuthenticated = "admin_authenticated"
+
+// RequireAdmin is middleware that checks the X-Admin-Token header against the configured token.
+func (h *AdminHandler) RequireAdmin(c *gin.Context) {
+	if h.token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API disabled"})
+		return
+	}
+	got := c.GetHeader("X-Admin-Token")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(h.token)) != 1 {
+		h.auditLog(c, "auth_failed", "")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Set(adminAuthenticated, true)
+	c.Next()
+}
+
+// ListSessions godoc
+// GET /admin/sessions
+func (h *AdminHandler) ListSessions(c *gin.Context) {
+	h.auditLog(c, "list_sessions", "")
+	c.JSON(http.StatusOK, model.HubSessionsResponse{Sessions: h.hub.Sessions()})
+}
+
+// RecordingSinks godoc
+// GET /admin/recording/sinks
+func (h *AdminHandler) RecordingSinks(c *gin.Context) {
+	h.auditLog(c, "recording_sinks", "")
+	resp := model.RecordingSinksResponse{Sinks: []model.RecordingSinkHealth{}}
+	if h.sinks != nil {
+		resp.Sinks = h.sinks.Health()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetSession godoc
+// GET /admin/sessions/:id
+func (h *AdminHandler) GetSession(c *gin.Context) {
+	sessionID, ok := adminSessionID(c)
+	if !ok {
+		return
+	}
+	h.auditLog(c, "get_session", sessionID)
+	hs, ok := h.hub.Session(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session has no live peers"})
+		return
+	}
+	c.JSON(http.StatusOK, hs)
+}
+
+// DisconnectPeer godoc
+// DELETE /admin/sessions/:id/peers/:user_id
+func (h *AdminHandler) DisconnectPeer(c *gin.Context) {
+	sessionID, ok := adminSessionID(c)
+	if !ok {
+		return
+	}
+	userID := c.Param("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id: must be a valid UUID"})
+		return
+	}
+	var req model.AdminDisconnectRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "disconnected by administrator"
+	}
+	n := h.hub.DisconnectPeer(sessionID, userID, req.Reason)
+	h.auditLog(c, "disconnect_peer", sessionID,
+		zap.String("target_user_id", userID),
+		zap.String("reason", req.Reason),
+		zap.Int("affected", n))
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "peer not connected"})
+		return
+	}
+	c.JSON(http.StatusOK, model.AdminActionResponse{SessionID: sessionID, Affected: n})
+}
+
+// FinishSession godoc
+// POST /admin/sessions/:id/finish
+func (h *AdminHandler) FinishSession(c *gin.Context) {
+	sessionID, ok := adminSessionID(c)
+	if !ok {
+		return
+	}
+	var req model.AdminFinishRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
+			return
+		}
+	}
+	if req.Reason != "" {
+		h.hub.Broadcast(sessionID, systemMessage(sessionID, req.Reason))
+	}
+	err := h.svc.Finish(sessionID)
+	h.auditLog(c, "finish_session", sessionID, zap.String("reason", req.Reason), zap.Error(err))
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finish session"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Broadcast godoc
+// POST /admin/sessions/:id/broadcast
+func (h *AdminHandler) Broadcast(c *gin.Context) {
+	sessionID, ok := adminSessionID(c)
+	if !ok {
+		return
+	}
+	var req model.AdminBroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
+		return
+	}
+	n := h.hub.Broadcast(sessionID, systemMessage(sessionID, req.Message))
+	h.auditLog(c, "broadcast", sessionID, zap.String("message", req.Message), zap.Int("affected", n))
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session has no live peers"})
+		return
+	}
+	c.JSON(http.StatusOK, model.AdminActionResponse{SessionID: sessionID, Affected: n})
+}
+
+func (h *AdminHandler) auditLog(c *gin.Context, action, sessionID string, fields ...zap.Field) {
+	base := []zap.Field{
+		zap.String("action", action),
+		zap.String("remote_ip", c.ClientIP()),
+	}
+	if c.GetBool(adminAuthenticated) {
+		base = append(base, zap.String("admin_id", h.id))
+	}
+	if sessionID != "" {
+		base = append(base, zap.String("session_id", sessionID))
+	}
+	h.audit.Info("admin action", append(base, fields...)...)
+}
+
+func adminSessionID(c *gin.Context) (string, bool) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return "", false
+	}
+	return sessionID, true
+}
+
+func systemMessage(sessionID, text string) gin.H {
+	return gin.H{"event": "system_message", "session_id": sessionID, "message": text, "time": time.Now().Unix()}
+}
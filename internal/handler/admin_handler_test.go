@@ -0,0 +1,189 @@
+package handler_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/router"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+const (
+	adminToken = "s3cret-admin-token"
+	sessionID  = "11111111-1111-1111-1111-111111111111"
+	userID     = "22222222-2222-2222-2222-222222222222"
+)
+
+// fakeAdminHub is a hub with one live session holding one peer.
+type fakeAdminHub struct {
+	disconnected []string // user_id:reason
+	broadcasts   int
+}
+
+func (f *fakeAdminHub) Sessions() []model.HubSession {
+	return []model.HubSession{{SessionID: sessionID}}
+}
+
+func (f *fakeAdminHub) Session(id string) (model.HubSession, bool) {
+	return model.HubSession{SessionID: id}, id == sessionID
+}
+
+func (f *fakeAdminHub) DisconnectPeer(id, user, reason string) int {
+	if id != sessionID || user != userID {
+		return 0
+	}
+	f.disconnected = append(f.disconnected, user+":"+reason)
+	return 1
+}
+
+func (f *fakeAdminHub) Broadcast(id string, _ any) int {
+	f.broadcasts++
+	if id != sessionID {
+		return 0
+	}
+	return 1
+}
+
+// fakeFinisher is a session service that only finishes sessionID.
+type fakeFinisher struct {
+	service.SessionServicer
+	finished []string
+}
+
+func (f *fakeFinisher) Finish(id string) error {
+	if id != sessionID {
+		return errs.ErrSessionNotFound
+	}
+	f.finished = append(f.finished, id)
+	return nil
+}
+
+// handlerTokenID is the audit admin_id of adminToken: a fingerprint, never the token.
+func handlerTokenID() string {
+	sum := sha256.Sum256([]byte(adminToken))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+func newAdmin(token string) (*gin.Engine, *fakeAdminHub, *fakeFinisher, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	hub, svc := &fakeAdminHub{}, &fakeFinisher{}
+	r := router.New(router.Handlers{Admin: handler.NewAdminHandler(hub, svc, token, zap.New(core))})
+	return r, hub, svc, logs
+}
+
+func do(r http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("X-Admin-Token", token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-User-ID", userID) // not authenticated: must not become the audit admin_id
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminToken(t *testing.T) {
+	r, _, _, logs := newAdmin(adminToken)
+	for _, tc := range []struct {
+		name, token string
+		code        int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong, same length", strings.Repeat("x", len(adminToken)), http.StatusUnauthorized},
+		{"prefix", adminToken[:len(adminToken)-1], http.StatusUnauthorized},
+		{"longer", adminToken + "x", http.StatusUnauthorized},
+		{"valid", adminToken, http.StatusOK},
+	} {
+		if w := do(r, http.MethodGet, "/admin/sessions", tc.token, ""); w.Code != tc.code {
+			t.Errorf("%s token: %d, want %d", tc.name, w.Code, tc.code)
+		}
+	}
+	failed := logs.FilterField(zap.String("action", "auth_failed")).All()
+	if len(failed) != 4 {
+		t.Fatalf("%d auth_failed audit entries, want 4", len(failed))
+	}
+	for _, e := range failed {
+		if _, ok := e.ContextMap()["admin_id"]; ok {
+			t.Fatal("failed authentication logged with an admin_id")
+		}
+	}
+
+	disabled, _, _, _ := newAdmin("")
+	if w := do(disabled, http.MethodGet, "/admin/sessions", "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("admin API without a token: %d, want 403", w.Code)
+	}
+	if w := do(disabled, http.MethodGet, "/admin/sessions", adminToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("admin API without a token, any X-Admin-Token: %d, want 403", w.Code)
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	r, hub, svc, logs := newAdmin(adminToken)
+
+	w := do(r, http.MethodDelete, "/admin/sessions/"+sessionID+"/peers/"+userID, adminToken, `{"reason":"abuse"}`)
+	if w.Code != http.StatusOK || len(hub.disconnected) != 1 || hub.disconnected[0] != userID+":abuse" {
+		t.Fatalf("disconnect: %d %s, hub %v", w.Code, w.Body, hub.disconnected)
+	}
+	if w := do(r, http.MethodDelete, "/admin/sessions/"+sessionID+"/peers/"+userID, adminToken, ""); w.Code != http.StatusOK ||
+		hub.disconnected[1] != userID+":disconnected by administrator" {
+		t.Fatalf("disconnect without a reason: %d, hub %v", w.Code, hub.disconnected)
+	}
+	other := "33333333-3333-3333-3333-333333333333"
+	if w := do(r, http.MethodDelete, "/admin/sessions/"+sessionID+"/peers/"+other, adminToken, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("disconnect of a peer not connected: %d, want 404", w.Code)
+	}
+	if w := do(r, http.MethodDelete, "/admin/sessions/"+sessionID+"/peers/not-a-uuid", adminToken, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("disconnect of an invalid user_id: %d, want 400", w.Code)
+	}
+
+	if w := do(r, http.MethodPost, "/admin/sessions/"+sessionID+"/finish", adminToken, `{"reason":"maintenance"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("finish: %d %s", w.Code, w.Body)
+	}
+	if len(svc.finished) != 1 || hub.broadcasts != 1 {
+		t.Fatalf("finish: finished %v, %d broadcasts; want the session finished and the reason broadcast", svc.finished, hub.broadcasts)
+	}
+	if w := do(r, http.MethodPost, "/admin/sessions/"+other+"/finish", adminToken, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("finish of an unknown session: %d, want 404", w.Code)
+	}
+
+	entries := logs.FilterField(zap.String("action", "disconnect_peer")).All()
+	if len(entries) != 3 {
+		t.Fatalf("%d disconnect_peer audit entries, want 3", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]any{
+		"admin_id":       handlerTokenID(),
+		"session_id":     sessionID,
+		"target_user_id": userID,
+		"reason":         "abuse",
+		"affected":       int64(1),
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("audit %s = %v, want %v", k, fields[k], v)
+		}
+	}
+	if _, ok := fields["remote_ip"]; !ok {
+		t.Error("audit entry without remote_ip")
+	}
+	finish := logs.FilterField(zap.String("action", "finish_session")).All()
+	if len(finish) != 2 || finish[0].ContextMap()["reason"] != "maintenance" || finish[1].ContextMap()["error"] == nil {
+		t.Fatalf("finish_session audit entries = %v, want the reason and the error of the failed one", finish)
+	}
+}
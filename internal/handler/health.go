@@ -5,16 +5,27 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/internal/model"
 )
 
+// BreakerReporter reports circuit breakers around downstream services (implemented by breaker.Registry).
+type BreakerReporter interface {
+	States() []model.BreakerState
+}
+
 // HealthHandler handles health and ready checks.
-type HealthHandler struct{}
+type HealthHandler struct {
+	breakers BreakerReporter // optional
+}
 
 // NewHealthHandler creates a health handler.
 func NewHealthHandler() *HealthHandler {
 	return &HealthHandler{}
 }
 
+// SetBreakers sets the optional circuit breaker reporter shown in /ready.
+func (h *HealthHandler) SetBreakers(r BreakerReporter) { h.breakers = r }
+
 // Health responds to GET /health.
 func (h *HealthHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -25,6 +36,17 @@ func (h *HealthHandler) Health(c *gin.Context) {
 }
 
 // Ready responds to GET /ready (for k8s readiness). Формат {"status": "ready"} для единообразия с остальными сервисами.
+// A breaker that is not closed makes the status "degraded" but keeps 200: the service falls back (spool, skip,
+// retry later) and taking every replica out of rotation because a dependency is down would not help.
 func (h *HealthHandler) Ready(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+	resp := model.ReadyResponse{Status: "ready"}
+	if h.breakers != nil {
+		resp.Breakers = h.breakers.States()
+		for _, b := range resp.Breakers {
+			if b.State != "closed" {
+				resp.Status = "degraded"
+			}
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 }
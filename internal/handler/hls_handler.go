@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"github.com/psds-microservice/streaming-service/internal/urltoken"
+	"go.uber.org/zap"
+)
+
+// URLSigner issues and checks the tokens of signed URLs (implemented by urltoken.Signer).
+type URLSigner interface {
+	Sign(scope, sessionID, userID string, now time.Time) (string, time.Time)
+	Verify(token, scope, sessionID string, now time.Time) (string, error)
+}
+
+// HLSHandler serves the client stream as HLS for operators that cannot hold a WebSocket.
+type HLSHandler struct {
+	sess   service.SessionServicer
+	hls    service.HLSPackager // nil: HLS disabled
+	tokens URLSigner
+	logger *zap.Logger
+}
+
+// NewHLSHandler creates the HLS handler (D: принимает интерфейсы); hls is nil when HLS is disabled.
+func NewHLSHandler(sess service.SessionServicer, hls service.HLSPackager, tokens URLSigner, logger *zap.Logger) *HLSHandler {
+	return &HLSHandler{sess: sess, hls: hls, tokens: tokens, logger: logger}
+}
+
+// Enroll godoc
+// POST /sessions/:id/hls — admits the caller (X-User-ID) as a viewer with the rules of a WebSocket join: a caller
+// who is not the session client becomes an operator. Returns the playlist URL with a signed token (players cannot
+// set headers); the viewer leaves after HLS_IDLE_SECONDS without requests.
+func (h *HLSHandler) Enroll(c *gin.Context) {
+	if h.hls == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "hls is not enabled"})
+		return
+	}
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	if _, err := uuid.Parse(callerID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid X-User-ID: must be a valid UUID"})
+		return
+	}
+	sess, ok := h.openSession(c, sessionID)
+	if !ok {
+		return
+	}
+	if !h.hls.Viewing(sessionID, callerID) {
+		operator := callerID != sess.ClientID
+		if operator {
+			if err := h.sess.AddOperator(sessionID, callerID); err != nil {
+				if errors.Is(err, errs.ErrTooManyOperators) {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+				h.logger.Warn("failed to add hls operator to session", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join session"})
+				return
+			}
+		}
+		h.hls.AddViewer(sessionID, callerID, operator)
+	}
+	token, exp := h.tokens.Sign(urltoken.ScopeHLS, sessionID, callerID, time.Now())
+	c.JSON(http.StatusOK, model.SignedURLResponse{
+		URL:       "/sessions/" + sessionID + "/hls/index.m3u8?token=" + url.QueryEscape(token),
+		ExpiresAt: exp,
+	})
+}
+
+// Serve godoc
+// GET /sessions/:id/hls/:file — index.m3u8 (playlist; LL-HLS blocking reload via _HLS_msn/_HLS_part),
+// seg<N>, part<N>.<I> and init<V>.mp4. The caller is identified by the token of the URL returned by
+// POST /sessions/:id/hls (carried into every URI of the playlist) or by X-User-ID, and must be enrolled;
+// the session is checked on every request, so playback stops when it finishes.
+func (h *HLSHandler) Serve(c *gin.Context) {
+	if h.hls == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "hls is not enabled"})
+		return
+	}
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID, query := c.GetHeader("X-User-ID"), ""
+	if token := c.Query("token"); token != "" {
+		userID, err := h.tokens.Verify(token, urltoken.ScopeHLS, sessionID, time.Now())
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		callerID, query = userID, "?token="+url.QueryEscape(token)
+	}
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token query parameter or X-User-ID header required"})
+		return
+	}
+	if _, ok := h.openSession(c, sessionID); !ok {
+		return
+	}
+	if !h.hls.Viewing(sessionID, callerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errs.ErrHLSNotEnrolled.Error()})
+		return
+	}
+
+	if file := c.Param("file"); file != "" && file != "index.m3u8" {
+		data, ctype, err := h.hls.File(sessionID, file)
+		if err != nil {
+			hlsError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "private, max-age=60")
+		c.Data(http.StatusOK, ctype, data)
+		return
+	}
+	msn, part := -1, -1
+	for name, dst := range map[string]*int{"_HLS_msn": &msn, "_HLS_part": &part} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+				return
+			}
+			*dst = n
+		}
+	}
+	if part >= 0 && msn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "_HLS_part requires _HLS_msn"})
+		return
+	}
+	data, err := h.hls.Playlist(c.Request.Context(), sessionID, msn, part, query)
+	if err != nil {
+		hlsError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", data)
+}
+
+// openSession loads a session that is not finished; false when the response was written.
+func (h *HLSHandler) openSession(c *gin.Context, sessionID string) (*model.Session, bool) {
+	sess, err := h.sess.Get(sessionID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		return nil, false
+	}
+	if sess.Status == model.SessionStatusFinished {
+		c.JSON(http.StatusGone, gin.H{"error": "session already finished"})
+		return nil, false
+	}
+	return sess, true
+}
+
+func hlsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrHLSFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrHLSBadRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrHLSUnsupported):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrHLSNotReady):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "hls failed"})
+	}
+}
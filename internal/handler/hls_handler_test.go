@@ -0,0 +1,183 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/router"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"github.com/psds-microservice/streaming-service/internal/urltoken"
+	"go.uber.org/zap"
+)
+
+const (
+	clientID     = "33333333-3333-3333-3333-333333333333"
+	otherSession = "44444444-4444-4444-4444-444444444444"
+)
+
+// fakeHLSSessions is a session service with sessionID (of clientID) and the finished otherSession.
+type fakeHLSSessions struct {
+	service.SessionServicer
+	operators []string
+}
+
+func (f *fakeHLSSessions) Get(id string) (*model.Session, error) {
+	switch id {
+	case sessionID:
+		return &model.Session{ID: id, ClientID: clientID, Status: model.SessionStatusActive}, nil
+	case otherSession:
+		return &model.Session{ID: id, ClientID: clientID, Status: model.SessionStatusFinished}, nil
+	}
+	return nil, errs.ErrSessionNotFound
+}
+
+func (f *fakeHLSSessions) AddOperator(id, user string) error {
+	f.operators = append(f.operators, id+":"+user)
+	return nil
+}
+
+// fakeHLS is a packager whose playlist echoes the query its URIs would carry.
+type fakeHLS struct {
+	viewers map[string]bool // session:user -> operator
+	queries []string
+}
+
+func (f *fakeHLS) Viewing(sessionID, userID string) bool {
+	_, ok := f.viewers[sessionID+":"+userID]
+	return ok
+}
+
+func (f *fakeHLS) AddViewer(sessionID, userID string, operator bool) {
+	f.viewers[sessionID+":"+userID] = operator
+}
+
+func (f *fakeHLS) Playlist(_ context.Context, _ string, _, _ int, query string) ([]byte, error) {
+	f.queries = append(f.queries, query)
+	return []byte("#EXTM3U\nseg0.ts" + query + "\n"), nil
+}
+
+func (f *fakeHLS) File(_, name string) ([]byte, string, error) {
+	if name != "seg0.ts" {
+		return nil, "", errs.ErrHLSFileNotFound
+	}
+	return []byte("segment"), "video/mp2t", nil
+}
+
+func newHLS(ttl time.Duration) (*gin.Engine, *fakeHLSSessions, *fakeHLS) {
+	sess, hls := &fakeHLSSessions{}, &fakeHLS{viewers: make(map[string]bool)}
+	h := handler.NewHLSHandler(sess, hls, urltoken.New("hls-test-secret", ttl), zap.NewNop())
+	return router.New(router.Handlers{HLS: h}), sess, hls
+}
+
+// enroll posts POST /sessions/:id/hls as user and returns the signed playlist URL.
+func enroll(t *testing.T, r http.Handler, id, user string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/sessions/"+id+"/hls", nil)
+	req.Header.Set("X-User-ID", user)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll: %d %s", w.Code, w.Body)
+	}
+	var resp model.SignedURLResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.URL, "/sessions/"+id+"/hls/index.m3u8?token=") || !resp.ExpiresAt.After(time.Now()) {
+		t.Fatalf("enroll returned %+v", resp)
+	}
+	return resp.URL
+}
+
+// get requests path without X-User-ID, as a player does.
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHLSEnrollSignedURL(t *testing.T) {
+	r, sess, hls := newHLS(time.Minute)
+
+	playlist := enroll(t, r, sessionID, userID)
+	if len(sess.operators) != 1 || sess.operators[0] != sessionID+":"+userID || !hls.viewers[sessionID+":"+userID] {
+		t.Fatalf("operators %v, viewers %v; want the caller enrolled as an operator", sess.operators, hls.viewers)
+	}
+	w := get(r, playlist)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Fatalf("playlist: %d %s", w.Code, w.Body)
+	}
+	_, query, _ := strings.Cut(playlist, "?")
+	if len(hls.queries) != 1 || hls.queries[0] != "?"+query {
+		t.Fatalf("playlist queries %v, want the token carried into its URIs", hls.queries)
+	}
+	if w := get(r, "/sessions/"+sessionID+"/hls/seg0.ts?"+query); w.Code != http.StatusOK || w.Body.String() != "segment" {
+		t.Fatalf("segment with the token: %d %s", w.Code, w.Body)
+	}
+	if w := get(r, "/sessions/"+sessionID+"/hls/seg9.ts?"+query); w.Code != http.StatusNotFound {
+		t.Fatalf("missing segment: %d, want 404", w.Code)
+	}
+
+	// the session client is a viewer but not an operator
+	enroll(t, r, sessionID, clientID)
+	if len(sess.operators) != 1 || hls.viewers[sessionID+":"+clientID] {
+		t.Fatalf("the client was enrolled as an operator: %v", sess.operators)
+	}
+	// enrolling again keeps the viewer and does not add the operator twice
+	enroll(t, r, sessionID, userID)
+	if len(sess.operators) != 1 {
+		t.Fatalf("operators %v after a second enroll, want one", sess.operators)
+	}
+}
+
+func TestHLSServeRejectsBadTokens(t *testing.T) {
+	r, _, hls := newHLS(time.Minute)
+	playlist := enroll(t, r, sessionID, userID)
+	_, query, _ := strings.Cut(playlist, "?")
+	token := strings.TrimPrefix(query, "token=")
+
+	for _, tc := range []struct {
+		name, path string
+		code       int
+	}{
+		{"tampered", playlist + "x", http.StatusForbidden},
+		{"another user", "/sessions/" + sessionID + "/hls/index.m3u8?token=" + strings.Replace(token, userID, clientID, 1), http.StatusForbidden},
+		{"another session", "/sessions/" + otherSession + "/hls/index.m3u8?" + query, http.StatusForbidden},
+		{"none", "/sessions/" + sessionID + "/hls/index.m3u8", http.StatusForbidden},
+	} {
+		if w := get(r, tc.path); w.Code != tc.code {
+			t.Errorf("%s token: %d, want %d", tc.name, w.Code, tc.code)
+		}
+	}
+
+	// a valid token of a viewer whose playback expired
+	delete(hls.viewers, sessionID+":"+userID)
+	if w := get(r, playlist); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), errs.ErrHLSNotEnrolled.Error()) {
+		t.Fatalf("expired viewer: %d %s, want 403 not enrolled", w.Code, w.Body)
+	}
+	if len(hls.queries) != 0 {
+		t.Fatalf("playlist served %d times to rejected requests", len(hls.queries))
+	}
+
+	expired, _, _ := newHLS(-2 * time.Second)
+	req := httptest.NewRequest(http.MethodPost, "/sessions/"+sessionID+"/hls", nil)
+	req.Header.Set("X-User-ID", userID)
+	w := httptest.NewRecorder()
+	expired.ServeHTTP(w, req)
+	var resp model.SignedURLResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(expired, resp.URL); w.Code != http.StatusForbidden {
+		t.Fatalf("expired token: %d, want 403", w.Code)
+	}
+}
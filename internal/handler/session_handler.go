@@ -38,8 +38,20 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
 		return
 	}
-	sess, err := h.svc.Create(req.ClientID)
+	sess, err := h.svc.Create(c.Request.Context(), req)
 	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrRecordingUnavailable), errors.Is(err, errs.ErrSessionManagerClosed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, errs.ErrUnknownRecordingSink), errors.Is(err, errs.ErrSessionManagerNotFound),
+			errors.Is(err, errs.ErrSessionManagerLinkRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, errs.ErrSessionManagerUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
@@ -52,6 +64,159 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 	})
 }
 
+// GetSession godoc
+// GET /sessions/:id
+func (h *SessionHandler) GetSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	sess, err := h.svc.Get(sessionID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		return
+	}
+	if !sessionParticipant(sess, callerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caller is not the session client or an operator"})
+		return
+	}
+	c.JSON(http.StatusOK, sess)
+}
+
+// GetRecordingState godoc
+// GET /sessions/:id/recording
+func (h *SessionHandler) GetRecordingState(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	ok, err := h.svc.IsClientOrOperator(sessionID, callerID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permission"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caller is not the session client or an operator"})
+		return
+	}
+	st, err := h.svc.RecordingState(sessionID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get recording state"})
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// ControlRecording returns the handler for POST /sessions/:id/recording/{start,stop,pause,resume}.
+func (h *SessionHandler) ControlRecording(action model.RecordingAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID := c.Param("id")
+		if _, err := uuid.Parse(sessionID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+			return
+		}
+		callerID := c.GetHeader("X-User-ID")
+		if callerID == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+			return
+		}
+		ok, err := h.svc.IsClientOrOperator(sessionID, callerID)
+		if err != nil {
+			if errors.Is(err, errs.ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permission"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "caller is not the session client or an operator"})
+			return
+		}
+		mode, err := h.svc.ControlRecording(sessionID, callerID, action)
+		if err != nil {
+			switch {
+			case errors.Is(err, errs.ErrSessionNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			case errors.Is(err, errs.ErrSessionFinished), errors.Is(err, errs.ErrRecordingUnavailable):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, errs.ErrRecordingTransition):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "recording_mode": mode})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change recording"})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, model.RecordingControlResponse{SessionID: sessionID, RecordingMode: mode})
+	}
+}
+
+// GetTimeline godoc
+// GET /sessions/:id/timeline — JSONL event timeline recorded alongside the session's media.
+func (h *SessionHandler) GetTimeline(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	ok, err := h.svc.IsClientOrOperator(sessionID, callerID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permission"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caller is not the session client or an operator"})
+		return
+	}
+	rc, err := h.svc.Timeline(sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		case errors.Is(err, errs.ErrTimelineNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "timeline not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read timeline"})
+		}
+		return
+	}
+	defer rc.Close()
+	c.DataFromReader(http.StatusOK, -1, "application/x-ndjson", rc, nil)
+}
+
 // DeleteSession godoc
 // DELETE /sessions/:id
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
@@ -138,3 +303,16 @@ func (h *SessionHandler) GetSessionOperators(c *gin.Context) {
 		Operators: operators,
 	})
 }
+
+// sessionParticipant reports whether userID is the client or one of the operators of sess.
+func sessionParticipant(sess *model.Session, userID string) bool {
+	if sess.ClientID == userID {
+		return true
+	}
+	for _, o := range sess.Operators {
+		if o.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"github.com/psds-microservice/streaming-service/internal/urltoken"
+)
+
+// SnapshotHandler serves the latest still image of a session, for dashboards and supervisor walls that show
+// many sessions at once without subscribing to their streams.
+type SnapshotHandler struct {
+	sess   service.SessionServicer
+	hub    service.StreamHubSnapshots
+	tokens URLSigner
+	token  string // admin token; empty: supervisors cannot use it here
+}
+
+// NewSnapshotHandler creates the snapshot handler (D: принимает интерфейсы).
+func NewSnapshotHandler(sess service.SessionServicer, hub service.StreamHubSnapshots, tokens URLSigner, adminToken string) *SnapshotHandler {
+	return &SnapshotHandler{sess: sess, hub: hub, tokens: tokens, token: adminToken}
+}
+
+// SignURL godoc
+// POST /sessions/:id/snapshot — returns the snapshot URL with a signed token (URL_TOKEN_TTL_SECONDS) for a
+// session participant (X-User-ID), so the URL works in an <img> tag.
+func (h *SnapshotHandler) SignURL(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	if !h.participant(c, sessionID, callerID) {
+		return
+	}
+	token, exp := h.tokens.Sign(urltoken.ScopeSnapshot, sessionID, callerID, time.Now())
+	c.JSON(http.StatusOK, model.SignedURLResponse{
+		URL:       "/sessions/" + sessionID + "/snapshot?token=" + url.QueryEscape(token),
+		ExpiresAt: exp,
+	})
+}
+
+// Snapshot godoc
+// GET /sessions/:id/snapshot — the image of the client's latest snapshot frame (kept in memory until the
+// session is closed, or SESSION_IDLE_TIMEOUT after its last peer left). The caller is a session participant
+// (X-User-ID, or the token of the URL returned by POST /sessions/:id/snapshot) or a supervisor
+// (X-Admin-Token). ETag and Last-Modified make polling cheap: a conditional request for an unchanged
+// snapshot gets 304.
+func (h *SnapshotHandler) Snapshot(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return
+	}
+	if !h.authorize(c, sessionID) {
+		return
+	}
+	snap, ok := h.hub.Snapshot(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no snapshot yet"})
+		return
+	}
+	c.Header("Content-Type", snap.ContentType)
+	c.Header("Cache-Control", "private, no-cache") // revalidate every time: the snapshot changes with the stream
+	c.Header("ETag", fmt.Sprintf(`"%x"`, snap.At.UnixNano()))
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, "", snap.At, bytes.NewReader(snap.Data))
+}
+
+// authorize admits a supervisor or a session participant; false when the response was written.
+func (h *SnapshotHandler) authorize(c *gin.Context, sessionID string) bool {
+	if token := c.GetHeader("X-Admin-Token"); token != "" {
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return false
+		}
+		if _, err := h.sess.Get(sessionID); err != nil {
+			if errors.Is(err, errs.ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+			return false
+		}
+		return true
+	}
+	callerID := c.GetHeader("X-User-ID")
+	if token := c.Query("token"); token != "" {
+		userID, err := h.tokens.Verify(token, urltoken.ScopeSnapshot, sessionID, time.Now())
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return false
+		}
+		callerID = userID
+	}
+	if callerID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token query parameter or X-User-ID header required"})
+		return false
+	}
+	return h.participant(c, sessionID, callerID)
+}
+
+// participant checks that callerID is the session client or an operator; false when the response was written.
+func (h *SnapshotHandler) participant(c *gin.Context, sessionID, callerID string) bool {
+	ok, err := h.sess.IsClientOrOperator(sessionID, callerID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permission"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "caller is not the session client or an operator"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/api"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// swaggerUI loads the embedded Swagger UI assets (relative to /swagger/) and points it at the embedded spec.
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>streaming-service API</title>
+  <link rel="stylesheet" href="swagger-ui.css">
+  <link rel="icon" type="image/png" href="favicon-32x32.png">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" }); };
+  </script>
+</body>
+</html>`
+
+// swaggerAssets are the Swagger UI files the page loads; nothing else of the embedded dist is served.
+var swaggerAssets = map[string]bool{
+	"swagger-ui.css":       true,
+	"swagger-ui-bundle.js": true,
+	"favicon-32x32.png":    true,
+}
+
+// SwaggerHandler serves the embedded OpenAPI spec and Swagger UI (assets from github.com/swaggo/files,
+// so the UI works without internet access).
+type SwaggerHandler struct{}
+
+// NewSwaggerHandler creates the swagger handler.
+func NewSwaggerHandler() *SwaggerHandler {
+	return &SwaggerHandler{}
+}
+
+// UI responds to GET /swagger/ with Swagger UI.
+func (h *SwaggerHandler) UI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
+
+// Asset responds to GET /swagger/:file with an embedded Swagger UI asset.
+func (h *SwaggerHandler) Asset(c *gin.Context) {
+	file := c.Param("file")
+	if !swaggerAssets[file] {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.FileFromFS(file, http.FS(swaggerFiles.FS))
+}
+
+// Spec responds to GET /swagger/openapi.json.
+func (h *SwaggerHandler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", api.OpenAPISpec)
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	sseKeepAlive = 15 * time.Second // an idle event stream gets a comment line, so proxies do not time it out
+	viewerWrite  = 10 * time.Second // a viewer not reading for this long is dropped (its queue overflows meanwhile)
+)
+
+// ViewerHandler serves read-only consumers that do not need a WebSocket: control events as Server-Sent Events
+// and the client's media frames as a chunked HTTP body.
+type ViewerHandler struct {
+	sess   service.SessionServicer
+	hub    service.StreamHubAttacher
+	logger *zap.Logger
+}
+
+// NewViewerHandler creates the SSE / chunked HTTP viewer handler (D: принимает интерфейсы).
+func NewViewerHandler(sess service.SessionServicer, hub service.StreamHubAttacher, logger *zap.Logger) *ViewerHandler {
+	return &ViewerHandler{sess: sess, hub: hub, logger: logger}
+}
+
+// Events godoc
+// GET /sessions/:id/events — text/event-stream of the control events a WebSocket operator receives
+// (recording_mode, recording_state, broadcasts, session_finished); the SSE event name is the JSON "event" field.
+// The caller is X-User-ID or the user_id query parameter (EventSource cannot set headers). It observes the
+// session: no operator slot, no media frames.
+func (h *ViewerHandler) Events(c *gin.Context) {
+	sess, userID, ok := h.caller(c)
+	if !ok {
+		return
+	}
+	peer, leave := h.hub.Observe(sess.ID, userID, service.TransportSSE)
+	defer leave()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	h.event(c, model.RecordingControlEvent{Event: "recording_mode", SessionID: sess.ID, RecordingMode: sess.RecordingMode})
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if !write(c, func() error { _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); return err }) {
+				return
+			}
+		case msg, ok := <-peer.Send:
+			if !ok {
+				return
+			}
+			var ev struct {
+				Event string `json:"event"`
+			}
+			if json.Unmarshal(msg.Data, &ev) != nil || ev.Event == "" {
+				ev.Event = "message"
+			}
+			if !write(c, func() error { return sseEvent(c, ev.Event, msg.Data) }) {
+				return
+			}
+		}
+	}
+}
+
+// event writes v as an SSE event named by its "event" field.
+func (h *ViewerHandler) event(c *gin.Context, v model.RecordingControlEvent) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	write(c, func() error { return sseEvent(c, v.Event, raw) })
+}
+
+// sseEvent renders one event with gin-contrib/sse (data is single-line JSON); render errors abort the context.
+func sseEvent(c *gin.Context, name string, data []byte) error {
+	c.SSEvent(name, string(data))
+	if c.IsAborted() {
+		return c.Errors.Last()
+	}
+	return nil
+}
+
+// write runs fn and flushes within viewerWrite; false when the viewer is gone or too slow. Each write moves
+// the deadline, which also lifts the server's WriteTimeout for the long-lived response.
+func write(c *gin.Context, fn func() error) bool {
+	rc := http.NewResponseController(c.Writer)
+	_ = rc.SetWriteDeadline(time.Now().Add(viewerWrite))
+	if err := fn(); err != nil {
+		return false
+	}
+	return rc.Flush() == nil
+}
+
+// Stream godoc
+// GET /sessions/:id/stream — the client's binary frames concatenated into a chunked response body, as
+// relayed (MPEG-TS, fMP4 or FLV, whatever the client publishes). Frames dropped by the hub's full queue are
+// missing from the body. Same caller rules as Events; the caller joins as an operator.
+func (h *ViewerHandler) Stream(c *gin.Context) {
+	peer, leave, ok := h.join(c, service.TransportHTTP)
+	if !ok {
+		return
+	}
+	defer leave()
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if !write(c, func() error { return nil }) {
+		return
+	}
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case msg, ok := <-peer.Send:
+			if !ok {
+				return
+			}
+			if msg.Type != websocket.BinaryMessage || len(msg.Data) == 0 {
+				continue // control events: GET /sessions/:id/events
+			}
+			if !write(c, func() error { _, err := c.Writer.Write(msg.Data); return err }) {
+				return
+			}
+		}
+	}
+}
+
+// caller checks the caller (X-User-ID or user_id) and the session with the rules of a WebSocket connect;
+// false when the response was written.
+func (h *ViewerHandler) caller(c *gin.Context) (*model.Session, string, bool) {
+	sessionID := c.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return nil, "", false
+	}
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = c.Query("user_id")
+	}
+	if userID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header or user_id query parameter required"})
+		return nil, "", false
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id: must be a valid UUID"})
+		return nil, "", false
+	}
+	sess, err := h.sess.Get(sessionID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return nil, "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		return nil, "", false
+	}
+	if sess.Status == model.SessionStatusFinished {
+		c.JSON(http.StatusGone, gin.H{"error": "session already finished"})
+		return nil, "", false
+	}
+	if userID == sess.ClientID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the session client cannot subscribe to its own stream"})
+		return nil, "", false
+	}
+	return sess, userID, true
+}
+
+// join admits the caller as an operator peer; false when the response was written. leave unregisters the
+// peer and records the operator's leave.
+func (h *ViewerHandler) join(c *gin.Context, transport string) (*service.Peer, func(), bool) {
+	sess, userID, ok := h.caller(c)
+	if !ok {
+		return nil, nil, false
+	}
+	if err := h.sess.AddOperator(sess.ID, userID); err != nil {
+		if errors.Is(err, errs.ErrTooManyOperators) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return nil, nil, false
+		}
+		h.logger.Warn("failed to add viewer to session", zap.String("transport", transport), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join session"})
+		return nil, nil, false
+	}
+	peer, cleanup := h.hub.Subscribe(sess.ID, userID, transport)
+	return peer, func() {
+		cleanup()
+		if err := h.sess.OperatorLeft(sess.ID, userID); err != nil {
+			h.logger.Warn("failed to record operator leave", zap.Error(err))
+		}
+	}, true
+}
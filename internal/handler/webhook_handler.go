@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// WebhookManager — интерфейс управления подписками и доставками (реализует webhook.Dispatcher).
+type WebhookManager interface {
+	CreateSubscription(req model.CreateWebhookRequest) (*model.Webhook, error)
+	ListSubscriptions() ([]model.Webhook, error)
+	DeleteSubscription(id string) error
+	ListDeliveries(subscriptionID, sessionID, status string, limit int) ([]model.WebhookDeliveryView, error)
+	GetDelivery(id string) (*model.WebhookDeliveryView, error)
+	Replay(id string) error
+}
+
+// WebhookHandler handles /admin/webhooks — subscriptions, delivery inspection and replay.
+// Every action is written to the admin audit log.
+type WebhookHandler struct {
+	mgr   WebhookManager
+	admin *AdminHandler // audit log
+}
+
+// NewWebhookHandler creates the webhook admin handler; actions are audit-logged through admin.
+func NewWebhookHandler(mgr WebhookManager, admin *AdminHandler) *WebhookHandler {
+	return &WebhookHandler{mgr: mgr, admin: admin}
+}
+
+// CreateWebhook godoc
+// POST /admin/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req model.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
+		return
+	}
+	wh, err := h.mgr.CreateSubscription(req)
+	h.admin.auditLog(c, "create_webhook", "", zap.String("url", req.URL), zap.Strings("events", req.Events), zap.Error(err))
+	if err != nil {
+		if errors.Is(err, errs.ErrUnknownEventType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create webhook"})
+		return
+	}
+	c.JSON(http.StatusCreated, wh)
+}
+
+// ListWebhooks godoc
+// GET /admin/webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	h.admin.auditLog(c, "list_webhooks", "")
+	list, err := h.mgr.ListSubscriptions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhooks"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": list})
+}
+
+// DeleteWebhook godoc
+// DELETE /admin/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id: must be a valid UUID"})
+		return
+	}
+	err := h.mgr.DeleteSubscription(id)
+	h.admin.auditLog(c, "delete_webhook", "", zap.String("webhook_id", id), zap.Error(err))
+	if err != nil {
+		if errors.Is(err, errs.ErrWebhookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete webhook"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries godoc
+// GET /admin/webhooks/deliveries?subscription_id=&session_id=&status=&limit=
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	limit := 50
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: must be 1..500"})
+			return
+		}
+		limit = n
+	}
+	for _, key := range []string{"subscription_id", "session_id"} {
+		if v := c.Query(key); v != "" {
+			if _, err := uuid.Parse(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key + ": must be a valid UUID"})
+				return
+			}
+		}
+	}
+	h.admin.auditLog(c, "list_webhook_deliveries", c.Query("session_id"), zap.String("webhook_id", c.Query("subscription_id")))
+	list, err := h.mgr.ListDeliveries(c.Query("subscription_id"), c.Query("session_id"), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": list})
+}
+
+// GetDelivery godoc
+// GET /admin/webhooks/deliveries/:id
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id: must be a valid UUID"})
+		return
+	}
+	h.admin.auditLog(c, "get_webhook_delivery", "", zap.String("delivery_id", id))
+	d, err := h.mgr.GetDelivery(id)
+	if err != nil {
+		if errors.Is(err, errs.ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// ReplayDelivery godoc
+// POST /admin/webhooks/deliveries/:id/replay
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id: must be a valid UUID"})
+		return
+	}
+	err := h.mgr.Replay(id)
+	h.admin.auditLog(c, "replay_webhook_delivery", "", zap.String("delivery_id", id), zap.Error(err))
+	if err != nil {
+		if errors.Is(err, errs.ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay delivery"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/errs"
 	"github.com/psds-microservice/streaming-service/internal/model"
 	"github.com/psds-microservice/streaming-service/internal/service"
 	"go.uber.org/zap"
@@ -15,6 +20,7 @@ import (
 type StreamWSHandler struct {
 	hub    service.StreamHubForHandler
 	sess   service.SessionServicer
+	sfu    service.SFU // optional: WebRTC mode
 	logger *zap.Logger
 }
 
@@ -23,6 +29,9 @@ func NewStreamWSHandler(hub service.StreamHubForHandler, sess service.SessionSer
 	return &StreamWSHandler{hub: hub, sess: sess, logger: logger}
 }
 
+// SetSFU enables WebRTC signaling (webrtc_* events) on the stream socket.
+func (h *StreamWSHandler) SetSFU(s service.SFU) { h.sfu = s }
+
 // ServeWS upgrades the request to WebSocket and runs the stream loop.
 // Path: /ws/stream/:session_id/:user_id
 // First connection with user_id == session.ClientID is the stream source (client); others are operators.
@@ -64,14 +73,34 @@ func (h *StreamWSHandler) ServeWS(c *gin.Context) {
 		role = service.PeerRoleClient
 	}
 
-	peer, cleanup := h.hub.Register(sessionID, userID, role, conn)
+	peer, cleanup, err := h.hub.Register(sessionID, userID, role, conn)
+	if err != nil {
+		// one client per session: the client is already streaming (another socket, WHIP or RTMP)
+		h.logger.Info("websocket client rejected", zap.String("session_id", sessionID), zap.Error(err))
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return
+	}
 	defer cleanup()
+	if h.sfu != nil {
+		defer h.sfu.Leave(peer) // runs before cleanup closes peer.Send
+	}
+	// Load the persisted recording mode before any chunk is relayed (the hub keeps newer changes); after
+	// Register, so the hub never drops it as the mode of a session without peers.
+	h.hub.InitRecording(sessionID, sess.RecordingMode == model.RecordingModeOn)
+	// Tell the new peer whether the session is being recorded.
+	peer.SendJSON(model.RecordingControlEvent{Event: "recording_mode", SessionID: sessionID, RecordingMode: sess.RecordingMode})
 
 	if role == service.PeerRoleOperator {
 		if err := h.sess.AddOperator(sessionID, userID); err != nil {
 			h.logger.Warn("failed to add operator to session", zap.Error(err))
 			return
 		}
+		defer func() {
+			if err := h.sess.OperatorLeft(sessionID, userID); err != nil {
+				h.logger.Warn("failed to record operator leave", zap.Error(err))
+			}
+		}()
 	}
 
 	// Writer goroutine: send from peer.Send to connection
@@ -93,19 +122,98 @@ func (h *StreamWSHandler) readPump(p *service.Peer) {
 			}
 			break
 		}
+		if h.signal(p, mt, data) || h.track(p, mt, data) || h.ack(p, mt, data) || h.snapshot(p, mt, data) {
+			continue
+		}
 		if p.Role == service.PeerRoleClient {
 			h.hub.RelayToOperators(p.SessionID, mt, data)
+		} else {
+			// Operators don't send media back; their text frames (chat, annotations) go to the timeline
+			h.hub.OperatorMessage(p.SessionID, p.UserID, mt, data)
 		}
-		// Operators don't send media back in this minimal version; could add later
 	}
 }
 
+// signal passes a WebRTC signaling frame to the SFU; false if data is not one (it is then relayed as usual).
+func (h *StreamWSHandler) signal(p *service.Peer, mt int, data []byte) bool {
+	if mt != websocket.TextMessage || !bytes.Contains(data, []byte(`"webrtc_`)) {
+		return false
+	}
+	var msg model.SignalMessage
+	if err := json.Unmarshal(data, &msg); err != nil || !model.IsSignal(msg.Event) {
+		return false
+	}
+	if h.sfu == nil {
+		p.SendJSON(model.SignalMessage{Event: model.SignalError, SessionID: p.SessionID, Error: "webrtc is not enabled"})
+		return true
+	}
+	h.sfu.Signal(p, msg)
+	return true
+}
+
+// track handles a track declaration (client) or subscription change (operator); false if data is not one.
+func (h *StreamWSHandler) track(p *service.Peer, mt int, data []byte) bool {
+	if mt != websocket.TextMessage || !bytes.Contains(data, []byte(`"track`)) {
+		return false
+	}
+	var ev struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil || !model.IsTrackMessage(ev.Event) {
+		return false
+	}
+	var msg model.TrackMessage
+	err := json.Unmarshal(data, &msg)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("%w: %v", errs.ErrInvalidTracks, err)
+	case msg.Event == model.TrackDeclare:
+		err = h.hub.DeclareTracks(p, msg.Tracks)
+	default:
+		var reply model.TrackMessage
+		if reply, err = h.hub.SetTrackSubscription(p, msg.TrackIDs, msg.Event == model.TrackSubscribe); err == nil {
+			p.SendJSON(reply)
+		}
+	}
+	if err != nil {
+		p.SendJSON(model.TrackMessage{Event: model.TrackError, SessionID: p.SessionID, Error: err.Error()})
+	}
+	return true
+}
+
+// ack passes an operator's frame_ack to the hub's frame stats; false if data is not one.
+func (h *StreamWSHandler) ack(p *service.Peer, mt int, data []byte) bool {
+	if mt != websocket.TextMessage || p.Role != service.PeerRoleOperator || !bytes.Contains(data, []byte(`"frame_ack"`)) {
+		return false
+	}
+	var msg model.FrameAckMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Event != model.FrameAck {
+		return false
+	}
+	h.hub.AckFrame(p, msg)
+	return true
+}
+
+// snapshot keeps a client's snapshot frame for GET /sessions/:id/snapshot, before (and whatever) the track
+// checks of relayed frames; false if data is not one.
+func (h *StreamWSHandler) snapshot(p *service.Peer, mt int, data []byte) bool {
+	if mt != websocket.BinaryMessage || p.Role != service.PeerRoleClient {
+		return false
+	}
+	img, ok := service.ParseSnapshotFrame(data)
+	if !ok {
+		return false
+	}
+	h.hub.SetSnapshot(p, img)
+	return true
+}
+
 func (h *StreamWSHandler) writePump(p *service.Peer) {
 	defer func() {
 		_ = p.Conn.Close()
 	}()
-	for data := range p.Send {
-		if err := p.Conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+	for msg := range p.Send {
+		if err := p.Write(msg); err != nil {
 			break
 		}
 	}
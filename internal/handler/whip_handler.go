@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// maxSDPSize bounds WHIP/WHEP request bodies (offers and trickle fragments).
+const maxSDPSize = 64 << 10
+
+// WHIPHandler serves WHIP ingest (/whip) and WHEP playback (/whep) on top of the SFU.
+type WHIPHandler struct {
+	sess   service.SessionServicer
+	hub    service.StreamHubAttacher
+	rtc    service.WHIPServer // nil: WebRTC disabled
+	logger *zap.Logger
+}
+
+// NewWHIPHandler creates the WHIP/WHEP handler (D: принимает интерфейсы); rtc is nil when WebRTC is disabled.
+func NewWHIPHandler(sess service.SessionServicer, hub service.StreamHubAttacher, rtc service.WHIPServer, logger *zap.Logger) *WHIPHandler {
+	return &WHIPHandler{sess: sess, hub: hub, rtc: rtc, logger: logger}
+}
+
+// Publish godoc
+// POST /whip/:session_id — the session client's SDP offer, authorized by "Authorization: Bearer <stream_key>".
+// Answers 201 with the SDP answer and the resource URL in Location; publishing activates the session.
+func (h *WHIPHandler) Publish(c *gin.Context) {
+	sessionID, offer, ok := h.offer(c)
+	if !ok {
+		return
+	}
+	sess, ok := h.session(c, sessionID)
+	if !ok || !h.streamKey(c, sess) {
+		return
+	}
+	peer, cleanup, err := h.hub.Publish(sessionID, sess.ClientID, service.TransportWHIP)
+	if err != nil {
+		// one client per session: the client is already streaming over WebSocket, RTMP or another WHIP resource
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	id, answer, err := h.rtc.WHIP(peer, offer, cleanup)
+	if err != nil {
+		h.webrtcError(c, err)
+		return
+	}
+	h.watch(peer, id)
+	if err := h.sess.Activate(sessionID); err != nil {
+		h.logger.Warn("failed to activate session on whip publish", zap.String("session_id", sessionID), zap.Error(err))
+	}
+	h.created(c, "/whip/"+sessionID+"/"+id, answer)
+}
+
+// View godoc
+// POST /whep/:session_id — an operator's SDP offer (X-User-ID). Once the SFU answered, the operator joins the
+// session like a WebSocket operator; answers 201 with the client's tracks, or 503 while the client is not publishing.
+func (h *WHIPHandler) View(c *gin.Context) {
+	sessionID, offer, ok := h.offer(c)
+	if !ok {
+		return
+	}
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "X-User-ID header required"})
+		return
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid X-User-ID: must be a valid UUID"})
+		return
+	}
+	sess, ok := h.session(c, sessionID)
+	if !ok {
+		return
+	}
+	if userID == sess.ClientID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the session client publishes with WHIP"})
+		return
+	}
+	// the media goes over WebRTC: the peer takes control events only (session_finished, admin disconnect)
+	peer, cleanup := h.hub.SubscribeControl(sessionID, userID, service.TransportWHEP)
+	var mu sync.Mutex
+	joined, closed := false, false
+	id, answer, err := h.rtc.WHEP(peer, offer, func() {
+		cleanup()
+		mu.Lock()
+		closed = true
+		leave := joined
+		mu.Unlock()
+		if leave {
+			if err := h.sess.OperatorLeft(sessionID, userID); err != nil {
+				h.logger.Warn("failed to record operator leave", zap.Error(err))
+			}
+		}
+	})
+	if err != nil {
+		h.webrtcError(c, err)
+		return
+	}
+	// join the session only with an answer; under mu, so a resource closed meanwhile is not left joined
+	mu.Lock()
+	err = errs.ErrWebRTCResourceNotFound
+	if !closed {
+		err = h.sess.AddOperator(sessionID, userID)
+		joined = err == nil
+	}
+	mu.Unlock()
+	if err != nil {
+		_ = h.rtc.Delete(id)
+		switch {
+		case errors.Is(err, errs.ErrTooManyOperators):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrWebRTCResourceNotFound):
+			h.webrtcError(c, err)
+		default:
+			h.logger.Warn("failed to add whep operator to session", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to join session"})
+		}
+		return
+	}
+	h.watch(peer, id)
+	h.created(c, "/whep/"+sessionID+"/"+id, answer)
+}
+
+// Trickle godoc
+// PATCH /whip/:session_id/:resource_id and /whep/:session_id/:resource_id — remote ICE candidates
+// (application/trickle-ice-sdpfrag), authorized like the POST that created the resource.
+func (h *WHIPHandler) Trickle(c *gin.Context) {
+	id, ok := h.resource(c)
+	if !ok {
+		return
+	}
+	if !hasContentType(c, "application/trickle-ice-sdpfrag") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/trickle-ice-sdpfrag"})
+		return
+	}
+	frag, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSDPSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	if err := h.rtc.Trickle(id, string(frag)); err != nil {
+		h.webrtcError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Delete godoc
+// DELETE /whip/:session_id/:resource_id and /whep/:session_id/:resource_id — ends the publish or playback.
+func (h *WHIPHandler) Delete(c *gin.Context) {
+	id, ok := h.resource(c)
+	if !ok {
+		return
+	}
+	if err := h.rtc.Delete(id); err != nil {
+		h.webrtcError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// offer validates the session ID and reads the SDP offer; false when the response was written.
+func (h *WHIPHandler) offer(c *gin.Context) (string, string, bool) {
+	if h.rtc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webrtc is not enabled"})
+		return "", "", false
+	}
+	sessionID := c.Param("session_id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id: must be a valid UUID"})
+		return "", "", false
+	}
+	if !hasContentType(c, "application/sdp") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/sdp"})
+		return "", "", false
+	}
+	offer, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSDPSize))
+	if err != nil || len(offer) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SDP offer required"})
+		return "", "", false
+	}
+	return sessionID, string(offer), true
+}
+
+// session loads a session that can still be joined; false when the response was written.
+func (h *WHIPHandler) session(c *gin.Context, sessionID string) (*model.Session, bool) {
+	sess, err := h.sess.Get(sessionID)
+	if err != nil {
+		if errors.Is(err, errs.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		return nil, false
+	}
+	if sess.Status == model.SessionStatusFinished {
+		c.JSON(http.StatusGone, gin.H{"error": "session already finished"})
+		return nil, false
+	}
+	return sess, true
+}
+
+// streamKey checks the bearer token against the session's stream key; false when the response was written.
+func (h *WHIPHandler) streamKey(c *gin.Context, sess *model.Session) bool {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(sess.StreamKey)) != 1 {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization: Bearer <stream_key> required"})
+		return false
+	}
+	return true
+}
+
+// resource authorizes a request on /whip|/whep/:session_id/:resource_id: the WHIP publisher by the stream
+// key, the WHEP viewer by X-User-ID. False when the response was written.
+func (h *WHIPHandler) resource(c *gin.Context) (string, bool) {
+	if h.rtc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webrtc is not enabled"})
+		return "", false
+	}
+	sessionID, id := c.Param("session_id"), c.Param("resource_id")
+	peer, ok := h.rtc.Resource(id)
+	whip := strings.HasPrefix(c.FullPath(), "/whip/")
+	if !ok || peer.SessionID != sessionID || (peer.Transport == service.TransportWHIP) != whip {
+		c.JSON(http.StatusNotFound, gin.H{"error": errs.ErrWebRTCResourceNotFound.Error()})
+		return "", false
+	}
+	if whip {
+		sess, ok := h.session(c, sessionID)
+		if !ok || !h.streamKey(c, sess) {
+			return "", false
+		}
+	} else if c.GetHeader("X-User-ID") != peer.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not the owner of this resource"})
+		return "", false
+	}
+	return id, true
+}
+
+// watch ends the resource when the hub removes its peer (session closed, admin disconnect). The peer's
+// Send carries nothing a WebRTC connection can deliver and is drained.
+func (h *WHIPHandler) watch(peer *service.Peer, id string) {
+	go func() {
+		for range peer.Send {
+		}
+		_ = h.rtc.Delete(id)
+	}()
+}
+
+func (h *WHIPHandler) created(c *gin.Context, location, answer string) {
+	c.Header("Location", location)
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer))
+}
+
+func hasContentType(c *gin.Context, want string) bool {
+	mt, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return err == nil && mt == want
+}
+
+// webrtcError answers an SFU error: 400 only for an offer or candidate that does not parse or apply, 404 and
+// 503 for the typed resource states, 500 with a generic message (the cause is logged) for anything else.
+func (h *WHIPHandler) webrtcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrWebRTCBadOffer), errors.Is(err, errs.ErrWebRTCBadCandidate):
+		h.logger.Debug("webrtc request rejected", zap.String("path", c.FullPath()), zap.String("session_id", c.Param("session_id")), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrWebRTCResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrWebRTCNotPublishing):
+		c.Header("Retry-After", "2")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		h.logger.Warn("webrtc request failed", zap.String("path", c.FullPath()), zap.String("session_id", c.Param("session_id")), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "webrtc failed"})
+	}
+}
@@ -0,0 +1,155 @@
+package handler_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/router"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const streamKey = "sk_live"
+
+// fakeWHIPSessions is a session service with the active sessionID of clientID.
+type fakeWHIPSessions struct {
+	service.SessionServicer
+}
+
+func (fakeWHIPSessions) Get(id string) (*model.Session, error) {
+	if id != sessionID {
+		return nil, errs.ErrSessionNotFound
+	}
+	return &model.Session{ID: id, ClientID: clientID, StreamKey: streamKey, Status: model.SessionStatusActive}, nil
+}
+
+func (fakeWHIPSessions) Activate(string) error { return nil }
+
+// fakeSFU answers every call with err; on success it holds one resource, "res".
+type fakeSFU struct {
+	err   error
+	calls int
+	peer  *service.Peer
+}
+
+func (f *fakeSFU) WHIP(p *service.Peer, _ string, onClose func()) (string, string, error) {
+	f.calls++
+	if f.err != nil {
+		onClose()
+		return "", "", f.err
+	}
+	f.peer = p
+	return "res", "v=0\r\n", nil
+}
+
+func (f *fakeSFU) WHEP(p *service.Peer, offer string, onClose func()) (string, string, error) {
+	return f.WHIP(p, offer, onClose)
+}
+
+func (f *fakeSFU) Resource(id string) (*service.Peer, bool) {
+	return f.peer, id == "res" && f.peer != nil
+}
+
+func (f *fakeSFU) Trickle(string, string) error { return f.err }
+
+func (f *fakeSFU) Delete(string) error { return nil }
+
+func newWHIP(rtc *fakeSFU) (*gin.Engine, *service.StreamHub, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	hub := service.NewStreamHub(0, zap.NewNop())
+	h := handler.NewWHIPHandler(fakeWHIPSessions{}, hub, rtc, zap.New(core))
+	return router.New(router.Handlers{WHIP: h}), hub, logs
+}
+
+func whipRequest(r http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+streamKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestWHIPPublishErrors(t *testing.T) {
+	cause := errors.New("ice: udp mux closed")
+	for _, tc := range []struct {
+		name string
+		err  error
+		code int
+		body string
+	}{
+		{"offer that does not parse", fmt.Errorf("%w: %v", errs.ErrWebRTCBadOffer, "sdp: invalid syntax"), http.StatusBadRequest, "invalid SDP offer"},
+		{"internal failure", cause, http.StatusInternalServerError, `{"error":"webrtc failed"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, hub, logs := newWHIP(&fakeSFU{err: tc.err})
+			w := whipRequest(r, http.MethodPost, "/whip/"+sessionID, "application/sdp", "v=0\r\n")
+			if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.body) {
+				t.Fatalf("got %d %s, want %d with %s", w.Code, w.Body, tc.code, tc.body)
+			}
+			if strings.Contains(w.Body.String(), cause.Error()) {
+				t.Fatalf("internal cause leaked to the client: %s", w.Body)
+			}
+			if hub.PeerCount(sessionID) != 0 {
+				t.Fatal("hub peer left after a failed publish")
+			}
+			if tc.code == http.StatusInternalServerError {
+				entries := logs.FilterLevelExact(zapcore.WarnLevel).FilterField(zap.Error(cause)).All()
+				if len(entries) != 1 {
+					t.Fatalf("cause logged %d times, want once", len(entries))
+				}
+			}
+		})
+	}
+}
+
+func TestWHIPPublishWhileClientConnected(t *testing.T) {
+	rtc := &fakeSFU{}
+	r, hub, _ := newWHIP(rtc)
+	_, leave, err := hub.Publish(sessionID, clientID, service.TransportRTMP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := whipRequest(r, http.MethodPost, "/whip/"+sessionID, "application/sdp", "v=0\r\n")
+	if w.Code != http.StatusConflict || rtc.calls != 0 {
+		t.Fatalf("got %d with %d SFU calls, want 409 before the offer reaches the SFU", w.Code, rtc.calls)
+	}
+
+	// once the RTMP publisher left, WHIP takes over
+	leave()
+	if w := whipRequest(r, http.MethodPost, "/whip/"+sessionID, "application/sdp", "v=0\r\n"); w.Code != http.StatusCreated {
+		t.Fatalf("publish after the client left: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestWHIPTrickleErrors(t *testing.T) {
+	rtc := &fakeSFU{}
+	r, _, _ := newWHIP(rtc)
+	if w := whipRequest(r, http.MethodPost, "/whip/"+sessionID, "application/sdp", "v=0\r\n"); w.Code != http.StatusCreated {
+		t.Fatalf("publish: %d %s", w.Code, w.Body)
+	}
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("%w: %v", errs.ErrWebRTCBadCandidate, "ice: unknown candidate type"), http.StatusBadRequest},
+		{errs.ErrWebRTCResourceNotFound, http.StatusNotFound},
+		{errors.New("ice: agent closed"), http.StatusInternalServerError},
+	} {
+		rtc.err = tc.err
+		w := whipRequest(r, http.MethodPatch, "/whip/"+sessionID+"/res", "application/trickle-ice-sdpfrag", "a=candidate:x\r\n")
+		if w.Code != tc.code {
+			t.Errorf("%v: got %d, want %d", tc.err, w.Code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package hls
+
+import (
+	"encoding/binary"
+
+	"github.com/psds-microservice/streaming-service/internal/container"
+)
+
+// maxBoxSize bounds a top-level box; a larger (or corrupt) size drops the buffered bytes.
+const maxBoxSize = 64 << 20
+
+// fmp4Splitter cuts a fragmented MP4 byte stream into fragments (moof+mdat, with a preceding styp/sidx/prft/emsg).
+// ftyp+moov is the init segment. A fragment is a keyframe when the first sample of its timing track (the first
+// video track, else the first track) is a sync sample; its duration is that track's sample durations.
+type fmp4Splitter struct {
+	emit     func(unit)
+	emitInit func([]byte)
+
+	buf     []byte
+	ftyp    []byte
+	tracks  map[uint32]*container.Track
+	timing  uint32
+	pending []byte // boxes that belong to the next fragment
+	moof    []byte
+	key     bool
+	dur     float64
+}
+
+func newFMP4Splitter(emit func(unit), emitInit func([]byte)) *fmp4Splitter {
+	return &fmp4Splitter{emit: emit, emitInit: emitInit}
+}
+
+func (s *fmp4Splitter) feed(data []byte) {
+	s.buf = append(s.buf, data...)
+	for len(s.buf) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(s.buf))
+		typ := string(s.buf[4:8])
+		hdr := uint64(8)
+		if size == 1 {
+			if len(s.buf) < 16 {
+				return
+			}
+			size, hdr = binary.BigEndian.Uint64(s.buf[8:]), 16
+		}
+		if size < hdr || size > maxBoxSize {
+			s.buf = nil // not a box boundary: resynchronization is impossible, wait for the next init
+			s.moof, s.pending = nil, nil
+			return
+		}
+		if uint64(len(s.buf)) < size {
+			return
+		}
+		s.box(typ, s.buf[:size], s.buf[hdr:size])
+		s.buf = s.buf[size:]
+	}
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+}
+
+func (s *fmp4Splitter) flush() {}
+
+func (s *fmp4Splitter) box(typ string, box, payload []byte) {
+	switch typ {
+	case "ftyp":
+		s.ftyp = append([]byte(nil), box...)
+	case "moov":
+		s.tracks, s.timing = container.ParseMoov(payload)
+		s.emitInit(append(append([]byte(nil), s.ftyp...), box...))
+		s.moof, s.pending = nil, nil
+	case "styp", "sidx", "prft", "emsg":
+		s.pending = append(s.pending, box...)
+	case "moof":
+		if len(s.tracks) == 0 {
+			return // no init yet
+		}
+		s.key, s.dur = false, 0
+		if f, ok := container.ParseMoof(payload, s.tracks, s.timing); ok {
+			s.key = f.Key
+			if t := s.tracks[s.timing]; t.Timescale > 0 {
+				s.dur = float64(f.Ticks) / float64(t.Timescale)
+			}
+		}
+		s.moof = append(s.pending, box...)
+		s.pending = nil
+	case "mdat":
+		if s.moof == nil {
+			return
+		}
+		s.emit(unit{data: append(s.moof, box...), key: s.key, dur: s.dur})
+		s.moof = nil
+	}
+}
+
+// isFMP4 reports whether data starts with a box that opens a fragmented MP4 stream.
+func isFMP4(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	switch string(data[4:8]) {
+	case "ftyp", "styp", "moov", "moof":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Package hls packages a session's client stream as HLS (LL-HLS when parts are enabled) for operators whose
+// network kills WebSockets. The packager of a session subscribes to StreamHub like an operator, detects
+// MPEG-TS or fragmented MP4 from the first binary frame, cuts segments at keyframes (random access indicator,
+// sync-sample flags) and keeps a bounded window of segments in memory. It starts on the first request for the
+// session and stops once nobody has requested it for Settings.Idle.
+package hls
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// subscriberID is the user ID of the packager's peer in StreamHub (admin views, timeline).
+const subscriberID = "hls"
+
+// Settings configure the packaging.
+type Settings struct {
+	SegmentDuration time.Duration // target; segments are cut at the first keyframe after it
+	PartDuration    time.Duration // LL-HLS part target; 0 serves plain HLS
+	Window          int           // segments listed and held per session
+	MaxBytes        int           // bytes held per session; oldest segments are dropped above it
+	Idle            time.Duration // packager and viewers expire after this long without a request
+}
+
+// Hub is the packaging side of StreamHub.
+type Hub interface {
+	Package(sessionID, userID, transport string) (*service.Peer, func())
+}
+
+// Server holds the packagers and viewers of all sessions.
+type Server struct {
+	hub      Hub
+	settings Settings
+	log      *zap.Logger
+	onLeave  func(sessionID, userID string) error
+
+	mu      sync.Mutex
+	streams map[string]*entry
+	viewers map[viewerKey]*viewer
+}
+
+type entry struct {
+	st       *stream
+	cancel   func()
+	lastSeen time.Time
+}
+
+type viewerKey struct{ sessionID, userID string }
+
+type viewer struct {
+	operator bool
+	lastSeen time.Time
+}
+
+// New creates the server; call Run to expire idle packagers and viewers.
+func New(hub Hub, s Settings, log *zap.Logger) *Server {
+	return &Server{hub: hub, settings: s, log: log, streams: make(map[string]*entry), viewers: make(map[viewerKey]*viewer)}
+}
+
+// OnViewerLeft sets the callback for operators whose playback expired (e.g. SessionService.OperatorLeft).
+func (s *Server) OnViewerLeft(fn func(sessionID, userID string) error) { s.onLeave = fn }
+
+// Viewing reports whether userID is a current viewer of the session, refreshing it.
+func (s *Server) Viewing(sessionID, userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.viewers[viewerKey{sessionID, userID}]
+	if ok {
+		v.lastSeen = time.Now()
+	}
+	return ok
+}
+
+// AddViewer records a viewer admitted by the handler; operators are reported to OnViewerLeft when they expire.
+func (s *Server) AddViewer(sessionID, userID string, operator bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.viewers[viewerKey{sessionID, userID}] = &viewer{operator: operator, lastSeen: time.Now()}
+}
+
+// Playlist returns the session's media playlist, starting its packager if needed. msn and part are the
+// LL-HLS blocking reload parameters (_HLS_msn, _HLS_part), -1 when absent; query is appended to every URI.
+func (s *Server) Playlist(ctx context.Context, sessionID string, msn, part int, query string) ([]byte, error) {
+	return s.stream(sessionID, true).playlist(ctx, msn, part, query)
+}
+
+// File returns a segment, part or init segment of a running packager and its content type.
+func (s *Server) File(sessionID, name string) ([]byte, string, error) {
+	st := s.stream(sessionID, false)
+	if st == nil {
+		return nil, "", errs.ErrHLSFileNotFound
+	}
+	return st.file(name)
+}
+
+// Run expires idle packagers and viewers until ctx is cancelled, then stops every packager.
+func (s *Server) Run(ctx context.Context) {
+	t := time.NewTicker(max(s.settings.Idle/4, time.Second))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.sweep(time.Time{})
+			return
+		case now := <-t.C:
+			s.sweep(now.Add(-s.settings.Idle))
+		}
+	}
+}
+
+// stream returns the session's packager, starting it when start is set.
+func (s *Server) stream(sessionID string, start bool) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.streams[sessionID]; ok {
+		e.lastSeen = time.Now()
+		return e.st
+	}
+	if !start {
+		return nil
+	}
+	st := newStream(sessionID, s.settings)
+	peer, cleanup := s.hub.Package(sessionID, subscriberID, service.TransportHLS)
+	var once sync.Once
+	stop := func() { once.Do(cleanup) }
+	s.streams[sessionID] = &entry{st: st, cancel: stop, lastSeen: time.Now()}
+	go func() {
+		for msg := range peer.Send {
+			st.frame(msg.Type, msg.Data)
+		}
+		st.end() // session closed or packager stopped: the playlist gets EXT-X-ENDLIST
+		stop()
+	}()
+	s.log.Info("hls packager started", zap.String("session_id", sessionID))
+	return st
+}
+
+// sweep stops packagers and expires viewers not seen since before; zero before expires everything.
+func (s *Server) sweep(before time.Time) {
+	var left []viewerKey
+	s.mu.Lock()
+	for id, e := range s.streams {
+		if before.IsZero() || e.lastSeen.Before(before) {
+			delete(s.streams, id)
+			e.cancel()
+			s.log.Info("hls packager stopped", zap.String("session_id", id))
+		}
+	}
+	for k, v := range s.viewers {
+		if before.IsZero() || v.lastSeen.Before(before) {
+			delete(s.viewers, k)
+			if v.operator {
+				left = append(left, k)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if s.onLeave == nil {
+		return
+	}
+	for _, k := range left {
+		if err := s.onLeave(k.sessionID, k.userID); err != nil {
+			s.log.Warn("hls: failed to record operator leave", zap.String("session_id", k.sessionID), zap.Error(err))
+		}
+	}
+}
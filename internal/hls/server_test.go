@@ -0,0 +1,90 @@
+package hls
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// fakeHub hands out packager peers; the cleanup closes the peer's Send like StreamHub does.
+type fakeHub struct {
+	mu       sync.Mutex
+	packaged []string
+	cleaned  []string
+}
+
+func (h *fakeHub) Package(sessionID, userID, transport string) (*service.Peer, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.packaged = append(h.packaged, sessionID+":"+userID+":"+transport)
+	peer := &service.Peer{SessionID: sessionID, UserID: userID, Send: make(chan service.Message, 8)}
+	return peer, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.cleaned = append(h.cleaned, sessionID)
+		close(peer.Send)
+	}
+}
+
+func (h *fakeHub) calls() (packaged, cleaned []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.packaged...), append([]string(nil), h.cleaned...)
+}
+
+func TestServerSweepsIdlePackagersAndViewers(t *testing.T) {
+	hub := &fakeHub{}
+	s := New(hub, Settings{SegmentDuration: time.Second, Window: 3, MaxBytes: 1 << 20, Idle: time.Minute}, zap.NewNop())
+	var left []string
+	s.OnViewerLeft(func(sessionID, userID string) error {
+		left = append(left, sessionID+":"+userID)
+		return nil
+	})
+
+	st := s.stream("s1", true)
+	if again := s.stream("s1", true); again != st {
+		t.Fatal("a second request started another packager")
+	}
+	s.AddViewer("s1", "operator", true)
+	s.AddViewer("s1", "client", false)
+
+	s.sweep(time.Now().Add(-time.Minute)) // everything was seen within the idle time
+	if packaged, cleaned := hub.calls(); len(packaged) != 1 || packaged[0] != "s1:hls:"+service.TransportHLS || len(cleaned) != 0 {
+		t.Fatalf("packaged %v, cleaned %v; want one running packager", packaged, cleaned)
+	}
+	if !s.Viewing("s1", "operator") || !s.Viewing("s1", "client") || len(left) != 0 {
+		t.Fatal("viewers expired before the idle time")
+	}
+
+	s.sweep(time.Now().Add(time.Second)) // idle
+	if _, cleaned := hub.calls(); len(cleaned) != 1 || cleaned[0] != "s1" {
+		t.Fatalf("cleaned %v, want the idle packager stopped", cleaned)
+	}
+	if s.stream("s1", false) != nil {
+		t.Fatal("the idle packager is still served")
+	}
+	if s.Viewing("s1", "operator") || s.Viewing("s1", "client") {
+		t.Fatal("idle viewers are still enrolled")
+	}
+	if len(left) != 1 || left[0] != "s1:operator" {
+		t.Fatalf("left %v, want only the operator reported", left)
+	}
+
+	// the stopped packager ends its playlist
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st.mu.Lock()
+		ended := st.ended
+		st.mu.Unlock()
+		if ended {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stopped packager's stream did not end")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,387 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/container"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+)
+
+// unknownFrameLimit: binary frames that are neither MPEG-TS nor fMP4 before the stream is reported unsupported.
+const unknownFrameLimit = 16
+
+// unit is what the splitters emit: an access unit (MPEG-TS) or a fragment (fMP4).
+type unit struct {
+	data []byte
+	key  bool
+	dur  float64 // seconds
+}
+
+type splitter interface {
+	feed(data []byte)
+	flush()
+}
+
+type part struct {
+	data        []byte
+	dur         float64
+	independent bool
+}
+
+type segment struct {
+	msn     int
+	parts   []part
+	dur     float64
+	size    int
+	initVer int
+	disc    bool // the init segment changed before this segment
+}
+
+// stream packages one session: the HLS subscriber's frames are split and grouped into parts and segments.
+type stream struct {
+	sessionID string
+	settings  Settings
+
+	mu       sync.Mutex
+	changed  chan struct{} // closed and replaced on every new part or segment
+	format   string        // "ts", "fmp4"; "" until detected
+	unknown  int
+	split    splitter
+	header   func() []byte // MPEG-TS: PAT+PMT prepended to every segment
+	init     []byte
+	initVer  int
+	segments []*segment // complete, oldest first
+	cur      *segment   // in progress
+	partBuf  []byte
+	partDur  float64
+	partInd  bool
+	nextMSN  int
+	size     int // bytes held
+	maxPart  float64
+	ended    bool
+}
+
+func newStream(sessionID string, s Settings) *stream {
+	return &stream{sessionID: sessionID, settings: s, changed: make(chan struct{})}
+}
+
+// frame feeds a relayed frame; text frames (control messages) are ignored.
+func (st *stream) frame(messageType int, data []byte) {
+	if messageType != websocket.BinaryMessage || len(data) == 0 {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.split == nil && !st.detect(data) {
+		return
+	}
+	st.split.feed(data)
+}
+
+// detect picks the splitter from the first frame; st.mu must be held.
+func (st *stream) detect(data []byte) bool {
+	switch {
+	case data[0] == container.SyncByte:
+		ts := newTSSplitter(st.add)
+		st.split, st.header, st.format = ts, ts.header, "ts"
+	case isFMP4(data):
+		st.split = newFMP4Splitter(st.add, st.setInit)
+		st.format = "fmp4"
+	default:
+		st.unknown++
+		if st.unknown == unknownFrameLimit {
+			st.notify()
+		}
+		return false
+	}
+	return true
+}
+
+// end marks the end of the stream (the subscription was closed).
+func (st *stream) end() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.split != nil {
+		st.split.flush()
+	}
+	if st.cur != nil {
+		st.closePart()
+		st.closeSegment()
+	}
+	st.ended = true
+	st.notify()
+}
+
+func (st *stream) setInit(init []byte) {
+	if bytes.Equal(init, st.init) {
+		return
+	}
+	st.size += len(init) - len(st.init)
+	st.init = init
+	st.initVer++
+	if st.cur != nil {
+		// the next fragment belongs to the new init: cut here
+		st.closePart()
+		st.closeSegment()
+	}
+}
+
+// add groups a unit into the current part and segment; st.mu must be held.
+func (st *stream) add(u unit) {
+	target := st.settings.SegmentDuration.Seconds()
+	if st.format == "fmp4" && st.init == nil {
+		return
+	}
+	switch {
+	case st.cur == nil:
+		if !u.key {
+			return // a segment must start with a keyframe
+		}
+		st.openSegment()
+	case u.key && st.cur.dur+st.partDur >= target,
+		st.cur.dur+st.partDur >= 4*target: // keyframes too rare: cut anyway to keep retention bounded
+		st.closePart()
+		st.closeSegment()
+		st.openSegment()
+	}
+	if len(st.partBuf) == 0 {
+		st.partInd = u.key
+		if len(st.cur.parts) == 0 && st.header != nil {
+			st.partBuf = append(st.partBuf, st.header()...)
+		}
+	}
+	st.partBuf = append(st.partBuf, u.data...)
+	st.partDur += u.dur
+	if pt := st.settings.PartDuration.Seconds(); pt > 0 && st.partDur >= pt {
+		st.closePart()
+	}
+}
+
+func (st *stream) openSegment() {
+	disc := len(st.segments) > 0 && st.segments[len(st.segments)-1].initVer != st.initVer
+	st.cur = &segment{msn: st.nextMSN, initVer: st.initVer, disc: disc}
+	st.nextMSN++
+}
+
+func (st *stream) closePart() {
+	if len(st.partBuf) == 0 {
+		return
+	}
+	p := part{data: st.partBuf, dur: st.partDur, independent: st.partInd}
+	st.cur.parts = append(st.cur.parts, p)
+	st.cur.dur += p.dur
+	st.cur.size += len(p.data)
+	st.size += len(p.data)
+	st.maxPart = max(st.maxPart, p.dur)
+	st.partBuf, st.partDur, st.partInd = nil, 0, false
+	st.notify()
+}
+
+func (st *stream) closeSegment() {
+	if len(st.cur.parts) > 0 {
+		st.segments = append(st.segments, st.cur)
+	}
+	st.cur = nil
+	for len(st.segments) > 1 && (len(st.segments) > st.settings.Window || st.size > st.settings.MaxBytes) {
+		st.size -= st.segments[0].size
+		st.segments = st.segments[1:]
+	}
+	st.notify()
+}
+
+func (st *stream) notify() {
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// playlist renders the media playlist. With msn >= 0 it blocks (LL-HLS blocking reload) until segment msn
+// (part when >= 0) is available, the stream ends or ctx is done; without segments it waits for the first one.
+func (st *stream) playlist(ctx context.Context, msn, partIdx int, query string) ([]byte, error) {
+	timeout := time.NewTimer(3 * st.settings.SegmentDuration)
+	defer timeout.Stop()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if msn >= 0 && msn > st.nextMSN+1 {
+		return nil, errs.ErrHLSBadRequest
+	}
+	for {
+		if st.unknown >= unknownFrameLimit && st.split == nil {
+			return nil, errs.ErrHLSUnsupported
+		}
+		if st.ended || st.playable() && (msn < 0 || st.has(msn, partIdx)) {
+			break
+		}
+		ch := st.changed
+		st.mu.Unlock()
+		select {
+		case <-ch:
+			st.mu.Lock()
+			continue
+		case <-ctx.Done():
+		case <-timeout.C:
+		}
+		st.mu.Lock()
+		break
+	}
+	if !st.playable() {
+		return nil, errs.ErrHLSNotReady
+	}
+	return st.render(query), nil
+}
+
+// playable reports whether the playlist would list anything; st.mu must be held.
+func (st *stream) playable() bool {
+	return len(st.segments) > 0 || st.settings.PartDuration > 0 && st.cur != nil && len(st.cur.parts) > 0
+}
+
+// has reports whether segment msn (or its part partIdx, when >= 0) is available; st.mu must be held.
+func (st *stream) has(msn, partIdx int) bool {
+	if st.cur != nil && st.cur.msn == msn {
+		return partIdx >= 0 && partIdx < len(st.cur.parts)
+	}
+	return len(st.segments) > 0 && st.segments[len(st.segments)-1].msn >= msn
+}
+
+// render writes the playlist; st.mu must be held.
+func (st *stream) render(query string) []byte {
+	ext := st.ext()
+	target := st.settings.SegmentDuration.Seconds()
+	for _, s := range st.segments {
+		target = max(target, s.dur)
+	}
+	partTarget := max(st.settings.PartDuration.Seconds(), st.maxPart)
+	ll := st.settings.PartDuration > 0
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	switch {
+	case ll:
+		b.WriteString("#EXT-X-VERSION:9\n")
+	case st.format == "fmp4":
+		b.WriteString("#EXT-X-VERSION:7\n")
+	default:
+		b.WriteString("#EXT-X-VERSION:3\n")
+	}
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	first := 0
+	if len(st.segments) > 0 {
+		first = st.segments[0].msn
+	} else if st.cur != nil {
+		first = st.cur.msn
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	if ll {
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+		fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	}
+
+	all := st.segments
+	if st.cur != nil && len(st.cur.parts) > 0 && ll {
+		all = append(all[:len(all):len(all)], st.cur)
+	}
+	initVer := -1
+	for i, s := range all {
+		if st.format == "fmp4" && s.initVer != initVer {
+			if s.disc && i > 0 {
+				b.WriteString("#EXT-X-DISCONTINUITY\n")
+			}
+			fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init%d.mp4%s\"\n", s.initVer, query)
+			initVer = s.initVer
+		}
+		// parts are listed for the last segments only (LL-HLS: about three target durations)
+		if ll && i >= len(all)-3 {
+			for j, p := range s.parts {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.%d.%s%s\"", p.dur, s.msn, j, ext, query)
+				if p.independent {
+					b.WriteString(",INDEPENDENT=YES")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if s == st.cur {
+			break
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\nseg%d.%s%s\n", s.dur, s.msn, ext, query)
+	}
+	if st.ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return []byte(b.String())
+}
+
+func (st *stream) ext() string {
+	if st.format == "fmp4" {
+		return "m4s"
+	}
+	return "ts"
+}
+
+// file returns a segment, part or init segment by name and its content type.
+func (st *stream) file(name string) ([]byte, string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var msn, idx, ver int
+	ext := st.ext()
+	ctype := "video/mp2t"
+	if ext == "m4s" {
+		ctype = "video/iso.segment"
+	}
+	switch {
+	case scan(name, "init%d.mp4", &ver) && st.format == "fmp4":
+		if ver != st.initVer || st.init == nil {
+			return nil, "", errs.ErrHLSFileNotFound
+		}
+		return st.init, "video/mp4", nil
+	case scan(name, "part%d.%d."+ext, &msn, &idx):
+		s := st.segment(msn)
+		if s == nil || idx < 0 || idx >= len(s.parts) {
+			return nil, "", errs.ErrHLSFileNotFound
+		}
+		return s.parts[idx].data, ctype, nil
+	case scan(name, "seg%d."+ext, &msn):
+		s := st.segment(msn)
+		if s == nil || s == st.cur {
+			return nil, "", errs.ErrHLSFileNotFound
+		}
+		out := make([]byte, 0, s.size)
+		for _, p := range s.parts {
+			out = append(out, p.data...)
+		}
+		return out, ctype, nil
+	}
+	return nil, "", errs.ErrHLSFileNotFound
+}
+
+// segment finds a held segment (complete or in progress); st.mu must be held.
+func (st *stream) segment(msn int) *segment {
+	if st.cur != nil && st.cur.msn == msn {
+		return st.cur
+	}
+	for _, s := range st.segments {
+		if s.msn == msn {
+			return s
+		}
+	}
+	return nil
+}
+
+// scan matches name against format exactly.
+func scan(name, format string, args ...any) bool {
+	n, err := fmt.Sscanf(name, format, args...)
+	return err == nil && n == len(args) && fmt.Sprintf(format, derefInts(args)...) == name
+}
+
+func derefInts(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = *a.(*int)
+	}
+	return out
+}
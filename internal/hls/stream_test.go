@@ -0,0 +1,325 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/container"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+)
+
+const (
+	testPMTPID   = 0x100
+	testVideoPID = 0x101
+)
+
+// tsPacket builds one MPEG-TS packet: payload after an optional adaptation field carrying the random access
+// indicator, padded with 0xff.
+func tsPacket(pid int, pusi, rai bool, payload []byte) []byte {
+	p := make([]byte, container.PacketSize)
+	for i := range p {
+		p[i] = 0xff
+	}
+	p[0] = container.SyncByte
+	p[1] = byte(pid >> 8 & 0x1f)
+	if pusi {
+		p[1] |= 0x40
+	}
+	p[2] = byte(pid)
+	p[3] = 0x10
+	off := 4
+	if rai {
+		p[3] = 0x30
+		p[4], p[5] = 1, 0x40
+		off = 6
+	}
+	copy(p[off:], payload)
+	return p
+}
+
+// tsHeader returns a PAT pointing at testPMTPID and a PMT with one H.264 stream on testVideoPID.
+func tsHeader() []byte {
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe0 | testPMTPID>>8, testPMTPID & 0xff, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 18, 0, 1, 0xc1, 0, 0, 0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0,
+		0x1b, 0xe0 | testVideoPID>>8, testVideoPID & 0xff, 0xf0, 0, 0, 0, 0, 0}
+	return append(tsPacket(0, true, false, pat), tsPacket(testPMTPID, true, false, pmt)...)
+}
+
+// tsFrame returns one access unit on testVideoPID: a PES packet with pts (90 kHz) and a continuation packet.
+func tsFrame(key bool, pts int64) []byte {
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14 | 1), byte(pts >> 7), byte(pts<<1 | 1)}
+	return append(tsPacket(testVideoPID, true, key, pes), tsPacket(testVideoPID, false, false, nil)...)
+}
+
+// feedUnits adds n units of 0.5 s with a keyframe every keyEvery units (only the first when keyEvery is 0).
+func feedUnits(st *stream, from, n, keyEvery int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.format == "" {
+		st.format = "ts"
+	}
+	for i := from; i < from+n; i++ {
+		key := i == 0 || keyEvery > 0 && i%keyEvery == 0
+		st.add(unit{data: []byte{byte(i)}, key: key, dur: 0.5})
+	}
+}
+
+func TestStreamSegmentsAtKeyframes(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   time.Duration
+		units    int
+		keyEvery int
+		want     []float64 // durations of the complete segments
+	}{
+		{"cut at the first keyframe after the target", 2 * time.Second, 13, 3, []float64{3, 3}},
+		{"keyframe on the target", 2 * time.Second, 9, 4, []float64{2, 2}},
+		{"no keyframe before the target", 2 * time.Second, 5, 6, nil},
+		{"keyframes too rare: cut at four targets", time.Second, 10, 0, []float64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newStream("s1", Settings{SegmentDuration: tt.target, Window: 10, MaxBytes: 1 << 20})
+			feedUnits(st, 0, tt.units, tt.keyEvery)
+			var got []float64
+			for _, s := range st.segments {
+				got = append(got, s.dur)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("segments %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("segments %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamDropsUnitsBeforeFirstKeyframe(t *testing.T) {
+	st := newStream("s1", Settings{SegmentDuration: time.Second, Window: 10, MaxBytes: 1 << 20})
+	st.mu.Lock()
+	st.format = "ts"
+	st.add(unit{data: []byte{1}, dur: 0.5})
+	st.add(unit{data: []byte{2}, dur: 0.5})
+	st.add(unit{data: []byte{3}, key: true, dur: 0.5})
+	st.mu.Unlock()
+	st.end()
+	if len(st.segments) != 1 || string(st.segments[0].parts[0].data) != "\x03" {
+		t.Fatalf("segments %+v, want one starting at the keyframe", st.segments)
+	}
+}
+
+func TestStreamCutsMPEGTSAtRandomAccessIndicator(t *testing.T) {
+	st := newStream("s1", Settings{SegmentDuration: 2 * time.Second, Window: 10, MaxBytes: 1 << 20})
+	st.frame(websocket.BinaryMessage, tsHeader())
+	// 0.5 s frames, a keyframe every 1.5 s: segments are cut at 3 s and 6 s
+	for i := range 14 {
+		st.frame(websocket.BinaryMessage, tsFrame(i%3 == 0, int64(i)*container.PTSClock/2))
+	}
+	if len(st.segments) != 2 {
+		t.Fatalf("%d segments, want 2", len(st.segments))
+	}
+	for _, s := range st.segments {
+		if s.dur != 3 {
+			t.Fatalf("segment %d lasts %.3f s, want 3", s.msn, s.dur)
+		}
+		data, ctype, err := st.file(fmt.Sprintf("seg%d.ts", s.msn))
+		if err != nil || ctype != "video/mp2t" {
+			t.Fatalf("seg%d: %s, %v", s.msn, ctype, err)
+		}
+		if len(data) < 3*container.PacketSize || string(data[:2*container.PacketSize]) != string(tsHeader()) {
+			t.Fatalf("seg%d does not start with PAT and PMT", s.msn)
+		}
+		if pkt := container.ParsePacket(data[2*container.PacketSize:]); pkt.PID != testVideoPID || !pkt.RAI {
+			t.Fatalf("seg%d does not start with a keyframe: %+v", s.msn, pkt)
+		}
+	}
+}
+
+func TestStreamPlaylist(t *testing.T) {
+	plain := Settings{SegmentDuration: 2 * time.Second, Window: 10, MaxBytes: 1 << 20}
+	ll := plain
+	ll.PartDuration = time.Second
+	tests := []struct {
+		name     string
+		settings Settings
+		units    int
+		end      bool
+		want     string
+	}{
+		{
+			name:     "plain HLS lists complete segments",
+			settings: plain,
+			units:    9,
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:2.000,
+seg0.ts?token=t
+#EXTINF:2.000,
+seg1.ts?token=t
+`,
+		},
+		{
+			name:     "window drops the oldest segments",
+			settings: Settings{SegmentDuration: 2 * time.Second, Window: 2, MaxBytes: 1 << 20},
+			units:    13,
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:1
+#EXTINF:2.000,
+seg1.ts?token=t
+#EXTINF:2.000,
+seg2.ts?token=t
+`,
+		},
+		{
+			name:     "ended stream",
+			settings: plain,
+			units:    9,
+			end:      true,
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:2.000,
+seg0.ts?token=t
+#EXTINF:2.000,
+seg1.ts?token=t
+#EXTINF:0.500,
+seg2.ts?token=t
+#EXT-X-ENDLIST
+`,
+		},
+		{
+			name:     "LL-HLS lists parts of the segment in progress",
+			settings: ll,
+			units:    11,
+			want: `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=3.000
+#EXT-X-PART-INF:PART-TARGET=1.000
+#EXT-X-PART:DURATION=1.000,URI="part0.0.ts?token=t",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.000,URI="part0.1.ts?token=t"
+#EXTINF:2.000,
+seg0.ts?token=t
+#EXT-X-PART:DURATION=1.000,URI="part1.0.ts?token=t",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.000,URI="part1.1.ts?token=t"
+#EXTINF:2.000,
+seg1.ts?token=t
+#EXT-X-PART:DURATION=1.000,URI="part2.0.ts?token=t",INDEPENDENT=YES
+`,
+		},
+		{
+			name:     "LL-HLS lists parts of the last three segments only",
+			settings: ll,
+			units:    19,
+			want: `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=3.000
+#EXT-X-PART-INF:PART-TARGET=1.000
+#EXTINF:2.000,
+seg0.ts?token=t
+#EXTINF:2.000,
+seg1.ts?token=t
+#EXT-X-PART:DURATION=1.000,URI="part2.0.ts?token=t",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.000,URI="part2.1.ts?token=t"
+#EXTINF:2.000,
+seg2.ts?token=t
+#EXT-X-PART:DURATION=1.000,URI="part3.0.ts?token=t",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.000,URI="part3.1.ts?token=t"
+#EXTINF:2.000,
+seg3.ts?token=t
+#EXT-X-PART:DURATION=1.000,URI="part4.0.ts?token=t",INDEPENDENT=YES
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newStream("s1", tt.settings)
+			feedUnits(st, 0, tt.units, 4)
+			if tt.end {
+				st.end()
+			}
+			got, err := st.playlist(context.Background(), -1, -1, "?token=t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("playlist:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamPlaylistBlockingReload(t *testing.T) {
+	st := newStream("s1", Settings{SegmentDuration: 2 * time.Second, PartDuration: time.Second, Window: 10, MaxBytes: 1 << 20})
+	feedUnits(st, 0, 2, 4) // part 0.0
+
+	done := make(chan string, 1)
+	go func() {
+		got, err := st.playlist(context.Background(), 0, 1, "")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		done <- string(got)
+	}()
+	select {
+	case got := <-done:
+		t.Fatalf("returned before part 0.1 existed:\n%s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	feedUnits(st, 2, 2, 4) // part 0.1
+	select {
+	case got := <-done:
+		if !strings.Contains(got, `URI="part0.1.ts"`) {
+			t.Fatalf("playlist without the awaited part:\n%s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocking reload did not return after the part was added")
+	}
+
+	// a segment two ahead of the next one can never be awaited
+	if _, err := st.playlist(context.Background(), st.nextMSN+2, -1, ""); !errors.Is(err, errs.ErrHLSBadRequest) {
+		t.Fatalf("msn beyond the next segment: %v, want ErrHLSBadRequest", err)
+	}
+
+	// a request cancelled while waiting gets the current playlist
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, err := st.playlist(ctx, 1, -1, "") // segment 1 has not started
+	if err != nil || !strings.Contains(string(got), `URI="part0.1.ts"`) {
+		t.Fatalf("cancelled reload: %v\n%s", err, got)
+	}
+}
+
+func TestStreamPlaylistNotReady(t *testing.T) {
+	st := newStream("s1", Settings{SegmentDuration: 2 * time.Second, Window: 10, MaxBytes: 1 << 20})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := st.playlist(ctx, -1, -1, ""); !errors.Is(err, errs.ErrHLSNotReady) {
+		t.Fatalf("playlist without segments: %v, want ErrHLSNotReady", err)
+	}
+
+	for range unknownFrameLimit {
+		st.frame(websocket.BinaryMessage, []byte("not a container"))
+	}
+	if _, err := st.playlist(context.Background(), -1, -1, ""); !errors.Is(err, errs.ErrHLSUnsupported) {
+		t.Fatalf("playlist of an unknown format: %v, want ErrHLSUnsupported", err)
+	}
+}
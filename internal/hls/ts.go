@@ -0,0 +1,110 @@
+package hls
+
+import (
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/container"
+)
+
+// tsSplitter cuts an MPEG-TS byte stream into access units of the timing stream (the first video stream of
+// the PMT, or its first stream). A unit is every packet from one PES start of that stream to the next; it is a
+// keyframe when its first packet carries the random access indicator. PAT and PMT are kept as the header every
+// segment starts with.
+type tsSplitter struct {
+	emit func(unit)
+
+	buf       []byte
+	pmtPID    int
+	timingPID int
+	pat, pmt  []byte
+
+	cur     []byte
+	curKey  bool
+	curPTS  int64 // -1: no PTS, durations fall back to arrival time
+	curTime time.Time
+	lastDur float64
+}
+
+func newTSSplitter(emit func(unit)) *tsSplitter {
+	return &tsSplitter{emit: emit, pmtPID: -1, timingPID: -1, curPTS: -1}
+}
+
+// header returns the PAT and PMT packets, nil until both were seen.
+func (s *tsSplitter) header() []byte {
+	if s.pat == nil || s.pmt == nil {
+		return nil
+	}
+	return append(append([]byte(nil), s.pat...), s.pmt...)
+}
+
+func (s *tsSplitter) feed(data []byte) {
+	s.buf = append(s.buf, data...)
+	for len(s.buf) >= container.PacketSize {
+		if s.buf[0] != container.SyncByte {
+			i := 1
+			for i < len(s.buf) && s.buf[i] != container.SyncByte {
+				i++
+			}
+			s.buf = s.buf[i:]
+			continue
+		}
+		s.packet(s.buf[:container.PacketSize])
+		s.buf = s.buf[container.PacketSize:]
+	}
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+}
+
+// flush emits the unit in progress (end of stream).
+func (s *tsSplitter) flush() {
+	if len(s.cur) > 0 {
+		s.emit(unit{data: s.cur, key: s.curKey, dur: s.lastDur})
+		s.cur = nil
+	}
+}
+
+func (s *tsSplitter) packet(p []byte) {
+	pkt := container.ParsePacket(p)
+	switch {
+	case pkt.PID == 0:
+		if pkt.PUSI {
+			if pid, ok := container.ParsePAT(pkt.Payload); ok {
+				s.pmtPID = pid
+			}
+			s.pat = append(s.pat[:0], p...)
+		}
+		return
+	case pkt.PID == s.pmtPID:
+		if pkt.PUSI {
+			if pid, ok := container.ParsePMT(pkt.Payload); ok {
+				s.timingPID = pid
+			}
+			s.pmt = append(s.pmt[:0], p...)
+		}
+		return
+	}
+
+	if pkt.PID == s.timingPID && pkt.PUSI && container.PESStart(pkt.Payload) {
+		s.startUnit(pkt.RAI, container.PESPTS(pkt.Payload))
+	}
+	if s.curTime.IsZero() {
+		return // before the first access unit: not decodable
+	}
+	s.cur = append(s.cur, p...)
+}
+
+func (s *tsSplitter) startUnit(key bool, pts int64) {
+	now := time.Now()
+	if len(s.cur) > 0 {
+		dur := now.Sub(s.curTime).Seconds()
+		if pts >= 0 && s.curPTS >= 0 {
+			if d := float64((pts-s.curPTS+container.PTSWrap)%container.PTSWrap) / container.PTSClock; d < 10 {
+				dur = d
+			}
+		}
+		s.lastDur = dur
+		s.emit(unit{data: s.cur, key: s.curKey, dur: dur})
+	}
+	s.cur, s.curKey, s.curPTS, s.curTime = nil, key, pts, now
+}
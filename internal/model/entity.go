@@ -1,16 +1,24 @@
 package model
 
-import "time"
+import (
+	"time"
+)
 
 // StreamingSession — сущность сессии трансляции (GORM).
 type StreamingSession struct {
-	ID         string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ClientID   string     `gorm:"type:uuid;not null;index"`
-	StreamKey  string     `gorm:"size:64;not null;uniqueIndex"`
-	Status     string     `gorm:"size:20;not null;default:waiting"` // waiting, active, finished
-	CreatedAt  time.Time  `gorm:"autoCreateTime"`
-	UpdatedAt  time.Time  `gorm:"autoUpdateTime"`
-	FinishedAt *time.Time `gorm:"column:finished_at"`
+	ID                      string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ClientID                string     `gorm:"type:uuid;not null;index"`
+	StreamKey               string     `gorm:"size:64;not null;uniqueIndex"`
+	Status                  string     `gorm:"size:20;not null;default:waiting"`                   // waiting, active, finished
+	RecordingMode           string     `gorm:"column:recording_mode;size:10;not null;default:off"` // off, on, paused
+	RecordingURL            *string    `gorm:"column:recording_url"`
+	RecordingStatus         string     `gorm:"column:recording_status;size:20;not null;default:none"` // none, pending, finished, failed
+	RecordingError          *string    `gorm:"column:recording_error"`
+	RecordingSinks          string     `gorm:"column:recording_sinks;size:255;not null;default:''"` // comma-separated; empty = all sinks
+	SessionManagerSessionID *string    `gorm:"column:session_manager_session_id;size:64;index"`     // linked session-manager session
+	CreatedAt               time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt               time.Time  `gorm:"autoUpdateTime"`
+	FinishedAt              *time.Time `gorm:"column:finished_at"`
 
 	Operators []SessionOperator `gorm:"foreignKey:SessionID"`
 }
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// EventType is a session lifecycle event type (webhooks, outbox).
+type EventType string
+
+const (
+	EventSessionCreated  EventType = "session.created"
+	EventSessionActive   EventType = "session.active"
+	EventOperatorJoined  EventType = "operator.joined"
+	EventOperatorLeft    EventType = "operator.left"
+	EventSessionFinished EventType = "session.finished"
+	// EventRecordingFinished is written when a recording is finalized; for a live recording that is right
+	// after session.finished, for a spooled one after the upload.
+	EventRecordingFinished EventType = "recording.finished"
+)
+
+// EventTypes lists all known event types (for validating subscriptions).
+var EventTypes = []EventType{
+	EventSessionCreated,
+	EventSessionActive,
+	EventOperatorJoined,
+	EventOperatorLeft,
+	EventSessionFinished,
+	EventRecordingFinished,
+}
+
+// Event is the envelope delivered to webhook subscribers.
+type Event struct {
+	ID         string           `json:"id"`
+	Type       EventType        `json:"type"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	SessionID  string           `json:"session_id"`
+	Data       SessionEventData `json:"data"`
+}
+
+// SessionEventData is the event payload; fields not relevant to the event type are omitted.
+type SessionEventData struct {
+	ClientID     string        `json:"client_id,omitempty"`
+	Status       SessionStatus `json:"status,omitempty"`
+	UserID       string        `json:"user_id,omitempty"`
+	RecordingURL string        `json:"recording_url,omitempty"`
+}
@@ -0,0 +1,34 @@
+package model
+
+// FrameAck is the event an operator sends over /ws/stream/:session_id/:user_id to report when it received a
+// timed frame (version 2 track header). Operators may acknowledge every frame or a sample of them.
+const FrameAck = "frame_ack"
+
+// FrameAckMessage reports the receipt of a timed frame.
+type FrameAckMessage struct {
+	Event      string `json:"event"`
+	TrackID    int    `json:"track_id"`    // the frame header's track (0 without declared tracks)
+	Seq        uint32 `json:"seq"`         // the frame header's sequence number
+	ReceivedAt int64  `json:"received_at"` // µs since the Unix epoch, operator clock
+}
+
+// LatencyStats summarizes a latency over the frames it was measured on.
+type LatencyStats struct {
+	Samples int64   `json:"samples"`
+	LastMs  float64 `json:"last_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// FrameStats are the timed frame figures of the session client's stream (ingress) or of an operator.
+type FrameStats struct {
+	Frames    int64   `json:"frames"`     // ingress: frames received; operator: frames it acknowledged (frame_ack)
+	Lost      int64   `json:"lost"`       // ingress: sequence gaps; operator: sequence gaps in its frame_ack receipts
+	LossRatio float64 `json:"loss_ratio"` // lost / (frames + lost)
+	// Uplink is ingress − capture time (ingress only); Hub is egress − ingress time (WebSocket operators);
+	// GlassToGlass is the reported receive time − capture time (operators that send frame_ack).
+	// Capture and receive times come from the peers' clocks, which must be synchronized (NTP).
+	Uplink       *LatencyStats `json:"uplink,omitempty"`
+	Hub          *LatencyStats `json:"hub,omitempty"`
+	GlassToGlass *LatencyStats `json:"glass_to_glass,omitempty"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// BreakerState is the readiness view of a circuit breaker around a downstream service.
+type BreakerState struct {
+	Name                string    `json:"name"`
+	State               string    `json:"state"` // closed, half-open, open
+	ConsecutiveFailures uint32    `json:"consecutive_failures"`
+	Since               time.Time `json:"since"` // last state change (process start if never changed)
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// ReadyResponse is the response for GET /ready: "ready", or "degraded" while a breaker is not closed
+// (the service still accepts traffic and falls back for the broken dependency).
+type ReadyResponse struct {
+	Status   string         `json:"status"`
+	Breakers []BreakerState `json:"breakers,omitempty"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// HubPeer is the admin view of a live connection in StreamHub.
+type HubPeer struct {
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	Transport   string    `json:"transport"` // websocket, hls, rtmp, whip, whep, sse or http
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	QueueDepth  int       `json:"queue_depth"`
+	QueueCap    int       `json:"queue_cap"`
+	// Unsubscribed lists the tracks an operator opted out of (track_unsubscribe).
+	Unsubscribed []int `json:"unsubscribed_tracks,omitempty"`
+	// Frames are the timed frame figures of an operator; absent until it got one.
+	Frames *FrameStats `json:"frames,omitempty"`
+}
+
+// HubSession is the admin view of a session that has live connections in StreamHub.
+type HubSession struct {
+	SessionID string  `json:"session_id"`
+	Tracks    []Track `json:"tracks,omitempty"` // declared by the client
+	// SnapshotAt is when the client pushed its latest snapshot (GET /sessions/:id/snapshot).
+	SnapshotAt *time.Time `json:"snapshot_at,omitempty"`
+	// Ingress are the timed frame figures of the client's stream; absent until the hub got one.
+	Ingress *FrameStats `json:"ingress,omitempty"`
+	Peers   []HubPeer   `json:"peers"`
+}
+
+// HubSessionsResponse is the response for GET /admin/sessions.
+type HubSessionsResponse struct {
+	Sessions []HubSession `json:"sessions"`
+}
+
+// AdminDisconnectRequest is the request body for DELETE /admin/sessions/:id/peers/:user_id.
+type AdminDisconnectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminFinishRequest is the request body for POST /admin/sessions/:id/finish.
+type AdminFinishRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminBroadcastRequest is the request body for POST /admin/sessions/:id/broadcast.
+type AdminBroadcastRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// AdminActionResponse is returned by admin intervention endpoints.
+type AdminActionResponse struct {
+	SessionID string `json:"session_id"`
+	Affected  int    `json:"affected"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Session-manager notification statuses.
+const (
+	NotificationPending = "pending"
+	NotificationDone    = "done"
+	NotificationFailed  = "failed"
+	// NotificationSuperseded: a newer status push for the same session was queued before this one was delivered.
+	NotificationSuperseded = "superseded"
+)
+
+// Session-manager notification kinds.
+const (
+	NotificationKindRecordingURL = "recording_url" // SetRecordingUrl
+	NotificationKindStatus       = "status"        // Control with a stream status action
+)
+
+// SessionManagerNotification — отложенный вызов session-manager (SetRecordingUrl или Control со статусом), повторяется до успеха.
+type SessionManagerNotification struct {
+	ID            string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SessionID     string     `gorm:"type:uuid;not null;index"`
+	Kind          string     `gorm:"size:20;not null;default:recording_url"` // recording_url, status
+	RecordingURL  string     `gorm:"column:recording_url;not null;default:''"`
+	TargetID      *string    `gorm:"column:target_id;size:64"`      // session-manager session ID (status)
+	SessionStatus *string    `gorm:"column:session_status;size:20"` // streaming session status pushed (status)
+	Status        string     `gorm:"size:20;not null;default:pending"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null"`
+	LastError     *string    `gorm:"column:last_error"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+	DoneAt        *time.Time `gorm:"column:done_at"`
+}
+
+func (SessionManagerNotification) TableName() string { return "session_manager_notifications" }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// OutboxMessage — доменное событие, записанное в той же транзакции, что и изменение состояния (GORM).
+// ID — ключ дедупликации для получателей; Seq задаёт порядок публикации.
+type OutboxMessage struct {
+	Seq         int64      `gorm:"primaryKey;autoIncrement"`
+	ID          string     `gorm:"type:uuid;not null;uniqueIndex"`
+	EventType   string     `gorm:"size:64;not null"`
+	AggregateID *string    `gorm:"type:uuid"`
+	Payload     []byte     `gorm:"type:jsonb;not null"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	PublishedAt *time.Time `gorm:"column:published_at"`
+	Attempts    int        `gorm:"not null;default:0"`
+	LastError   *string    `gorm:"column:last_error"`
+	LeaseOwner  *string    `gorm:"column:lease_owner;size:64"` // relay publishing the row
+	LeaseUntil  *time.Time `gorm:"column:lease_until"`
+}
+
+func (OutboxMessage) TableName() string { return "outbox" }
+
+// LeasedBy returns the relay holding an unexpired lease on the row at now ("" if none).
+func (m *OutboxMessage) LeasedBy(now time.Time) string {
+	if m.LeaseOwner == nil || m.LeaseUntil == nil || !m.LeaseUntil.After(now) {
+		return ""
+	}
+	return *m.LeaseOwner
+}
@@ -0,0 +1,133 @@
+package model
+
+import "time"
+
+// RecordingStatus is the state of a session's recording stream.
+type RecordingStatus string
+
+const (
+	RecordingStatusInactive  RecordingStatus = "inactive"  // no recording stream for the session
+	RecordingStatusRecording RecordingStatus = "recording" // chunks are delivered to recording-service
+	RecordingStatusDegraded  RecordingStatus = "degraded"  // stream broken, reconnecting; chunks are buffered
+	RecordingStatusSpooling  RecordingStatus = "spooling"  // recording-service unreachable; chunks go to the local spool
+	RecordingStatusFailed    RecordingStatus = "failed"    // gave up; the recording is truncated
+)
+
+// RecordingMode is the per-session recording switch persisted on the session.
+type RecordingMode string
+
+const (
+	RecordingModeOff    RecordingMode = "off"    // chunks are not recorded
+	RecordingModeOn     RecordingMode = "on"     // chunks are forwarded to the recorder
+	RecordingModePaused RecordingMode = "paused" // recording stays open, chunks are skipped
+)
+
+// RecordingResultStatus is the outcome of a session's recording persisted on the session.
+type RecordingResultStatus string
+
+const (
+	RecordingResultNone     RecordingResultStatus = "none"     // nothing was recorded
+	RecordingResultPending  RecordingResultStatus = "pending"  // session finished, recording not finalized yet (e.g. spooled)
+	RecordingResultFinished RecordingResultStatus = "finished" // recording_url is set
+	RecordingResultFailed   RecordingResultStatus = "failed"   // see recording_error
+)
+
+// RecordingAction is a control action of POST /sessions/:id/recording/{action}.
+type RecordingAction string
+
+const (
+	RecordingActionStart  RecordingAction = "start"
+	RecordingActionStop   RecordingAction = "stop"
+	RecordingActionPause  RecordingAction = "pause"
+	RecordingActionResume RecordingAction = "resume"
+)
+
+// Transition returns the mode reached by applying a to mode m; false if a is not allowed in m.
+// start: off→on; stop: on|paused→off (finalizes the recording); pause: on→paused; resume: paused→on.
+func (a RecordingAction) Transition(m RecordingMode) (RecordingMode, bool) {
+	switch {
+	case a == RecordingActionStart && m == RecordingModeOff:
+		return RecordingModeOn, true
+	case a == RecordingActionStop && (m == RecordingModeOn || m == RecordingModePaused):
+		return RecordingModeOff, true
+	case a == RecordingActionPause && m == RecordingModeOn:
+		return RecordingModePaused, true
+	case a == RecordingActionResume && m == RecordingModePaused:
+		return RecordingModeOn, true
+	}
+	return m, false
+}
+
+// RecordingControlResponse is the response of POST /sessions/:id/recording/{action}.
+type RecordingControlResponse struct {
+	SessionID     string        `json:"session_id"`
+	RecordingMode RecordingMode `json:"recording_mode"`
+}
+
+// RecordingControlEvent is the control message sent to session peers when the recording mode changes
+// (and to each peer on connect), so participants know whether they are being recorded.
+type RecordingControlEvent struct {
+	Event         string        `json:"event"` // "recording_mode"
+	SessionID     string        `json:"session_id"`
+	RecordingMode RecordingMode `json:"recording_mode"`
+	ChangedBy     string        `json:"changed_by,omitempty"`
+}
+
+// RecordingState is the API view of a session's recording stream.
+type RecordingState struct {
+	SessionID     string          `json:"session_id"`
+	Status        RecordingStatus `json:"status"`
+	Seq           uint64          `json:"seq"`            // chunks recorded
+	Offset        int64           `json:"offset"`         // bytes recorded
+	AckedSeq      uint64          `json:"acked_seq"`      // chunks read by recording-service or spooled
+	AckedOffset   int64           `json:"acked_offset"`   // bytes read by recording-service or spooled
+	PendingChunks int             `json:"pending_chunks"` // possibly unread by recording-service; resent if the stream breaks
+	SpooledChunks int             `json:"spooled_chunks"`
+	DroppedChunks int             `json:"dropped_chunks"`
+	Reconnects    int             `json:"reconnects"`
+	LastError     string          `json:"last_error,omitempty"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// RecordedFrame describes a chunk to a recorder that indexes frames (service.FrameRecorder): its websocket
+// message type and, for the client's binary frames, the track and what the frame inspector recognized in it.
+type RecordedFrame struct {
+	MessageType int // websocket.TextMessage or websocket.BinaryMessage
+	Track       uint8
+	Container   string // fmp4, mpegts; "" when the stream is not recognized (the fields below are then unset)
+	Keyframe    bool
+	Init        bool
+	PTS         time.Duration // valid when HasPTS
+	HasPTS      bool
+}
+
+// RecordingStateEvent is the control message sent to session peers when the recording status changes.
+type RecordingStateEvent struct {
+	Event string `json:"event"` // "recording_state"
+	RecordingState
+}
+
+// RecordingSinkStatus is the health of one recording sink.
+type RecordingSinkStatus string
+
+const (
+	SinkHealthOK       RecordingSinkStatus = "ok"
+	SinkHealthDegraded RecordingSinkStatus = "degraded" // the sink's queue overflowed recently; chunks were dropped for it
+)
+
+// RecordingSinkHealth is the API view of one recording sink (GET /admin/recording/sinks).
+type RecordingSinkHealth struct {
+	Name       string              `json:"name"`
+	Status     RecordingSinkStatus `json:"status"`
+	QueueLen   int                 `json:"queue_len"`
+	QueueCap   int                 `json:"queue_cap"`
+	Processed  int64               `json:"processed"`
+	Dropped    int64               `json:"dropped"`
+	LastDropAt *time.Time          `json:"last_drop_at,omitempty"`
+	LastError  string              `json:"last_error,omitempty"`
+}
+
+// RecordingSinksResponse is the response for GET /admin/recording/sinks.
+type RecordingSinksResponse struct {
+	Sinks []RecordingSinkHealth `json:"sinks"`
+}
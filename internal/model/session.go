@@ -13,13 +13,19 @@ const (
 
 // Session is the API view of a streaming session (not GORM entity).
 type Session struct {
-	ID         string        `json:"id"`
-	ClientID   string        `json:"client_id"`
-	StreamKey  string        `json:"stream_key"`
-	Status     SessionStatus `json:"status"`
-	Operators  []Operator    `json:"operators"`
-	CreatedAt  time.Time     `json:"created_at"`
-	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	ID                      string                `json:"id"`
+	ClientID                string                `json:"client_id"`
+	StreamKey               string                `json:"stream_key"`
+	Status                  SessionStatus         `json:"status"`
+	RecordingMode           RecordingMode         `json:"recording_mode"`
+	RecordingStatus         RecordingResultStatus `json:"recording_status"`
+	RecordingURL            string                `json:"recording_url,omitempty"`
+	RecordingError          string                `json:"recording_error,omitempty"`
+	RecordingSinks          []string              `json:"recording_sinks,omitempty"` // empty = all configured sinks
+	SessionManagerSessionID string                `json:"session_manager_session_id,omitempty"`
+	Operators               []Operator            `json:"operators"`
+	CreatedAt               time.Time             `json:"created_at"`
+	FinishedAt              *time.Time            `json:"finished_at,omitempty"`
 }
 
 // Operator is a participant (operator) in a session — API response DTO.
@@ -30,7 +36,11 @@ type Operator struct {
 
 // CreateSessionRequest is the request body for POST /sessions.
 type CreateSessionRequest struct {
-	ClientID string `json:"client_id" binding:"required"`
+	ClientID       string   `json:"client_id" binding:"required"`
+	Record         *bool    `json:"record,omitempty"`          // record the session; default is ENABLE_RECORDING
+	RecordingSinks []string `json:"recording_sinks,omitempty"` // subset of RECORDING_BACKEND sinks; default is all
+	// SessionManagerSessionID links the stream to a session-manager session; it is verified on create.
+	SessionManagerSessionID string `json:"session_manager_session_id,omitempty"`
 }
 
 // CreateSessionResponse is the response for POST /sessions.
@@ -46,3 +56,19 @@ type SessionOperatorsResponse struct {
 	SessionID string     `json:"session_id"`
 	Operators []Operator `json:"operators"`
 }
+
+// SignedURLResponse is a URL carrying a signed token, for clients that cannot send X-User-ID
+// (POST /sessions/:id/hls).
+type SignedURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ValidSessionStatus reports whether s is a known session status.
+func ValidSessionStatus(s SessionStatus) bool {
+	switch s {
+	case SessionStatusWaiting, SessionStatusActive, SessionStatusFinished:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Timeline event types.
+const (
+	TimelineJoin            = "join"
+	TimelineLeave           = "leave"
+	TimelineClientMessage   = "client_message"   // text frame sent by the session client (chat, annotations)
+	TimelineOperatorMessage = "operator_message" // text frame sent by an operator (chat, annotations)
+	TimelineControl         = "control"          // control message sent to peers (system_message, recording_mode, ...)
+	TimelineSessionFinished = "session_finished"
+)
+
+// TimelineEvent is one line of a session's JSONL timeline. Time uses the same clock (UTC wall time)
+// as the recorded media chunks; Media is the recorder position at that moment, when known.
+type TimelineEvent struct {
+	Time   time.Time         `json:"t"`
+	Type   string            `json:"type"`
+	UserID string            `json:"user_id,omitempty"`
+	Role   string            `json:"role,omitempty"`
+	Media  *TimelineMediaPos `json:"media,omitempty"`
+	Data   json.RawMessage   `json:"data,omitempty"`
+}
+
+// TimelineMediaPos is the position in the recorded media stream: chunks and bytes recorded so far.
+type TimelineMediaPos struct {
+	Seq    uint64 `json:"seq"`
+	Offset int64  `json:"offset"`
+}
@@ -0,0 +1,43 @@
+package model
+
+// Track events carried as JSON text frames over /ws/stream/:session_id/:user_id. The session client declares
+// its tracks; from then on every binary frame it sends starts with a track header (see service.ParseTrackFrame).
+const (
+	TrackDeclare     = "tracks"             // client → service: declare; service → peers: the declared tracks
+	TrackSubscribe   = "track_subscribe"    // operator → service: receive track_ids again
+	TrackUnsubscribe = "track_unsubscribe"  // operator → service: stop receiving track_ids
+	TrackSubscribed  = "track_subscription" // service → operator: the tracks it now receives
+	TrackError       = "track_error"        // service → peer: the message was rejected
+)
+
+// Track kinds.
+const (
+	TrackKindVideo = "video"
+	TrackKindAudio = "audio"
+	TrackKindData  = "data"
+)
+
+// Track is a declared media track of the session client (screen, camera, microphone...).
+type Track struct {
+	ID    uint8  `json:"id"` // 1..255, the track ID of the frame header
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"`
+}
+
+// TrackMessage is a track declaration, subscription change or reply.
+type TrackMessage struct {
+	Event     string  `json:"event"`
+	SessionID string  `json:"session_id,omitempty"`
+	Tracks    []Track `json:"tracks,omitempty"`    // tracks
+	TrackIDs  []int   `json:"track_ids,omitempty"` // track_subscribe, track_unsubscribe, track_subscription
+	Error     string  `json:"error,omitempty"`
+}
+
+// IsTrackMessage reports whether event is a track event a peer may send.
+func IsTrackMessage(event string) bool {
+	switch event {
+	case TrackDeclare, TrackSubscribe, TrackUnsubscribe:
+		return true
+	}
+	return false
+}
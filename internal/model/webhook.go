@@ -0,0 +1,98 @@
+package model
+
+import "time"
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription — подписка на события сессий (GORM). Events — список типов через запятую.
+type WebhookSubscription struct {
+	ID        string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	URL       string    `gorm:"column:url;not null"`
+	Secret    string    `gorm:"size:128;not null"`
+	Events    string    `gorm:"not null"`
+	Active    bool      `gorm:"not null;default:true"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (WebhookSubscription) TableName() string { return "webhook_subscriptions" }
+
+// WebhookDelivery — доставка одного события одной подписке (GORM).
+type WebhookDelivery struct {
+	ID             string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SubscriptionID string     `gorm:"type:uuid;not null;index"`
+	EventID        string     `gorm:"type:uuid;not null"`
+	EventType      string     `gorm:"size:64;not null"`
+	SessionID      *string    `gorm:"type:uuid"`
+	Payload        []byte     `gorm:"type:jsonb;not null"`
+	Status         string     `gorm:"size:20;not null;default:pending"`
+	Attempts       int        `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `gorm:"column:next_attempt_at;not null"`
+	LastError      *string    `gorm:"column:last_error"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+	DeliveredAt    *time.Time `gorm:"column:delivered_at"`
+
+	AttemptLog []WebhookDeliveryAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+func (WebhookDelivery) TableName() string { return "webhook_deliveries" }
+
+// WebhookDeliveryAttempt — одна попытка HTTP-доставки (GORM).
+type WebhookDeliveryAttempt struct {
+	ID          string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	DeliveryID  string    `gorm:"type:uuid;not null;index"`
+	Attempt     int       `gorm:"not null"`
+	StatusCode  *int      `gorm:"column:status_code"`
+	Error       *string   `gorm:"column:error"`
+	DurationMs  int64     `gorm:"column:duration_ms;not null"`
+	AttemptedAt time.Time `gorm:"column:attempted_at;not null"`
+}
+
+func (WebhookDeliveryAttempt) TableName() string { return "webhook_delivery_attempts" }
+
+// CreateWebhookRequest is the request body for POST /admin/webhooks.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1"`
+	Secret string   `json:"secret"`
+}
+
+// Webhook is the API view of a subscription. Secret is only returned on creation.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeliveryView is the API view of a delivery with its attempts.
+type WebhookDeliveryView struct {
+	ID             string                 `json:"id"`
+	SubscriptionID string                 `json:"subscription_id"`
+	EventID        string                 `json:"event_id"`
+	EventType      string                 `json:"event_type"`
+	SessionID      string                 `json:"session_id,omitempty"`
+	Status         string                 `json:"status"`
+	Attempts       int                    `json:"attempts"`
+	NextAttemptAt  time.Time              `json:"next_attempt_at"`
+	LastError      string                 `json:"last_error,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	AttemptLog     []WebhookAttemptView   `json:"attempt_log,omitempty"`
+	Payload        map[string]interface{} `json:"payload,omitempty"`
+}
+
+// WebhookAttemptView is the API view of a delivery attempt.
+type WebhookAttemptView struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,37 @@
+package model
+
+// WebRTC signaling events carried as JSON text frames over /ws/stream/:session_id/:user_id.
+// The session client publishes (sends an offer), operators subscribe (the service sends the offer).
+const (
+	SignalOffer     = "webrtc_offer"     // client → service: publish offer; service → operator: subscription offer
+	SignalAnswer    = "webrtc_answer"    // service → client; operator → service
+	SignalCandidate = "webrtc_candidate" // trickle ICE, both directions
+	SignalSubscribe = "webrtc_subscribe" // operator → service: receive the client's tracks
+	SignalError     = "webrtc_error"     // service → peer: the signal was rejected
+)
+
+// SignalMessage is a WebRTC signaling message.
+type SignalMessage struct {
+	Event     string        `json:"event"`
+	SessionID string        `json:"session_id,omitempty"`
+	SDP       string        `json:"sdp,omitempty"`
+	Candidate *ICECandidate `json:"candidate,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ICECandidate mirrors the browser's RTCIceCandidateInit.
+type ICECandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// IsSignal reports whether event is a WebRTC signaling event.
+func IsSignal(event string) bool {
+	switch event {
+	case SignalOffer, SignalAnswer, SignalCandidate, SignalSubscribe:
+		return true
+	}
+	return false
+}
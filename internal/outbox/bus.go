@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// busBuffer is the per-subscriber buffer; a subscriber that falls further behind is closed.
+const busBuffer = 64
+
+// Bus is an in-process sink that fans relayed messages out to live subscribers
+// (e.g. gRPC WatchSessionEvents). It never fails, so it does not hold back the relay.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[string]map[*busSub]struct{} // key ("" = all) -> subscribers
+}
+
+type busSub struct {
+	ch     chan Message
+	closed bool // guarded by Bus.mu
+}
+
+// NewBus creates an empty bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]map[*busSub]struct{})}
+}
+
+func (b *Bus) Name() string { return "bus" }
+
+// Publish delivers msg to subscribers of msg.Key and of all keys. A subscriber whose buffer is full is
+// closed instead of skipped, so it cannot miss an event unnoticed: it sees its channel closed and resubscribes.
+func (b *Bus) Publish(_ context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := []string{""}
+	if msg.Key != "" {
+		keys = append(keys, msg.Key)
+	}
+	for _, key := range keys {
+		for sub := range b.subs[key] {
+			select {
+			case sub.ch <- msg:
+			default:
+				b.removeLocked(key, sub)
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel of messages for key ("" for every message) and a function that unsubscribes
+// and closes it. The channel is also closed when the subscriber falls behind by more than busBuffer messages.
+func (b *Bus) Subscribe(key string) (<-chan Message, func()) {
+	sub := &busSub{ch: make(chan Message, busBuffer)}
+	b.mu.Lock()
+	if b.subs[key] == nil {
+		b.subs[key] = make(map[*busSub]struct{})
+	}
+	b.subs[key][sub] = struct{}{}
+	b.mu.Unlock()
+	return sub.ch, func() {
+		b.mu.Lock()
+		b.removeLocked(key, sub)
+		b.mu.Unlock()
+	}
+}
+
+// removeLocked unsubscribes sub and closes its channel; b.mu must be held.
+func (b *Bus) removeLocked(key string, sub *busSub) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subs[key], sub)
+	if len(b.subs[key]) == 0 {
+		delete(b.subs, key)
+	}
+	close(sub.ch)
+}
@@ -0,0 +1,33 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBusClosesSlowSubscriber(t *testing.T) {
+	b := NewBus()
+	slow, unsubSlow := b.Subscribe("s1")
+	defer unsubSlow()
+	all, unsubAll := b.Subscribe("")
+	defer unsubAll()
+
+	for i := 0; i <= busBuffer; i++ {
+		_ = b.Publish(context.Background(), Message{ID: fmt.Sprint(i), Key: "s1"})
+		<-all // keeps up
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != busBuffer {
+		t.Fatalf("slow subscriber got %d messages before its channel closed, want %d", n, busBuffer)
+	}
+
+	_ = b.Publish(context.Background(), Message{ID: "next", Key: "s1"})
+	if m := <-all; m.ID != "next" {
+		t.Fatalf("subscriber that kept up got %q, want next", m.ID)
+	}
+	unsubSlow() // unsubscribing after the bus closed the channel is a no-op
+}
@@ -0,0 +1,286 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSSink publishes to a NATS-compatible server using the plain-text client protocol
+// (HPUB with a Nats-Msg-Id header, which JetStream uses for deduplication).
+//
+// Subject is "<prefix>.<event type>". With JetStream enabled, every publish waits for the
+// stream's PubAck; otherwise a PING/PONG round-trip confirms the server received the message.
+type NATSSink struct {
+	addr      string
+	user      string
+	pass      string
+	token     string
+	prefix    string
+	jetStream bool
+	timeout   time.Duration
+
+	mu    sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string
+	seq   uint64
+}
+
+// NewNATSSink creates a sink for rawURL (nats://[user:pass@|token@]host:port). The connection is opened lazily.
+func NewNATSSink(rawURL, subjectPrefix string, jetStream bool, timeout time.Duration) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("nats url: %w", err)
+	}
+	if u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("nats url: expected nats://host:port, got %q", rawURL)
+	}
+	s := &NATSSink{addr: u.Host, prefix: subjectPrefix, jetStream: jetStream, timeout: timeout}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			s.user, s.pass = u.User.Username(), p
+		} else {
+			s.token = u.User.Username()
+		}
+	}
+	return s, nil
+}
+
+func (s *NATSSink) Name() string { return "nats" }
+
+// Publish sends msg and waits for confirmation. On any error the connection is dropped and reopened on the next call.
+func (s *NATSSink) Publish(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := s.publish(ctx, msg); err != nil {
+		s.closeLocked()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+	return nil
+}
+
+func (s *NATSSink) closeLocked() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		s.r = nil
+	}
+}
+
+func (s *NATSSink) connect(ctx context.Context) error {
+	d := net.Dialer{Timeout: s.timeout}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	s.setDeadline(ctx)
+
+	line, err := s.readLine()
+	if err != nil {
+		s.closeLocked()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		s.closeLocked()
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"headers":  true,
+		"name":     "streaming-service",
+		"lang":     "go",
+		"protocol": 1,
+	}
+	if s.user != "" {
+		opts["user"], opts["pass"] = s.user, s.pass
+	}
+	if s.token != "" {
+		opts["auth_token"] = s.token
+	}
+	raw, _ := json.Marshal(opts)
+	cmd := "CONNECT " + string(raw) + "\r\n"
+	if s.jetStream {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		s.inbox = "_INBOX." + hex.EncodeToString(b)
+		cmd += "SUB " + s.inbox + ".* 1\r\n"
+	}
+	if _, err := s.conn.Write([]byte(cmd)); err != nil {
+		s.closeLocked()
+		return err
+	}
+	if err := s.flush(); err != nil {
+		s.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (s *NATSSink) publish(ctx context.Context, msg Message) error {
+	s.setDeadline(ctx)
+	subject := s.prefix + "." + msg.Type
+	hdr := "NATS/1.0\r\nNats-Msg-Id: " + msg.ID + "\r\n\r\n"
+	reply := ""
+	if s.jetStream {
+		s.seq++
+		reply = s.inbox + "." + strconv.FormatUint(s.seq, 10)
+	}
+	var b strings.Builder
+	b.WriteString("HPUB ")
+	b.WriteString(subject)
+	if reply != "" {
+		b.WriteString(" " + reply)
+	}
+	fmt.Fprintf(&b, " %d %d\r\n", len(hdr), len(hdr)+len(msg.Payload))
+	b.WriteString(hdr)
+	b.Write(msg.Payload)
+	b.WriteString("\r\n")
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	if s.jetStream {
+		return s.awaitAck(reply)
+	}
+	return s.flush()
+}
+
+// flush sends PING and reads until PONG, answering server PINGs; -ERR fails.
+func (s *NATSSink) flush() error {
+	if _, err := s.conn.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", line)
+		case strings.HasPrefix(line, "MSG ") || strings.HasPrefix(line, "HMSG "):
+			if _, _, err := s.readMsg(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// awaitAck reads until the JetStream PubAck for reply arrives.
+func (s *NATSSink) awaitAck(reply string) error {
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", line)
+		case strings.HasPrefix(line, "MSG ") || strings.HasPrefix(line, "HMSG "):
+			subject, body, err := s.readMsg(line)
+			if err != nil {
+				return err
+			}
+			if subject != reply {
+				continue // late ack of an earlier, timed-out publish
+			}
+			var ack struct {
+				Stream string `json:"stream"`
+				Error  *struct {
+					Description string `json:"description"`
+				} `json:"error"`
+			}
+			if len(body) == 0 {
+				return errors.New("nats: no JetStream stream for subject")
+			}
+			if err := json.Unmarshal(body, &ack); err != nil {
+				return fmt.Errorf("nats: bad pub ack: %w", err)
+			}
+			if ack.Error != nil {
+				return fmt.Errorf("nats: jetstream: %s", ack.Error.Description)
+			}
+			return nil
+		}
+	}
+}
+
+// readMsg reads the payload of a MSG/HMSG whose control line is line; returns subject and body without headers.
+func (s *NATSSink) readMsg(line string) (string, []byte, error) {
+	f := strings.Fields(line)
+	hmsg := f[0] == "HMSG"
+	// MSG <subject> <sid> [reply] <size>; HMSG <subject> <sid> [reply] <hdr size> <total size>
+	if len(f) < 4 {
+		return "", nil, fmt.Errorf("nats: bad message line %q", line)
+	}
+	total, err := strconv.Atoi(f[len(f)-1])
+	if err != nil {
+		return "", nil, fmt.Errorf("nats: bad message line %q", line)
+	}
+	hdrLen := 0
+	if hmsg {
+		if hdrLen, err = strconv.Atoi(f[len(f)-2]); err != nil || hdrLen > total {
+			return "", nil, fmt.Errorf("nats: bad message line %q", line)
+		}
+	}
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return "", nil, err
+	}
+	return f[1], buf[hdrLen:total], nil
+}
+
+func (s *NATSSink) readLine() (string, error) {
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *NATSSink) setDeadline(ctx context.Context) {
+	dl := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(dl) {
+		dl = d
+	}
+	_ = s.conn.SetDeadline(dl)
+}
@@ -0,0 +1,242 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS speaks enough of the NATS client protocol for NATSSink: INFO, CONNECT, SUB, PING and HPUB.
+// With ack set it answers HPUBs that have a reply subject like a JetStream stream would.
+type fakeNATS struct {
+	ln  net.Listener
+	ack func(n int) string // PubAck body for the n-th publish (from 1); "" acks with an empty body
+
+	mu      sync.Mutex
+	connect []string // CONNECT option JSON per connection
+	pubs    []natsPub
+	dropN   int // close the connection instead of answering the n-th publish (from 1)
+}
+
+type natsPub struct {
+	subject, reply, header string
+	payload                []byte
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{ln: ln}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) url(userinfo string) string { return "nats://" + userinfo + f.ln.Addr().String() }
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"headers\":true}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		f.mu.Lock()
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			f.connect = append(f.connect, strings.TrimPrefix(line, "CONNECT "))
+		case line == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case strings.HasPrefix(line, "HPUB "):
+			fields := strings.Fields(line)
+			hdrLen, _ := strconv.Atoi(fields[len(fields)-2])
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				f.mu.Unlock()
+				return
+			}
+			p := natsPub{subject: fields[1], header: string(buf[:hdrLen]), payload: buf[hdrLen:total]}
+			if len(fields) == 5 {
+				p.reply = fields[2]
+			}
+			f.pubs = append(f.pubs, p)
+			n := len(f.pubs)
+			if n == f.dropN {
+				f.mu.Unlock()
+				return
+			}
+			if p.reply != "" && f.ack != nil {
+				body := f.ack(n)
+				fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", p.reply, len(body), body)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeNATS) published() []natsPub {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]natsPub(nil), f.pubs...)
+}
+
+func testMessage(id string) Message {
+	return Message{ID: id, Type: "session.finished", Key: "s1", Payload: []byte(`{"id":"` + id + `"}`)}
+}
+
+func TestNATSSinkPublish(t *testing.T) {
+	srv := newFakeNATS(t)
+	s, err := NewNATSSink(srv.url("alice:secret@"), "psds.streaming", false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, id := range []string{"e1", "e2"} {
+		if err := s.Publish(context.Background(), testMessage(id)); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+	pubs := srv.published()
+	if len(pubs) != 2 {
+		t.Fatalf("server got %d publishes, want 2", len(pubs))
+	}
+	p := pubs[1]
+	if p.subject != "psds.streaming.session.finished" || p.reply != "" {
+		t.Fatalf("subject %q reply %q, want psds.streaming.session.finished and no reply", p.subject, p.reply)
+	}
+	if !strings.Contains(p.header, "Nats-Msg-Id: e2\r\n") {
+		t.Fatalf("header %q lacks Nats-Msg-Id", p.header)
+	}
+	if string(p.payload) != `{"id":"e2"}` {
+		t.Fatalf("payload = %q", p.payload)
+	}
+	srv.mu.Lock()
+	conns := srv.connect
+	srv.mu.Unlock()
+	if len(conns) != 1 || !strings.Contains(conns[0], `"user":"alice"`) || !strings.Contains(conns[0], `"pass":"secret"`) {
+		t.Fatalf("CONNECT = %v, want one connection with the URL's credentials", conns)
+	}
+}
+
+func TestNATSSinkJetStreamAck(t *testing.T) {
+	srv := newFakeNATS(t)
+	srv.ack = func(n int) string {
+		switch n {
+		case 2:
+			return `{"error":{"code":503,"description":"stream offline"}}`
+		case 3:
+			return ""
+		}
+		return fmt.Sprintf(`{"stream":"EVENTS","seq":%d}`, n)
+	}
+	s, err := NewNATSSink(srv.url("token@"), "psds", true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Publish(context.Background(), testMessage("e1")); err != nil {
+		t.Fatalf("acked publish: %v", err)
+	}
+	if err := s.Publish(context.Background(), testMessage("e2")); err == nil || !strings.Contains(err.Error(), "stream offline") {
+		t.Fatalf("publish with error ack = %v, want the stream error", err)
+	}
+	if err := s.Publish(context.Background(), testMessage("e3")); err == nil {
+		t.Fatal("publish without a stream succeeded")
+	}
+	if err := s.Publish(context.Background(), testMessage("e4")); err != nil {
+		t.Fatalf("publish after failures: %v", err)
+	}
+	pubs := srv.published()
+	if len(pubs) != 4 || pubs[0].reply == "" || pubs[0].reply == pubs[3].reply {
+		t.Fatalf("publishes = %+v, want 4 with distinct reply subjects", pubs)
+	}
+}
+
+func TestNATSSinkReconnects(t *testing.T) {
+	srv := newFakeNATS(t)
+	srv.dropN = 2
+	s, err := NewNATSSink(srv.url(""), "psds", false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Publish(context.Background(), testMessage("e1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish(context.Background(), testMessage("e2")); err == nil {
+		t.Fatal("publish on a dropped connection succeeded")
+	}
+	// the relay retries the same message; the sink reconnects
+	if err := s.Publish(context.Background(), testMessage("e2")); err != nil {
+		t.Fatalf("retry after reconnect: %v", err)
+	}
+	srv.mu.Lock()
+	conns := len(srv.connect)
+	srv.mu.Unlock()
+	if conns != 2 {
+		t.Fatalf("connections = %d, want 2", conns)
+	}
+}
+
+func TestNATSSinkTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second) // never greets
+		}
+	}()
+	s, err := NewNATSSink("nats://"+ln.Addr().String(), "psds", false, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := s.Publish(context.Background(), testMessage("e1")); err == nil {
+		t.Fatal("publish to a silent server succeeded")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("publish took %v, want the 50ms timeout", d)
+	}
+}
+
+func TestNewNATSSinkURL(t *testing.T) {
+	for _, raw := range []string{"http://localhost:4222", "nats://", "::"} {
+		if _, err := NewNATSSink(raw, "psds", false, time.Second); err == nil {
+			t.Errorf("NewNATSSink(%q) succeeded", raw)
+		}
+	}
+	s, err := NewNATSSink("nats://localhost", "psds", false, time.Second)
+	if err != nil || s.addr != "localhost:4222" {
+		t.Fatalf("default port: addr %q, err %v", s.addr, err)
+	}
+}
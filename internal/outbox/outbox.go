@@ -0,0 +1,158 @@
+// Package outbox implements the transactional outbox for domain events.
+//
+// Services call Write inside the same GORM transaction as the state change; Relay
+// later publishes committed rows to one or more Sinks in seq order. Delivery is
+// at-least-once: a row is marked published only after every sink accepted it, so
+// sinks must deduplicate by Message.ID. Relays of several replicas lease batches
+// from the head of the outbox, so only one of them publishes at a time and the
+// order holds across replicas; no row lock is held while sinks are called.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 100
+	retryBase    = time.Second
+	retryMax     = time.Minute
+	retention    = 7 * 24 * time.Hour
+	// leaseTTL bounds how long a relay may publish a claimed batch before other relays may claim it again.
+	leaseTTL = time.Minute
+)
+
+// Write stores ev in the outbox using tx; it becomes visible to the relay when tx commits.
+func Write(tx *gorm.DB, ev model.Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	row := &model.OutboxMessage{
+		ID:        ev.ID,
+		EventType: string(ev.Type),
+		Payload:   payload,
+	}
+	if ev.SessionID != "" {
+		row.AggregateID = &ev.SessionID
+	}
+	return tx.Create(row).Error
+}
+
+// Relay publishes outbox rows to sinks.
+type Relay struct {
+	store store
+	sinks []Sink
+	log   *zap.Logger
+	owner string // lease owner: this relay (process)
+}
+
+// NewRelay creates a relay that publishes every row to all sinks in order.
+func NewRelay(db *gorm.DB, log *zap.Logger, sinks ...Sink) *Relay {
+	return newRelay(gormStore{db: db}, log, sinks...)
+}
+
+func newRelay(st store, log *zap.Logger, sinks ...Sink) *Relay {
+	return &Relay{store: st, sinks: sinks, log: log, owner: uuid.New().String()}
+}
+
+// Run publishes rows until ctx is cancelled. After a failed publish the relay backs off
+// (1s doubling to 1m) and retries the same row, which keeps events in order.
+func (r *Relay) Run(ctx context.Context) {
+	delay := pollInterval
+	lastCleanup := time.Time{}
+	for {
+		n, err := r.publishBatch(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			r.log.Warn("outbox: publish failed", zap.Error(err), zap.Duration("retry_in", delay))
+			delay = min(max(delay*2, retryBase), retryMax)
+		case n == batchSize:
+			delay = 0 // more rows are waiting
+		default:
+			delay = pollInterval
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+		if delay == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// publishBatch leases a batch of unpublished rows, then publishes them in seq order outside any transaction,
+// marking each published. It stops at the first failure and releases the rest of the lease; a lease that
+// runs out mid-batch stops it too, since another relay may have taken the rows over.
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	until := time.Now().Add(leaseTTL)
+	rows, err := r.store.claim(ctx, r.owner, batchSize, until)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	published := 0
+	for i := range rows {
+		row := &rows[i]
+		if time.Now().After(until) {
+			break
+		}
+		if err := r.publish(ctx, row); err != nil {
+			if ferr := r.store.fail(ctx, r.owner, row.Seq, err.Error()); ferr != nil {
+				return published, errors.Join(err, ferr)
+			}
+			return published, err
+		}
+		if err := r.store.published(ctx, r.owner, row.Seq, time.Now()); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, r.store.release(ctx, r.owner)
+}
+
+func (r *Relay) publish(ctx context.Context, row *model.OutboxMessage) error {
+	msg := Message{
+		ID:        row.ID,
+		Type:      row.EventType,
+		Payload:   row.Payload,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.AggregateID != nil {
+		msg.Key = *row.AggregateID
+	}
+	for _, s := range r.sinks {
+		if err := s.Publish(ctx, msg); err != nil {
+			return &SinkError{Sink: s.Name(), MessageID: msg.ID, Err: err}
+		}
+	}
+	return nil
+}
+
+// cleanup removes rows published longer ago than the retention period.
+func (r *Relay) cleanup(ctx context.Context) {
+	n, err := r.store.cleanup(ctx, time.Now().Add(-retention))
+	if err != nil {
+		r.log.Warn("outbox: cleanup failed", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		r.log.Info("outbox: cleanup", zap.Int64("deleted", n))
+	}
+}
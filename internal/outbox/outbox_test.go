@@ -0,0 +1,233 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory outbox with the lease semantics of gormStore.
+type memStore struct {
+	mu   sync.Mutex
+	rows []*model.OutboxMessage
+}
+
+func (s *memStore) add(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		seq := int64(len(s.rows) + 1)
+		key := fmt.Sprintf("session-%d", seq%3)
+		s.rows = append(s.rows, &model.OutboxMessage{
+			Seq: seq, ID: fmt.Sprintf("event-%03d", seq), EventType: "session.active", AggregateID: &key, Payload: []byte("{}"),
+		})
+	}
+}
+
+func (s *memStore) claim(_ context.Context, owner string, n int, until time.Time) ([]model.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var head []*model.OutboxMessage
+	for _, r := range s.rows {
+		if r.PublishedAt == nil && len(head) < n {
+			head = append(head, r)
+		}
+	}
+	now := time.Now()
+	for _, r := range head {
+		if by := r.LeasedBy(now); by != "" && by != owner {
+			return nil, nil
+		}
+	}
+	out := make([]model.OutboxMessage, 0, len(head))
+	for _, r := range head {
+		o, u := owner, until
+		r.LeaseOwner, r.LeaseUntil = &o, &u
+		out = append(out, *r)
+	}
+	return out, nil
+}
+
+func (s *memStore) row(owner string, seq int64) *model.OutboxMessage {
+	for _, r := range s.rows {
+		if r.Seq == seq && r.LeaseOwner != nil && *r.LeaseOwner == owner {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *memStore) published(_ context.Context, owner string, seq int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.row(owner, seq); r != nil {
+		r.PublishedAt, r.LastError, r.LeaseOwner, r.LeaseUntil = &at, nil, nil, nil
+	}
+	return nil
+}
+
+func (s *memStore) fail(ctx context.Context, owner string, seq int64, msg string) error {
+	s.mu.Lock()
+	if r := s.row(owner, seq); r != nil {
+		r.Attempts++
+		r.LastError = &msg
+	}
+	s.mu.Unlock()
+	return s.release(ctx, owner)
+}
+
+func (s *memStore) release(_ context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rows {
+		if r.PublishedAt == nil && r.LeaseOwner != nil && *r.LeaseOwner == owner {
+			r.LeaseOwner, r.LeaseUntil = nil, nil
+		}
+	}
+	return nil
+}
+
+func (s *memStore) cleanup(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	kept := s.rows[:0]
+	for _, r := range s.rows {
+		if r.PublishedAt != nil && r.PublishedAt.Before(before) {
+			n++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.rows = kept
+	return n, nil
+}
+
+func (s *memStore) unpublished() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.rows {
+		if r.PublishedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func drain(t *testing.T, r *Relay) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		n, err := r.publishBatch(context.Background())
+		if err == nil && n == 0 {
+			return
+		}
+	}
+	t.Fatal("relay did not drain the outbox")
+}
+
+func assertInOrder(t *testing.T, msgs []Message, want int) {
+	t.Helper()
+	if len(msgs) != want {
+		t.Fatalf("published %d messages, want %d", len(msgs), want)
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("messages published out of seq order: %v", ids)
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	st := &memStore{}
+	st.add(batchSize + 20)
+	sink := NewMemorySink()
+	drain(t, newRelay(st, zap.NewNop(), sink))
+
+	assertInOrder(t, sink.Messages(), batchSize+20)
+	if n := st.unpublished(); n != 0 {
+		t.Fatalf("%d rows left unpublished", n)
+	}
+	if m := sink.Messages()[1]; m.Key != "session-2" || m.Type != "session.active" {
+		t.Fatalf("message = %+v, want key session-2 and the row's event type", m)
+	}
+}
+
+func TestRelayRetriesFailedRow(t *testing.T) {
+	st := &memStore{}
+	st.add(5)
+	sink := NewMemorySink()
+	r := newRelay(st, zap.NewNop(), sink)
+
+	sink.FailNext(2)
+	for i := 0; i < 2; i++ {
+		if n, err := r.publishBatch(context.Background()); err == nil || n != 0 {
+			t.Fatalf("attempt %d: published %d, err %v; want a failure before the first row", i, n, err)
+		}
+	}
+	st.mu.Lock()
+	first := *st.rows[0]
+	st.mu.Unlock()
+	if first.Attempts != 2 || first.LastError == nil || first.LeaseOwner != nil {
+		t.Fatalf("failed row = attempts %d, last error %v, lease %v; want 2 attempts, an error and no lease",
+			first.Attempts, first.LastError, first.LeaseOwner)
+	}
+	drain(t, r)
+	assertInOrder(t, sink.Messages(), 5)
+	if calls := sink.Calls(); calls != 7 {
+		t.Fatalf("sink calls = %d, want 7 (2 failed + 5)", calls)
+	}
+}
+
+func TestRelayWaitsForOtherRelaysLease(t *testing.T) {
+	st := &memStore{}
+	st.add(3)
+	sink := NewMemorySink()
+	a := newRelay(st, zap.NewNop(), sink)
+	b := newRelay(st, zap.NewNop(), sink)
+
+	// a holds the head, as if it were still publishing
+	if rows, _ := st.claim(context.Background(), a.owner, batchSize, time.Now().Add(leaseTTL)); len(rows) != 3 {
+		t.Fatalf("a claimed %d rows, want 3", len(rows))
+	}
+	st.add(2)
+	if n, err := b.publishBatch(context.Background()); n != 0 || err != nil {
+		t.Fatalf("b published %d (err %v) while a holds the head of the outbox", n, err)
+	}
+
+	// a's lease runs out (a crashed): b takes over from the head, in order
+	st.mu.Lock()
+	past := time.Now().Add(-time.Second)
+	for _, r := range st.rows {
+		if r.LeaseOwner != nil {
+			r.LeaseUntil = &past
+		}
+	}
+	st.mu.Unlock()
+	drain(t, b)
+	assertInOrder(t, sink.Messages(), 5)
+}
+
+func TestRelayCleanup(t *testing.T) {
+	st := &memStore{}
+	st.add(2)
+	drain(t, newRelay(st, zap.NewNop(), NewMemorySink()))
+	old := time.Now().Add(-retention - time.Hour)
+	st.mu.Lock()
+	st.rows[0].PublishedAt = &old
+	st.mu.Unlock()
+	st.add(1)
+
+	newRelay(st, zap.NewNop()).cleanup(context.Background())
+	if len(st.rows) != 2 || st.rows[0].Seq != 2 {
+		t.Fatalf("rows after cleanup = %d (first seq %d), want the expired row removed", len(st.rows), st.rows[0].Seq)
+	}
+}
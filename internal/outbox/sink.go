@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is an outbox row handed to sinks. ID is stable across retries and must be used for deduplication.
+type Message struct {
+	ID        string
+	Type      string
+	Key       string // aggregate ID (session ID)
+	Payload   []byte // JSON-encoded model.Event
+	CreatedAt time.Time
+}
+
+// Sink publishes outbox messages. Publish returns nil only once the message is durably accepted.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, msg Message) error
+}
+
+// SinkError wraps a publish failure with the sink name and message ID.
+type SinkError struct {
+	Sink      string
+	MessageID string
+	Err       error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %s: message %s: %v", e.Sink, e.MessageID, e.Err)
+}
+
+func (e *SinkError) Unwrap() error { return e.Err }
+
+// LogSink writes messages to the log (default sink for development).
+type LogSink struct {
+	log *zap.Logger
+}
+
+// NewLogSink creates a log sink.
+func NewLogSink(log *zap.Logger) *LogSink { return &LogSink{log: log} }
+
+func (s *LogSink) Name() string { return "log" }
+
+func (s *LogSink) Publish(_ context.Context, msg Message) error {
+	s.log.Info("outbox event",
+		zap.String("id", msg.ID),
+		zap.String("type", msg.Type),
+		zap.String("key", msg.Key),
+		zap.ByteString("payload", msg.Payload))
+	return nil
+}
+
+// HTTPSink POSTs each message as JSON; Idempotency-Key carries the message ID. Non-2xx is a failure.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink creates an HTTP sink.
+func NewHTTPSink(url string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *HTTPSink) Name() string { return "http" }
+
+func (s *HTTPSink) Publish(ctx context.Context, msg Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", msg.ID)
+	req.Header.Set("X-Event-Type", msg.Type)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MemorySink keeps published messages in memory, deduplicated by ID. Intended for tests;
+// FailNext makes the next n Publish calls fail to exercise the relay's retry path.
+type MemorySink struct {
+	mu       sync.Mutex
+	seen     map[string]struct{}
+	messages []Message
+	failNext int
+	calls    int
+}
+
+// NewMemorySink creates an in-process sink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{seen: make(map[string]struct{})}
+}
+
+func (s *MemorySink) Name() string { return "memory" }
+
+func (s *MemorySink) Publish(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failNext > 0 {
+		s.failNext--
+		return fmt.Errorf("memory sink: injected failure")
+	}
+	if _, ok := s.seen[msg.ID]; ok {
+		return nil
+	}
+	s.seen[msg.ID] = struct{}{}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// FailNext makes the next n Publish calls return an error.
+func (s *MemorySink) FailNext(n int) {
+	s.mu.Lock()
+	s.failNext = n
+	s.mu.Unlock()
+}
+
+// Messages returns a copy of the distinct messages published so far, in publish order.
+func (s *MemorySink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Calls returns the number of Publish calls, including failed and duplicate ones.
+func (s *MemorySink) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
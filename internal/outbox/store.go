@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// store is the relay's view of the outbox table.
+type store interface {
+	// claim leases up to n of the oldest unpublished rows to owner until the given time and returns them in
+	// seq order. It returns nothing while another owner holds an unexpired lease on one of those rows.
+	claim(ctx context.Context, owner string, n int, until time.Time) ([]model.OutboxMessage, error)
+	// published marks the row published and ends its lease.
+	published(ctx context.Context, owner string, seq int64, at time.Time) error
+	// fail records a failed attempt on the row and releases all of owner's leases.
+	fail(ctx context.Context, owner string, seq int64, msg string) error
+	// release ends all of owner's leases on unpublished rows.
+	release(ctx context.Context, owner string) error
+	// cleanup deletes rows published before the given time.
+	cleanup(ctx context.Context, before time.Time) (int64, error)
+}
+
+// gormStore keeps the outbox in PostgreSQL. Claims lock the head rows only for the claiming transaction.
+type gormStore struct {
+	db *gorm.DB
+}
+
+func (s gormStore) claim(ctx context.Context, owner string, n int, until time.Time) ([]model.OutboxMessage, error) {
+	var rows []model.OutboxMessage
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("published_at IS NULL").Order("seq").Limit(n).Find(&rows).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		seqs := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			if by := row.LeasedBy(now); by != "" && by != owner {
+				rows = nil
+				return nil // another relay is publishing the head of the outbox
+			}
+			seqs = append(seqs, row.Seq)
+		}
+		if len(seqs) == 0 {
+			return nil
+		}
+		return tx.Model(&model.OutboxMessage{}).Where("seq IN ?", seqs).
+			Updates(map[string]interface{}{"lease_owner": owner, "lease_until": until}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (s gormStore) published(ctx context.Context, owner string, seq int64, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&model.OutboxMessage{}).Where("seq = ? AND lease_owner = ?", seq, owner).
+		Updates(map[string]interface{}{"published_at": at, "last_error": nil, "lease_owner": nil, "lease_until": nil}).Error
+}
+
+func (s gormStore) fail(ctx context.Context, owner string, seq int64, msg string) error {
+	if err := s.db.WithContext(ctx).Model(&model.OutboxMessage{}).Where("seq = ? AND lease_owner = ?", seq, owner).
+		Updates(map[string]interface{}{"attempts": gorm.Expr("attempts + 1"), "last_error": msg}).Error; err != nil {
+		return err
+	}
+	return s.release(ctx, owner)
+}
+
+func (s gormStore) release(ctx context.Context, owner string) error {
+	return s.db.WithContext(ctx).Model(&model.OutboxMessage{}).Where("lease_owner = ? AND published_at IS NULL", owner).
+		Updates(map[string]interface{}{"lease_owner": nil, "lease_until": nil}).Error
+}
+
+func (s gormStore) cleanup(ctx context.Context, before time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).Where("published_at < ?", before).Delete(&model.OutboxMessage{})
+	return res.RowsAffected, res.Error
+}
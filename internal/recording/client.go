@@ -2,141 +2,852 @@ package recording
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/psds-microservice/recording-service/pkg/gen/recording_service"
-	"github.com/psds-microservice/session-manager-service/pkg/gen/session_manager_service"
+	"github.com/psds-microservice/streaming-service/internal/breaker"
+	"github.com/psds-microservice/streaming-service/internal/model"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
-// StreamRecorder sends a copy of the client stream to recording-service and sets recording_url in session-manager.
+// Metadata sent when an IngestStream is opened. StreamChunk has no sequence fields, so every stream announces
+// where it continues the session's recording: recording-service keeps the recording up to x-resume-offset,
+// discards anything after it and appends the stream's chunks (0 starts the recording afresh).
+const (
+	MDSessionID    = "x-session-id"
+	MDResumeSeq    = "x-resume-seq"
+	MDResumeOffset = "x-resume-offset"
+)
+
+// A session is one recording, named by its session_id, sent over as many IngestStreams as it takes. The only
+// acknowledgement is the RecordingResult of a finalized stream, so after a broken stream the client resumes on a
+// new one from the oldest chunk recording-service may not have read. gRPC flow control bounds that: no more than
+// the stream's receive window can be sent and unread, and grpc-go servers grow that window to 16 MiB at most,
+// so the client keeps the last resendWindow bytes it sent and forgets older chunks.
+//
+// With a spool, a broken stream moves the resend window and the chunks after it to disk (see spill) until a new
+// stream opens; the reconnect loop replays the spooled chunks on it and the session continues live.
+const (
+	resendWindow         = 16 << 20
+	maxPendingBytes      = 2 * resendWindow // held in memory while degraded; beyond this the recording fails
+	maxReconnectAttempts = 10               // without a spool
+	reconnectBase        = 500 * time.Millisecond
+	reconnectMax         = 10 * time.Second
+	endedRetention       = 24 * time.Hour // how long a stopped recording can be started again as its continuation
+)
+
+// errRecordingRejected wraps an error reported by recording-service in RecordingResult (not retryable).
+var errRecordingRejected = errors.New("recording-service rejected the recording")
+
+// StreamRecorder sends a copy of the client stream to recording-service.
 type StreamRecorder interface {
 	WriteChunk(ctx context.Context, sessionID string, data []byte)
-	EndSession(ctx context.Context, sessionID string) // finalizes recording, gets URL, calls session-manager SetRecordingUrl
+	EndSession(ctx context.Context, sessionID string) // finalizes recording and reports its URL (see OnRecordingURL)
+}
+
+// Recorder is one recording sink as wired by the application (RECORDING_BACKEND): Client (grpc) or FSRecorder (fs),
+// usually behind a Composite.
+type Recorder interface {
+	StreamRecorder
+	State(sessionID string) (model.RecordingState, bool)
+	OnRecordingURL(fn func(ctx context.Context, sessionID, url string))
+	OnRecordingError(fn func(ctx context.Context, sessionID, msg string))
+	OnStateChange(fn func(sessionID string, state model.RecordingState))
+	Run(ctx context.Context) // background work until ctx is cancelled
+	Close() error
 }
 
 // Client implements StreamRecorder using gRPC to recording-service and session-manager.
 type Client struct {
 	recordingAddr string
-	sessionAddr   string
 	log           *zap.Logger
 	mu            sync.Mutex
-	streams       map[string]recording_service.RecordingService_IngestStreamClient
+	sessions      map[string]*sessionStream
+	ended         map[string]position // where stopped recordings end, so starting one again continues it
 	recConn       *grpc.ClientConn
-	sessConn      *grpc.ClientConn
+	dialOpts      []grpc.DialOption                                  // optional, see SetDialOptions
+	breaker       *breaker.Breaker                                   // optional, see SetBreaker
+	onURL         func(ctx context.Context, sessionID, url string)   // optional, see OnRecordingURL
+	onError       func(ctx context.Context, sessionID, msg string)   // optional, see OnRecordingError
+	onState       func(sessionID string, state model.RecordingState) // optional, see OnStateChange
+	spool         *Spool                                             // optional, see SetSpool
+	wake          chan struct{}                                      // nudges RunUploader when a spooled session completes
+}
+
+// position is a place in a session's recording.
+type position struct {
+	seq    uint64
+	offset int64
+	at     time.Time
+}
+
+// sessionStream is the recording stream of one session. Its own mutex serializes Send on the stream,
+// so sessions do not block each other.
+type sessionStream struct {
+	mu           sync.Mutex
+	id           string
+	st           recording_service.RecordingService_IngestStreamClient // nil while not live
+	status       model.RecordingStatus
+	seq          uint64      // chunks recorded
+	offset       int64       // bytes recorded
+	win          chunkWindow // chunks recording-service may not have read; resent on a new stream
+	sent         int         // chunks of win sent on st
+	dropped      int
+	reconnects   int
+	reconnecting bool
+	spooling     bool   // chunks go to spoolKey until the reconnect loop has replayed it on a new stream
+	replaying    bool   // the reconnect loop is sending spoolKey
+	ending       bool   // EndSession came during a replay: the reconnect loop finalizes the recording
+	spoolFailed  bool   // the spool rejected a chunk; the session does not spool again
+	spoolKey     string // spool entry of the session while spooling
+	spoolSeq     uint64 // where spoolKey starts in the recording
+	spoolOffset  int64
+	spoolChunks  int // chunks in spoolKey
+	spooled      int
+	lastErr      string
+	updatedAt    time.Time
+}
+
+// chunkWindow is a run of consecutive chunks of a recording, starting at seq/offset.
+type chunkWindow struct {
+	chunks [][]byte
+	bytes  int
+	seq    uint64
+	offset int64
+}
+
+func (w *chunkWindow) push(data []byte) {
+	w.chunks = append(w.chunks, data)
+	w.bytes += len(data)
+}
+
+// trim forgets the oldest of the first n chunks while the window holds more than limit bytes and returns
+// how many it forgot.
+func (w *chunkWindow) trim(n, limit int) int {
+	i := 0
+	for ; i < n && w.bytes > limit; i++ {
+		w.bytes -= len(w.chunks[i])
+		w.seq++
+		w.offset += int64(len(w.chunks[i]))
+	}
+	w.chunks = w.chunks[i:]
+	return i
+}
+
+// reset empties the window, which then starts at seq/offset.
+func (w *chunkWindow) reset(seq uint64, offset int64) {
+	*w = chunkWindow{seq: seq, offset: offset}
 }
 
 // NewClient creates a recording client. Call Connect() before use, then Close() when done.
-func NewClient(recordingAddr, sessionManagerAddr string, log *zap.Logger) *Client {
+func NewClient(recordingAddr string, log *zap.Logger) *Client {
 	return &Client{
 		recordingAddr: recordingAddr,
-		sessionAddr:   sessionManagerAddr,
 		log:           log,
-		streams:       make(map[string]recording_service.RecordingService_IngestStreamClient),
+		sessions:      make(map[string]*sessionStream),
+		ended:         make(map[string]position),
+		wake:          make(chan struct{}, 1),
 	}
 }
 
-// Connect establishes gRPC connections to recording-service and session-manager.
+// SetSpool enables the local disk spool: when a stream fails, the session's resend window and the chunks after it
+// are written to sp until recording-service is reachable again, and RunUploader/FlushSpool upload what is left of
+// ended sessions. Set it before the client is used.
+func (c *Client) SetSpool(sp *Spool) {
+	c.spool = sp
+}
+
+// OnRecordingURL sets a callback invoked with the URL of a session's recording once recording-service has
+// finalized it: from EndSession or, for a spooled recording, from the uploader. Set it before the client is used.
+func (c *Client) OnRecordingURL(fn func(ctx context.Context, sessionID, url string)) {
+	c.onURL = fn
+}
+
+// OnRecordingError sets a callback invoked when a session's recording ends without a URL. Set it before the client is used.
+func (c *Client) OnRecordingError(fn func(ctx context.Context, sessionID, msg string)) {
+	c.onError = fn
+}
+
+// OnStateChange sets a callback invoked whenever a session's recording status changes.
+// It is called with the session's lock held and must not block. Set it before the client is used.
+func (c *Client) OnStateChange(fn func(sessionID string, state model.RecordingState)) {
+	c.onState = fn
+}
+
+// SetDialOptions sets the credentials used by Connect (see grpccreds); plaintext when unset.
+func (c *Client) SetDialOptions(opts ...grpc.DialOption) {
+	c.dialOpts = opts
+}
+
+// SetBreaker sets the circuit breaker for recording-service calls. While it is open, sessions without a live
+// stream spool (or, without a spool, hold their chunks in memory) instead of calling recording-service.
+// Set it before the client is used.
+func (c *Client) SetBreaker(b *breaker.Breaker) {
+	c.breaker = b
+}
+
+// call runs fn through the breaker, if any.
+func (c *Client) call(fn func() error) error {
+	if c.breaker == nil {
+		return fn()
+	}
+	return c.breaker.Do(fn)
+}
+
+// Connect creates the gRPC connection to recording-service and starts connecting in the background; it fails
+// only for an invalid address. While recording-service is unreachable, streams fail to open and sessions spool.
 // Must be called before WriteChunk/EndSession; connection fields are guarded by c.mu.
 func (c *Client) Connect(ctx context.Context) error {
-	recConn, err := grpc.NewClient(c.recordingAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return err
+	opts := c.dialOpts
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
 	}
-	sessConn, err := grpc.NewClient(c.sessionAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	recConn, err := grpc.NewClient(c.recordingAddr, opts...)
 	if err != nil {
-		_ = recConn.Close()
 		return err
 	}
+	recConn.Connect()
 	c.mu.Lock()
 	c.recConn = recConn
-	c.sessConn = sessConn
 	c.mu.Unlock()
 	return nil
 }
 
-// Close closes gRPC connections and any open streams.
+// Close ends every session's recording like EndSession and closes the gRPC connection.
 func (c *Client) Close() error {
 	c.mu.Lock()
-	for _, st := range c.streams {
-		_ = st.CloseSend()
+	ids := make([]string, 0, len(c.sessions))
+	for id := range c.sessions {
+		ids = append(ids, id)
 	}
-	c.streams = make(map[string]recording_service.RecordingService_IngestStreamClient)
 	c.mu.Unlock()
-	if c.recConn != nil {
-		_ = c.recConn.Close()
-		c.recConn = nil
+	for _, id := range ids {
+		c.EndSession(context.Background(), id)
 	}
-	if c.sessConn != nil {
-		_ = c.sessConn.Close()
-		c.sessConn = nil
+	c.mu.Lock()
+	recConn := c.recConn
+	c.recConn = nil
+	c.mu.Unlock()
+	if recConn != nil {
+		_ = recConn.Close()
 	}
 	return nil
 }
 
-// WriteChunk sends a chunk to recording-service for the given session (opens stream on first chunk).
-// Lock is held for the whole lookup/create and Send to avoid races with Close() and concurrent Send on the same stream.
-func (c *Client) WriteChunk(ctx context.Context, sessionID string, data []byte) {
+// State returns the recording state of a session; false if the session has no recording stream.
+func (c *Client) State(sessionID string) (model.RecordingState, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.recConn == nil {
+	s, ok := c.sessions[sessionID]
+	c.mu.Unlock()
+	if !ok {
+		return model.RecordingState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot(), true
+}
+
+// WriteChunk sends a chunk to recording-service for the given session (opens the stream on its first chunk).
+// If the stream fails, the session spools (or, without a spool, becomes degraded) and a background reconnect
+// resumes the recording; WriteChunk itself never waits for reconnection or finalization.
+func (c *Client) WriteChunk(ctx context.Context, sessionID string, data []byte) {
+	s := c.session(sessionID)
+	if s == nil {
 		return
 	}
-	st, ok := c.streams[sessionID]
-	if !ok {
-		recClient := recording_service.NewRecordingServiceClient(c.recConn)
-		var err error
-		st, err = recClient.IngestStream(ctx)
-		if err != nil {
-			c.log.Warn("recording: start stream failed", zap.String("session_id", sessionID), zap.Error(err))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.status == model.RecordingStatusFailed:
+		s.dropped++
+		return
+	case s.spooling:
+		c.spoolChunk(s, data)
+		return
+	}
+	if !c.hold(s, data) || s.reconnecting {
+		return
+	}
+	if s.st == nil {
+		if err := c.open(ctx, s); err != nil {
+			c.degrade(ctx, s, err)
 			return
 		}
-		c.streams[sessionID] = st
 	}
-	chunk := &recording_service.StreamChunk{SessionId: sessionID, Data: data, Last: false}
-	if err := st.Send(chunk); err != nil {
-		c.log.Warn("recording: send chunk failed", zap.String("session_id", sessionID), zap.Error(err))
-		delete(c.streams, sessionID)
+	if err := c.flush(s); err != nil {
+		c.degrade(ctx, s, err)
 	}
 }
 
-// EndSession sends last chunk, closes stream, gets URL, and sets it in session-manager.
-// Lock is held until stream is removed and final Send/CloseAndRecv are done so Close() cannot close connections meanwhile.
+// hold adds data to the session's window; overflowing maxPendingBytes (only possible while no stream takes the
+// chunks) spools or fails the recording. It reports whether data was kept in the window. s.mu must be held.
+func (c *Client) hold(s *sessionStream, data []byte) bool {
+	if s.win.bytes+len(data) > maxPendingBytes {
+		c.fail(s, errors.New("reconnect buffer overflow"))
+		if s.spooling {
+			c.spoolChunk(s, data)
+		} else {
+			s.dropped++
+		}
+		return false
+	}
+	s.win.push(data)
+	s.seq++
+	s.offset += int64(len(data))
+	return true
+}
+
+// EndSession finalizes the session's recording and reports its URL (OnRecordingURL), or OnRecordingError if the
+// recording failed. A broken stream gets one synchronous resend of the window; if that fails too the window goes
+// to the spool. A spooling session's entry is marked complete for the uploader; one being replayed is finalized by
+// the reconnect loop once the replay is done.
 func (c *Client) EndSession(ctx context.Context, sessionID string) {
 	c.mu.Lock()
-	if c.recConn == nil {
-		c.mu.Unlock()
+	s, ok := c.sessions[sessionID]
+	delete(c.sessions, sessionID)
+	c.mu.Unlock()
+	if !ok {
 		return
 	}
-	st, ok := c.streams[sessionID]
-	if !ok {
-		c.mu.Unlock()
+
+	s.mu.Lock()
+	s.reconnecting = false // stops a background reconnect loop
+	if s.status != model.RecordingStatusFailed {
+		c.remember(s)
+	}
+	if s.replaying {
+		s.ending = true
+		s.mu.Unlock()
+		c.log.Info("recording: session ended during a spool replay, finalized after it", zap.String("session_id", sessionID))
+		return
+	}
+	if s.status != model.RecordingStatusFailed && !s.spooling {
+		url, err := c.finish(ctx, s)
+		if err == nil {
+			s.mu.Unlock()
+			c.report(ctx, sessionID, url)
+			return
+		}
+		c.log.Warn("recording: finalize failed", zap.String("session_id", sessionID), zap.Error(err))
+		c.fail(s, err)
+	}
+	key, spooling := s.spoolKey, s.spooling
+	lastErr := s.lastErr
+	s.mu.Unlock()
+
+	if spooling {
+		c.completeSpooled(sessionID, key)
+		return
+	}
+	c.log.Warn("recording: session ended without a complete recording", zap.String("session_id", sessionID))
+	c.reportError(ctx, sessionID, "recording failed: "+lastErr)
+}
+
+// remember keeps where the session's recording ends, so the recording started again continues it. s.mu must be held.
+func (c *Client) remember(s *sessionStream) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, p := range c.ended {
+		if now.Sub(p.at) > endedRetention {
+			delete(c.ended, id)
+		}
+	}
+	c.ended[s.id] = position{seq: s.seq, offset: s.offset, at: now}
+}
+
+// completeSpooled hands a spooled recording to the uploader.
+func (c *Client) completeSpooled(sessionID, key string) {
+	if err := c.spool.Complete(key); err != nil {
+		c.log.Error("recording: spool complete failed", zap.String("session_id", sessionID), zap.Error(err))
 		return
 	}
-	delete(c.streams, sessionID)
+	c.log.Info("recording: session spooled, upload deferred", zap.String("session_id", sessionID), zap.String("spool_key", key))
+	c.wakeUploader()
+}
+
+func (c *Client) report(ctx context.Context, sessionID, url string) {
+	if c.onURL != nil {
+		c.onURL(ctx, sessionID, url)
+	}
+}
+
+func (c *Client) reportError(ctx context.Context, sessionID, msg string) {
+	if c.onError != nil {
+		c.onError(ctx, sessionID, msg)
+	}
+}
+
+func (c *Client) wakeUploader() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finalize sends the last chunk of sessionID's recording and waits for its URL: recording-service's acknowledgement.
+func (c *Client) finalize(st recording_service.RecordingService_IngestStreamClient, sessionID string) (string, error) {
 	_ = st.Send(&recording_service.StreamChunk{SessionId: sessionID, Last: true})
-	res, err := st.CloseAndRecv()
+	var res *recording_service.RecordingResult
+	err := c.call(func() error {
+		var err error
+		res, err = st.CloseAndRecv()
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("close and recv: %w", err)
+	}
+	url := res.GetRecordingUrl()
+	if url == "" {
+		msg := res.GetError()
+		if msg == "" {
+			msg = "no recording URL returned"
+		}
+		return "", fmt.Errorf("%w: %s", errRecordingRejected, msg)
+	}
+	return url, nil
+}
+
+// finish sends what is left of the window and finalizes the recording. If the stream turns out to be broken
+// (or is already gone), the window is resent once over a new stream. s.mu must be held.
+func (c *Client) finish(ctx context.Context, s *sessionStream) (string, error) {
+	for attempt := 0; ; attempt++ {
+		var err error
+		if attempt > 0 {
+			s.reconnects++
+		}
+		if s.st == nil {
+			err = c.open(ctx, s)
+		}
+		if err == nil {
+			err = c.flush(s)
+		}
+		if err == nil {
+			st := s.st
+			s.st = nil
+			var url string
+			if url, err = c.finalize(st, s.id); err == nil {
+				c.log.Debug("recording: finalized", zap.String("session_id", s.id), zap.Uint64("seq", s.seq), zap.Int64("offset", s.offset))
+				return url, nil
+			}
+		}
+		s.closeStream()
+		if attempt > 0 || errors.Is(err, errRecordingRejected) || errors.Is(err, breaker.ErrOpen) {
+			return "", err
+		}
+	}
+}
+
+// session returns the stream state for sessionID, creating it on first use; nil if neither connected nor spooling.
+// A recording started again after EndSession continues where the last one ended.
+func (c *Client) session(sessionID string) *sessionStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.recConn == nil && c.spool == nil {
+		return nil
+	}
+	s, ok := c.sessions[sessionID]
+	if !ok {
+		s = &sessionStream{id: sessionID, status: model.RecordingStatusRecording, updatedAt: time.Now()}
+		if p, ok := c.ended[sessionID]; ok {
+			s.seq, s.offset = p.seq, p.offset
+			delete(c.ended, sessionID)
+		}
+		s.win.reset(s.seq, s.offset)
+		c.sessions[sessionID] = s
+		c.notify(s)
+	}
+	return s
+}
+
+// open starts an IngestStream that resumes the recording at the start of the window. While an earlier
+// recording of the session waits in the spool, it fails: the session spools after it. s.mu must be held.
+func (c *Client) open(ctx context.Context, s *sessionStream) error {
+	if err := c.spoolPending(s.id, ""); err != nil {
+		return err
+	}
+	st, err := c.openAt(ctx, s.id, s.win.seq, s.win.offset)
+	if err != nil {
+		return err
+	}
+	s.st, s.sent = st, 0
+	return nil
+}
+
+// spoolPending fails while the spool holds an entry of sessionID other than key: an earlier stretch of the
+// recording that must reach recording-service first.
+func (c *Client) spoolPending(sessionID, key string) error {
+	if c.spool == nil {
+		return nil
+	}
+	list, err := c.spool.Manifests()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if m.SessionID == sessionID && m.ID() != key {
+			return fmt.Errorf("recording of the session still spooled from seq %d", m.StartSeq)
+		}
+	}
+	return nil
+}
+
+// openAt starts an IngestStream that continues sessionID's recording at seq/offset. It fails fast while the
+// connection is down (no wait-for-ready), so a session spools instead of waiting for recording-service.
+func (c *Client) openAt(ctx context.Context, sessionID string, seq uint64, offset int64) (recording_service.RecordingService_IngestStreamClient, error) {
+	c.mu.Lock()
+	conn := c.recConn
 	c.mu.Unlock()
+	if conn == nil {
+		return nil, errors.New("recording client not connected")
+	}
+	md := metadata.Pairs(
+		MDSessionID, sessionID,
+		MDResumeSeq, strconv.FormatUint(seq, 10),
+		MDResumeOffset, strconv.FormatInt(offset, 10),
+	)
+	var st recording_service.RecordingService_IngestStreamClient
+	err := c.call(func() error {
+		var err error
+		st, err = recording_service.NewRecordingServiceClient(conn).IngestStream(metadata.NewOutgoingContext(ctx, md))
+		return err
+	})
+	return st, err
+}
+
+// flush sends the window's chunks not yet sent on the stream, then forgets sent chunks beyond resendWindow.
+// s.mu must be held.
+func (c *Client) flush(s *sessionStream) error {
+	for s.sent < len(s.win.chunks) {
+		data := s.win.chunks[s.sent]
+		if err := c.call(func() error {
+			return s.st.Send(&recording_service.StreamChunk{SessionId: s.id, Data: data})
+		}); err != nil {
+			return err
+		}
+		s.sent++
+	}
+	s.sent -= s.win.trim(s.sent, resendWindow)
+	return nil
+}
+
+// closeStream abandons the stream, if any; the next one resumes at the start of the window. s.mu must be held.
+func (s *sessionStream) closeStream() {
+	if s.st != nil {
+		_ = s.st.CloseSend()
+		s.st = nil
+	}
+}
+
+// degrade handles a failed stream (or one that could not be opened): the window goes to the spool if there is
+// one, otherwise it is held in memory; either way a background loop reconnects. s.mu must be held.
+func (c *Client) degrade(ctx context.Context, s *sessionStream, err error) {
+	s.closeStream()
+	s.lastErr = err.Error()
+	if s.status == model.RecordingStatusFailed || s.reconnecting {
+		return
+	}
+	if c.spool != nil && !s.spoolFailed {
+		if serr := c.spill(s, err); serr != nil {
+			c.log.Warn("recording: spool failed, holding the chunks in memory", zap.String("session_id", s.id), zap.Error(serr))
+		}
+	}
+	if !s.spooling {
+		c.log.Warn("recording: stream broken, reconnecting",
+			zap.String("session_id", s.id),
+			zap.Uint64("resume_seq", s.win.seq),
+			zap.Uint64("seq", s.seq),
+			zap.Error(err))
+		s.status = model.RecordingStatusDegraded
+		s.updatedAt = time.Now()
+		c.notify(s)
+	}
+	s.reconnecting = true
+	go c.reconnectLoop(ctx, s)
+}
+
+// reconnectLoop brings a degraded or spooling session back to a live stream, retrying with exponential backoff
+// until it succeeds or the session ends. Without a spool it gives up after maxReconnectAttempts.
+func (c *Client) reconnectLoop(ctx context.Context, s *sessionStream) {
+	delay := reconnectBase
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, reconnectMax)
+
+		s.mu.Lock()
+		if !s.reconnecting {
+			s.mu.Unlock()
+			return
+		}
+		spooling := s.spooling
+		var err error
+		if !spooling {
+			err = c.resume(ctx, s)
+		}
+		s.mu.Unlock()
+		if spooling {
+			err = c.unspool(ctx, s)
+		}
+		if err == nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.lastErr = err.Error()
+		if !s.spooling && s.reconnecting && attempt >= maxReconnectAttempts {
+			c.fail(s, err)
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		c.log.Debug("recording: reconnect failed", zap.String("session_id", s.id), zap.Int("attempt", attempt), zap.Error(err))
+	}
+}
+
+// resume opens a new stream at the start of the window and resends the window. s.mu must be held.
+func (c *Client) resume(ctx context.Context, s *sessionStream) error {
+	s.reconnects++
+	if err := c.open(ctx, s); err != nil {
+		return err
+	}
+	if err := c.flush(s); err != nil {
+		s.closeStream()
+		return err
+	}
+	s.reconnecting = false
+	s.status = model.RecordingStatusRecording
+	s.updatedAt = time.Now()
+	c.log.Info("recording: stream resumed", zap.String("session_id", s.id), zap.Uint64("seq", s.seq), zap.Int64("offset", s.offset))
+	c.notify(s)
+	return nil
+}
+
+// unspool replays a spooling session's entry on a new stream, without holding s.mu, so chunks keep going to the
+// spool meanwhile; once the replay has caught up the session continues live on that stream and the entry is
+// removed. If the session ended during the replay, the recording is finalized instead (or, if that fails,
+// left to the uploader).
+func (c *Client) unspool(ctx context.Context, s *sessionStream) error {
+	s.mu.Lock()
+	if !s.reconnecting || !s.spooling {
+		s.mu.Unlock()
+		return nil
+	}
+	key := s.spoolKey
+	w := chunkWindow{seq: s.spoolSeq, offset: s.spoolOffset}
+	s.reconnects++
+	s.mu.Unlock()
+
+	if err := c.spoolPending(s.id, key); err != nil {
+		return err
+	}
+	st, err := c.openAt(ctx, s.id, w.seq, w.offset)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if !s.reconnecting {
+		s.mu.Unlock()
+		_ = st.CloseSend()
+		return nil
+	}
+	s.replaying = true
+	s.mu.Unlock()
+
+	sent := 0
+	for {
+		i := 0
+		err := c.spool.ReadChunks(key, func(data []byte) error {
+			if i++; i <= sent {
+				return nil
+			}
+			if err := c.call(func() error {
+				return st.Send(&recording_service.StreamChunk{SessionId: s.id, Data: data})
+			}); err != nil {
+				return err
+			}
+			sent++
+			w.push(data)
+			w.trim(len(w.chunks), resendWindow)
+			return nil
+		})
+
+		s.mu.Lock()
+		if err == nil && sent < s.spoolChunks && !s.ending && s.status != model.RecordingStatusFailed {
+			s.mu.Unlock()
+			continue // spooled meanwhile
+		}
+		s.replaying = false
+		switch {
+		case err != nil:
+			ended := s.ending || s.status == model.RecordingStatusFailed
+			s.mu.Unlock()
+			_ = st.CloseSend()
+			if ended {
+				c.completeSpooled(s.id, key)
+				return nil
+			}
+			return err
+		case s.ending || s.status == model.RecordingStatusFailed:
+			failed := s.status == model.RecordingStatusFailed
+			s.mu.Unlock()
+			c.endReplayed(ctx, s.id, key, st, failed)
+			return nil
+		}
+		if err := c.spool.Remove(key); err != nil {
+			c.log.Warn("recording: spool remove failed", zap.String("session_id", s.id), zap.Error(err))
+		}
+		s.st, s.win, s.sent = st, w, len(w.chunks)
+		s.spooling, s.spoolKey, s.spoolChunks = false, "", 0
+		s.reconnecting = false
+		s.status = model.RecordingStatusRecording
+		s.updatedAt = time.Now()
+		c.log.Info("recording: recording-service is back, spool replayed",
+			zap.String("session_id", s.id), zap.Int("chunks", sent), zap.Uint64("seq", s.seq))
+		c.notify(s)
+		s.mu.Unlock()
+		return nil
+	}
+}
 
+// endReplayed finishes a recording whose session ended while its spool entry was replayed on st: the recording is
+// finalized on st and the entry removed. A recording that failed meanwhile, or whose finalization fails, is left
+// to the uploader.
+func (c *Client) endReplayed(ctx context.Context, sessionID, key string, st recording_service.RecordingService_IngestStreamClient, failed bool) {
+	if failed {
+		_ = st.CloseSend()
+		c.completeSpooled(sessionID, key)
+		return
+	}
+	url, err := c.finalize(st, sessionID)
 	if err != nil {
-		c.log.Warn("recording: close and recv failed", zap.String("session_id", sessionID), zap.Error(err))
+		c.log.Warn("recording: finalize after the spool replay failed", zap.String("session_id", sessionID), zap.Error(err))
+		c.completeSpooled(sessionID, key)
 		return
 	}
-	url := res.GetRecordingUrl()
-	if url == "" && res.GetError() != "" {
-		c.log.Warn("recording: error from service", zap.String("session_id", sessionID), zap.String("error", res.GetError()))
+	if err := c.spool.Remove(key); err != nil {
+		c.log.Warn("recording: spool remove failed", zap.String("session_id", sessionID), zap.Error(err))
+	}
+	c.report(ctx, sessionID, url)
+}
+
+// fail moves the window to the spool if one is usable; otherwise (or if spooling fails too, or recording-service
+// rejected the recording) it marks the recording failed and discards the window. s.mu must be held.
+func (c *Client) fail(s *sessionStream, err error) {
+	if s.status == model.RecordingStatusFailed {
 		return
 	}
-	if c.sessConn != nil && url != "" {
-		smClient := session_manager_service.NewSessionManagerServiceClient(c.sessConn)
-		_, err = smClient.SetRecordingUrl(ctx, &session_manager_service.SetRecordingUrlRequest{
-			StreamSessionId: sessionID,
-			RecordingUrl:    url,
-		})
-		if err != nil {
-			c.log.Warn("session-manager: SetRecordingUrl failed", zap.String("session_id", sessionID), zap.Error(err))
+	s.closeStream()
+	if c.spool != nil && !s.spooling && !s.spoolFailed && !errors.Is(err, errRecordingRejected) {
+		serr := c.spill(s, err)
+		if serr == nil {
+			return
+		}
+		err = fmt.Errorf("%w; spool: %v", err, serr)
+	}
+	c.log.Error("recording: giving up, recording is truncated",
+		zap.String("session_id", s.id),
+		zap.Uint64("resume_seq", s.win.seq),
+		zap.Int64("resume_offset", s.win.offset),
+		zap.Int("dropped_chunks", len(s.win.chunks)),
+		zap.Error(err))
+	s.dropped += len(s.win.chunks)
+	s.win.reset(s.seq, s.offset)
+	s.sent = 0
+	s.reconnecting = false
+	s.lastErr = err.Error()
+	s.status = model.RecordingStatusFailed
+	s.updatedAt = time.Now()
+	c.notify(s)
+}
+
+// spill moves the window to a new spool entry and switches the session to spooling; the entry continues the
+// recording at the start of the window. If the spool fails, nothing changes and the session does not try the
+// spool again. s.mu must be held.
+func (c *Client) spill(s *sessionStream, cause error) error {
+	m := Manifest{SessionID: s.id, StartSeq: s.win.seq, StartOffset: s.win.offset}
+	key := m.ID()
+	err := c.spool.Begin(m)
+	for i := 0; err == nil && i < len(s.win.chunks); i++ {
+		err = c.spool.Append(key, s.win.chunks[i])
+	}
+	if err != nil {
+		_ = c.spool.Remove(key)
+		s.spoolFailed = true
+		return err
+	}
+	s.spoolKey, s.spoolSeq, s.spoolOffset, s.spoolChunks = key, m.StartSeq, m.StartOffset, len(s.win.chunks)
+	s.spooled += len(s.win.chunks)
+	s.win.reset(s.seq, s.offset)
+	s.sent = 0
+	s.spooling = true
+	s.lastErr = cause.Error()
+	s.status = model.RecordingStatusSpooling
+	s.updatedAt = time.Now()
+	c.log.Warn("recording: recording-service unavailable, spooling to disk",
+		zap.String("session_id", s.id),
+		zap.Uint64("start_seq", m.StartSeq),
+		zap.Int64("start_offset", m.StartOffset),
+		zap.Error(cause))
+	c.notify(s)
+	return nil
+}
+
+// spoolChunk appends data to the session's spool entry; if that fails the recording fails, and what is already
+// spooled is marked complete so it is still uploaded (by the reconnect loop if it is replaying the entry).
+// s.mu must be held.
+func (c *Client) spoolChunk(s *sessionStream, data []byte) {
+	if err := c.spool.Append(s.spoolKey, data); err != nil {
+		s.spooling, s.spoolFailed = false, true
+		s.dropped++
+		if !s.replaying {
+			if cerr := c.spool.Complete(s.spoolKey); cerr != nil {
+				c.log.Warn("recording: spool complete failed", zap.String("session_id", s.id), zap.Error(cerr))
+			}
+			c.wakeUploader()
 		}
+		c.fail(s, err)
+		return
+	}
+	s.spoolChunks++
+	s.spooled++
+	s.seq++
+	s.offset += int64(len(data))
+}
+
+func (c *Client) notify(s *sessionStream) {
+	if c.onState != nil {
+		c.onState(s.id, s.snapshot())
+	}
+}
+
+func (s *sessionStream) snapshot() model.RecordingState {
+	acked, ackedOffset := s.win.seq, s.win.offset
+	if s.spooling {
+		acked, ackedOffset = s.seq, s.offset
+	}
+	return model.RecordingState{
+		SessionID:     s.id,
+		Status:        s.status,
+		Seq:           s.seq,
+		Offset:        s.offset,
+		AckedSeq:      acked,
+		AckedOffset:   ackedOffset,
+		PendingChunks: len(s.win.chunks),
+		SpooledChunks: s.spooled,
+		DroppedChunks: s.dropped,
+		Reconnects:    s.reconnects,
+		LastError:     s.lastErr,
+		UpdatedAt:     s.updatedAt,
 	}
 }
@@ -0,0 +1,238 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/psds-microservice/recording-service/pkg/gen/recording_service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRecordingService behaves like recording-service with the resume contract of Client: every IngestStream
+// continues the recording named by its x-session-id at x-resume-offset (dropping anything after it), and the URL
+// is returned only once the client closes the stream.
+type fakeRecordingService struct {
+	recording_service.UnimplementedRecordingServiceServer
+	addr string
+
+	mu      sync.Mutex
+	files   map[string][]byte
+	offsets []int64 // x-resume-offset of every stream
+	chunks  int     // chunks received over all streams, the last marker included
+	breakAt int     // fail the stream on this chunk (from 1)
+}
+
+func newFakeRecordingService(t *testing.T) *fakeRecordingService {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRecordingService{addr: ln.Addr().String(), files: make(map[string][]byte)}
+	srv := grpc.NewServer()
+	recording_service.RegisterRecordingServiceServer(srv, f)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+	return f
+}
+
+func (f *fakeRecordingService) IngestStream(stream recording_service.RecordingService_IngestStreamServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	var id string
+	var offset int64
+	if v := md.Get(MDSessionID); len(v) == 1 {
+		id = v[0]
+	}
+	if v := md.Get(MDResumeOffset); len(v) == 1 {
+		offset, _ = strconv.ParseInt(v[0], 10, 64)
+	}
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	if int64(len(f.files[id])) < offset {
+		f.mu.Unlock()
+		return status.Errorf(codes.FailedPrecondition, "resume at %d after %d bytes", offset, len(f.files[id]))
+	}
+	f.files[id] = f.files[id][:offset:offset]
+	f.mu.Unlock()
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.chunks++
+		if f.chunks == f.breakAt {
+			f.mu.Unlock()
+			return status.Error(codes.Unavailable, "recording-service restarting")
+		}
+		if chunk.SessionId != id {
+			f.mu.Unlock()
+			return status.Errorf(codes.InvalidArgument, "chunk of %s on the stream of %s", chunk.SessionId, id)
+		}
+		f.files[id] = append(f.files[id], chunk.Data...)
+		f.mu.Unlock()
+		if chunk.Last {
+			break
+		}
+	}
+	return stream.SendAndClose(&recording_service.RecordingResult{RecordingUrl: "rec://" + id})
+}
+
+// recorded returns the recording behind url.
+func (f *fakeRecordingService) recorded(t *testing.T, url string) []byte {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.files[strings.TrimPrefix(url, "rec://")]
+	if !ok {
+		t.Fatalf("recording %s does not exist", url)
+	}
+	return data
+}
+
+func (f *fakeRecordingService) streams() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.offsets...)
+}
+
+// recordedURLs collects what a client reports per session.
+type recordedURLs struct {
+	mu   sync.Mutex
+	urls map[string][]string
+	errs map[string]string
+}
+
+func newTestClient(t *testing.T, addr string, sp *Spool) (*Client, *recordedURLs) {
+	t.Helper()
+	c := NewClient(addr, zap.NewNop())
+	if sp != nil {
+		c.SetSpool(sp)
+	}
+	got := &recordedURLs{urls: make(map[string][]string), errs: make(map[string]string)}
+	c.OnRecordingURL(func(_ context.Context, sessionID, url string) {
+		got.mu.Lock()
+		got.urls[sessionID] = append(got.urls[sessionID], url)
+		got.mu.Unlock()
+	})
+	c.OnRecordingError(func(_ context.Context, sessionID, msg string) {
+		got.mu.Lock()
+		got.errs[sessionID] = msg
+		got.mu.Unlock()
+	})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c, got
+}
+
+func (r *recordedURLs) of(sessionID string) ([]string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.urls[sessionID]...), r.errs[sessionID]
+}
+
+// writeChunks writes n chunks of size bytes (chunk i filled with byte i) and returns everything written.
+func writeChunks(c *Client, sessionID string, n, size int) []byte {
+	var all []byte
+	for i := 0; i < n; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, size)
+		c.WriteChunk(context.Background(), sessionID, data)
+		all = append(all, data...)
+	}
+	return all
+}
+
+func TestClientResumesRecordingAfterStreamBreaks(t *testing.T) {
+	srv := newFakeRecordingService(t)
+	// 1 MiB chunks, more than the resend window in all; the stream breaks on the 20th
+	srv.breakAt = 20
+	c, got := newTestClient(t, srv.addr, nil)
+
+	want := writeChunks(c, "s1", 24, 1<<20)
+	if urls, _ := got.of("s1"); len(urls) != 0 {
+		t.Fatalf("reported %v before the session ended", urls)
+	}
+	c.EndSession(context.Background(), "s1")
+
+	urls, msg := got.of("s1")
+	if msg != "" || len(urls) != 1 || urls[0] != "rec://s1" {
+		t.Fatalf("urls %v, error %q; want the session's one recording", urls, msg)
+	}
+	if rec := srv.recorded(t, urls[0]); !bytes.Equal(rec, want) {
+		t.Fatalf("recorded %d bytes, want the %d bytes written", len(rec), len(want))
+	}
+	offsets := srv.streams()
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] == 0 || offsets[1] > 19<<20 {
+		t.Fatalf("streams resumed at %v, want a second stream resuming within what was read", offsets)
+	}
+}
+
+func TestClientResendsWindowWhenFinalizeFails(t *testing.T) {
+	srv := newFakeRecordingService(t)
+	srv.breakAt = 4 // the last marker: every Send succeeded, nothing is acknowledged
+	c, got := newTestClient(t, srv.addr, nil)
+
+	want := writeChunks(c, "s1", 3, 1024)
+	c.EndSession(context.Background(), "s1")
+
+	urls, msg := got.of("s1")
+	if msg != "" || len(urls) != 1 {
+		t.Fatalf("urls %v, error %q; want one recording", urls, msg)
+	}
+	if rec := srv.recorded(t, urls[0]); !bytes.Equal(rec, want) {
+		t.Fatalf("recorded %d bytes, want %d", len(rec), len(want))
+	}
+	if offsets := srv.streams(); len(offsets) != 2 || offsets[1] != 0 {
+		t.Fatalf("streams resumed at %v, want the window resent from the start on a second stream", offsets)
+	}
+}
+
+func TestClientContinuesStoppedRecording(t *testing.T) {
+	srv := newFakeRecordingService(t)
+	c, got := newTestClient(t, srv.addr, nil)
+
+	first := writeChunks(c, "s1", 2, 100)
+	c.EndSession(context.Background(), "s1") // recording stopped ...
+	second := writeChunks(c, "s1", 3, 100)
+	c.EndSession(context.Background(), "s1") // ... and started again
+
+	urls, _ := got.of("s1")
+	if len(urls) != 2 || urls[0] != "rec://s1" || urls[1] != "rec://s1" {
+		t.Fatalf("urls = %v, want the same recording twice", urls)
+	}
+	if rec := srv.recorded(t, urls[1]); !bytes.Equal(rec, append(first, second...)) {
+		t.Fatal("the recording started again does not continue the stopped one")
+	}
+	if offsets := srv.streams(); len(offsets) != 2 || offsets[1] != 200 {
+		t.Fatalf("streams resumed at %v, want the second at 200", offsets)
+	}
+}
+
+func TestChunkWindowTrim(t *testing.T) {
+	var w chunkWindow
+	w.reset(10, 1000)
+	for range 5 {
+		w.push([]byte("abc"))
+	}
+	if n := w.trim(3, 7); n != 3 || w.seq != 13 || w.offset != 1009 || w.bytes != 6 || len(w.chunks) != 2 {
+		t.Fatalf("trim(3, 7) = %d, window at %d/%d with %d bytes in %d chunks", n, w.seq, w.offset, w.bytes, len(w.chunks))
+	}
+	if n := w.trim(2, 6); n != 0 {
+		t.Fatalf("trimmed %d chunks of a window within its limit", n)
+	}
+}
@@ -0,0 +1,384 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+const (
+	// endSessionTimeout bounds how long EndSession waits for one sink to drain and finalize;
+	// a slow sink finishes in the background and reports its result late.
+	endSessionTimeout = 30 * time.Second
+	// sinkDegradedWindow: a sink that dropped chunks within this window is reported as degraded.
+	sinkDegradedWindow = time.Minute
+)
+
+// Sink is a named recorder behind a Composite.
+type Sink struct {
+	Name     string
+	Recorder Recorder
+}
+
+// Composite fans chunks out to several recorders. Every sink has its own queue and worker, so a slow or
+// failing sink only drops its own chunks. Sessions use all sinks unless a resolver narrows them down;
+// the first sink of a session is its primary: its URL, errors and state are the session's recording result.
+type Composite struct {
+	sinks    []*compositeSink
+	log      *zap.Logger
+	resolver func(sessionID string) ([]string, error)
+
+	mu       sync.Mutex
+	sessions map[string][]*compositeSink // sessionID -> sinks the session is recorded to
+	ending   map[string]*endingRecording // sessionID -> recording still being finalized
+
+	// qmu is held (read) while sending to the queues and (write) by Close, which closes them.
+	qmu    sync.RWMutex
+	closed bool
+
+	onURL   func(ctx context.Context, sessionID, url string)
+	onError func(ctx context.Context, sessionID, msg string)
+	onState func(sessionID string, state model.RecordingState)
+}
+
+// endingRecording is a session's recording whose end is queued but not yet finalized by every sink.
+type endingRecording struct {
+	sinks []*compositeSink
+}
+
+type compositeSink struct {
+	name  string
+	rec   Recorder
+	queue chan sinkOp
+	done  chan struct{}
+
+	processed atomic.Int64
+	dropped   atomic.Int64
+	lastDrop  atomic.Int64 // unix nanos
+	lastErr   atomic.Value // string
+}
+
+// FrameWriter is implemented by a sink that keeps each chunk's websocket message type and media annotations;
+// other sinks get WriteChunk, and only for binary frames.
+type FrameWriter interface {
+	WriteFrame(ctx context.Context, sessionID string, data []byte, f model.RecordedFrame)
+}
+
+type sinkOp struct {
+	sessionID string
+	data      []byte
+	frame     model.RecordedFrame
+	end       chan struct{} // non-nil: EndSession, closed when finalized
+}
+
+// NewComposite starts one worker per sink with a queue of queueSize operations.
+func NewComposite(sinks []Sink, queueSize int, log *zap.Logger) *Composite {
+	c := &Composite{log: log, sessions: make(map[string][]*compositeSink), ending: make(map[string]*endingRecording)}
+	for _, s := range sinks {
+		cs := &compositeSink{name: s.Name, rec: s.Recorder, queue: make(chan sinkOp, queueSize), done: make(chan struct{})}
+		cs.lastErr.Store("")
+		c.sinks = append(c.sinks, cs)
+		s.Recorder.OnRecordingURL(func(ctx context.Context, sessionID, url string) {
+			if c.isPrimary(cs, sessionID) && c.onURL != nil {
+				c.onURL(ctx, sessionID, url)
+				return
+			}
+			log.Info("recording sink: finalized", zap.String("sink", cs.name), zap.String("session_id", sessionID), zap.String("url", url))
+		})
+		s.Recorder.OnRecordingError(func(ctx context.Context, sessionID, msg string) {
+			cs.lastErr.Store(msg)
+			if c.isPrimary(cs, sessionID) && c.onError != nil {
+				c.onError(ctx, sessionID, msg)
+				return
+			}
+			log.Warn("recording sink: failed", zap.String("sink", cs.name), zap.String("session_id", sessionID), zap.String("error", msg))
+		})
+		s.Recorder.OnStateChange(func(sessionID string, st model.RecordingState) {
+			if st.LastError != "" {
+				cs.lastErr.Store(st.LastError)
+			}
+			if c.isPrimary(cs, sessionID) && c.onState != nil {
+				c.onState(sessionID, st)
+			}
+		})
+		go c.work(cs)
+	}
+	return c
+}
+
+// Names returns the configured sink names in order.
+func (c *Composite) Names() []string {
+	out := make([]string, len(c.sinks))
+	for i, s := range c.sinks {
+		out[i] = s.name
+	}
+	return out
+}
+
+// SetSinkResolver sets a lookup of the sinks a session is recorded to (nil or empty: all sinks).
+// It is called by StartSession, once per recording. Set it before the composite is used.
+func (c *Composite) SetSinkResolver(fn func(sessionID string) ([]string, error)) { c.resolver = fn }
+
+// StartSession resolves the sinks of the session's recording unless they are known already; the hub calls it
+// when recording is switched on, before the first chunk. If the lookup fails the session is not recorded
+// (its sinks may exclude some on purpose) and the failure is reported as the session's recording error;
+// the next StartSession retries.
+func (c *Composite) StartSession(ctx context.Context, sessionID string) {
+	c.mu.Lock()
+	_, ok := c.sessions[sessionID]
+	c.mu.Unlock()
+	if ok {
+		return
+	}
+	var names []string
+	if c.resolver != nil {
+		var err error
+		if names, err = c.resolver(sessionID); err != nil {
+			c.log.Error("recording sinks lookup failed, session not recorded", zap.String("session_id", sessionID), zap.Error(err))
+			if c.onError != nil {
+				c.onError(ctx, sessionID, "recording sinks lookup failed: "+err.Error())
+			}
+			return
+		}
+	}
+	var sinks []*compositeSink
+	for _, s := range c.sinks {
+		if len(names) == 0 || slices.Contains(names, s.name) {
+			sinks = append(sinks, s)
+		}
+	}
+	c.mu.Lock()
+	if _, ok := c.sessions[sessionID]; !ok {
+		c.sessions[sessionID] = sinks
+	}
+	c.mu.Unlock()
+}
+
+// OnRecordingURL sets the callback for the recording URL reported by a session's primary sink.
+func (c *Composite) OnRecordingURL(fn func(ctx context.Context, sessionID, url string)) {
+	c.onURL = fn
+}
+
+// OnRecordingError sets the callback for errors reported by a session's primary sink.
+func (c *Composite) OnRecordingError(fn func(ctx context.Context, sessionID, msg string)) {
+	c.onError = fn
+}
+
+// OnStateChange sets the callback for state changes of a session's primary sink. It must not block.
+func (c *Composite) OnStateChange(fn func(sessionID string, state model.RecordingState)) {
+	c.onState = fn
+}
+
+// State returns the recording state of the session's primary sink.
+func (c *Composite) State(sessionID string) (model.RecordingState, bool) {
+	c.mu.Lock()
+	sinks, ok := c.sessions[sessionID]
+	c.mu.Unlock()
+	if !ok || len(sinks) == 0 {
+		return model.RecordingState{}, false
+	}
+	st, ok := sinks[0].rec.State(sessionID)
+	if !ok {
+		// queued chunks not yet written by the primary: the recording exists all the same
+		return model.RecordingState{SessionID: sessionID, Status: model.RecordingStatusRecording, UpdatedAt: time.Now()}, true
+	}
+	return st, true
+}
+
+// WriteChunk queues a binary chunk to every sink of the session.
+func (c *Composite) WriteChunk(ctx context.Context, sessionID string, data []byte) {
+	c.WriteFrame(ctx, sessionID, data, model.RecordedFrame{MessageType: websocket.BinaryMessage})
+}
+
+// WriteFrame queues a chunk to every sink of the session without blocking; a full queue drops the chunk for that sink only.
+func (c *Composite) WriteFrame(_ context.Context, sessionID string, data []byte, f model.RecordedFrame) {
+	op := sinkOp{sessionID: sessionID, data: data, frame: f}
+	c.qmu.RLock()
+	defer c.qmu.RUnlock()
+	if c.closed {
+		return
+	}
+	for _, s := range c.session(sessionID) {
+		select {
+		case s.queue <- op:
+		default:
+			s.dropped.Add(1)
+			s.lastDrop.Store(time.Now().UnixNano())
+		}
+	}
+}
+
+// EndSession queues the end of the session's recording on every sink and returns; the sinks finalize in the
+// background, each logged if it takes longer than endSessionTimeout. A later StartSession starts a new recording.
+func (c *Composite) EndSession(_ context.Context, sessionID string) {
+	c.mu.Lock()
+	sinks, ok := c.sessions[sessionID]
+	rec := &endingRecording{sinks: sinks}
+	if ok {
+		delete(c.sessions, sessionID)
+		c.ending[sessionID] = rec
+	}
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	// queued here, so the end follows the recording's chunks and precedes those of a next one
+	ends := make(map[*compositeSink]chan struct{}, len(sinks))
+	for _, s := range sinks {
+		end := make(chan struct{})
+		if c.enqueue(s, sinkOp{sessionID: sessionID, end: end}) {
+			ends[s] = end
+		}
+	}
+	go func() {
+		var wg sync.WaitGroup
+		for s, end := range ends {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case <-end:
+					return
+				case <-time.After(endSessionTimeout):
+					c.log.Warn("recording sink: finalize still running", zap.String("sink", s.name), zap.String("session_id", sessionID))
+				}
+				<-end
+			}()
+		}
+		wg.Wait()
+		c.mu.Lock()
+		if c.ending[sessionID] == rec {
+			delete(c.ending, sessionID)
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// Health reports queue and drop statistics per sink.
+func (c *Composite) Health() []model.RecordingSinkHealth {
+	out := make([]model.RecordingSinkHealth, 0, len(c.sinks))
+	now := time.Now()
+	for _, s := range c.sinks {
+		h := model.RecordingSinkHealth{
+			Name:      s.name,
+			Status:    model.SinkHealthOK,
+			QueueLen:  len(s.queue),
+			QueueCap:  cap(s.queue),
+			Processed: s.processed.Load(),
+			Dropped:   s.dropped.Load(),
+			LastError: s.lastErr.Load().(string),
+		}
+		if ts := s.lastDrop.Load(); ts != 0 {
+			t := time.Unix(0, ts).UTC()
+			h.LastDropAt = &t
+			if now.Sub(t) < sinkDegradedWindow {
+				h.Status = model.SinkHealthDegraded
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// Run runs every sink's background work until ctx is cancelled.
+func (c *Composite) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range c.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.rec.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// Close stops the workers after their queues drain and closes every sink.
+func (c *Composite) Close() error {
+	var errs []error
+	c.qmu.Lock()
+	if c.closed {
+		c.qmu.Unlock()
+		return nil
+	}
+	c.closed = true
+	for _, s := range c.sinks {
+		close(s.queue)
+	}
+	c.qmu.Unlock()
+	for _, s := range c.sinks {
+		select {
+		case <-s.done:
+		case <-time.After(endSessionTimeout):
+			c.log.Warn("recording sink: queue not drained on close", zap.String("sink", s.name))
+		}
+		if err := s.rec.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue sends op to the sink, blocking while its queue is full; false once the composite is closed.
+func (c *Composite) enqueue(s *compositeSink, op sinkOp) bool {
+	c.qmu.RLock()
+	defer c.qmu.RUnlock()
+	if c.closed {
+		return false
+	}
+	s.queue <- op
+	return true
+}
+
+func (c *Composite) work(s *compositeSink) {
+	defer close(s.done)
+	fr, typed := s.rec.(FrameWriter)
+	ctx := context.Background()
+	for op := range s.queue {
+		switch {
+		case op.end != nil:
+			s.rec.EndSession(ctx, op.sessionID)
+			close(op.end)
+		case typed:
+			fr.WriteFrame(ctx, op.sessionID, op.data, op.frame)
+		case op.frame.MessageType != websocket.BinaryMessage:
+			// a text frame would be indistinguishable from media in a sink without message types
+		default:
+			s.rec.WriteChunk(ctx, op.sessionID, op.data)
+		}
+		s.processed.Add(1)
+	}
+}
+
+// session returns the sinks of the session's recording. Without a resolver a session not started yet is
+// recorded to all sinks; with one it is not recorded until StartSession resolved its sinks.
+func (c *Composite) session(sessionID string) []*compositeSink {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sinks, ok := c.sessions[sessionID]
+	if !ok && c.resolver == nil {
+		sinks = c.sinks
+		c.sessions[sessionID] = sinks
+	}
+	return sinks
+}
+
+// isPrimary reports whether s is the first sink of the session's current or finalizing recording
+// (the first configured sink if neither is known).
+func (c *Composite) isPrimary(s *compositeSink, sessionID string) bool {
+	c.mu.Lock()
+	cur, started := c.sessions[sessionID]
+	ending, finalizing := c.ending[sessionID]
+	c.mu.Unlock()
+	if started || finalizing {
+		return (len(cur) > 0 && cur[0] == s) || (finalizing && len(ending.sinks) > 0 && ending.sinks[0] == s)
+	}
+	return len(c.sinks) > 0 && c.sinks[0] == s
+}
@@ -0,0 +1,115 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// fakeSink records what reaches it; EndSession blocks until release is closed.
+type fakeSink struct {
+	mu      sync.Mutex
+	chunks  map[string]int
+	ended   chan string
+	release chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{chunks: make(map[string]int), ended: make(chan string, 4), release: make(chan struct{})}
+}
+
+func (f *fakeSink) WriteChunk(_ context.Context, sessionID string, _ []byte) {
+	f.mu.Lock()
+	f.chunks[sessionID]++
+	f.mu.Unlock()
+}
+
+func (f *fakeSink) EndSession(_ context.Context, sessionID string) {
+	<-f.release
+	f.ended <- sessionID
+}
+
+func (f *fakeSink) count(sessionID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.chunks[sessionID]
+}
+
+func (f *fakeSink) State(string) (model.RecordingState, bool)                         { return model.RecordingState{}, false }
+func (f *fakeSink) OnRecordingURL(func(ctx context.Context, sessionID, url string))   {}
+func (f *fakeSink) OnRecordingError(func(ctx context.Context, sessionID, msg string)) {}
+func (f *fakeSink) OnStateChange(func(sessionID string, state model.RecordingState))  {}
+func (f *fakeSink) Run(context.Context)                                               {}
+func (f *fakeSink) Close() error                                                      { return nil }
+
+func TestCompositeResolvesSinksOnStart(t *testing.T) {
+	a, b := newFakeSink(), newFakeSink()
+	close(a.release)
+	close(b.release)
+	c := NewComposite([]Sink{{Name: "a", Recorder: a}, {Name: "b", Recorder: b}}, 8, zap.NewNop())
+	defer c.Close()
+	calls := 0
+	c.SetSinkResolver(func(sessionID string) ([]string, error) {
+		calls++
+		if sessionID == "broken" {
+			return nil, errors.New("db down")
+		}
+		return []string{"b"}, nil
+	})
+	var failed string
+	c.OnRecordingError(func(_ context.Context, sessionID, _ string) { failed = sessionID })
+
+	ctx := context.Background()
+	c.WriteChunk(ctx, "s1", []byte("before start")) // not started: dropped
+	c.StartSession(ctx, "s1")
+	c.StartSession(ctx, "s1")
+	c.WriteChunk(ctx, "s1", []byte("x"))
+	c.WriteFrame(ctx, "s1", []byte(`{"event":"track_declare"}`), model.RecordedFrame{MessageType: websocket.TextMessage})
+	c.StartSession(ctx, "broken")
+	c.WriteChunk(ctx, "broken", []byte("x"))
+	c.EndSession(ctx, "s1")
+	<-b.ended
+
+	if calls != 2 {
+		t.Fatalf("resolver called %d times, want once per session", calls)
+	}
+	if a.count("s1") != 0 || b.count("s1") != 1 {
+		t.Fatalf("chunks a=%d b=%d, want only the resolved sink, no text frames and nothing before start", a.count("s1"), b.count("s1"))
+	}
+	if failed != "broken" || a.count("broken")+b.count("broken") != 0 {
+		t.Fatalf("lookup failure: reported %q, chunks written %d; want reported and nothing recorded",
+			failed, a.count("broken")+b.count("broken"))
+	}
+}
+
+func TestCompositeEndSessionDoesNotWaitForSinks(t *testing.T) {
+	s := newFakeSink()
+	c := NewComposite([]Sink{{Name: "a", Recorder: s}}, 8, zap.NewNop())
+	defer c.Close()
+	ctx := context.Background()
+	c.WriteChunk(ctx, "s1", []byte("x"))
+
+	done := make(chan struct{})
+	go func() {
+		c.EndSession(ctx, "s1")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("EndSession waited for the sink to finalize")
+	}
+	if _, ok := c.State("s1"); ok {
+		t.Fatal("session still recording after EndSession")
+	}
+	close(s.release)
+	if got := <-s.ended; got != "s1" {
+		t.Fatalf("ended %q", got)
+	}
+}
@@ -0,0 +1,475 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// Files of one filesystem recording: <dir>/<session_id>_<started>/{media.bin,index.jsonl,manifest.json}.
+// index.jsonl is the chunk index, appended per chunk and kept; manifest.json holds the totals only, so neither
+// the recorder nor the manifest grows with the recording.
+const (
+	fsMediaFile    = "media.bin"
+	fsIndexFile    = "index.jsonl"
+	fsManifestFile = "manifest.json"
+)
+
+// FS recording statuses in manifest.json.
+const (
+	FSStatusRecording   = "recording"
+	FSStatusFinished    = "finished"
+	FSStatusInterrupted = "interrupted" // finalized at startup after the process died mid-recording
+)
+
+// FSChunk describes one chunk in media.bin (a line of index.jsonl). Type is the websocket frame type; the
+// media fields are set for binary frames of a stream the frame inspector recognized (fMP4, MPEG-TS).
+type FSChunk struct {
+	Seq       uint64    `json:"seq"`
+	Offset    int64     `json:"offset"` // byte offset in media.bin
+	Size      int       `json:"size"`
+	Type      string    `json:"type"` // binary or text
+	Time      time.Time `json:"time"`
+	Track     uint8     `json:"track,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Keyframe  bool      `json:"keyframe,omitempty"`
+	Init      bool      `json:"init,omitempty"` // carries the stream configuration (ftyp+moov, PAT/PMT)
+	PTSUs     *int64    `json:"pts_us,omitempty"`
+}
+
+// FSManifest is manifest.json of a filesystem recording.
+type FSManifest struct {
+	SessionID  string     `json:"session_id"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Chunks     uint64     `json:"chunk_count"`
+	Bytes      int64      `json:"bytes"`
+	Media      string     `json:"media"`
+	Index      string     `json:"index"` // FSChunk lines
+}
+
+// FSRecorder is a StreamRecorder that writes recordings to a local directory, for deployments without
+// recording-service. EndSession finalizes the recording; RunRetention removes old recordings.
+type FSRecorder struct {
+	dir      string
+	maxAge   time.Duration // 0 = keep forever
+	maxBytes int64         // 0 = unlimited
+	log      *zap.Logger
+	mu       sync.Mutex
+	sessions map[string]*fsRecording
+	onURL    func(ctx context.Context, sessionID, url string)
+	onError  func(ctx context.Context, sessionID, msg string)
+	onState  func(sessionID string, state model.RecordingState)
+}
+
+type fsRecording struct {
+	mu        sync.Mutex
+	sessionID string
+	path      string
+	media     *os.File
+	index     *os.File
+	seq       uint64
+	offset    int64
+	startedAt time.Time
+	failed    bool
+	lastErr   string
+	dropped   int
+	updatedAt time.Time
+}
+
+// NewFSRecorder creates a filesystem recorder in dir (created if missing) and finalizes recordings
+// left unfinished by a previous process as "interrupted".
+func NewFSRecorder(dir string, maxAge time.Duration, maxBytes int64, log *zap.Logger) (*FSRecorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("recordings dir: %w", err)
+	}
+	r := &FSRecorder{dir: dir, maxAge: maxAge, maxBytes: maxBytes, log: log, sessions: make(map[string]*fsRecording)}
+	if err := r.recoverInterrupted(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnRecordingURL sets a callback invoked from EndSession with the file:// URL of the finalized recording.
+func (r *FSRecorder) OnRecordingURL(fn func(ctx context.Context, sessionID, url string)) {
+	r.onURL = fn
+}
+
+// OnRecordingError sets a callback invoked when a recording cannot be finalized.
+func (r *FSRecorder) OnRecordingError(fn func(ctx context.Context, sessionID, msg string)) {
+	r.onError = fn
+}
+
+// OnStateChange sets a callback invoked when a session's recording starts or fails. It must not block.
+func (r *FSRecorder) OnStateChange(fn func(sessionID string, state model.RecordingState)) {
+	r.onState = fn
+}
+
+// State returns the recording state of a session; false if nothing is being recorded.
+func (r *FSRecorder) State(sessionID string) (model.RecordingState, bool) {
+	r.mu.Lock()
+	rec, ok := r.sessions[sessionID]
+	r.mu.Unlock()
+	if !ok {
+		return model.RecordingState{}, false
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.snapshot(), true
+}
+
+// WriteChunk records a binary chunk.
+func (r *FSRecorder) WriteChunk(ctx context.Context, sessionID string, data []byte) {
+	r.WriteFrame(ctx, sessionID, data, model.RecordedFrame{MessageType: websocket.BinaryMessage})
+}
+
+// WriteFrame records a chunk and indexes it with f; the recording is created on the first chunk.
+func (r *FSRecorder) WriteFrame(_ context.Context, sessionID string, data []byte, f model.RecordedFrame) {
+	rec, err := r.recording(sessionID)
+	if err != nil {
+		r.log.Error("fs recording: start failed", zap.String("session_id", sessionID), zap.Error(err))
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.failed {
+		rec.dropped++
+		return
+	}
+	ch := FSChunk{Seq: rec.seq, Offset: rec.offset, Size: len(data), Type: frameType(f.MessageType), Time: time.Now().UTC(),
+		Track: f.Track, Container: f.Container, Keyframe: f.Keyframe, Init: f.Init}
+	if f.HasPTS {
+		us := f.PTS.Microseconds()
+		ch.PTSUs = &us
+	}
+	line, _ := json.Marshal(ch)
+	if _, err := rec.media.Write(data); err != nil {
+		r.fail(rec, err)
+		return
+	}
+	if _, err := rec.index.Write(append(line, '\n')); err != nil {
+		r.fail(rec, err)
+		return
+	}
+	rec.seq++
+	rec.offset += int64(len(data))
+	rec.updatedAt = ch.Time
+}
+
+// EndSession finalizes the session's recording: closes the files, writes manifest.json with the totals
+// and reports the file:// URL. A later chunk for the same session starts a new recording.
+func (r *FSRecorder) EndSession(ctx context.Context, sessionID string) {
+	r.mu.Lock()
+	rec, ok := r.sessions[sessionID]
+	delete(r.sessions, sessionID)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	_ = rec.media.Close()
+	_ = rec.index.Close()
+	now := time.Now().UTC()
+	m := FSManifest{
+		SessionID:  sessionID,
+		Status:     FSStatusFinished,
+		StartedAt:  rec.startedAt,
+		FinishedAt: &now,
+		Chunks:     rec.seq,
+		Bytes:      rec.offset,
+		Media:      fsMediaFile,
+		Index:      fsIndexFile,
+	}
+	if err := writeFSManifest(rec.path, &m); err != nil {
+		r.log.Error("fs recording: finalize failed", zap.String("session_id", sessionID), zap.Error(err))
+		if r.onError != nil {
+			r.onError(ctx, sessionID, "finalize: "+err.Error())
+		}
+		return
+	}
+	abs, err := filepath.Abs(rec.path)
+	if err != nil {
+		abs = rec.path
+	}
+	url := "file://" + filepath.ToSlash(abs)
+	r.log.Info("fs recording: finalized", zap.String("session_id", sessionID), zap.String("url", url), zap.Uint64("chunks", rec.seq))
+	if r.onURL != nil {
+		r.onURL(ctx, sessionID, url)
+	}
+}
+
+// Close finalizes all open recordings.
+func (r *FSRecorder) Close() error {
+	r.mu.Lock()
+	ids := make([]string, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+	for _, id := range ids {
+		r.EndSession(context.Background(), id)
+	}
+	return nil
+}
+
+// Run applies retention every hour until ctx is cancelled.
+func (r *FSRecorder) Run(ctx context.Context) {
+	r.RunRetention(ctx, time.Hour)
+}
+
+// RunRetention applies Prune every interval until ctx is cancelled.
+func (r *FSRecorder) RunRetention(ctx context.Context, interval time.Duration) {
+	if r.maxAge <= 0 && r.maxBytes <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if n, err := r.Prune(time.Now()); err != nil {
+			r.log.Warn("fs recording: retention failed", zap.Error(err))
+		} else if n > 0 {
+			r.log.Info("fs recording: retention removed recordings", zap.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Prune removes finalized recordings older than maxAge, then the oldest recordings
+// until the total size is within maxBytes. Recordings in progress are never removed. Returns the number of removed entries.
+func (r *FSRecorder) Prune(now time.Time) (int, error) {
+	type entry struct {
+		path     string
+		finished time.Time
+		size     int64
+	}
+	dirs, err := os.ReadDir(r.dir)
+	if err != nil {
+		return 0, err
+	}
+	var list []entry
+	var total int64
+	removed := 0
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue // e.g. session timelines, pruned by Timeline
+		}
+		path := filepath.Join(r.dir, d.Name())
+		m, err := readFSManifest(path)
+		if err != nil {
+			continue // not a recording or being created
+		}
+		size := dirSize(path)
+		total += size
+		if m.Status == FSStatusRecording || m.FinishedAt == nil {
+			continue
+		}
+		list = append(list, entry{path: path, finished: *m.FinishedAt, size: size})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].finished.Before(list[j].finished) })
+	for _, e := range list {
+		expired := r.maxAge > 0 && now.Sub(e.finished) > r.maxAge
+		over := r.maxBytes > 0 && total > r.maxBytes
+		if !expired && !over {
+			continue
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return removed, err
+		}
+		total -= e.size
+		removed++
+	}
+	return removed, nil
+}
+
+// recording returns the open recording of the session, starting a new one on first use.
+func (r *FSRecorder) recording(sessionID string) (*fsRecording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.sessions[sessionID]; ok {
+		return rec, nil
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(r.dir, filepath.Base(sessionID)+"_"+now.Format("20060102T150405.000000000Z"))
+	// a stopped and restarted recording gets a new directory; never reuse (and overwrite) an existing one
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, err
+	}
+	m := FSManifest{SessionID: sessionID, Status: FSStatusRecording, StartedAt: now, Media: fsMediaFile, Index: fsIndexFile}
+	if err := writeFSManifest(path, &m); err != nil {
+		return nil, err
+	}
+	media, err := os.OpenFile(filepath.Join(path, fsMediaFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(filepath.Join(path, fsIndexFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		_ = media.Close()
+		return nil, err
+	}
+	rec := &fsRecording{sessionID: sessionID, path: path, media: media, index: index, startedAt: now, updatedAt: now}
+	r.sessions[sessionID] = rec
+	r.log.Info("fs recording: started", zap.String("session_id", sessionID), zap.String("path", path))
+	if r.onState != nil {
+		r.onState(sessionID, rec.snapshot())
+	}
+	return rec, nil
+}
+
+// fail marks the recording failed after a write error; rec.mu must be held.
+func (r *FSRecorder) fail(rec *fsRecording, err error) {
+	r.log.Error("fs recording: write failed, recording is truncated", zap.String("session_id", rec.sessionID), zap.Error(err))
+	rec.failed = true
+	rec.dropped++
+	rec.lastErr = err.Error()
+	rec.updatedAt = time.Now()
+	if r.onState != nil {
+		r.onState(rec.sessionID, rec.snapshot())
+	}
+}
+
+// recoverInterrupted finalizes recordings whose manifest still says "recording", taking the totals from their
+// index.jsonl (a torn last line is cut off).
+func (r *FSRecorder) recoverInterrupted() error {
+	dirs, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		path := filepath.Join(r.dir, d.Name())
+		m, err := readFSManifest(path)
+		if err != nil || m.Status != FSStatusRecording {
+			continue
+		}
+		m.Chunks, m.Bytes, err = repairFSIndex(filepath.Join(path, fsIndexFile))
+		if err != nil {
+			return err
+		}
+		m.Index = fsIndexFile
+		finished := time.Now().UTC()
+		if info, err := os.Stat(filepath.Join(path, fsMediaFile)); err == nil {
+			finished = info.ModTime().UTC()
+		}
+		m.Status = FSStatusInterrupted
+		m.FinishedAt = &finished
+		if err := writeFSManifest(path, m); err != nil {
+			return err
+		}
+		r.log.Warn("fs recording: finalized interrupted recording", zap.String("session_id", m.SessionID), zap.String("path", path))
+	}
+	return nil
+}
+
+func (rec *fsRecording) snapshot() model.RecordingState {
+	st := model.RecordingState{
+		SessionID:     rec.sessionID,
+		Status:        model.RecordingStatusRecording,
+		Seq:           rec.seq,
+		Offset:        rec.offset,
+		DroppedChunks: rec.dropped,
+		LastError:     rec.lastErr,
+		UpdatedAt:     rec.updatedAt,
+	}
+	if rec.failed {
+		st.Status = model.RecordingStatusFailed
+	}
+	return st
+}
+
+func frameType(messageType int) string {
+	if messageType == websocket.TextMessage {
+		return "text"
+	}
+	return "binary"
+}
+
+// repairFSIndex counts the chunks and bytes in index.jsonl, streaming it, and truncates the file after the
+// last complete entry. A missing index is an empty recording.
+func repairFSIndex(path string) (chunks uint64, bytes int64, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var good int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		var ch FSChunk
+		if err != nil || json.Unmarshal(line, &ch) != nil {
+			break
+		}
+		good += int64(len(line))
+		chunks++
+		bytes = ch.Offset + int64(ch.Size)
+	}
+	return chunks, bytes, f.Truncate(good)
+}
+
+func readFSManifest(dir string) (*FSManifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, fsManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m FSManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", dir, err)
+	}
+	return &m, nil
+}
+
+// writeFSManifest writes manifest.json atomically (temp file + rename).
+func writeFSManifest(dir string, m *FSManifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, fsManifestFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, fsManifestFile))
+}
+
+func dirSize(dir string) int64 {
+	var n int64
+	_ = filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && !strings.HasSuffix(d.Name(), ".tmp") {
+			if info, err := d.Info(); err == nil {
+				n += info.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
@@ -0,0 +1,105 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+func readIndex(t *testing.T, path string) []FSChunk {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []FSChunk
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var ch FSChunk
+		if err := json.Unmarshal(sc.Bytes(), &ch); err != nil {
+			t.Fatalf("index line %q: %v", sc.Text(), err)
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+func TestFSRecorderIndexesFrames(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewFSRecorder(dir, 0, 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var url string
+	r.OnRecordingURL(func(_ context.Context, _, u string) { url = u })
+
+	ctx := context.Background()
+	r.WriteFrame(ctx, "s1", []byte(`{"event":"track_declare"}`), model.RecordedFrame{MessageType: websocket.TextMessage})
+	r.WriteFrame(ctx, "s1", []byte("moov"), model.RecordedFrame{MessageType: websocket.BinaryMessage, Track: 1, Container: "fmp4", Init: true})
+	r.WriteFrame(ctx, "s1", []byte("moof"), model.RecordedFrame{MessageType: websocket.BinaryMessage, Track: 1, Container: "fmp4",
+		Keyframe: true, PTS: 40 * time.Millisecond, HasPTS: true})
+	r.EndSession(ctx, "s1")
+
+	if !strings.HasPrefix(url, "file://") {
+		t.Fatalf("url = %q, want a file:// URL", url)
+	}
+	path := strings.TrimPrefix(url, "file://")
+	m, err := readFSManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Status != FSStatusFinished || m.Chunks != 3 || m.Bytes != int64(len(`{"event":"track_declare"}`)+8) || m.Index != fsIndexFile {
+		t.Fatalf("manifest = %+v", m)
+	}
+	idx := readIndex(t, filepath.Join(path, m.Index))
+	if len(idx) != 3 || idx[0].Type != "text" || idx[0].Container != "" {
+		t.Fatalf("index = %+v", idx)
+	}
+	if ch := idx[1]; ch.Type != "binary" || ch.Track != 1 || !ch.Init || ch.Keyframe || ch.PTSUs != nil {
+		t.Fatalf("init chunk = %+v", ch)
+	}
+	if ch := idx[2]; !ch.Keyframe || ch.PTSUs == nil || *ch.PTSUs != 40000 || ch.Offset != idx[1].Offset+4 {
+		t.Fatalf("keyframe chunk = %+v", ch)
+	}
+}
+
+func TestFSRecorderRecoversTornIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s1_20260101T000000.000000000Z")
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFSManifest(path, &FSManifest{SessionID: "s1", Status: FSStatusRecording, Media: fsMediaFile, Index: fsIndexFile}); err != nil {
+		t.Fatal(err)
+	}
+	index := `{"seq":0,"offset":0,"size":10,"type":"binary"}` + "\n" +
+		`{"seq":1,"offset":10,"size":5,"type":"binary"}` + "\n" +
+		`{"seq":2,"offs`
+	if err := os.WriteFile(filepath.Join(path, fsIndexFile), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFSRecorder(dir, 0, 0, zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readFSManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Status != FSStatusInterrupted || m.Chunks != 2 || m.Bytes != 15 {
+		t.Fatalf("manifest = %+v, want 2 chunks of 15 bytes, interrupted", m)
+	}
+	if idx := readIndex(t, filepath.Join(path, fsIndexFile)); len(idx) != 2 {
+		t.Fatalf("index has %d entries after recovery, want the torn line cut off", len(idx))
+	}
+}
@@ -0,0 +1,271 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpoolFull is returned by Append when the spool size cap would be exceeded.
+var ErrSpoolFull = errors.New("recording spool is full")
+
+// Manifest describes one spooled stretch of a session's recording (see Client). The chunk file continues the
+// recording at StartSeq/StartOffset, where the client's resend window started when the stream broke.
+type Manifest struct {
+	SessionID   string     `json:"session_id"`
+	StartSeq    uint64     `json:"start_seq"`
+	StartOffset int64      `json:"start_offset"`
+	Complete    bool       `json:"complete"` // no more chunks will be appended
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// ID returns the spool key of the entry: <session_id>.<start_seq>.
+func (m Manifest) ID() string {
+	return m.SessionID + "." + strconv.FormatUint(m.StartSeq, 10)
+}
+
+// Spool stores recording chunks on local disk while recording-service is unavailable.
+// Per entry it keeps <id>.json (Manifest) and <id>.chunks (records of 4-byte big-endian length + data).
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	files map[string]*os.File // open chunk files of entries still being appended to
+}
+
+// NewSpool opens (creating if needed) the spool directory; maxBytes caps the total size of chunk files.
+func NewSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool dir: %w", err)
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, files: make(map[string]*os.File)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".chunks") {
+			if info, err := e.Info(); err == nil {
+				s.size += info.Size()
+			}
+		}
+	}
+	return s, nil
+}
+
+// Size returns the current total size of chunk files in bytes.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Begin starts spool entry m.ID(): it writes the manifest and opens the chunk file for Append.
+func (s *Spool) Begin(m Manifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[m.ID()]; ok {
+		return fmt.Errorf("spool entry %s already open", m.ID())
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+	if err := s.writeManifest(&m); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.chunksPath(m.ID()), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.files[m.ID()] = f
+	return nil
+}
+
+// Append adds a chunk to an entry opened by Begin.
+func (s *Spool) Append(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	if !ok {
+		return fmt.Errorf("spool entry %s is not open", id)
+	}
+	rec := int64(4 + len(data))
+	if s.maxBytes > 0 && s.size+rec > s.maxBytes {
+		return ErrSpoolFull
+	}
+	buf := make([]byte, rec)
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := f.Write(buf); err != nil {
+		return err
+	}
+	s.size += rec
+	return nil
+}
+
+// Complete closes the entry's chunk file and marks its manifest complete (ready for upload).
+func (s *Spool) Complete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[id]; ok {
+		_ = f.Close()
+		delete(s.files, id)
+	}
+	m, err := s.readManifest(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	m.Complete = true
+	m.FinishedAt = &now
+	return s.writeManifest(m)
+}
+
+// RecoverIncomplete marks manifests without an open file complete: they belong to a previous process
+// that exited mid-session, so no more chunks will arrive. Call once at startup, before recording begins.
+func (s *Spool) RecoverIncomplete() (int, error) {
+	list, err := s.Manifests()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range list {
+		if m.Complete {
+			continue
+		}
+		s.mu.Lock()
+		_, live := s.files[m.ID()]
+		s.mu.Unlock()
+		if live {
+			continue
+		}
+		if err := s.Complete(m.ID()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Manifests returns all spool entries, oldest first.
+func (s *Spool) Manifests() ([]Manifest, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Manifest
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		m, err := s.readManifest(id)
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// ReadChunks calls fn for every chunk of the entry in order. A truncated trailing record
+// (process killed mid-write) is ignored.
+func (s *Spool) ReadChunks(id string, fn func(data []byte) error) error {
+	f, err := os.Open(s.chunksPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+}
+
+// Remove deletes the entry's spool files.
+func (s *Spool) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[id]; ok {
+		_ = f.Close()
+		delete(s.files, id)
+	}
+	if info, err := os.Stat(s.chunksPath(id)); err == nil {
+		s.size -= info.Size()
+	}
+	if err := os.Remove(s.chunksPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.manifestPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Spool) readManifest(id string) (*Manifest, error) {
+	raw, err := os.ReadFile(s.manifestPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("spool manifest %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// writeManifest writes atomically (temp file + rename) so a crash never leaves a torn manifest.
+func (s *Spool) writeManifest(m *Manifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.manifestPath(m.ID()) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.manifestPath(m.ID()))
+}
+
+func (s *Spool) manifestPath(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+func (s *Spool) chunksPath(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".chunks")
+}
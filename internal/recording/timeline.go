@@ -0,0 +1,113 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+const timelineSuffix = ".timeline.jsonl"
+
+// Timeline stores per-session control-event timelines as <dir>/<session_id>.timeline.jsonl, one JSON event per line.
+// Every Append opens, appends to and closes the file, so idle sessions hold no file handles. Timelines not
+// written to for maxAge are removed by Run.
+type Timeline struct {
+	dir    string
+	maxAge time.Duration // 0 = keep forever
+	log    *zap.Logger
+	mu     sync.Mutex
+}
+
+// NewTimeline opens (creating if needed) the timeline directory.
+func NewTimeline(dir string, maxAge time.Duration, log *zap.Logger) (*Timeline, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Timeline{dir: dir, maxAge: maxAge, log: log}, nil
+}
+
+// Append writes ev to the session's timeline; the file is created on first use and appended to across restarts.
+func (t *Timeline) Append(sessionID string, ev model.TimelineEvent) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := os.OpenFile(t.path(sessionID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Open returns the session's timeline for reading; errs.ErrTimelineNotFound if nothing was recorded.
+func (t *Timeline) Open(sessionID string) (io.ReadCloser, error) {
+	f, err := os.Open(t.path(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errs.ErrTimelineNotFound
+	}
+	return f, err
+}
+
+// Run removes old timelines every hour until ctx is cancelled.
+func (t *Timeline) Run(ctx context.Context) {
+	if t.maxAge <= 0 {
+		return
+	}
+	tick := time.NewTicker(time.Hour)
+	defer tick.Stop()
+	for {
+		if n, err := t.Prune(time.Now()); err != nil {
+			t.log.Warn("timeline: retention failed", zap.Error(err))
+		} else if n > 0 {
+			t.log.Info("timeline: retention removed timelines", zap.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Prune removes timelines last written before now-maxAge and returns how many it removed.
+func (t *Timeline) Prune(now time.Time) (int, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), timelineSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) <= t.maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(t.dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (t *Timeline) path(sessionID string) string {
+	return filepath.Join(t.dir, filepath.Base(sessionID)+timelineSuffix)
+}
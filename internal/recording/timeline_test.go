@@ -0,0 +1,52 @@
+package recording
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+func TestTimelineAppendAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	tl, err := NewTimeline(dir, time.Hour, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{model.TimelineJoin, model.TimelineClientMessage} {
+		if err := tl.Append("s1", model.TimelineEvent{Type: typ}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tl.Append("s2", model.TimelineEvent{Type: model.TimelineJoin}); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := tl.Open("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if n := bytes.Count(raw, []byte("\n")); n != 2 || !bytes.Contains(raw, []byte(`"client_message"`)) {
+		t.Fatalf("timeline = %s", raw)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "s2"+timelineSuffix), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tl.Prune(time.Now()); n != 1 || err != nil {
+		t.Fatalf("prune removed %d, err %v; want the idle timeline", n, err)
+	}
+	if _, err := tl.Open("s2"); err == nil {
+		t.Fatal("pruned timeline still readable")
+	}
+	if _, err := tl.Open("s1"); err != nil {
+		t.Fatalf("recent timeline pruned: %v", err)
+	}
+}
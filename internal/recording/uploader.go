@@ -0,0 +1,134 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/psds-microservice/recording-service/pkg/gen/recording_service"
+	"github.com/psds-microservice/streaming-service/internal/breaker"
+	"go.uber.org/zap"
+)
+
+// spoolUploadInterval is how often spooled recordings are retried while recording-service is down.
+const spoolUploadInterval = 30 * time.Second
+
+// Run drains the spool in the background (see RunUploader) until ctx is cancelled.
+func (c *Client) Run(ctx context.Context) {
+	c.RunUploader(ctx, spoolUploadInterval)
+}
+
+// RunUploader drains the spool to recording-service every interval (and right after a spooled session ends)
+// until ctx is cancelled. Failed uploads stay in the spool for the next round.
+func (c *Client) RunUploader(ctx context.Context, interval time.Duration) {
+	if c.spool == nil {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if n, err := c.FlushSpool(ctx, false); err != nil {
+			c.log.Debug("recording: spool upload incomplete", zap.Int("uploaded", n), zap.Error(err))
+		} else if n > 0 {
+			c.log.Info("recording: spool uploaded", zap.Int("sessions", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// FlushSpool uploads spooled recordings to recording-service: each entry continues its session's recording at the
+// manifest's StartSeq/StartOffset, is finalized, reported via OnRecordingURL and removed from the spool. Entries of
+// a session are uploaded oldest first; after a failed entry the session's later entries wait for the next round,
+// so the recording is continued in order. Only complete entries are uploaded unless all is set (for a stopped
+// service whose sessions will never complete). Entries rejected by recording-service are reported via
+// OnRecordingError and dropped.
+// Returns the number of uploaded entries and the joined upload errors.
+func (c *Client) FlushSpool(ctx context.Context, all bool) (int, error) {
+	if c.spool == nil {
+		return 0, errors.New("recording spool is not configured")
+	}
+	list, err := c.spool.Manifests()
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	blocked := make(map[string]bool) // sessions with an entry that failed this round
+	n := 0
+	for _, m := range list {
+		if (!m.Complete && !all) || blocked[m.SessionID] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		url, uploadErr := c.uploadSpooled(ctx, m)
+		if errors.Is(uploadErr, breaker.ErrOpen) {
+			// recording-service is known to be down: stop this round instead of failing every entry
+			errs = append(errs, uploadErr)
+			break
+		}
+		if uploadErr != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", m.SessionID, uploadErr))
+			if !errors.Is(uploadErr, errRecordingRejected) {
+				blocked[m.SessionID] = true
+				continue // transient: retry next round
+			}
+			// rejected by recording-service: retrying cannot help, report and drop the spooled data
+			c.reportError(ctx, m.SessionID, uploadErr.Error())
+		} else {
+			c.report(ctx, m.SessionID, url)
+		}
+		if err := c.spool.Remove(m.ID()); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", m.SessionID, err))
+			continue
+		}
+		if uploadErr == nil {
+			n++
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// uploadSpooled sends a spooled entry and returns the recording's URL.
+func (c *Client) uploadSpooled(ctx context.Context, m Manifest) (string, error) {
+	url, chunks, err := c.upload(ctx, m.SessionID, m.StartSeq, m.StartOffset, func(fn func([]byte) error) error {
+		return c.spool.ReadChunks(m.ID(), fn)
+	})
+	if err != nil {
+		return "", err
+	}
+	c.log.Info("recording: spooled recording uploaded",
+		zap.String("session_id", m.SessionID),
+		zap.Uint64("start_seq", m.StartSeq),
+		zap.Int64("start_offset", m.StartOffset),
+		zap.Int("chunks", chunks))
+	return url, nil
+}
+
+// upload sends the chunks produced by each as sessionID's recording from seq/offset on, finalizes it and returns
+// its URL and the number of chunks.
+func (c *Client) upload(ctx context.Context, sessionID string, seq uint64, offset int64, each func(fn func([]byte) error) error) (string, int, error) {
+	st, err := c.openAt(ctx, sessionID, seq, offset)
+	if err != nil {
+		return "", 0, err
+	}
+	var chunks int
+	err = each(func(data []byte) error {
+		chunks++
+		return c.call(func() error {
+			return st.Send(&recording_service.StreamChunk{SessionId: sessionID, Data: data})
+		})
+	})
+	if err != nil {
+		_ = st.CloseSend()
+		return "", chunks, err
+	}
+	url, err := c.finalize(st, sessionID)
+	return url, chunks, err
+}
@@ -0,0 +1,173 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newTestSpool(t *testing.T) *Spool {
+	t.Helper()
+	sp, err := NewSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+// unreachableAddr returns a loopback address nothing listens on.
+func unreachableAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func waitStatus(t *testing.T, c *Client, sessionID string, want model.RecordingStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, _ := c.State(sessionID)
+		if st.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, want %s", st.Status, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientSpoolsWhenServiceIsDownAtStart(t *testing.T) {
+	sp := newTestSpool(t)
+	c, _ := newTestClient(t, unreachableAddr(t), sp)
+
+	c.WriteChunk(context.Background(), "s1", []byte("first"))
+	if st, _ := c.State("s1"); st.Status != model.RecordingStatusSpooling || st.SpooledChunks != 1 {
+		t.Fatalf("state after the first chunk = %s with %d spooled, want spooling", st.Status, st.SpooledChunks)
+	}
+	want := append([]byte("first"), writeChunks(c, "s1", 3, 100)...)
+	c.EndSession(context.Background(), "s1")
+
+	// recording-service is back: the uploader (here: recording flush) sends the spooled recording
+	srv := newFakeRecordingService(t)
+	up, got := newTestClient(t, srv.addr, sp)
+	if n, err := up.FlushSpool(context.Background(), false); n != 1 || err != nil {
+		t.Fatalf("flush uploaded %d entries, err %v; want 1", n, err)
+	}
+	urls, _ := got.of("s1")
+	if len(urls) != 1 {
+		t.Fatalf("urls = %v, want one", urls)
+	}
+	if rec := srv.recorded(t, urls[0]); !bytes.Equal(rec, want) {
+		t.Fatalf("uploaded %q, want %q", rec, want)
+	}
+	if list, _ := sp.Manifests(); len(list) != 0 {
+		t.Fatalf("%d entries left in the spool", len(list))
+	}
+}
+
+func TestClientLeavesSpoolOnTheSameRecording(t *testing.T) {
+	srv := newFakeRecordingService(t)
+	var down atomic.Bool
+	sp := newTestSpool(t)
+	c, got := newTestClient(t, srv.addr, nil)
+	c.SetSpool(sp)
+	c.SetDialOptions(
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+			streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			if down.Load() {
+				return nil, status.Error(codes.Unavailable, "connection refused")
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := writeChunks(c, "s1", 4, 1000)
+	if st, _ := c.State("s1"); st.Status != model.RecordingStatusRecording {
+		t.Fatalf("state = %s, want recording", st.Status)
+	}
+	down.Store(true)
+	srv.mu.Lock()
+	srv.breakAt = srv.chunks + 1 // the stream breaks on the next chunk and cannot be reopened
+	srv.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; ; i++ {
+		data := bytes.Repeat([]byte{byte(100 + i)}, 1000)
+		c.WriteChunk(context.Background(), "s1", data)
+		want = append(want, data...)
+		if st, _ := c.State("s1"); st.Status == model.RecordingStatusSpooling {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the broken stream was not noticed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	want = append(want, writeChunks(c, "s1", 3, 1000)...) // spooled
+	down.Store(false)
+	waitStatus(t, c, "s1", model.RecordingStatusRecording)
+	want = append(want, writeChunks(c, "s1", 3, 1000)...) // live again
+	c.EndSession(context.Background(), "s1")
+
+	urls, msg := got.of("s1")
+	if msg != "" || len(urls) != 1 || urls[0] != "rec://s1" {
+		t.Fatalf("urls %v, error %q; want the session's one recording", urls, msg)
+	}
+	if rec := srv.recorded(t, urls[0]); !bytes.Equal(rec, want) {
+		t.Fatalf("recorded %d bytes, want the %d bytes written in order", len(rec), len(want))
+	}
+	if list, _ := sp.Manifests(); len(list) != 0 {
+		t.Fatalf("%d entries left in the spool", len(list))
+	}
+}
+
+func TestFlushSpoolKeepsSessionOrderAfterFailure(t *testing.T) {
+	sp := newTestSpool(t)
+	for i, data := range []string{"abc", "def"} {
+		m := Manifest{SessionID: "s1", StartSeq: uint64(i), StartOffset: int64(3 * i), CreatedAt: time.Now().Add(time.Duration(i) * time.Second)}
+		if err := sp.Begin(m); err != nil {
+			t.Fatal(err)
+		}
+		if err := sp.Append(m.ID(), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := sp.Complete(m.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := newFakeRecordingService(t)
+	srv.breakAt = 1 // the first entry fails
+	c, got := newTestClient(t, srv.addr, sp)
+
+	if n, err := c.FlushSpool(context.Background(), false); n != 0 || err == nil {
+		t.Fatalf("first round uploaded %d entries, err %v; want none", n, err)
+	}
+	if n, err := c.FlushSpool(context.Background(), false); n != 2 || err != nil {
+		t.Fatalf("second round uploaded %d entries, err %v; want 2", n, err)
+	}
+	urls, _ := got.of("s1")
+	if len(urls) != 2 || urls[1] != "rec://s1" {
+		t.Fatalf("urls = %v, want the recording reported after each entry", urls)
+	}
+	if rec := srv.recorded(t, urls[1]); string(rec) != "abcdef" {
+		t.Fatalf("recorded %q, want the entries in order", rec)
+	}
+}
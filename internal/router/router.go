@@ -4,30 +4,91 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/internal/model"
 	"github.com/psds-microservice/streaming-service/pkg/constants"
 )
 
-// New builds the HTTP router.
-func New(
-	sessionHandler *handler.SessionHandler,
-	streamWS *handler.StreamWSHandler,
-	health *handler.HealthHandler,
-) http.Handler {
+// Handlers are the handlers the router serves. New registers the same routes whichever are set: a nil
+// handler is only dereferenced when a request reaches it, so New(Handlers{}) yields the route table.
+type Handlers struct {
+	Sessions  *handler.SessionHandler
+	StreamWS  *handler.StreamWSHandler
+	Health    *handler.HealthHandler
+	Admin     *handler.AdminHandler
+	Webhooks  *handler.WebhookHandler
+	HLS       *handler.HLSHandler
+	WHIP      *handler.WHIPHandler
+	Viewers   *handler.ViewerHandler
+	Snapshots *handler.SnapshotHandler
+	Swagger   *handler.SwaggerHandler
+}
+
+// New builds the HTTP router. Every route except the swagger ones must be documented in api/openapi.json
+// (see CheckSpec; run by "streaming-service openapi check" and the router tests).
+func New(h Handlers) *gin.Engine {
+	sessionHandler, streamWS, health, admin, webhooks := h.Sessions, h.StreamWS, h.Health, h.Admin, h.Webhooks
+	hls, whip, viewers, snapshots, swagger := h.HLS, h.WHIP, h.Viewers, h.Snapshots, h.Swagger
 	r := gin.New()
 	r.Use(gin.Recovery())
 
 	r.GET(constants.PathHealth, health.Health)
 	r.GET(constants.PathReady, health.Ready)
+	r.GET(constants.PathMetrics, gin.WrapH(promhttp.Handler()))
+	r.GET(constants.PathSwagger, func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, constants.PathSwagger+"/") })
+	r.GET(constants.PathSwagger+"/", swagger.UI)
+	r.GET(constants.PathOpenAPI, swagger.Spec)
+	r.GET(constants.PathSwagger+"/:file", swagger.Asset)
 
 	// REST sessions
 	sessions := r.Group("/sessions")
 	{
 		sessions.POST("", sessionHandler.CreateSession)
+		sessions.GET("/:id", sessionHandler.GetSession)
 		sessions.DELETE("/:id", sessionHandler.DeleteSession)
 		sessions.GET("/:id/operators", sessionHandler.GetSessionOperators)
+		sessions.GET("/:id/recording", sessionHandler.GetRecordingState)
+		sessions.GET("/:id/timeline", sessionHandler.GetTimeline)
+		sessions.POST("/:id/recording/start", sessionHandler.ControlRecording(model.RecordingActionStart))
+		sessions.POST("/:id/recording/stop", sessionHandler.ControlRecording(model.RecordingActionStop))
+		sessions.POST("/:id/recording/pause", sessionHandler.ControlRecording(model.RecordingActionPause))
+		sessions.POST("/:id/recording/resume", sessionHandler.ControlRecording(model.RecordingActionResume))
+		sessions.POST("/:id/hls", hls.Enroll)
+		sessions.GET("/:id/hls/index.m3u8", hls.Serve)
+		sessions.GET("/:id/hls/:file", hls.Serve)
+		sessions.GET("/:id/events", viewers.Events)
+		sessions.GET("/:id/stream", viewers.Stream)
+		sessions.POST("/:id/snapshot", snapshots.SignURL)
+		sessions.GET("/:id/snapshot", snapshots.Snapshot)
 	}
 
+	// Admin: live hub inspection and intervention (X-Admin-Token)
+	adminGroup := r.Group("/admin", admin.RequireAdmin)
+	{
+		adminGroup.GET("/sessions", admin.ListSessions)
+		adminGroup.GET("/sessions/:id", admin.GetSession)
+		adminGroup.DELETE("/sessions/:id/peers/:user_id", admin.DisconnectPeer)
+		adminGroup.POST("/sessions/:id/finish", admin.FinishSession)
+		adminGroup.POST("/sessions/:id/broadcast", admin.Broadcast)
+		adminGroup.GET("/recording/sinks", admin.RecordingSinks)
+
+		adminGroup.POST("/webhooks", webhooks.CreateWebhook)
+		adminGroup.GET("/webhooks", webhooks.ListWebhooks)
+		adminGroup.DELETE("/webhooks/:id", webhooks.DeleteWebhook)
+		adminGroup.GET("/webhooks/deliveries", webhooks.ListDeliveries)
+		adminGroup.GET("/webhooks/deliveries/:id", webhooks.GetDelivery)
+		adminGroup.POST("/webhooks/deliveries/:id/replay", webhooks.ReplayDelivery)
+	}
+
+	// WebRTC HTTP ingest/egress: WHIP (stream key) and WHEP (X-User-ID)
+	r.POST("/whip/:session_id", whip.Publish)
+	r.PATCH("/whip/:session_id/:resource_id", whip.Trickle)
+	r.DELETE("/whip/:session_id/:resource_id", whip.Delete)
+	r.POST("/whep/:session_id", whip.View)
+	r.PATCH("/whep/:session_id/:resource_id", whip.Trickle)
+	r.DELETE("/whep/:session_id/:resource_id", whip.Delete)
+
 	// WebSocket: /ws/stream/:session_id/:user_id
 	r.GET("/ws/stream/:session_id/:user_id", streamWS.ServeWS)
 
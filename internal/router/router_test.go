@@ -0,0 +1,74 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/api"
+	"github.com/psds-microservice/streaming-service/internal/handler"
+	"github.com/psds-microservice/streaming-service/pkg/constants"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+// TestRoutesMatchOpenAPI walks the routes of New and compares them with api/openapi.json both ways.
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	routed := Operations(New(Handlers{}))
+	documented, err := api.Operations()
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	for _, op := range routed {
+		if !slices.Contains(documented, op) {
+			t.Errorf("route %s is not documented in api/openapi.json", op)
+		}
+	}
+	for _, op := range documented {
+		if !slices.Contains(routed, op) {
+			t.Errorf("api/openapi.json documents %s, which is not routed", op)
+		}
+	}
+	if n, err := CheckSpec(); err != nil || n != len(routed) {
+		t.Errorf("CheckSpec() = %d, %v; want %d routes and no error", n, err, len(routed))
+	}
+}
+
+func TestOperationsSkipsSwagger(t *testing.T) {
+	for _, op := range Operations(New(Handlers{})) {
+		if strings.Contains(op, constants.PathSwagger) {
+			t.Errorf("Operations lists swagger route %s", op)
+		}
+	}
+}
+
+func TestSwaggerUIIsSelfContained(t *testing.T) {
+	r := New(Handlers{Swagger: handler.NewSwaggerHandler()})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	page := get(constants.PathSwagger + "/")
+	if page.Code != http.StatusOK {
+		t.Fatalf("GET %s/ = %d", constants.PathSwagger, page.Code)
+	}
+	if body := page.Body.String(); strings.Contains(body, "http://") || strings.Contains(body, "https://") {
+		t.Errorf("Swagger UI page loads external resources:\n%s", body)
+	}
+	for _, asset := range []string{"swagger-ui.css", "swagger-ui-bundle.js", "favicon-32x32.png"} {
+		if w := get(constants.PathSwagger + "/" + asset); w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("GET %s = %d (%d bytes), want the embedded asset", asset, w.Code, w.Body.Len())
+		}
+	}
+	if w := get(constants.PathSwagger + "/oauth2-redirect.html"); w.Code != http.StatusNotFound {
+		t.Errorf("GET oauth2-redirect.html = %d, want 404 (not an asset of the page)", w.Code)
+	}
+	if w := get(constants.PathOpenAPI); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"openapi"`) {
+		t.Errorf("GET %s = %d, want the spec", constants.PathOpenAPI, w.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/psds-microservice/streaming-service/api"
+	"github.com/psds-microservice/streaming-service/pkg/constants"
+)
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Operations returns "METHOD /path" for every route of r except the swagger ones, sorted, with path
+// params written as in OpenAPI ({name}).
+func Operations(r *gin.Engine) []string {
+	var ops []string
+	for _, rt := range r.Routes() {
+		if rt.Path == constants.PathSwagger || strings.HasPrefix(rt.Path, constants.PathSwagger+"/") {
+			continue
+		}
+		ops = append(ops, rt.Method+" "+ginParam.ReplaceAllString(rt.Path, "{$1}"))
+	}
+	slices.Sort(ops)
+	return ops
+}
+
+// CheckSpec compares the routes of New with the operations of api/openapi.json and returns the number of
+// routes; the error lists undocumented routes and documented operations that are not routed.
+func CheckSpec() (int, error) {
+	routed := Operations(New(Handlers{}))
+	documented, err := api.Operations()
+	if err != nil {
+		return 0, fmt.Errorf("openapi: parse spec: %w", err)
+	}
+	var problems []string
+	for _, op := range routed {
+		if !slices.Contains(documented, op) {
+			problems = append(problems, "undocumented route: "+op)
+		}
+	}
+	for _, op := range documented {
+		if !slices.Contains(routed, op) {
+			problems = append(problems, "documented but not routed: "+op)
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return len(routed), fmt.Errorf("openapi check failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return len(routed), nil
+}
@@ -0,0 +1,182 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// AMF0 type markers.
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+	amfDate        = 0x0b
+	amfLongString  = 0x0c
+)
+
+var errAMF = errors.New("rtmp: malformed AMF0 data")
+
+// object is an AMF0 object to encode; properties keep their order.
+type object []property
+
+type property struct {
+	key   string
+	value any
+}
+
+// decodeAMF decodes every AMF0 value in b. Objects and ECMA arrays become map[string]any.
+func decodeAMF(b []byte) ([]any, error) {
+	var out []any
+	for len(b) > 0 {
+		v, n, err := decodeValue(b, 0)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+func decodeValue(b []byte, depth int) (any, int, error) {
+	if len(b) == 0 || depth > 16 {
+		return nil, 0, errAMF
+	}
+	switch b[0] {
+	case amfNumber:
+		if len(b) < 9 {
+			return nil, 0, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 9, nil
+	case amfBoolean:
+		if len(b) < 2 {
+			return nil, 0, errAMF
+		}
+		return b[1] != 0, 2, nil
+	case amfString:
+		s, n, err := decodeString(b[1:])
+		return s, 1 + n, err
+	case amfLongString:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		l := int(binary.BigEndian.Uint32(b[1:]))
+		if l > len(b)-5 {
+			return nil, 0, errAMF
+		}
+		return string(b[5 : 5+l]), 5 + l, nil
+	case amfNull, amfUndefined:
+		return nil, 1, nil
+	case amfObject:
+		m, n, err := decodeProperties(b[1:], depth)
+		return m, 1 + n, err
+	case amfECMAArray:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		m, n, err := decodeProperties(b[5:], depth)
+		return m, 5 + n, err
+	case amfStrictArray:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		count := binary.BigEndian.Uint32(b[1:])
+		off := 5
+		var arr []any
+		for i := uint32(0); i < count; i++ {
+			v, n, err := decodeValue(b[off:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			off += n
+		}
+		return arr, off, nil
+	case amfDate:
+		if len(b) < 11 {
+			return nil, 0, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 11, nil
+	}
+	return nil, 0, errAMF
+}
+
+func decodeString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, errAMF
+	}
+	l := int(binary.BigEndian.Uint16(b))
+	if l > len(b)-2 {
+		return "", 0, errAMF
+	}
+	return string(b[2 : 2+l]), 2 + l, nil
+}
+
+// decodeProperties reads key/value pairs up to the object end marker (an empty key followed by 0x09).
+func decodeProperties(b []byte, depth int) (map[string]any, int, error) {
+	m := make(map[string]any)
+	off := 0
+	for {
+		key, n, err := decodeString(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		if key == "" && off < len(b) && b[off] == amfObjectEnd {
+			return m, off + 1, nil
+		}
+		v, n, err := decodeValue(b[off:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		m[key] = v
+		off += n
+	}
+}
+
+// encodeAMF encodes values: float64 and int as numbers, bool, string, object, nil as null.
+func encodeAMF(values ...any) []byte {
+	var b []byte
+	for _, v := range values {
+		b = appendValue(b, v)
+	}
+	return b
+}
+
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case float64:
+		b = append(b, amfNumber)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case int:
+		return appendValue(b, float64(v))
+	case bool:
+		if v {
+			return append(b, amfBoolean, 1)
+		}
+		return append(b, amfBoolean, 0)
+	case string:
+		b = append(b, amfString)
+		return appendString(b, v)
+	case object:
+		b = append(b, amfObject)
+		for _, p := range v {
+			b = appendString(b, p.key)
+			b = appendValue(b, p.value)
+		}
+		return append(b, 0, 0, amfObjectEnd)
+	}
+	return append(b, amfNull)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
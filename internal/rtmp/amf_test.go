@@ -0,0 +1,88 @@
+package rtmp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAMFRoundTrip(t *testing.T) {
+	in := []any{"connect", 1.0, object{{"app", "live"}, {"tcUrl", "rtmp://host/live"}, {"fpad", false}}, nil, true}
+	got, err := decodeAMF(encodeAMF(in...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"connect", 1.0, map[string]any{"app": "live", "tcUrl": "rtmp://host/live", "fpad": false}, nil, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeAMFTypes(t *testing.T) {
+	date := append([]byte{amfDate}, encodeAMF(2.0)[1:]...)
+	for name, tc := range map[string]struct {
+		b    []byte
+		want any
+	}{
+		"long string":  {[]byte{amfLongString, 0, 0, 0, 2, 'o', 'k'}, "ok"},
+		"ECMA array":   {[]byte{amfECMAArray, 0, 0, 0, 1, 0, 1, 'a', amfNull, 0, 0, amfObjectEnd}, map[string]any{"a": nil}},
+		"strict array": {[]byte{amfStrictArray, 0, 0, 0, 2, amfBoolean, 1, amfUndefined}, []any{true, nil}},
+		"date":         {append(date, 0, 0), 2.0}, // milliseconds and a time zone
+	} {
+		v, n, err := decodeValue(tc.b, 0)
+		if err != nil || n != len(tc.b) || !reflect.DeepEqual(v, tc.want) {
+			t.Errorf("%s: %#v (%d of %d bytes), %v; want %#v", name, v, n, len(tc.b), err, tc.want)
+		}
+	}
+}
+
+func TestDecodeAMFMalformed(t *testing.T) {
+	nested := bytes.Repeat([]byte{amfStrictArray, 0, 0, 0, 1}, 32)
+	for name, b := range map[string][]byte{
+		"truncated number":         {amfNumber, 0, 0},
+		"string past the end":      {amfString, 0, 10, 'a'},
+		"long string past the end": {amfLongString, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"object without end":       {amfObject, 0, 1, 'a', amfNull},
+		"array count past the end": {amfStrictArray, 0xff, 0xff, 0xff, 0xff, amfNull},
+		"unknown marker":           {0x10},
+		"nested too deep":          append(nested, amfNull),
+	} {
+		if _, err := decodeAMF(b); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
+
+// FuzzDecodeAMF checks that no input panics or reports more bytes than it has, and that what decodes
+// without objects encodes back to the same values.
+func FuzzDecodeAMF(f *testing.F) {
+	f.Add(encodeAMF("connect", 1, object{{"app", "live"}, {"objectEncoding", 0}}))
+	f.Add(encodeAMF("publish", 0, nil, "sk_live?token=x", "live"))
+	f.Add(encodeAMF("@setDataFrame", "onMetaData", object{{"width", 1280}, {"height", 720}}))
+	f.Add([]byte{amfECMAArray, 0, 0, 0, 1, 0, 1, 'a', amfStrictArray, 0, 0, 0, 1, amfDate, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, amfObjectEnd})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for off := 0; off < len(b); {
+			v, n, err := decodeValue(b[off:], 0)
+			if err != nil {
+				return
+			}
+			if n <= 0 || n > len(b)-off {
+				t.Fatalf("decoded %d bytes at %d of %d", n, off, len(b))
+			}
+			off += n
+			switch v := v.(type) {
+			case float64, bool, string, nil:
+				if f, ok := v.(float64); ok && f != f {
+					continue // NaN never equals itself
+				}
+				if s, ok := v.(string); ok && len(s) > 0xffff {
+					continue // encodeAMF writes short strings only
+				}
+				again, m, err := decodeValue(encodeAMF(v), 0)
+				if err != nil || again != v || m == 0 {
+					t.Fatalf("%#v re-encoded as %#v, %v", v, again, err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+// Message type IDs.
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAck              = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF3         = 15
+	msgCommandAMF3      = 17
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+const (
+	handshakeSize    = 1536
+	defaultChunkSize = 128
+	outChunkSize     = 4096
+	maxChunkSize     = 1 << 24
+	maxMessageSize   = 1<<24 - 1 // the message length field has 24 bits
+	maxBuffered      = 20 << 20  // bytes of unfinished messages held per connection, over all chunk streams
+	maxChunkStreams  = 64
+	windowAckSize    = 2500000
+
+	// chunk stream IDs used for outgoing messages
+	csidControl = 2
+	csidCommand = 3
+	csidStatus  = 5
+)
+
+var errProtocol = errors.New("rtmp: protocol error")
+
+type message struct {
+	typ      uint8
+	streamID uint32
+	ts       uint32 // milliseconds
+	payload  []byte
+}
+
+// chunkStream is the header state of one incoming chunk stream.
+type chunkStream struct {
+	ts, delta uint32
+	length    uint32
+	typ       uint8
+	streamID  uint32
+	ext       bool // the last header used an extended timestamp
+	buf       []byte
+}
+
+// chunkConn reads and writes RTMP messages over the chunk stream protocol.
+type chunkConn struct {
+	nc       net.Conn
+	r        *bufio.Reader
+	w        *bufio.Writer
+	read     uint64 // bytes read, for acknowledgements
+	acked    uint64
+	window   uint32
+	inChunk  uint32
+	streams  map[uint32]*chunkStream
+	buffered int // len(buf) summed over streams
+}
+
+func newChunkConn(nc net.Conn) *chunkConn {
+	c := &chunkConn{nc: nc, inChunk: defaultChunkSize, streams: make(map[uint32]*chunkStream)}
+	c.r = bufio.NewReaderSize(countingReader{nc, &c.read}, 16<<10)
+	c.w = bufio.NewWriterSize(nc, 16<<10)
+	return c
+}
+
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += uint64(n)
+	return n, err
+}
+
+// handshake runs the simple (version 3) handshake: C0+C1 are answered with S0+S1+S2 (S2 echoes C1), then C2 is read.
+func (c *chunkConn) handshake() error {
+	c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.r, c1); err != nil {
+		return err
+	}
+	if c1[0] != 3 {
+		return fmt.Errorf("rtmp: unsupported version %d", c1[0])
+	}
+	s := make([]byte, 1+2*handshakeSize)
+	s[0] = 3
+	binary.BigEndian.PutUint32(s[1:], uint32(time.Now().UnixMilli()))
+	if _, err := rand.Read(s[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	copy(s[1+handshakeSize:], c1[1:])
+	if _, err := c.w.Write(s); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(c.r, c1[:handshakeSize])
+	return err
+}
+
+// readMessage returns the next complete message. Protocol control messages are handled here
+// (chunk size, abort, window size) and also returned.
+func (c *chunkConn) readMessage() (message, error) {
+	for {
+		msg, ok, err := c.readChunk()
+		if err != nil {
+			return message{}, err
+		}
+		if c.window > 0 && c.read-c.acked >= uint64(c.window) {
+			c.acked = c.read
+			if err := c.writeMessage(csidControl, msgAck, 0, 0, binary.BigEndian.AppendUint32(nil, uint32(c.read))); err != nil {
+				return message{}, err
+			}
+		}
+		if !ok {
+			continue
+		}
+		switch msg.typ {
+		case msgSetChunkSize:
+			if len(msg.payload) < 4 {
+				return message{}, errProtocol
+			}
+			size := binary.BigEndian.Uint32(msg.payload) & 0x7fffffff
+			if size == 0 || size > maxChunkSize {
+				return message{}, errProtocol
+			}
+			c.inChunk = size
+		case msgAbort:
+			if len(msg.payload) >= 4 {
+				if cs := c.streams[binary.BigEndian.Uint32(msg.payload)]; cs != nil {
+					c.buffered -= len(cs.buf)
+					cs.buf = nil
+				}
+			}
+		case msgWindowAckSize:
+			if len(msg.payload) >= 4 {
+				c.window = binary.BigEndian.Uint32(msg.payload)
+			}
+		}
+		return msg, nil
+	}
+}
+
+// readChunk reads one chunk; ok is set when it completes a message.
+func (c *chunkConn) readChunk() (msg message, ok bool, err error) {
+	b0, err := c.r.ReadByte()
+	if err != nil {
+		return msg, false, err
+	}
+	format := b0 >> 6
+	csid := uint32(b0 & 0x3f)
+	switch csid {
+	case 0:
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return msg, false, err
+		}
+		csid = 64 + uint32(b)
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return msg, false, err
+		}
+		csid = 64 + uint32(b[0]) + uint32(b[1])<<8
+	}
+	cs := c.streams[csid]
+	if cs == nil {
+		if format != 0 || len(c.streams) >= maxChunkStreams {
+			return msg, false, errProtocol
+		}
+		cs = &chunkStream{}
+		c.streams[csid] = cs
+	}
+
+	var hdr [11]byte
+	n := [4]int{11, 7, 3, 0}[format]
+	if _, err := io.ReadFull(c.r, hdr[:n]); err != nil {
+		return msg, false, err
+	}
+	var ts uint32
+	if format < 3 {
+		ts = uint32(hdr[0])<<16 | uint32(hdr[1])<<8 | uint32(hdr[2])
+		cs.ext = ts == 0xffffff
+	}
+	if format < 2 {
+		cs.length = uint32(hdr[3])<<16 | uint32(hdr[4])<<8 | uint32(hdr[5])
+		cs.typ = hdr[6]
+	}
+	if format == 0 {
+		cs.streamID = binary.LittleEndian.Uint32(hdr[7:])
+	}
+	if cs.ext {
+		var b [4]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return msg, false, err
+		}
+		if format < 3 {
+			ts = binary.BigEndian.Uint32(b[:])
+		}
+	}
+	if format < 3 && len(cs.buf) > 0 {
+		return msg, false, errProtocol // a new header in the middle of a message
+	}
+	if len(cs.buf) == 0 {
+		switch format {
+		case 0:
+			cs.ts, cs.delta = ts, ts
+		case 1, 2:
+			cs.ts += ts
+			cs.delta = ts
+		case 3:
+			cs.ts += cs.delta
+		}
+	}
+	size := int(min(c.inChunk, cs.length-uint32(len(cs.buf))))
+	if c.buffered+size > maxBuffered {
+		return msg, false, errProtocol
+	}
+	// grow with the data actually received: the declared length alone allocates nothing
+	start := len(cs.buf)
+	cs.buf = slices.Grow(cs.buf, size)[:start+size]
+	c.buffered += size
+	if _, err := io.ReadFull(c.r, cs.buf[start:]); err != nil {
+		return msg, false, err
+	}
+	if uint32(len(cs.buf)) < cs.length {
+		return msg, false, nil
+	}
+	msg = message{typ: cs.typ, streamID: cs.streamID, ts: cs.ts, payload: cs.buf}
+	c.buffered -= len(cs.buf)
+	cs.buf = nil
+	return msg, true, nil
+}
+
+// writeMessage sends a message in outChunkSize chunks: a type 0 header, then type 3 continuations.
+func (c *chunkConn) writeMessage(csid uint8, typ uint8, streamID, ts uint32, payload []byte) error {
+	hdr := []byte{csid, 0, 0, 0, byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), typ}
+	if ts >= 0xffffff {
+		hdr[1], hdr[2], hdr[3] = 0xff, 0xff, 0xff
+	} else {
+		hdr[1], hdr[2], hdr[3] = byte(ts>>16), byte(ts>>8), byte(ts)
+	}
+	hdr = binary.LittleEndian.AppendUint32(hdr, streamID)
+	if ts >= 0xffffff {
+		hdr = binary.BigEndian.AppendUint32(hdr, ts)
+	}
+	if _, err := c.w.Write(hdr); err != nil {
+		return err
+	}
+	for {
+		n := min(len(payload), outChunkSize)
+		if _, err := c.w.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if len(payload) == 0 {
+			break
+		}
+		if err := c.w.WriteByte(0xc0 | csid); err != nil {
+			return err
+		}
+		if ts >= 0xffffff {
+			if _, err := c.w.Write(binary.BigEndian.AppendUint32(nil, ts)); err != nil {
+				return err
+			}
+		}
+	}
+	return c.w.Flush()
+}
+
+// writeControl sends the connect preamble: window acknowledgement size, peer bandwidth and our chunk size.
+func (c *chunkConn) writeControl() error {
+	if err := c.writeMessage(csidControl, msgWindowAckSize, 0, 0, binary.BigEndian.AppendUint32(nil, windowAckSize)); err != nil {
+		return err
+	}
+	if err := c.writeMessage(csidControl, msgSetPeerBandwidth, 0, 0, append(binary.BigEndian.AppendUint32(nil, windowAckSize), 2)); err != nil {
+		return err
+	}
+	return c.writeMessage(csidControl, msgSetChunkSize, 0, 0, binary.BigEndian.AppendUint32(nil, outChunkSize))
+}
+
+// writeCommand sends an AMF0 command.
+func (c *chunkConn) writeCommand(csid uint8, streamID uint32, values ...any) error {
+	return c.writeMessage(csid, msgCommandAMF0, streamID, 0, encodeAMF(values...))
+}
@@ -0,0 +1,165 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// readerConn is a chunkConn reading raw; what it writes (acknowledgements) is discarded.
+func readerConn(raw []byte) *chunkConn {
+	return &chunkConn{
+		inChunk: defaultChunkSize,
+		streams: make(map[uint32]*chunkStream),
+		r:       bufio.NewReader(bytes.NewReader(raw)),
+		w:       bufio.NewWriter(io.Discard),
+	}
+}
+
+// chunk0 is a type 0 chunk header: csid (< 64), timestamp, message length, type and stream ID.
+func chunk0(csid byte, ts uint32, length int, typ byte, streamID uint32) []byte {
+	b := []byte{csid, byte(ts >> 16), byte(ts >> 8), byte(ts), byte(length >> 16), byte(length >> 8), byte(length), typ}
+	return binary.LittleEndian.AppendUint32(b, streamID)
+}
+
+func setChunkSize(size uint32) []byte {
+	return append(chunk0(csidControl, 0, 4, msgSetChunkSize, 0), binary.BigEndian.AppendUint32(nil, size)...)
+}
+
+func TestReadMessageChunking(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 300)
+	// default chunk size: 128 + 128 + 44 bytes, continued with type 3 headers
+	raw := append(chunk0(4, 1000, len(payload), msgVideo, 1), payload[:128]...)
+	raw = append(append(raw, 0xc4), payload[128:256]...)
+	raw = append(append(raw, 0xc4), payload[256:]...)
+	// a type 1 chunk: the timestamp is a delta to the previous message of the chunk stream
+	raw = append(raw, 0x44, 0, 0, 40, 0, 0, 2, msgAudio, 1, 2)
+	// after Set Chunk Size, 300 bytes fit one chunk
+	raw = append(raw, setChunkSize(4096)...)
+	raw = append(append(raw, chunk0(4, 2000, len(payload), msgVideo, 1)...), payload...)
+
+	c := readerConn(raw)
+	for i, want := range []message{
+		{typ: msgVideo, streamID: 1, ts: 1000, payload: payload},
+		{typ: msgAudio, streamID: 1, ts: 1040, payload: []byte{1, 2}},
+		{typ: msgSetChunkSize, payload: binary.BigEndian.AppendUint32(nil, 4096)},
+		{typ: msgVideo, streamID: 1, ts: 2000, payload: payload},
+	} {
+		msg, err := c.readMessage()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if msg.typ != want.typ || msg.streamID != want.streamID || msg.ts != want.ts || !bytes.Equal(msg.payload, want.payload) {
+			t.Fatalf("message %d = type %d stream %d ts %d (%d bytes), want type %d stream %d ts %d (%d bytes)",
+				i, msg.typ, msg.streamID, msg.ts, len(msg.payload), want.typ, want.streamID, want.ts, len(want.payload))
+		}
+	}
+	if c.inChunk != 4096 || c.buffered != 0 {
+		t.Fatalf("chunk size %d, %d bytes buffered", c.inChunk, c.buffered)
+	}
+}
+
+func TestReadMessageExtendedTimestamp(t *testing.T) {
+	const ts = 0x01020304 // above 0xffffff: carried in the extended timestamp field
+	payload := bytes.Repeat([]byte{1}, outChunkSize+10)
+	var out bytes.Buffer
+	w := &chunkConn{w: bufio.NewWriter(&out)}
+	if err := w.writeMessage(6, msgVideo, 1, ts, payload); err != nil {
+		t.Fatal(err)
+	}
+	raw := out.Bytes()
+	if !bytes.Equal(raw[1:4], []byte{0xff, 0xff, 0xff}) {
+		t.Fatalf("timestamp field %x, want the extended marker", raw[1:4])
+	}
+
+	c := readerConn(append(setChunkSize(outChunkSize), raw...))
+	if _, err := c.readMessage(); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the continuation chunk repeats the extended timestamp; it must not end up in the payload
+	if msg.ts != ts || !bytes.Equal(msg.payload, payload) {
+		t.Fatalf("ts %#x with %d bytes, want %#x with %d", msg.ts, len(msg.payload), ts, len(payload))
+	}
+}
+
+func TestReadMessageLimits(t *testing.T) {
+	const half = 8 << 20
+	// two chunk streams each holding half of an unfinished message of the largest length
+	pending := setChunkSize(half)
+	for _, csid := range []byte{4, 5} {
+		pending = append(append(pending, chunk0(csid, 0, maxMessageSize, msgVideo, 1)...), make([]byte, half)...)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		// messages read before the error
+		ok int
+	}{
+		{"chunk size zero", setChunkSize(0), 0},
+		{"chunk size above the maximum", setChunkSize(maxChunkSize + 1), 0},
+		{"first chunk of a stream without a full header", []byte{0xc4, 1, 2, 3}, 0},
+		{"new header in the middle of a message", append(append(chunk0(4, 0, 200, msgVideo, 1), make([]byte, 128)...), chunk0(4, 0, 10, msgVideo, 1)...), 0},
+		{"unfinished messages above the buffer limit", append(pending, chunk0(6, 0, maxMessageSize, msgVideo, 1)...), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := readerConn(tc.raw)
+			for i := 0; i < tc.ok; i++ {
+				if _, err := c.readMessage(); err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+			}
+			if _, err := c.readMessage(); !errors.Is(err, errProtocol) {
+				t.Fatalf("got %v, want a protocol error", err)
+			}
+		})
+	}
+}
+
+func TestReadMessageLargest(t *testing.T) {
+	// the declared length alone allocates nothing: a message cut short holds at most a chunk
+	raw := append(setChunkSize(outChunkSize), chunk0(4, 0, maxMessageSize, msgVideo, 1)...)
+	c := readerConn(append(raw, make([]byte, 1000)...))
+	if _, err := c.readMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.readMessage(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated message: %v", err)
+	}
+	if n := cap(c.streams[4].buf); n > outChunkSize {
+		t.Fatalf("%d bytes allocated for a chunk of %d", n, outChunkSize)
+	}
+
+	raw = append(setChunkSize(maxChunkSize), chunk0(4, 0, maxMessageSize, msgVideo, 1)...)
+	c = readerConn(append(raw, make([]byte, maxMessageSize)...))
+	if _, err := c.readMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := c.readMessage(); err != nil || len(msg.payload) != maxMessageSize {
+		t.Fatalf("largest message: %d bytes, %v", len(msg.payload), err)
+	}
+}
+
+func TestReadMessageChunkStreamLimit(t *testing.T) {
+	var raw []byte
+	for i := 0; i <= maxChunkStreams; i++ {
+		// two-byte chunk basic headers: chunk stream IDs 64 and up
+		raw = append(raw, 0, byte(i), 0, 0, 0, 0, 0, 1, msgAudio, 1, 0, 0, 0, 0xaf)
+	}
+	c := readerConn(raw)
+	for i := 0; i < maxChunkStreams; i++ {
+		if _, err := c.readMessage(); err != nil {
+			t.Fatalf("chunk stream %d: %v", 64+i, err)
+		}
+	}
+	if _, err := c.readMessage(); !errors.Is(err, errProtocol) {
+		t.Fatalf("chunk stream beyond the limit: %v, want a protocol error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package rtmp
+
+import "encoding/binary"
+
+// FLV tag types (the RTMP message types of the same media).
+const (
+	tagAudio  = 8
+	tagVideo  = 9
+	tagScript = 18
+)
+
+// Codec IDs of the FLV audio and video tag headers.
+const (
+	codecAVC       = 7
+	soundAAC       = 10
+	frameKey       = 1
+	avcSeqHeader   = 0
+	avcNALU        = 1
+	aacSeqHeader   = 0
+	aacRaw         = 1
+	flvHeaderFlags = 0x05 // audio and video present
+)
+
+// flvTag builds an FLV tag: 11-byte header, data and the trailing PreviousTagSize.
+func flvTag(typ uint8, ts uint32, data []byte) []byte {
+	b := make([]byte, 0, 11+len(data)+4)
+	b = append(b, typ, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	b = append(b, byte(ts>>16), byte(ts>>8), byte(ts), byte(ts>>24), 0, 0, 0)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, uint32(11+len(data)))
+}
+
+// flvHeader is the FLV file header followed by PreviousTagSize0.
+func flvHeader() []byte {
+	return []byte{'F', 'L', 'V', 1, flvHeaderFlags, 0, 0, 0, 9, 0, 0, 0, 0}
+}
+
+// isKeyframe reports whether an FLV video tag body is a keyframe.
+func isKeyframe(video []byte) bool {
+	return len(video) > 0 && video[0]>>4 == frameKey
+}
+
+// isSequenceHeader reports whether an audio or video tag body carries the codec configuration
+// (AVCDecoderConfigurationRecord, AudioSpecificConfig) that a decoder needs before any frame.
+func isSequenceHeader(typ uint8, body []byte) bool {
+	if len(body) < 2 {
+		return false
+	}
+	switch typ {
+	case tagVideo:
+		return body[0]&0x0f == codecAVC && body[1] == avcSeqHeader
+	case tagAudio:
+		return body[0]>>4 == soundAAC && body[1] == aacSeqHeader
+	}
+	return false
+}
+
+// flvPackager relays every tag as one binary frame, unchanged. Operators that join mid-stream get a
+// header frame (FLV header, metadata and sequence headers) before the next keyframe, so the frames they
+// receive from there on concatenate into a playable FLV file.
+type flvPackager struct {
+	meta, video, audio []byte // last script, video and audio sequence header tags
+}
+
+func (p *flvPackager) header() []byte {
+	b := flvHeader()
+	for _, t := range [][]byte{p.meta, p.video, p.audio} {
+		b = append(b, t...)
+	}
+	return b
+}
+
+func (p *flvPackager) tag(typ uint8, ts uint32, body []byte) (frames [][]byte, key bool) {
+	t := flvTag(typ, ts, body)
+	switch {
+	case typ == tagScript:
+		p.meta = t
+	case isSequenceHeader(typ, body) && typ == tagVideo:
+		p.video = t
+	case isSequenceHeader(typ, body):
+		p.audio = t
+	}
+	if isSequenceHeader(typ, body) {
+		return [][]byte{t}, false
+	}
+	// audio-only streams: every audio frame is a starting point
+	return [][]byte{t}, typ == tagVideo && isKeyframe(body) || typ == tagAudio && p.video == nil
+}
@@ -0,0 +1,350 @@
+package rtmp
+
+import "encoding/binary"
+
+const (
+	tsPacketSize = 188
+	pidPAT       = 0x0000
+	pidPMT       = 0x1000
+	pidVideo     = 0x0100
+	pidAudio     = 0x0101
+	streamH264   = 0x1b
+	streamAAC    = 0x0f
+	ptsMask      = 1<<33 - 1
+)
+
+// tsMuxer repackages H.264 and AAC tags into MPEG-TS: one binary frame per access unit (a PES split
+// into 188-byte packets), with PAT and PMT in front of every keyframe. AVC NAL units are converted to
+// Annex B with an access unit delimiter, SPS and PPS are repeated before every IDR frame, and AAC frames
+// get ADTS headers. Other codecs are dropped.
+type tsMuxer struct {
+	sps, pps   [][]byte
+	nalLen     int
+	asc        []byte // AudioSpecificConfig
+	hasVideo   bool
+	hasAudio   bool
+	pmtVersion byte
+	pmtStreams byte // bit 0 video, bit 1 audio: the streams the last PMT listed
+	cc         map[uint16]byte
+	dropped    func(typ uint8, codec byte)
+}
+
+func newTSMuxer(dropped func(typ uint8, codec byte)) *tsMuxer {
+	return &tsMuxer{cc: make(map[uint16]byte), dropped: dropped}
+}
+
+// header is nil: PAT, PMT and the parameter sets are repeated at every keyframe.
+func (m *tsMuxer) header() []byte { return nil }
+
+func (m *tsMuxer) tag(typ uint8, ts uint32, body []byte) ([][]byte, bool) {
+	if len(body) < 2 {
+		return nil, false
+	}
+	switch typ {
+	case tagVideo:
+		if body[0]&0x0f != codecAVC {
+			m.dropped(typ, body[0]&0x0f)
+			return nil, false
+		}
+		if len(body) < 5 {
+			return nil, false
+		}
+		switch body[1] {
+		case avcSeqHeader:
+			m.parseAVCConfig(body[5:])
+		case avcNALU:
+			cts := int32(uint32(body[2])<<16|uint32(body[3])<<8|uint32(body[4])) << 8 >> 8 // SI24
+			key := isKeyframe(body)
+			es := m.annexB(body[5:], key)
+			if es == nil {
+				return nil, false
+			}
+			dts := uint64(ts) * 90
+			pts := uint64(int64(dts) + int64(cts)*90)
+			var out []byte
+			if key {
+				out = m.psi()
+			}
+			out = append(out, m.pes(pidVideo, 0xe0, es, pts&ptsMask, dts&ptsMask, key, true)...)
+			return [][]byte{out}, key
+		}
+	case tagAudio:
+		if body[0]>>4 != soundAAC {
+			m.dropped(typ, body[0]>>4)
+			return nil, false
+		}
+		switch body[1] {
+		case aacSeqHeader:
+			m.asc = append([]byte(nil), body[2:]...)
+			m.hasAudio = len(m.asc) >= 2
+		case aacRaw:
+			if !m.hasAudio {
+				return nil, false
+			}
+			pts := uint64(ts) * 90 & ptsMask
+			var out []byte
+			if !m.hasVideo {
+				out = m.psi() // audio only: every frame is a random access point
+			}
+			out = append(out, m.pes(pidAudio, 0xc0, m.adts(body[2:]), pts, pts, true, !m.hasVideo)...)
+			return [][]byte{out}, !m.hasVideo
+		}
+	}
+	return nil, false
+}
+
+// parseAVCConfig reads the NAL length size, SPS and PPS of an AVCDecoderConfigurationRecord.
+func (m *tsMuxer) parseAVCConfig(b []byte) {
+	if len(b) < 7 {
+		return
+	}
+	m.nalLen = int(b[4]&0x03) + 1
+	m.sps, m.pps = nil, nil
+	off := 6
+	n := int(b[5] & 0x1f)
+	for i := 0; i < n && off+2 <= len(b); i++ {
+		l := int(binary.BigEndian.Uint16(b[off:]))
+		if off+2+l > len(b) {
+			return
+		}
+		m.sps = append(m.sps, append([]byte(nil), b[off+2:off+2+l]...))
+		off += 2 + l
+	}
+	if off >= len(b) {
+		return
+	}
+	n = int(b[off])
+	off++
+	for i := 0; i < n && off+2 <= len(b); i++ {
+		l := int(binary.BigEndian.Uint16(b[off:]))
+		if off+2+l > len(b) {
+			return
+		}
+		m.pps = append(m.pps, append([]byte(nil), b[off+2:off+2+l]...))
+		off += 2 + l
+	}
+	m.hasVideo = len(m.sps) > 0
+}
+
+// annexB converts length-prefixed NAL units to a start-code stream with an access unit delimiter,
+// inserting SPS and PPS before an IDR frame that does not carry them.
+func (m *tsMuxer) annexB(b []byte, key bool) []byte {
+	if !m.hasVideo {
+		return nil
+	}
+	startCode := []byte{0, 0, 0, 1}
+	out := append([]byte(nil), 0, 0, 0, 1, 0x09, 0xf0)
+	var nals [][]byte
+	hasParams := false
+	for len(b) >= m.nalLen {
+		l := 0
+		for i := 0; i < m.nalLen; i++ {
+			l = l<<8 | int(b[i])
+		}
+		b = b[m.nalLen:]
+		if l > len(b) {
+			break
+		}
+		nal := b[:l]
+		b = b[l:]
+		if len(nal) == 0 {
+			continue
+		}
+		switch nal[0] & 0x1f {
+		case 9: // access unit delimiter: ours is already in front
+			continue
+		case 7, 8:
+			hasParams = true
+		}
+		nals = append(nals, nal)
+	}
+	if len(nals) == 0 {
+		return nil
+	}
+	if key && !hasParams {
+		for _, p := range append(append([][]byte(nil), m.sps...), m.pps...) {
+			out = append(append(out, startCode...), p...)
+		}
+	}
+	for _, nal := range nals {
+		out = append(append(out, startCode...), nal...)
+	}
+	return out
+}
+
+// adts prefixes a raw AAC frame with an ADTS header built from the AudioSpecificConfig.
+func (m *tsMuxer) adts(frame []byte) []byte {
+	profile := m.asc[0]>>3 - 1 // audio object type - 1
+	freq := (m.asc[0]&0x07)<<1 | m.asc[1]>>7
+	channels := m.asc[1] >> 3 & 0x0f
+	n := len(frame) + 7
+	h := []byte{
+		0xff, 0xf1,
+		profile<<6 | freq<<2 | channels>>2,
+		channels&0x03<<6 | byte(n>>11),
+		byte(n >> 3),
+		byte(n&0x07)<<5 | 0x1f,
+		0xfc,
+	}
+	return append(h, frame...)
+}
+
+// psi returns PAT and PMT packets; the PMT version changes when the set of streams does.
+func (m *tsMuxer) psi() []byte {
+	var streams byte
+	if m.hasVideo {
+		streams |= 1
+	}
+	if m.hasAudio {
+		streams |= 2
+	}
+	if streams != m.pmtStreams {
+		if m.pmtStreams != 0 {
+			m.pmtVersion = (m.pmtVersion + 1) & 0x1f
+		}
+		m.pmtStreams = streams
+	}
+
+	pat := []byte{0x00, 0xb0, 13, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xe0 | pidPMT>>8, pidPMT & 0xff}
+	pcrPID := uint16(pidAudio)
+	if m.hasVideo {
+		pcrPID = pidVideo
+	}
+	pmt := []byte{0x02, 0xb0, 0, 0x00, 0x01, 0xc1 | m.pmtVersion<<1, 0x00, 0x00, 0xe0 | byte(pcrPID>>8), byte(pcrPID), 0xf0, 0x00}
+	if m.hasVideo {
+		pmt = append(pmt, streamH264, 0xe0|pidVideo>>8, pidVideo&0xff, 0xf0, 0x00)
+	}
+	if m.hasAudio {
+		pmt = append(pmt, streamAAC, 0xe0|pidAudio>>8, pidAudio&0xff, 0xf0, 0x00)
+	}
+	pmt[2] = byte(len(pmt) - 3 + 4)
+	return append(m.section(pidPAT, pat), m.section(pidPMT, pmt)...)
+}
+
+// section wraps a PSI section (without CRC) into one packet.
+func (m *tsMuxer) section(pid uint16, sec []byte) []byte {
+	sec = binary.BigEndian.AppendUint32(sec, crc32MPEG(sec))
+	p := make([]byte, tsPacketSize)
+	p[0], p[1], p[2], p[3] = 0x47, 0x40|byte(pid>>8), byte(pid), 0x10|m.next(pid)
+	p[4] = 0 // pointer field
+	n := copy(p[5:], sec)
+	for i := 5 + n; i < tsPacketSize; i++ {
+		p[i] = 0xff
+	}
+	return p
+}
+
+// pes packetizes one access unit; the first packet carries the PCR (when pcr is set) and the random
+// access indicator (when key is set).
+func (m *tsMuxer) pes(pid uint16, streamID byte, es []byte, pts, dts uint64, key, pcr bool) []byte {
+	h := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5}
+	h = appendTimestamp(h, 0x2, pts)
+	if pts != dts {
+		h[7], h[8] = 0xc0, 10
+		h[len(h)-5] |= 0x30 // PTS prefix 0011 when followed by DTS
+		h = appendTimestamp(h, 0x1, dts)
+	}
+	if l := len(h) - 6 + len(es); l <= 0xffff && streamID != 0xe0 {
+		binary.BigEndian.PutUint16(h[4:], uint16(l))
+	}
+	data := append(h, es...)
+
+	var out []byte
+	first := true
+	for len(data) > 0 {
+		p := make([]byte, 4, tsPacketSize)
+		p[0], p[1], p[2] = 0x47, byte(pid>>8), byte(pid)
+		if first {
+			p[1] |= 0x40
+		}
+		var af []byte
+		if first && (key || pcr) {
+			flags := byte(0)
+			if key {
+				flags |= 0x40
+			}
+			af = []byte{flags}
+			if pcr {
+				af[0] |= 0x10
+				base := dts
+				af = append(af, byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1), byte(base<<7)|0x7e, 0)
+			}
+		}
+		room := tsPacketSize - 4
+		if af != nil {
+			room -= 1 + len(af)
+		}
+		if len(data) < room {
+			// stuff the adaptation field so the payload ends the packet
+			pad := room - len(data)
+			if af == nil {
+				if pad == 1 {
+					af = []byte{} // a zero-length adaptation field takes one byte
+				} else {
+					af = []byte{0x00}
+					pad--
+				}
+				pad--
+			}
+			for i := 0; i < pad; i++ {
+				af = append(af, 0xff)
+			}
+			room = len(data)
+		}
+		if af != nil {
+			p[3] = 0x30 | m.next(pid)
+			p = append(p, byte(len(af)))
+			p = append(p, af...)
+		} else {
+			p[3] = 0x10 | m.next(pid)
+		}
+		p = append(p, data[:room]...)
+		data = data[room:]
+		out = append(out, p...)
+		first = false
+	}
+	return out
+}
+
+// next returns the continuity counter for the next packet of pid.
+func (m *tsMuxer) next(pid uint16) byte {
+	c := m.cc[pid]
+	m.cc[pid] = (c + 1) & 0x0f
+	return c
+}
+
+// appendTimestamp encodes a 33-bit PTS or DTS with its 4-bit prefix and marker bits.
+func appendTimestamp(b []byte, prefix byte, ts uint64) []byte {
+	return append(b,
+		prefix<<4|byte(ts>>29)&0x0e|1,
+		byte(ts>>22),
+		byte(ts>>14)|1,
+		byte(ts>>7),
+		byte(ts<<1)|1,
+	)
+}
+
+var crcTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// crc32MPEG is the CRC-32/MPEG-2 of PSI sections.
+func crc32MPEG(b []byte) uint32 {
+	c := uint32(0xffffffff)
+	for _, v := range b {
+		c = c<<8 ^ crcTable[byte(c>>24)^v]
+	}
+	return c
+}
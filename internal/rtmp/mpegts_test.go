@@ -0,0 +1,150 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/psds-microservice/streaming-service/internal/container"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// avcConfig is an AVCDecoderConfigurationRecord with 4-byte NAL lengths, one SPS and one PPS.
+func avcConfig(sps, pps []byte) []byte {
+	b := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	b = append(binary.BigEndian.AppendUint16(b, uint16(len(sps))), sps...)
+	b = append(b, 1)
+	return append(binary.BigEndian.AppendUint16(b, uint16(len(pps))), pps...)
+}
+
+// avcc joins NAL units with 4-byte length prefixes.
+func avcc(nals ...[]byte) []byte {
+	var b []byte
+	for _, n := range nals {
+		b = append(binary.BigEndian.AppendUint32(b, uint32(len(n))), n...)
+	}
+	return b
+}
+
+// flvToTS muxes a short H.264 + AAC publish: sequence headers, a keyframe, audio, an inter frame with a
+// composition offset and a second keyframe large enough to span several packets.
+func flvToTS(t *testing.T) [][]byte {
+	t.Helper()
+	sps := []byte{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb}
+	idr := append([]byte{0x65, 0x88, 0x84}, bytes.Repeat([]byte{0x5a}, 40)...)
+	big := append([]byte{0x65, 0x88, 0x80}, bytes.Repeat([]byte{0xa5}, 500)...)
+	tags := []struct {
+		typ  uint8
+		ts   uint32
+		body []byte
+	}{
+		{tagVideo, 0, append([]byte{0x17, avcSeqHeader, 0, 0, 0}, avcConfig(sps, pps)...)},
+		{tagAudio, 0, []byte{0xaf, aacSeqHeader, 0x12, 0x10}}, // AAC LC, 44.1 kHz, stereo
+		{tagVideo, 0, append([]byte{0x17, avcNALU, 0, 0, 0}, avcc(idr)...)},
+		{tagAudio, 23, append([]byte{0xaf, aacRaw}, bytes.Repeat([]byte{0x21}, 12)...)},
+		{tagVideo, 33, append([]byte{0x27, avcNALU, 0, 0, 66}, avcc([]byte{0x41, 0x9a, 0x02}, []byte{0x09, 0x10})...)},
+		{tagVideo, 66, append([]byte{0x17, avcNALU, 0, 0, 0}, avcc(sps, pps, big)...)},
+	}
+	var dropped []uint8
+	m := newTSMuxer(func(typ uint8, _ byte) { dropped = append(dropped, typ) })
+	var frames [][]byte
+	for _, tag := range tags {
+		out, _ := m.tag(tag.typ, tag.ts, tag.body)
+		frames = append(frames, out...)
+	}
+	if _, key := m.tag(tagVideo, 99, []byte{0x1c, 1, 0, 0, 0}); key || len(dropped) != 1 { // HEVC in FLV: dropped
+		t.Fatalf("unsupported codec: dropped %v", dropped)
+	}
+	return frames
+}
+
+func TestTSMuxerGolden(t *testing.T) {
+	frames := flvToTS(t)
+	got := bytes.Join(frames, nil)
+	golden := filepath.Join("testdata", "flv_to_mpegts.golden.ts")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("muxed %d bytes differ from %s (%d bytes); rerun with -update if the change is intended", len(got), golden, len(want))
+	}
+}
+
+func TestTSMuxerOutput(t *testing.T) {
+	frames := flvToTS(t)
+	if len(frames) != 4 {
+		t.Fatalf("%d frames, want an access unit per media tag after the sequence headers", len(frames))
+	}
+	cc := make(map[int]int)
+	for i, f := range frames {
+		if len(f)%container.PacketSize != 0 {
+			t.Fatalf("frame %d: %d bytes, not whole packets", i, len(f))
+		}
+		var pids []int
+		for off := 0; off < len(f); off += container.PacketSize {
+			p := f[off : off+container.PacketSize]
+			if p[0] != container.SyncByte {
+				t.Fatalf("frame %d packet %d: no sync byte", i, off/container.PacketSize)
+			}
+			pkt := container.ParsePacket(p)
+			if last, ok := cc[pkt.PID]; ok && int(p[3]&0x0f) != (last+1)&0x0f {
+				t.Fatalf("frame %d: continuity counter of PID %#x jumps from %d to %d", i, pkt.PID, last, p[3]&0x0f)
+			}
+			cc[pkt.PID] = int(p[3] & 0x0f)
+			pids = append(pids, pkt.PID)
+			if pkt.PID == pidPAT || pkt.PID == pidPMT {
+				sec := container.PSISection(pkt.Payload)
+				n := 3 + (int(sec[1]&0x0f)<<8 | int(sec[2]))
+				if crc32MPEG(sec[:n]) != 0 {
+					t.Fatalf("frame %d: PSI section of PID %#x fails its CRC", i, pkt.PID)
+				}
+			}
+		}
+		key := i == 0 || i == 3
+		if starts := pids[0] == pidPAT && pids[1] == pidPMT; starts != key {
+			t.Fatalf("frame %d: starts with PAT and PMT = %v, want %v", i, starts, key)
+		}
+	}
+
+	// the first keyframe: PAT -> PMT -> H.264 on pidVideo, with SPS and PPS inserted after the delimiter
+	pmtPID, _ := container.ParsePAT(container.ParsePacket(frames[0]).Payload)
+	timing, _ := container.ParsePMT(container.ParsePacket(frames[0][container.PacketSize:]).Payload)
+	if pmtPID != pidPMT || timing != pidVideo {
+		t.Fatalf("PMT on %#x with timing stream %#x", pmtPID, timing)
+	}
+	video := container.ParsePacket(frames[0][2*container.PacketSize:])
+	if !video.RAI || !container.PESStart(video.Payload) {
+		t.Fatal("keyframe PES without random access indicator")
+	}
+	es := video.Payload[9+int(video.Payload[8]):]
+	if want := []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 0, 1, 0x67}; !bytes.HasPrefix(es, want) {
+		t.Fatalf("elementary stream starts %x, want AUD and SPS", es[:16])
+	}
+
+	// audio gets an ADTS header, the inter frame its composition offset
+	audio := container.ParsePacket(frames[1])
+	if audio.PID != pidAudio || container.PESPTS(audio.Payload) != 23*90 {
+		t.Fatalf("audio on %#x at PTS %d", audio.PID, container.PESPTS(audio.Payload))
+	}
+	if adts := audio.Payload[9+int(audio.Payload[8]):]; adts[0] != 0xff || adts[1] != 0xf1 || int(adts[3]&0x03)<<11|int(adts[4])<<3|int(adts[5]>>5) != 7+12 {
+		t.Fatalf("ADTS header %x", adts[:7])
+	}
+	inter := container.ParsePacket(frames[2])
+	if inter.RAI || container.PESPTS(inter.Payload) != (33+66)*90 {
+		t.Fatalf("inter frame RAI %v at PTS %d, want %d", inter.RAI, container.PESPTS(inter.Payload), (33+66)*90)
+	}
+}
@@ -0,0 +1,336 @@
+// Package rtmp is the RTMP ingest: encoders (OBS, ffmpeg) publish with the session's stream key as the
+// stream name, and the demuxed FLV tags are relayed through the StreamHub as the session client's binary
+// frames — unchanged (FormatFLV) or repackaged into MPEG-TS (FormatMPEGTS).
+package rtmp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// Output formats of the relayed frames.
+const (
+	FormatFLV    = "flv"    // one FLV tag per frame, as published
+	FormatMPEGTS = "mpegts" // H.264/AAC repackaged into MPEG-TS, one access unit per frame
+)
+
+const (
+	handshakeTimeout = 10 * time.Second
+	readTimeout      = 30 * time.Second // a connection silent for this long is dropped
+	publishStreamID  = 1                // the message stream createStream hands out
+)
+
+// Sessions looks up the session a stream key publishes to (D: реализация — SessionService).
+type Sessions interface {
+	GetByStreamKey(streamKey string) (*model.Session, error)
+}
+
+// Hub is the part of StreamHub the ingest publishes through.
+type Hub interface {
+	Publish(sessionID, userID, transport string) (*service.Peer, func(), error)
+	RelayToOperators(sessionID string, messageType int, data []byte)
+	InitRecording(sessionID string, on bool)
+	PeerCount(sessionID string) int
+}
+
+// packager turns published tags into the frames relayed to operators.
+type packager interface {
+	// tag returns the frames for a media or script tag; key is set when they start at a keyframe.
+	tag(typ uint8, ts uint32, body []byte) (frames [][]byte, key bool)
+	// header returns the frame an operator joining mid-stream needs before the next keyframe; nil if none.
+	header() []byte
+}
+
+// Server accepts RTMP publishers.
+type Server struct {
+	sessions Sessions
+	hub      Hub
+	format   string
+	log      *zap.Logger
+
+	mu     sync.Mutex
+	lis    net.Listener
+	closed bool
+	conns  map[net.Conn]struct{}
+}
+
+// New creates the ingest server; format is FormatFLV or FormatMPEGTS.
+func New(sessions Sessions, hub Hub, format string, log *zap.Logger) *Server {
+	return &Server{
+		sessions: sessions,
+		hub:      hub,
+		format:   format,
+		log:      log,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on lis until Close.
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = lis.Close()
+		return nil
+	}
+	s.lis = lis
+	s.mu.Unlock()
+	for {
+		nc, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = nc.Close()
+			return nil
+		}
+		s.conns[nc] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(nc)
+	}
+}
+
+// Close stops accepting and drops every connection; publishers' streams end.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	if s.lis != nil {
+		err = s.lis.Close()
+	}
+	for nc := range s.conns {
+		_ = nc.Close()
+	}
+	return err
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer func() {
+		_ = nc.Close()
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+	}()
+	log := s.log.With(zap.String("remote_addr", nc.RemoteAddr().String()))
+	c := newChunkConn(nc)
+	_ = nc.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := c.handshake(); err != nil {
+		log.Debug("rtmp handshake failed", zap.Error(err))
+		return
+	}
+	p := &publisher{srv: s, c: c, log: log, dropped: make(map[[2]byte]bool)}
+	defer p.stop()
+	for {
+		_ = nc.SetDeadline(time.Now().Add(readTimeout))
+		msg, err := c.readMessage()
+		if err != nil {
+			if p.sessionID != "" {
+				log.Info("rtmp publisher disconnected", zap.String("session_id", p.sessionID), zap.Error(err))
+			}
+			return
+		}
+		switch msg.typ {
+		case msgCommandAMF0, msgCommandAMF3:
+			payload := msg.payload
+			if msg.typ == msgCommandAMF3 && len(payload) > 0 {
+				payload = payload[1:] // AMF3 commands are AMF0 after a format byte
+			}
+			if done, err := p.command(msg.streamID, payload); err != nil || done {
+				if err != nil {
+					log.Debug("rtmp command failed", zap.Error(err))
+				}
+				return
+			}
+		case msgDataAMF0, msgDataAMF3:
+			payload := msg.payload
+			if msg.typ == msgDataAMF3 && len(payload) > 0 {
+				payload = payload[1:]
+			}
+			p.metadata(msg.ts, payload)
+		case msgAudio, msgVideo:
+			p.media(msg.typ, msg.ts, msg.payload)
+		}
+	}
+}
+
+// publisher is the state of one RTMP connection.
+type publisher struct {
+	srv *Server
+	c   *chunkConn
+	log *zap.Logger
+
+	sessionID string
+	cleanup   func()
+	pkg       packager
+	started   bool // the first keyframe was relayed
+	peers     int  // hub peers when the header was last relayed
+	dropped   map[[2]byte]bool
+}
+
+// command handles a NetConnection or NetStream command; done ends the connection.
+func (p *publisher) command(streamID uint32, payload []byte) (done bool, err error) {
+	args, _ := decodeAMF(payload)
+	if len(args) < 2 {
+		return false, nil
+	}
+	name, _ := args[0].(string)
+	txID, _ := args[1].(float64)
+	switch name {
+	case "connect":
+		enc := 0.0
+		if obj, ok := arg(args, 2).(map[string]any); ok {
+			enc, _ = obj["objectEncoding"].(float64)
+		}
+		if err := p.c.writeControl(); err != nil {
+			return true, err
+		}
+		return false, p.c.writeCommand(csidCommand, 0, "_result", txID,
+			object{{"fmsVer", "FMS/3,0,1,123"}, {"capabilities", 31}},
+			object{{"level", "status"}, {"code", "NetConnection.Connect.Success"}, {"description", "Connection succeeded."}, {"objectEncoding", enc}})
+	case "createStream":
+		return false, p.c.writeCommand(csidCommand, 0, "_result", txID, nil, publishStreamID)
+	case "releaseStream", "FCPublish", "FCUnpublish", "getStreamLength":
+		if txID == 0 {
+			return false, nil
+		}
+		return false, p.c.writeCommand(csidCommand, 0, "_result", txID, nil)
+	case "publish":
+		key, _ := arg(args, 3).(string)
+		return p.publish(streamID, key)
+	case "play":
+		return true, p.status(streamID, "error", "NetStream.Play.Failed", "playback is not supported")
+	case "deleteStream", "closeStream":
+		return true, nil
+	}
+	return false, nil
+}
+
+func arg(args []any, i int) any {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// publish authenticates the stream key and registers the connection as the session's client.
+func (p *publisher) publish(streamID uint32, key string) (bool, error) {
+	if p.sessionID != "" {
+		return true, p.status(streamID, "error", "NetStream.Publish.BadName", "already publishing")
+	}
+	key, _, _ = strings.Cut(key, "?")
+	sess, err := p.srv.sessions.GetByStreamKey(key)
+	switch {
+	case errors.Is(err, errs.ErrSessionNotFound):
+		p.log.Warn("rtmp publish rejected: unknown stream key")
+		return true, p.status(streamID, "error", "NetStream.Publish.BadName", "unknown stream key")
+	case err != nil:
+		p.log.Warn("rtmp publish: failed to get session", zap.Error(err))
+		return true, p.status(streamID, "error", "NetStream.Publish.Failed", "failed to get session")
+	case sess.Status == model.SessionStatusFinished:
+		p.log.Warn("rtmp publish rejected: session already finished", zap.String("session_id", sess.ID))
+		return true, p.status(streamID, "error", "NetStream.Publish.BadName", "session already finished")
+	}
+	s := p.srv
+	// the client may already be streaming over WebSocket, WHIP or another RTMP connection: one source per session
+	peer, cleanup, err := s.hub.Publish(sess.ID, sess.ClientID, service.TransportRTMP)
+	if err != nil {
+		p.log.Warn("rtmp publish rejected: already publishing", zap.String("session_id", sess.ID), zap.Error(err))
+		return true, p.status(streamID, "error", "NetStream.Publish.BadName", "stream is already being published")
+	}
+
+	p.sessionID, p.cleanup = sess.ID, cleanup
+	if s.format == FormatMPEGTS {
+		p.pkg = newTSMuxer(p.drop)
+	} else {
+		p.pkg = &flvPackager{}
+	}
+	// Load the persisted recording mode before any frame is relayed (the hub keeps newer changes).
+	s.hub.InitRecording(sess.ID, sess.RecordingMode == model.RecordingModeOn)
+	go func() {
+		// Control messages (recording mode, broadcasts) cannot be delivered over RTMP. Send is closed when
+		// the session is closed or an admin disconnects the publisher: drop the connection.
+		for range peer.Send {
+		}
+		_ = p.c.nc.Close()
+	}()
+	p.log.Info("rtmp publish started", zap.String("session_id", sess.ID), zap.String("format", s.format))
+	return false, p.status(streamID, "status", "NetStream.Publish.Start", "publishing")
+}
+
+func (p *publisher) status(streamID uint32, level, code, description string) error {
+	return p.c.writeCommand(csidStatus, streamID, "onStatus", 0, nil,
+		object{{"level", level}, {"code", code}, {"description", description}})
+}
+
+// metadata relays @setDataFrame/onMetaData as a script tag without the @setDataFrame wrapper.
+func (p *publisher) metadata(ts uint32, payload []byte) {
+	if v, n, err := decodeValue(payload, 0); err == nil && v == "@setDataFrame" {
+		payload = payload[n:]
+	}
+	p.media(tagScript, ts, payload)
+}
+
+func (p *publisher) media(typ uint8, ts uint32, body []byte) {
+	if p.sessionID == "" {
+		return
+	}
+	hub := p.srv.hub
+	frames, key := p.pkg.tag(typ, ts, body)
+	if !p.started && !key {
+		return // nothing is decodable before the first keyframe; its header carries the configuration
+	}
+	p.started = true
+	if key {
+		// an operator joined since the last keyframe: let it start decoding here
+		n := hub.PeerCount(p.sessionID)
+		if h := p.pkg.header(); h != nil && n > p.peers {
+			hub.RelayToOperators(p.sessionID, websocket.BinaryMessage, h)
+		}
+		p.peers = n
+	}
+	for _, f := range frames {
+		hub.RelayToOperators(p.sessionID, websocket.BinaryMessage, f)
+	}
+}
+
+// drop logs a codec the MPEG-TS muxer cannot carry, once per connection.
+func (p *publisher) drop(typ uint8, codec byte) {
+	k := [2]byte{typ, codec}
+	if p.dropped[k] {
+		return
+	}
+	p.dropped[k] = true
+	p.log.Warn("rtmp: codec not supported by the mpegts format, dropping its tags",
+		zap.String("session_id", p.sessionID), zap.Uint8("tag_type", typ), zap.Uint8("codec_id", codec))
+}
+
+func (p *publisher) stop() {
+	if p.sessionID == "" {
+		return
+	}
+	p.cleanup()
+	p.log.Info("rtmp publish stopped", zap.String("session_id", p.sessionID))
+}
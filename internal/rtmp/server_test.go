@@ -0,0 +1,193 @@
+package rtmp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	testSessionID = "11111111-1111-1111-1111-111111111111"
+	testClientID  = "22222222-2222-2222-2222-222222222222"
+)
+
+// fakeSessions knows the stream keys "live" (active) and "done" (finished).
+type fakeSessions struct{}
+
+func (fakeSessions) GetByStreamKey(key string) (*model.Session, error) {
+	switch key {
+	case "live":
+		return &model.Session{ID: testSessionID, ClientID: testClientID, Status: model.SessionStatusActive}, nil
+	case "done":
+		return &model.Session{ID: testSessionID, ClientID: testClientID, Status: model.SessionStatusFinished}, nil
+	}
+	return nil, errs.ErrSessionNotFound
+}
+
+// dialPipe serves one connection of s over net.Pipe and runs the client side of the handshake.
+func dialPipe(t *testing.T, s *Server) *chunkConn {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serveConn(server)
+	}()
+	t.Cleanup(func() {
+		_ = client.Close()
+		<-done
+	})
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c1 := make([]byte, 1+handshakeSize)
+	c1[0] = 3
+	copy(c1[9:], "client random")
+	if _, err := client.Write(c1); err != nil {
+		t.Fatal(err)
+	}
+	s012 := make([]byte, 1+2*handshakeSize)
+	if _, err := io.ReadFull(client, s012); err != nil {
+		t.Fatal(err)
+	}
+	if s012[0] != 3 || !bytes.Equal(s012[1+handshakeSize:], c1[1:]) {
+		t.Fatal("S2 does not echo C1")
+	}
+	if _, err := client.Write(s012[1 : 1+handshakeSize]); err != nil { // C2 echoes S1
+		t.Fatal(err)
+	}
+	return newChunkConn(client)
+}
+
+// command sends an AMF0 command and returns the arguments of the next command the server sends.
+func command(t *testing.T, c *chunkConn, streamID uint32, values ...any) []any {
+	t.Helper()
+	if err := c.writeCommand(csidCommand, streamID, values...); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			t.Fatalf("reading the reply to %v: %v", values[0], err)
+		}
+		if msg.typ == msgCommandAMF0 {
+			args, err := decodeAMF(msg.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return args
+		}
+	}
+}
+
+// publish runs connect, createStream and publish with key and returns the onStatus code.
+func publish(t *testing.T, c *chunkConn, key string) string {
+	t.Helper()
+	reply := command(t, c, 0, "connect", 1, object{{"app", "live"}, {"objectEncoding", 0}})
+	if info, _ := arg(reply, 3).(map[string]any); reply[0] != "_result" || info["code"] != "NetConnection.Connect.Success" {
+		t.Fatalf("connect: %v", reply)
+	}
+	reply = command(t, c, 0, "createStream", 2, nil)
+	if reply[0] != "_result" || arg(reply, 3) != float64(publishStreamID) {
+		t.Fatalf("createStream: %v", reply)
+	}
+	reply = command(t, c, publishStreamID, "publish", 0, nil, key, "live")
+	info, _ := arg(reply, 3).(map[string]any)
+	if reply[0] != "onStatus" || info == nil {
+		t.Fatalf("publish: %v", reply)
+	}
+	code, _ := info["code"].(string)
+	return code
+}
+
+func TestPublishRelaysToOperators(t *testing.T) {
+	hub := service.NewStreamHub(0, zap.NewNop())
+	s := New(fakeSessions{}, hub, FormatFLV, zap.NewNop())
+	op, leave := hub.Subscribe(testSessionID, "op", service.TransportHTTP)
+	defer leave()
+
+	c := dialPipe(t, s)
+	if code := publish(t, c, "live?token=x"); code != "NetStream.Publish.Start" {
+		t.Fatalf("publish: %s", code)
+	}
+	if hub.PeerCount(testSessionID) != 2 {
+		t.Fatalf("%d hub peers, want the operator and the RTMP client", hub.PeerCount(testSessionID))
+	}
+	seq := []byte{0x17, avcSeqHeader, 0, 0, 0, 1, 0x64, 0, 0x1f, 0xff}
+	key := []byte{0x17, avcNALU, 0, 0, 0, 0, 0, 0, 1, 0x65}
+	for _, body := range [][]byte{seq, key} {
+		if err := c.writeMessage(6, msgVideo, publishStreamID, 40, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nothing is relayed before the keyframe; the operator joined since the last one and gets the header first
+	for _, want := range [][]byte{append(flvHeader(), flvTag(tagVideo, 40, seq)...), flvTag(tagVideo, 40, key)} {
+		select {
+		case msg := <-op.Send:
+			if !bytes.Equal(msg.Data, want) {
+				t.Fatalf("operator got %x, want %x", msg.Data, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("operator got no frame")
+		}
+	}
+}
+
+func TestPublishRejected(t *testing.T) {
+	for _, tc := range []struct {
+		name, key string
+		busy      bool
+		want      string
+	}{
+		{"unknown stream key", "nope", false, "NetStream.Publish.BadName"},
+		{"finished session", "done", false, "NetStream.Publish.BadName"},
+		{"client connected over WHIP", "live", true, "NetStream.Publish.BadName"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := service.NewStreamHub(0, zap.NewNop())
+			if tc.busy {
+				_, leave, err := hub.Publish(testSessionID, testClientID, service.TransportWHIP)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer leave()
+			}
+			c := dialPipe(t, New(fakeSessions{}, hub, FormatFLV, zap.NewNop()))
+			if code := publish(t, c, tc.key); code != tc.want {
+				t.Fatalf("publish: %s, want %s", code, tc.want)
+			}
+			// the server drops the connection after the rejection
+			if _, err := c.readMessage(); err == nil {
+				t.Fatal("connection open after a rejected publish")
+			}
+			want := 0
+			if tc.busy {
+				want = 1
+			}
+			if n := hub.PeerCount(testSessionID); n != want {
+				t.Fatalf("%d hub peers, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestPublishTwiceOnOneSession(t *testing.T) {
+	hub := service.NewStreamHub(0, zap.NewNop())
+	s := New(fakeSessions{}, hub, FormatFLV, zap.NewNop())
+	if code := publish(t, dialPipe(t, s), "live"); code != "NetStream.Publish.Start" {
+		t.Fatalf("first publish: %s", code)
+	}
+	if code := publish(t, dialPipe(t, s), "live"); code != "NetStream.Publish.BadName" {
+		t.Fatalf("second publisher: %s, want BadName", code)
+	}
+	if _, _, err := hub.Publish(testSessionID, testClientID, service.TransportWHIP); !errors.Is(err, errs.ErrClientConnected) {
+		t.Fatalf("WHIP while publishing over RTMP: %v, want ErrClientConnected", err)
+	}
+}
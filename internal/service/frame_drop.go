@@ -0,0 +1,67 @@
+package service
+
+import "sync"
+
+// catchUpDepth is the queue depth above which an operator skips to the next keyframe (see Peer.admit).
+const catchUpDepth = peerSendQueue * 3 / 4
+
+// keyGate is the smart dropping state of one peer: per track, whether it is waiting for a keyframe.
+type keyGate struct {
+	mu     sync.Mutex
+	tracks map[uint8]*gateTrack
+}
+
+type gateTrack struct {
+	seenKey bool // the track has keyframes: frames after a loss can be skipped up to the next one
+	waiting bool // a frame was lost: skip up to the next keyframe
+}
+
+// admit decides whether a binary frame annotated by the FrameInspector is queued for p. Once a frame of a
+// track is lost, the track's frames up to its next keyframe cannot be decoded and are skipped instead of
+// filling the queue; a peer whose queue is over catchUpDepth skips to the next keyframe at the next access
+// unit, so it catches up instead of falling further behind. Init frames always go through; tracks without
+// keyframes (or unrecognized frames) are never skipped.
+func (p *Peer) admit(msg Message) bool {
+	fi := msg.Frame
+	if fi.Container == "" {
+		return true
+	}
+	g := &p.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.tracks == nil {
+		g.tracks = make(map[uint8]*gateTrack)
+	}
+	t := g.tracks[msg.Track]
+	if t == nil {
+		t = &gateTrack{}
+		g.tracks[msg.Track] = t
+	}
+	switch {
+	case fi.Keyframe:
+		t.seenKey, t.waiting = true, false
+		return true
+	case fi.Init:
+		return true
+	case !t.seenKey:
+		return true
+	case t.waiting:
+		return false
+	case fi.HasPTS && len(p.Send) > catchUpDepth:
+		t.waiting = true // a new access unit that is not a keyframe
+		return false
+	}
+	return true
+}
+
+// lost records that a frame of the track could not be queued for p.
+func (p *Peer) lost(msg Message) {
+	if msg.Frame.Container == "" {
+		return
+	}
+	p.gate.mu.Lock()
+	if t := p.gate.tracks[msg.Track]; t != nil && t.seenKey {
+		t.waiting = true
+	}
+	p.gate.mu.Unlock()
+}
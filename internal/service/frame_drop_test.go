@@ -0,0 +1,52 @@
+package service
+
+import "testing"
+
+func TestPeerSkipsToNextKeyframe(t *testing.T) {
+	p := &Peer{Send: make(chan Message, peerSendQueue)}
+	frame := func(key, init, unit bool) Message {
+		return Message{Frame: FrameInfo{Container: ContainerMPEGTS, Keyframe: key, Init: init, HasPTS: unit}}
+	}
+	key, delta, cont, init := frame(true, false, true), frame(false, false, true), frame(false, false, false), frame(false, true, false)
+
+	if !p.admit(delta) {
+		t.Fatal("frame skipped before the track showed a keyframe")
+	}
+	if !p.admit(key) || !p.admit(delta) {
+		t.Fatal("frames skipped without a loss")
+	}
+	p.lost(delta)
+	for name, m := range map[string]Message{"delta": delta, "continuation": cont} {
+		if p.admit(m) {
+			t.Fatalf("%s admitted after a loss, before the next keyframe", name)
+		}
+	}
+	if !p.admit(init) {
+		t.Fatal("init frame skipped")
+	}
+	if !p.admit(key) || !p.admit(delta) {
+		t.Fatal("the keyframe did not end the skip")
+	}
+
+	// a lagging queue skips at the next access unit, not in the middle of one
+	for len(p.Send) <= catchUpDepth {
+		p.Send <- Message{}
+	}
+	if !p.admit(cont) {
+		t.Fatal("continuation of an access unit skipped to catch up")
+	}
+	if p.admit(delta) || p.admit(cont) {
+		t.Fatal("lagging peer not skipped to the next keyframe")
+	}
+	if !p.admit(key) {
+		t.Fatal("keyframe skipped")
+	}
+
+	// another track, and frames the inspector did not recognize, are not affected
+	other := key
+	other.Track = 2
+	p.lost(other)
+	if !p.admit(Message{}) {
+		t.Fatal("unrecognized frame skipped")
+	}
+}
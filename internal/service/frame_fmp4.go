@@ -0,0 +1,70 @@
+package service
+
+import (
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/container"
+)
+
+// fmp4Parser annotates fragmented MP4 frames: ftyp/moov is the init segment, a moof's timing-track run
+// gives the keyframe flag (first sample), PTS (tfdt plus the first composition offset) and duration.
+type fmp4Parser struct {
+	tracks map[uint32]*container.Track
+	timing uint32
+}
+
+func newFMP4Parser() *fmp4Parser {
+	return &fmp4Parser{}
+}
+
+func (p *fmp4Parser) inspect(data []byte) FrameInfo {
+	fi := FrameInfo{Container: ContainerFMP4}
+	first := true
+	container.EachBox(data, func(typ string, payload []byte) {
+		switch typ {
+		case "moov":
+			p.tracks, p.timing = container.ParseMoov(payload)
+			fi.Init = true
+		case "moof":
+			f, ok := container.ParseMoof(payload, p.tracks, p.timing)
+			if !ok {
+				return
+			}
+			timescale := p.tracks[p.timing].Timescale
+			if first {
+				fi.Keyframe = f.Key
+				if f.HasBase && timescale > 0 {
+					fi.PTS, fi.HasPTS = ticks(int64(f.Base)+f.CTO, timescale), true
+				}
+				first = false
+			}
+			if timescale > 0 {
+				fi.Duration += ticks(int64(f.Ticks), timescale)
+			}
+		}
+	})
+	return fi
+}
+
+// ticks converts a timescale count to a duration without overflowing for large counts.
+func ticks(n int64, timescale uint32) time.Duration {
+	ts := int64(timescale)
+	return time.Duration(n/ts)*time.Second + time.Duration(n%ts)*time.Second/time.Duration(ts)
+}
+
+// startsFMP4 reports whether data starts with a box of a fragmented MP4 stream.
+func startsFMP4(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	switch string(data[4:8]) {
+	case "ftyp", "styp", "moov", "moof", "sidx", "prft", "emsg":
+		return true
+	}
+	return false
+}
+
+// startsFMP4Init reports whether data starts an fMP4 init segment.
+func startsFMP4Init(data []byte) bool {
+	return len(data) >= 8 && (string(data[4:8]) == "ftyp" || string(data[4:8]) == "moov")
+}
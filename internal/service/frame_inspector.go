@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Containers recognized by ContainerInspector.
+const (
+	ContainerFMP4   = "fmp4"
+	ContainerMPEGTS = "mpegts"
+)
+
+// FrameInfo annotates a relayed binary frame with what its container says about it. Frames are expected to
+// carry whole boxes (fMP4) or whole 188-byte packets (MPEG-TS), as muxers write them; the rest of a frame
+// that does not is ignored.
+type FrameInfo struct {
+	Container string        // ContainerFMP4, ContainerMPEGTS; "" when the stream is not recognized
+	Keyframe  bool          // the frame's first access unit of the timing track is a sync sample / random access point
+	Init      bool          // the frame carries the stream configuration: ftyp+moov, or PAT and PMT
+	PTS       time.Duration // presentation time of that access unit; valid when HasPTS
+	HasPTS    bool
+	Duration  time.Duration // media time the frame covers (fMP4 sample durations); 0 for MPEG-TS, which has none
+}
+
+// FrameInspector parses the client's binary frames of a session in relay order, each track on its own
+// (track 0: the client declared no tracks; data is then the track frame's payload) (D: StreamHub зависит от
+// абстракции, реализация — ContainerInspector). End drops the session's parser state.
+type FrameInspector interface {
+	Inspect(sessionID string, track uint8, data []byte) FrameInfo
+	End(sessionID string)
+}
+
+// frameParser is the parsing state of one track's container.
+type frameParser interface {
+	inspect(data []byte) FrameInfo
+}
+
+// ContainerInspector recognizes fragmented MP4 and MPEG-TS by a track's first frames and keeps the state
+// later frames need: track timescales and defaults (moov), the PMT and timing stream PIDs (PAT/PMT). The timing
+// track is the first video track, else the first track. A new init segment restarts fMP4 parsing.
+type ContainerInspector struct {
+	mu       sync.Mutex
+	sessions map[string]*inspectedSession
+}
+
+type inspectedSession struct {
+	mu      sync.Mutex
+	parsers map[uint8]frameParser
+}
+
+// NewContainerInspector creates an inspector for fMP4 and MPEG-TS streams.
+func NewContainerInspector() *ContainerInspector {
+	return &ContainerInspector{sessions: make(map[string]*inspectedSession)}
+}
+
+// Inspect annotates data; a frame of an unrecognized stream gets a zero FrameInfo.
+func (i *ContainerInspector) Inspect(sessionID string, track uint8, data []byte) FrameInfo {
+	i.mu.Lock()
+	s := i.sessions[sessionID]
+	if s == nil {
+		s = &inspectedSession{parsers: make(map[uint8]frameParser)}
+		i.sessions[sessionID] = s
+	}
+	i.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parser := s.parsers[track]
+	switch {
+	case startsFMP4Init(data):
+		if _, ok := parser.(*fmp4Parser); !ok {
+			parser = newFMP4Parser()
+		}
+	case parser != nil:
+	case startsFMP4(data):
+		parser = newFMP4Parser()
+	case startsMPEGTS(data):
+		parser = newTSParser()
+	default:
+		return FrameInfo{}
+	}
+	s.parsers[track] = parser
+	return parser.inspect(data)
+}
+
+// End forgets the session (closed session).
+func (i *ContainerInspector) End(sessionID string) {
+	i.mu.Lock()
+	delete(i.sessions, sessionID)
+	i.mu.Unlock()
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, typ...), body...)
+}
+
+func u32(vs ...uint32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// fmp4Init is ftyp+moov of one 90 kHz video track (ID 1) with a default duration of 3000 ticks.
+func fmp4Init() []byte {
+	return append(box("ftyp", []byte("isom"), u32(0)), box("moov",
+		box("trak",
+			box("tkhd", u32(0, 0, 0, 1, 0)),
+			box("mdia", box("mdhd", u32(0, 0, 0, 90000, 0)), box("hdlr", u32(0, 0), []byte("vide"))),
+		),
+		box("mvex", box("trex", u32(0, 1, 1, 3000, 0, 0))),
+	)...)
+}
+
+// fmp4Fragment is a moof+mdat of track 1 starting at base ticks with two default-duration samples.
+func fmp4Fragment(base uint64, key bool) []byte {
+	flags := uint32(0)
+	if !key {
+		flags = 0x00010000
+	}
+	tfdt := append(u32(1<<24), binary.BigEndian.AppendUint64(nil, base)...)
+	return append(box("moof", box("traf",
+		box("tfhd", u32(0, 1)),
+		box("tfdt", tfdt),
+		box("trun", u32(0x004, 2, flags)),
+	)), box("mdat", []byte{1, 2, 3})...)
+}
+
+// tsPacket pads a packet of pid to 188 bytes; an adaptation field with the random access indicator when rai.
+func tsPacket(pid int, pusi, rai bool, payload []byte) []byte {
+	b := []byte{0x47, byte(pid >> 8 & 0x1f), byte(pid), 0x10}
+	if pusi {
+		b[1] |= 0x40
+	}
+	if rai {
+		b[3] = 0x30
+		b = append(b, 1, 0x40)
+	}
+	b = append(b, payload...)
+	for len(b) < 188 {
+		b = append(b, 0xff)
+	}
+	return b
+}
+
+// tsInit is a PAT (PMT on PID 0x1000) and a PMT with one H.264 stream on PID 0x100.
+func tsInit() []byte {
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 18, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0x00, 0x1b, 0xe1, 0x00, 0xf0, 0x00, 0, 0, 0, 0}
+	return append(tsPacket(0, true, false, pat), tsPacket(0x1000, true, false, pmt)...)
+}
+
+// tsPES is the first packet of a video PES with the given 90 kHz PTS.
+func tsPES(pts int64, key bool) []byte {
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14&0xfe | 1), byte(pts >> 7), byte(pts<<1&0xfe | 1)}
+	return tsPacket(0x100, true, key, pes)
+}
+
+func TestInspectFMP4(t *testing.T) {
+	i := NewContainerInspector()
+	if fi := i.Inspect("s1", 0, fmp4Init()); fi.Container != ContainerFMP4 || !fi.Init {
+		t.Fatalf("init = %+v", fi)
+	}
+	fi := i.Inspect("s1", 0, fmp4Fragment(90000, true))
+	want := FrameInfo{Container: ContainerFMP4, Keyframe: true, PTS: time.Second, HasPTS: true, Duration: 6000 * time.Second / 90000}
+	if fi != want {
+		t.Fatalf("fragment = %+v, want %+v", fi, want)
+	}
+	if fi := i.Inspect("s1", 0, fmp4Fragment(96000, false)); fi.Keyframe {
+		t.Fatalf("non-sync fragment reported as a keyframe: %+v", fi)
+	}
+}
+
+func TestInspectMPEGTS(t *testing.T) {
+	i := NewContainerInspector()
+	if fi := i.Inspect("s1", 0, tsInit()); fi.Container != ContainerMPEGTS || !fi.Init {
+		t.Fatalf("PAT/PMT = %+v", fi)
+	}
+	fi := i.Inspect("s1", 0, tsPES(90000, true))
+	want := FrameInfo{Container: ContainerMPEGTS, Keyframe: true, PTS: time.Second, HasPTS: true}
+	if fi != want {
+		t.Fatalf("PES = %+v, want %+v", fi, want)
+	}
+}
+
+func FuzzInspectFMP4(f *testing.F) {
+	f.Add(fmp4Fragment(90000, true))
+	f.Add(fmp4Fragment(0, false))
+	f.Add(append(fmp4Init(), fmp4Fragment(1, true)...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		i := NewContainerInspector()
+		i.Inspect("s1", 0, fmp4Init())
+		if fi := i.Inspect("s1", 0, data); fi.Container != ContainerFMP4 {
+			t.Fatalf("container = %q after an fMP4 init", fi.Container)
+		}
+	})
+}
+
+func FuzzInspectMPEGTS(f *testing.F) {
+	f.Add(tsPES(90000, true))
+	f.Add(tsPES(0, false))
+	f.Add(append(tsInit(), tsPES(1, true)...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if startsFMP4Init(data) {
+			t.Skip("an fMP4 init segment switches the track to fMP4")
+		}
+		i := NewContainerInspector()
+		i.Inspect("s1", 0, tsInit())
+		if fi := i.Inspect("s1", 0, data); fi.Container != ContainerMPEGTS {
+			t.Fatalf("container = %q after MPEG-TS PAT/PMT", fi.Container)
+		}
+	})
+}
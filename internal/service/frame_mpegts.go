@@ -0,0 +1,54 @@
+package service
+
+import (
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/container"
+)
+
+// tsParser annotates MPEG-TS frames: PAT and PMT make an init frame, the first PES start of the timing
+// stream (the first video stream of the PMT, else its first stream) gives the keyframe flag (random access
+// indicator) and the PTS.
+type tsParser struct {
+	pmtPID    int
+	timingPID int
+}
+
+func newTSParser() *tsParser {
+	return &tsParser{pmtPID: -1, timingPID: -1}
+}
+
+func (p *tsParser) inspect(data []byte) FrameInfo {
+	fi := FrameInfo{Container: ContainerMPEGTS}
+	var pat, pmt, unit bool
+	for ; len(data) >= container.PacketSize && data[0] == container.SyncByte; data = data[container.PacketSize:] {
+		pkt := container.ParsePacket(data[:container.PacketSize])
+		switch {
+		case !pkt.PUSI:
+		case pkt.PID == 0:
+			if pid, ok := container.ParsePAT(pkt.Payload); ok {
+				p.pmtPID, pat = pid, true
+			}
+		case pkt.PID == p.pmtPID:
+			if pid, ok := container.ParsePMT(pkt.Payload); ok {
+				p.timingPID, pmt = pid, true
+			}
+		case pkt.PID == p.timingPID && !unit && container.PESStart(pkt.Payload):
+			unit = true
+			fi.Keyframe = pkt.RAI
+			if pts := container.PESPTS(pkt.Payload); pts >= 0 {
+				fi.PTS, fi.HasPTS = time.Duration(pts)*time.Second/container.PTSClock, true
+			}
+		}
+	}
+	fi.Init = pat && pmt
+	return fi
+}
+
+// startsMPEGTS reports whether data starts with TS packets (sync bytes 188 bytes apart when there are two).
+func startsMPEGTS(data []byte) bool {
+	if len(data) < container.PacketSize || data[0] != container.SyncByte {
+		return false
+	}
+	return len(data) < 2*container.PacketSize || data[container.PacketSize] == container.SyncByte
+}
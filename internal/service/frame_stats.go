@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+// timingRing is how many recent frames per track keep their capture time for frame_ack; an acknowledgement
+// that arrives later is ignored.
+const timingRing = 256
+
+var (
+	latencyBuckets = []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	uplinkLatency  = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "streaming_frame_uplink_seconds",
+		Help:    "Ingress minus capture time of timed client frames.",
+		Buckets: latencyBuckets,
+	})
+	hubLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "streaming_frame_hub_seconds",
+		Help:    "Egress minus ingress time of timed frames written to WebSocket operators.",
+		Buckets: latencyBuckets,
+	})
+	glassToGlass = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "streaming_frame_glass_to_glass_seconds",
+		Help:    "Operator-reported receive minus capture time of timed frames (frame_ack).",
+		Buckets: latencyBuckets,
+	})
+	framesLost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "streaming_frames_lost_total",
+		Help: "Timed frames lost: sequence gaps on ingress, or in the frame_ack receipts of an operator.",
+	}, []string{"stage"})
+)
+
+func init() {
+	prometheus.MustRegister(uplinkLatency, hubLatency, glassToGlass, framesLost)
+}
+
+// latency accumulates one latency figure.
+type latency struct {
+	n              int64
+	sum, max, last time.Duration
+}
+
+func (l *latency) add(d time.Duration) {
+	l.n++
+	l.sum += d
+	l.last = d
+	l.max = max(l.max, d)
+}
+
+func (l *latency) stats() *model.LatencyStats {
+	if l.n == 0 {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return &model.LatencyStats{Samples: l.n, LastMs: ms(l.last), AvgMs: ms(l.sum / time.Duration(l.n)), MaxMs: ms(l.max)}
+}
+
+// frameStats accumulates the timed frame figures of the client's stream or of an operator.
+type frameStats struct {
+	mu                        sync.Mutex
+	frames, lost              int64
+	uplink, hub, glassToGlass latency
+}
+
+func (s *frameStats) stats() *model.FrameStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frames == 0 && s.lost == 0 {
+		return nil
+	}
+	return &model.FrameStats{
+		Frames:       s.frames,
+		Lost:         s.lost,
+		LossRatio:    float64(s.lost) / float64(s.frames+s.lost),
+		Uplink:       s.uplink.stats(),
+		Hub:          s.hub.stats(),
+		GlassToGlass: s.glassToGlass.stats(),
+	}
+}
+
+// fields are the figures as log fields.
+func (s *frameStats) fields() []zap.Field {
+	fs := s.stats()
+	if fs == nil {
+		return nil
+	}
+	fields := []zap.Field{zap.Int64("frames", fs.Frames), zap.Int64("lost", fs.Lost), zap.Float64("loss_ratio", fs.LossRatio)}
+	for _, l := range []struct {
+		name  string
+		stats *model.LatencyStats
+	}{{"uplink", fs.Uplink}, {"hub", fs.Hub}, {"glass_to_glass", fs.GlassToGlass}} {
+		if l.stats != nil {
+			fields = append(fields, zap.Float64(l.name+"_avg_ms", l.stats.AvgMs), zap.Float64(l.name+"_max_ms", l.stats.MaxMs))
+		}
+	}
+	return fields
+}
+
+// seqGaps follows the sequence numbers of each track: the next expected one.
+type seqGaps map[uint8]uint32
+
+// add records seq of track and returns how many numbers were skipped since the previous one. A reordered or
+// repeated number (behind the expected one, modulo the wrap) is not a gap and does not move it back.
+func (g seqGaps) add(track uint8, seq uint32) int64 {
+	next, seen := g[track]
+	if !seen {
+		g[track] = seq + 1
+		return 0
+	}
+	gap := seq - next
+	if gap >= 1<<31 {
+		return 0
+	}
+	g[track] = seq + 1
+	return int64(gap)
+}
+
+// sessionTiming is the ingress side of a session's timed frames: the figures, the sequence numbers and the
+// recent capture times of each track.
+type sessionTiming struct {
+	frameStats
+	seqs seqGaps
+	ring map[uint8]*[timingRing]timedFrame
+}
+
+type timedFrame struct {
+	seq     uint32
+	capture time.Time
+	ok      bool
+}
+
+// timing returns the session's ingress timing, created on first use.
+func (h *StreamHub) timing(sessionID string) *sessionTiming {
+	h.timingMu.Lock()
+	defer h.timingMu.Unlock()
+	t := h.timings[sessionID]
+	if t == nil {
+		t = &sessionTiming{seqs: make(seqGaps), ring: make(map[uint8]*[timingRing]timedFrame)}
+		h.timings[sessionID] = t
+	}
+	return t
+}
+
+// stampIngress records a timed client frame and writes the ingress time into its header, in data itself.
+func (h *StreamHub) stampIngress(sessionID string, th TrackHeader, data []byte) {
+	now := time.Now()
+	t := h.timing(sessionID)
+	t.mu.Lock()
+	if gap := t.seqs.add(th.Track, th.Seq); gap > 0 {
+		t.lost += gap
+		framesLost.WithLabelValues("ingress").Add(float64(gap))
+	}
+	t.frames++
+	if !th.Capture.IsZero() {
+		d := now.Sub(th.Capture)
+		t.uplink.add(d)
+		uplinkLatency.Observe(d.Seconds())
+	}
+	ring := t.ring[th.Track]
+	if ring == nil {
+		ring = new([timingRing]timedFrame)
+		t.ring[th.Track] = ring
+	}
+	ring[th.Seq%timingRing] = timedFrame{seq: th.Seq, capture: th.Capture, ok: !th.Capture.IsZero()}
+	t.mu.Unlock()
+
+	binary.BigEndian.PutUint64(data[20:], uint64(now.UnixMicro()))
+}
+
+// stampEgress writes the egress time into hdr, a copy of a timed frame's header, and records the hub latency.
+func (p *Peer) stampEgress(hdr []byte) {
+	now := time.Now()
+	binary.BigEndian.PutUint64(hdr[28:], uint64(now.UnixMicro()))
+	if ingress := micros(hdr[20:]); !ingress.IsZero() {
+		d := now.Sub(ingress)
+		p.frames.mu.Lock()
+		p.frames.hub.add(d)
+		p.frames.mu.Unlock()
+		hubLatency.Observe(d.Seconds())
+	}
+}
+
+// AckFrame records an operator's receipt of a timed frame (frame_ack): the frame counts as received, the
+// sequence numbers skipped since the previous receipt of the track as lost (dropped by the hub or on the
+// way), and the receive time as a glass-to-glass latency if the frame is recent enough to be known.
+func (h *StreamHub) AckFrame(p *Peer, ack model.FrameAckMessage) {
+	if p.Role != PeerRoleOperator || ack.TrackID < 0 || ack.TrackID > 255 || ack.ReceivedAt <= 0 {
+		return
+	}
+	p.frames.mu.Lock()
+	if p.acks == nil {
+		p.acks = make(seqGaps)
+	}
+	gap := p.acks.add(uint8(ack.TrackID), ack.Seq)
+	p.frames.frames++
+	p.frames.lost += gap
+	p.frames.mu.Unlock()
+	if gap > 0 {
+		framesLost.WithLabelValues("operator").Add(float64(gap))
+	}
+	h.timingMu.Lock()
+	t := h.timings[p.SessionID]
+	h.timingMu.Unlock()
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	var f timedFrame
+	if ring := t.ring[uint8(ack.TrackID)]; ring != nil {
+		f = ring[ack.Seq%timingRing]
+	}
+	t.mu.Unlock()
+	if !f.ok || f.seq != ack.Seq {
+		return
+	}
+	d := time.UnixMicro(ack.ReceivedAt).Sub(f.capture)
+	p.frames.mu.Lock()
+	p.frames.glassToGlass.add(d)
+	p.frames.mu.Unlock()
+	glassToGlass.Observe(d.Seconds())
+}
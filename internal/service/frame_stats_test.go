@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+)
+
+func TestSeqGaps(t *testing.T) {
+	g := make(seqGaps)
+	for _, step := range []struct {
+		track uint8
+		seq   uint32
+		gap   int64
+	}{
+		{1, 10, 0},        // first number: no gap
+		{1, 11, 0},        // in order
+		{1, 14, 2},        // 12 and 13 skipped
+		{1, 12, 0},        // reordered: not a gap, not moved back
+		{1, 15, 0},        // still in order after the reordered one
+		{2, 0, 0},         // tracks are independent
+		{1, 1<<32 - 1, 0}, // far behind: treated as reordered
+		{1, 16, 0},
+	} {
+		if gap := g.add(step.track, step.seq); gap != step.gap {
+			t.Fatalf("track %d seq %d: gap %d, want %d", step.track, step.seq, gap, step.gap)
+		}
+	}
+	w := seqGaps{3: 1<<32 - 2}
+	if gap := w.add(3, 1); gap != 3 { // 1<<32-2, 1<<32-1 and 0
+		t.Fatalf("gap across the wrap = %d, want 3", gap)
+	}
+}
+
+func TestFrameStatsMath(t *testing.T) {
+	var s frameStats
+	if s.stats() != nil {
+		t.Fatal("stats without frames")
+	}
+	s.frames, s.lost = 3, 1
+	for _, ms := range []int{10, 30, 20} {
+		s.hub.add(time.Duration(ms) * time.Millisecond)
+	}
+	fs := s.stats()
+	want := model.LatencyStats{Samples: 3, LastMs: 20, AvgMs: 20, MaxMs: 30}
+	if fs.LossRatio != 0.25 || *fs.Hub != want || fs.Uplink != nil {
+		t.Fatalf("stats = %+v hub %+v, want loss 0.25 and hub %+v", fs, fs.Hub, want)
+	}
+}
+
+func TestTimedFrameStats(t *testing.T) {
+	h := NewStreamHub(0, zap.NewNop())
+	op, leave := h.Subscribe("s1", "op", TransportHTTP)
+	defer leave()
+	capture := time.UnixMicro(time.Now().Add(-50 * time.Millisecond).UnixMicro()) // header precision
+	for _, seq := range []uint32{1, 2, 5} {
+		data := AppendTrackFrame(nil, TrackHeader{Timed: true, Seq: seq, Capture: capture}, []byte{0})
+		h.stampIngress("s1", TrackHeader{Timed: true, Seq: seq, Capture: capture}, data)
+		if binary.BigEndian.Uint64(data[20:]) == 0 {
+			t.Fatal("ingress time not stamped in place")
+		}
+	}
+	ingress := h.timing("s1").stats()
+	if ingress.Frames != 3 || ingress.Lost != 2 || ingress.Uplink == nil || ingress.Uplink.AvgMs < 50 {
+		t.Fatalf("ingress = %+v uplink %+v, want 3 frames, 2 lost and the uplink latency", ingress, ingress.Uplink)
+	}
+
+	// the operator acknowledges 1 and 5: 2, 3 and 4 are lost for it, whether the hub or the network lost them
+	received := capture.Add(80 * time.Millisecond).UnixMicro()
+	for _, seq := range []uint32{1, 5} {
+		h.AckFrame(op, model.FrameAckMessage{Event: model.FrameAck, Seq: seq, ReceivedAt: received})
+	}
+	fs := op.frames.stats()
+	if fs.Frames != 2 || fs.Lost != 3 || fs.LossRatio != 0.6 || fs.GlassToGlass == nil || fs.GlassToGlass.Samples != 2 || fs.GlassToGlass.AvgMs != 80 {
+		t.Fatalf("operator = %+v glass-to-glass %+v", fs, fs.GlassToGlass)
+	}
+}
@@ -1,13 +1,20 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/psds-microservice/streaming-service/internal/config"
 	"github.com/psds-microservice/streaming-service/internal/errs"
 	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/outbox"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -16,42 +23,304 @@ type SessionCloser interface {
 	CloseSession(sessionID string)
 }
 
+// RecordingSwitch — включение/выключение записи сессии в hub (D: SessionService не зависит от *StreamHub).
+type RecordingSwitch interface {
+	SetRecording(sessionID string, on bool)
+	EndRecording(sessionID string)
+}
+
+// SessionHub is what SessionService needs from the hub: closing sessions, the recording switch
+// and control messages to peers.
+type SessionHub interface {
+	SessionCloser
+	RecordingSwitch
+	Broadcast(sessionID string, v any) int
+}
+
+// RecordingStateProvider reports per-session recording state (implemented by recording.Client).
+type RecordingStateProvider interface {
+	State(sessionID string) (model.RecordingState, bool)
+}
+
+// RecordingSinkReporter reports per-sink health of the recorder (implemented by recording.Composite).
+type RecordingSinkReporter interface {
+	Health() []model.RecordingSinkHealth
+}
+
+// RecordingNotifier queues session-manager notifications in the caller's transaction (implemented by sessionmanager.Notifier).
+type RecordingNotifier interface {
+	Enqueue(tx *gorm.DB, sessionID, url string) error
+	Notify()
+}
+
+// SessionManagerLink verifies linked session-manager sessions and queues status pushes to them in the
+// caller's transaction (implemented by sessionmanager.Notifier).
+type SessionManagerLink interface {
+	VerifySession(ctx context.Context, smSessionID string) error
+	EnqueueStatus(tx *gorm.DB, sessionID, smSessionID string, status model.SessionStatus) error
+	Notify()
+}
+
+// TimelineReader opens a session's stored event timeline (implemented by recording.Timeline).
+type TimelineReader interface {
+	Open(sessionID string) (io.ReadCloser, error)
+}
+
 // SessionServicer — интерфейс для handlers (D: зависимость от абстракции).
 type SessionServicer interface {
-	Create(clientID string) (*model.Session, error)
+	Create(ctx context.Context, req model.CreateSessionRequest) (*model.Session, error)
 	Get(sessionID string) (*model.Session, error)
+	List(userID string, status model.SessionStatus, limit, offset int) ([]model.Session, error)
 	Finish(sessionID string) error
 	AddOperator(sessionID, userID string) error
+	Activate(sessionID string) error
+	OperatorLeft(sessionID, userID string) error
 	GetOperators(sessionID string) ([]model.Operator, error)
 	IsClientOrOperator(sessionID, userID string) (bool, error)
+	RecordingState(sessionID string) (*model.RecordingState, error)
+	ControlRecording(sessionID, userID string, action model.RecordingAction) (model.RecordingMode, error)
+	Timeline(sessionID string) (io.ReadCloser, error)
 }
 
 // SessionService manages streaming session lifecycle.
 type SessionService struct {
 	db     *gorm.DB
 	cfg    *config.Config
-	stream SessionCloser
+	stream SessionHub
+	rec    RecordingStateProvider // optional: nil when recording is disabled
+	tl     TimelineReader         // optional: nil when timelines are disabled
+	notify RecordingNotifier      // optional: nil when session-manager is not notified
+	sinks  []string               // recording sinks a session may select (RECORDING_BACKEND)
+	sm     SessionManagerLink     // optional: nil when session-manager is not configured
+	log    *zap.Logger
 }
 
 // NewSessionService creates a session service.
-func NewSessionService(db *gorm.DB, cfg *config.Config, hub SessionCloser) *SessionService {
-	return &SessionService{db: db, cfg: cfg, stream: hub}
+func NewSessionService(db *gorm.DB, cfg *config.Config, hub SessionHub, log *zap.Logger) *SessionService {
+	return &SessionService{db: db, cfg: cfg, stream: hub, log: log}
+}
+
+// SetRecordingStates sets the optional recording state provider.
+func (s *SessionService) SetRecordingStates(p RecordingStateProvider) { s.rec = p }
+
+// SetRecordingSinks sets the recording sink names sessions may select on create.
+func (s *SessionService) SetRecordingSinks(names []string) { s.sinks = names }
+
+// RecordingSinks returns the sinks the session is recorded to; nil means all sinks.
+// Used by the composite recorder when a recording starts.
+func (s *SessionService) RecordingSinks(sessionID string) ([]string, error) {
+	var ent model.StreamingSession
+	if err := s.db.Select("recording_sinks").Where("id = ?", sessionID).First(&ent).Error; err != nil {
+		return nil, err
+	}
+	return splitSinks(ent.RecordingSinks), nil
+}
+
+// SetSessionManager sets the optional session-manager link used to verify and update linked sessions.
+func (s *SessionService) SetSessionManager(l SessionManagerLink) { s.sm = l }
+
+// SetRecordingNotifier sets the optional session-manager notifier for recording URLs.
+func (s *SessionService) SetRecordingNotifier(n RecordingNotifier) { s.notify = n }
+
+// SetTimelines sets the optional timeline reader.
+func (s *SessionService) SetTimelines(t TimelineReader) { s.tl = t }
+
+// Timeline returns the session's JSONL event timeline; errs.ErrTimelineNotFound if none was recorded.
+func (s *SessionService) Timeline(sessionID string) (io.ReadCloser, error) {
+	if _, err := s.Get(sessionID); err != nil {
+		return nil, err
+	}
+	if s.tl == nil {
+		return nil, errs.ErrTimelineNotFound
+	}
+	return s.tl.Open(sessionID)
+}
+
+// RecordingState returns the recording state of a session ("inactive" when nothing is being recorded).
+func (s *SessionService) RecordingState(sessionID string) (*model.RecordingState, error) {
+	if _, err := s.Get(sessionID); err != nil {
+		return nil, err
+	}
+	if s.rec != nil {
+		if st, ok := s.rec.State(sessionID); ok {
+			return &st, nil
+		}
+	}
+	return &model.RecordingState{SessionID: sessionID, Status: model.RecordingStatusInactive}, nil
+}
+
+// RecordingFinalized stores the URL of the session's finalized recording and, in the same transaction, writes
+// recording.finished to the outbox. A new or changed URL is queued for session-manager.
+func (s *SessionService) RecordingFinalized(ctx context.Context, sessionID, url string) {
+	changed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ent model.StreamingSession
+		if err := tx.Select("id", "client_id", "recording_url").Where("id = ?", sessionID).First(&ent).Error; err != nil {
+			return err
+		}
+		changed = ent.RecordingURL == nil || *ent.RecordingURL != url
+		if err := tx.Model(&ent).Updates(map[string]interface{}{
+			"recording_url":    url,
+			"recording_status": string(model.RecordingResultFinished),
+			"recording_error":  nil,
+		}).Error; err != nil {
+			return err
+		}
+		data := model.SessionEventData{ClientID: ent.ClientID, RecordingURL: url}
+		if err := emit(tx, model.EventRecordingFinished, sessionID, data); err != nil {
+			return err
+		}
+		if s.notify == nil || !changed {
+			return nil
+		}
+		return s.notify.Enqueue(tx, sessionID, url)
+	})
+	if err != nil {
+		s.log.Error("recording url persist failed", zap.String("session_id", sessionID), zap.String("url", url), zap.Error(err))
+		return
+	}
+	if s.notify != nil && changed {
+		s.notify.Notify()
+	}
+}
+
+// RecordingFailed persists a recording failure on the session.
+func (s *SessionService) RecordingFailed(ctx context.Context, sessionID, msg string) {
+	if err := s.db.WithContext(ctx).Model(&model.StreamingSession{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"recording_status": string(model.RecordingResultFailed),
+		"recording_error":  msg,
+	}).Error; err != nil {
+		s.log.Error("recording failure persist failed", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// ControlRecording applies a recording action (start/stop/pause/resume) to the session: persists the new mode,
+// switches the hub and announces the mode to the session peers. userID is reported as changed_by.
+func (s *SessionService) ControlRecording(sessionID, userID string, action model.RecordingAction) (model.RecordingMode, error) {
+	var ent model.StreamingSession
+	if err := s.db.Where("id = ?", sessionID).First(&ent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errs.ErrSessionNotFound
+		}
+		return "", err
+	}
+	if ent.Status == string(model.SessionStatusFinished) {
+		return "", errs.ErrSessionFinished
+	}
+	cur := model.RecordingMode(ent.RecordingMode)
+	next, ok := action.Transition(cur)
+	if !ok {
+		return cur, errs.ErrRecordingTransition
+	}
+	if next == model.RecordingModeOn && s.rec == nil {
+		return cur, errs.ErrRecordingUnavailable
+	}
+	// Conditional on the mode we validated against, so concurrent actions cannot both apply.
+	res := s.db.Model(&model.StreamingSession{}).
+		Where("id = ? AND recording_mode = ?", sessionID, ent.RecordingMode).
+		Update("recording_mode", string(next))
+	if res.Error != nil {
+		return cur, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return cur, errs.ErrRecordingTransition
+	}
+	if action == model.RecordingActionStop {
+		s.stream.EndRecording(sessionID)
+	} else {
+		s.stream.SetRecording(sessionID, next == model.RecordingModeOn)
+	}
+	s.stream.Broadcast(sessionID, model.RecordingControlEvent{
+		Event:         "recording_mode",
+		SessionID:     sessionID,
+		RecordingMode: next,
+		ChangedBy:     userID,
+	})
+	return next, nil
 }
 
-// Create creates a new streaming session for the client.
-func (s *SessionService) Create(clientID string) (*model.Session, error) {
+// Create creates a new streaming session for the client. Record selects the initial recording mode;
+// nil means ENABLE_RECORDING. Requesting a recording when the server has no recorder is an error.
+// RecordingSinks narrows the recording down to some of the configured sinks (empty: all).
+// SessionManagerSessionID links the session to session-manager after checking it there (bounded by ctx);
+// the link then receives every status change.
+func (s *SessionService) Create(ctx context.Context, req model.CreateSessionRequest) (*model.Session, error) {
+	if len(req.RecordingSinks) > 0 {
+		if s.rec == nil {
+			return nil, errs.ErrRecordingUnavailable
+		}
+		for _, name := range req.RecordingSinks {
+			if !slices.Contains(s.sinks, name) {
+				return nil, fmt.Errorf("%w: %q", errs.ErrUnknownRecordingSink, name)
+			}
+		}
+	}
+	mode := model.RecordingModeOff
+	switch {
+	case req.Record == nil:
+		if s.cfg.EnableRecording && s.rec != nil {
+			mode = model.RecordingModeOn
+		}
+	case *req.Record:
+		if s.rec == nil {
+			return nil, errs.ErrRecordingUnavailable
+		}
+		mode = model.RecordingModeOn
+	}
+	var smID *string
+	switch {
+	case req.SessionManagerSessionID != "":
+		if s.sm == nil {
+			return nil, errs.ErrSessionManagerUnavailable
+		}
+		if err := s.sm.VerifySession(ctx, req.SessionManagerSessionID); err != nil {
+			return nil, err
+		}
+		smID = &req.SessionManagerSessionID
+	case s.cfg.SessionManagerRequireLink:
+		return nil, errs.ErrSessionManagerLinkRequired
+	}
 	ent := &model.StreamingSession{
-		ID:        uuid.New().String(),
-		ClientID:  clientID,
-		StreamKey: "sk_" + uuid.New().String()[:16],
-		Status:    string(model.SessionStatusWaiting),
+		ID:                      uuid.New().String(),
+		ClientID:                req.ClientID,
+		StreamKey:               "sk_" + uuid.New().String()[:16],
+		Status:                  string(model.SessionStatusWaiting),
+		RecordingMode:           string(mode),
+		RecordingStatus:         string(model.RecordingResultNone),
+		RecordingSinks:          strings.Join(req.RecordingSinks, ","),
+		SessionManagerSessionID: smID,
 	}
-	if err := s.db.Create(ent).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ent).Error; err != nil {
+			return err
+		}
+		if err := s.pushStatus(tx, ent, model.SessionStatusWaiting); err != nil {
+			return err
+		}
+		return emit(tx, model.EventSessionCreated, ent.ID, model.SessionEventData{ClientID: req.ClientID, Status: model.SessionStatusWaiting})
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.notifySessionManager(ent)
 	return entityToSession(ent), nil
 }
 
+// pushStatus queues the status change for the linked session-manager session, if any, in tx.
+func (s *SessionService) pushStatus(tx *gorm.DB, ent *model.StreamingSession, status model.SessionStatus) error {
+	if ent.SessionManagerSessionID == nil || s.sm == nil {
+		return nil
+	}
+	return s.sm.EnqueueStatus(tx, ent.ID, *ent.SessionManagerSessionID, status)
+}
+
+// notifySessionManager wakes the session-manager queue after a status push was committed.
+func (s *SessionService) notifySessionManager(ent *model.StreamingSession) {
+	if ent.SessionManagerSessionID != nil && s.sm != nil {
+		s.sm.Notify()
+	}
+}
+
 // Get returns a session by ID.
 func (s *SessionService) Get(sessionID string) (*model.Session, error) {
 	var ent model.StreamingSession
@@ -64,7 +333,39 @@ func (s *SessionService) Get(sessionID string) (*model.Session, error) {
 	return entityToSession(&ent), nil
 }
 
-// Finish marks session as finished and notifies hub.
+// GetByStreamKey returns the session whose stream key is streamKey (RTMP ingest authentication).
+func (s *SessionService) GetByStreamKey(streamKey string) (*model.Session, error) {
+	var ent model.StreamingSession
+	if err := s.db.Preload("Operators").Where("stream_key = ?", streamKey).First(&ent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return entityToSession(&ent), nil
+}
+
+// List returns sessions where userID is the client or an operator, newest first; status filters when not empty.
+func (s *SessionService) List(userID string, status model.SessionStatus, limit, offset int) ([]model.Session, error) {
+	q := s.db.Preload("Operators").
+		Where("client_id = ? OR id IN (SELECT session_id FROM session_operators WHERE user_id = ?)", userID, userID)
+	if status != "" {
+		q = q.Where("status = ?", string(status))
+	}
+	var ents []model.StreamingSession
+	if err := q.Order("created_at DESC").Limit(limit).Offset(offset).Find(&ents).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.Session, 0, len(ents))
+	for i := range ents {
+		out = append(out, *entityToSession(&ents[i]))
+	}
+	return out, nil
+}
+
+// Finish marks the session finished and writes session.finished to the outbox, then closes the session in
+// the hub once that is committed. Closing finalizes the recording: its URL follows in recording.finished.
+// Finishing a finished session is a no-op, so concurrent or repeated calls emit session.finished once.
 func (s *SessionService) Finish(sessionID string) error {
 	var ent model.StreamingSession
 	if err := s.db.Where("id = ?", sessionID).First(&ent).Error; err != nil {
@@ -73,14 +374,46 @@ func (s *SessionService) Finish(sessionID string) error {
 		}
 		return err
 	}
+	if ent.Status == string(model.SessionStatusFinished) {
+		return nil
+	}
+	// A recording still open now is finalized by CloseSession or, if spooled, later by the uploader.
+	recording := false
+	if s.rec != nil {
+		_, recording = s.rec.State(sessionID)
+	}
+	data := model.SessionEventData{ClientID: ent.ClientID, Status: model.SessionStatusFinished}
+	if ent.RecordingURL != nil && !recording {
+		data.RecordingURL = *ent.RecordingURL // finalized before the session ended (recording stopped)
+	}
 	now := time.Now()
-	if err := s.db.Model(&ent).Updates(map[string]interface{}{
-		"status":      string(model.SessionStatusFinished),
-		"finished_at": now,
-	}).Error; err != nil {
+	finished := false // by this call: another one may have won the race since the read above
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&ent).Where("status <> ?", string(model.SessionStatusFinished)).Updates(map[string]interface{}{
+			"status":      string(model.SessionStatusFinished),
+			"finished_at": now,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		finished = true
+		if err := s.pushStatus(tx, &ent, model.SessionStatusFinished); err != nil {
+			return err
+		}
+		if recording {
+			// finalized by CloseSession below, after the commit
+			if err := tx.Model(&model.StreamingSession{}).Where("id = ?", sessionID).
+				Update("recording_status", string(model.RecordingResultPending)).Error; err != nil {
+				return err
+			}
+		}
+		return emit(tx, model.EventSessionFinished, sessionID, data)
+	})
+	if err != nil || !finished {
 		return err
 	}
 	s.stream.CloseSession(sessionID)
+	s.notifySessionManager(&ent)
 	return nil
 }
 
@@ -95,7 +428,8 @@ func (s *SessionService) AddOperator(sessionID, userID string) error {
 	}
 	for _, op := range ent.Operators {
 		if op.UserID == userID {
-			return nil
+			// reconnect: already a participant, but still a join for event consumers
+			return emit(s.db, model.EventOperatorJoined, sessionID, model.SessionEventData{ClientID: ent.ClientID, UserID: userID})
 		}
 	}
 	if len(ent.Operators) >= s.cfg.SessionMaxOperators {
@@ -107,15 +441,79 @@ func (s *SessionService) AddOperator(sessionID, userID string) error {
 		UserID:      userID,
 		ConnectedAt: time.Now(),
 	}
-	if err := s.db.Create(op).Error; err != nil {
+	activated := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(op).Error; err != nil {
+			return err
+		}
+		if err := emit(tx, model.EventOperatorJoined, sessionID, model.SessionEventData{ClientID: ent.ClientID, UserID: userID}); err != nil {
+			return err
+		}
+		if ent.Status != string(model.SessionStatusWaiting) {
+			return nil
+		}
+		var err error
+		activated, err = s.activate(tx, &ent)
+		return err
+	})
+	if err != nil {
 		return err
 	}
-	if ent.Status == string(model.SessionStatusWaiting) {
-		_ = s.db.Model(&ent).Update("status", string(model.SessionStatusActive))
+	if activated {
+		s.notifySessionManager(&ent)
 	}
 	return nil
 }
 
+// Activate moves a waiting session to active when the client starts publishing without an operator
+// having joined (WHIP); it does nothing for active or finished sessions.
+func (s *SessionService) Activate(sessionID string) error {
+	var ent model.StreamingSession
+	if err := s.db.Where("id = ?", sessionID).First(&ent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.ErrSessionNotFound
+		}
+		return err
+	}
+	if ent.Status != string(model.SessionStatusWaiting) {
+		return nil
+	}
+	activated := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		activated, err = s.activate(tx, &ent)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if activated {
+		s.notifySessionManager(&ent)
+	}
+	return nil
+}
+
+// activate switches a waiting session to active in tx, pushing the status to session-manager and writing
+// session.active; false if another request activated (or finished) it first.
+func (s *SessionService) activate(tx *gorm.DB, ent *model.StreamingSession) (bool, error) {
+	res := tx.Model(&model.StreamingSession{}).
+		Where("id = ? AND status = ?", ent.ID, string(model.SessionStatusWaiting)).
+		Update("status", string(model.SessionStatusActive))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	if err := s.pushStatus(tx, ent, model.SessionStatusActive); err != nil {
+		return false, err
+	}
+	return true, emit(tx, model.EventSessionActive, ent.ID, model.SessionEventData{ClientID: ent.ClientID, Status: model.SessionStatusActive})
+}
+
+// OperatorLeft is called when an operator's connection ends; it only writes operator.left to the outbox
+// (the operator stays in session_operators so it keeps access to the session).
+func (s *SessionService) OperatorLeft(sessionID, userID string) error {
+	return emit(s.db, model.EventOperatorLeft, sessionID, model.SessionEventData{UserID: userID})
+}
+
 // GetOperators returns operators for a session.
 func (s *SessionService) GetOperators(sessionID string) ([]model.Operator, error) {
 	var ent model.StreamingSession
@@ -156,17 +554,48 @@ func (s *SessionService) IsClientOrOperator(sessionID, userID string) (bool, err
 	return false, nil
 }
 
+// emit writes a lifecycle event to the outbox using tx (same transaction as the state change).
+func emit(tx *gorm.DB, t model.EventType, sessionID string, data model.SessionEventData) error {
+	return outbox.Write(tx, model.Event{
+		ID:         uuid.New().String(),
+		Type:       t,
+		OccurredAt: time.Now().UTC(),
+		SessionID:  sessionID,
+		Data:       data,
+	})
+}
+
 func entityToSession(ent *model.StreamingSession) *model.Session {
 	sess := &model.Session{
-		ID:         ent.ID,
-		ClientID:   ent.ClientID,
-		StreamKey:  ent.StreamKey,
-		Status:     model.SessionStatus(ent.Status),
-		CreatedAt:  ent.CreatedAt,
-		FinishedAt: ent.FinishedAt,
+		ID:              ent.ID,
+		ClientID:        ent.ClientID,
+		StreamKey:       ent.StreamKey,
+		Status:          model.SessionStatus(ent.Status),
+		RecordingMode:   model.RecordingMode(ent.RecordingMode),
+		RecordingStatus: model.RecordingResultStatus(ent.RecordingStatus),
+		CreatedAt:       ent.CreatedAt,
+		FinishedAt:      ent.FinishedAt,
+		RecordingSinks:  splitSinks(ent.RecordingSinks),
+	}
+	if ent.SessionManagerSessionID != nil {
+		sess.SessionManagerSessionID = *ent.SessionManagerSessionID
+	}
+	if ent.RecordingURL != nil {
+		sess.RecordingURL = *ent.RecordingURL
+	}
+	if ent.RecordingError != nil {
+		sess.RecordingError = *ent.RecordingError
 	}
 	for _, o := range ent.Operators {
 		sess.Operators = append(sess.Operators, model.Operator{UserID: o.UserID, ConnectedAt: o.ConnectedAt})
 	}
 	return sess
 }
+
+// splitSinks parses the comma-separated recording_sinks column; nil for "" (all sinks).
+func splitSinks(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
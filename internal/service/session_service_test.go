@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sessionSchema is the part of the migrations SessionService.Finish and Get touch, in SQLite terms.
+const sessionSchema = `
+CREATE TABLE streaming_sessions (
+  id TEXT PRIMARY KEY,
+  client_id TEXT NOT NULL,
+  stream_key VARCHAR(64) NOT NULL UNIQUE,
+  status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+  recording_mode VARCHAR(10) NOT NULL DEFAULT 'off',
+  recording_url TEXT,
+  recording_status VARCHAR(20) NOT NULL DEFAULT 'none',
+  recording_error TEXT,
+  recording_sinks VARCHAR(255) NOT NULL DEFAULT '',
+  session_manager_session_id VARCHAR(64),
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  finished_at DATETIME
+);
+CREATE TABLE session_operators (
+  id TEXT PRIMARY KEY,
+  session_id TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  connected_at DATETIME NOT NULL
+);
+CREATE TABLE outbox (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  id TEXT NOT NULL UNIQUE,
+  event_type VARCHAR(64) NOT NULL,
+  aggregate_id TEXT,
+  payload BLOB NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  published_at DATETIME,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT,
+  lease_owner VARCHAR(64),
+  lease_until DATETIME
+);`
+
+// closeCounter is a SessionHub that counts CloseSession calls.
+type closeCounter struct{ closed int }
+
+func (c *closeCounter) CloseSession(string)       { c.closed++ }
+func (c *closeCounter) SetRecording(string, bool) {}
+func (c *closeCounter) EndRecording(string)       {}
+func (c *closeCounter) Broadcast(string, any) int { return 0 }
+
+func newTestSessionService(t *testing.T) (*SessionService, *closeCounter) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // one connection: one in-memory database
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.Exec(sessionSchema).Error; err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	hub := &closeCounter{}
+	return NewSessionService(db, &config.Config{}, hub, zap.NewNop()), hub
+}
+
+func TestFinishTwiceEmitsOnce(t *testing.T) {
+	s, hub := newTestSessionService(t)
+	ent := model.StreamingSession{
+		ID:        "11111111-1111-1111-1111-111111111111",
+		ClientID:  "22222222-2222-2222-2222-222222222222",
+		StreamKey: "key",
+		Status:    string(model.SessionStatusActive),
+	}
+	if err := s.db.Create(&ent).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for i := range 2 {
+		if err := s.Finish(ent.ID); err != nil {
+			t.Fatalf("finish %d: %v", i+1, err)
+		}
+	}
+	var rows []model.OutboxMessage
+	if err := s.db.Where("event_type = ?", string(model.EventSessionFinished)).Find(&rows).Error; err != nil {
+		t.Fatalf("outbox: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("%d session.finished outbox rows, want 1", len(rows))
+	}
+	if hub.closed != 1 {
+		t.Fatalf("session closed in the hub %d times, want 1", hub.closed)
+	}
+	got, err := s.Get(ent.ID)
+	if err != nil || got.Status != model.SessionStatusFinished || got.FinishedAt == nil {
+		t.Fatalf("session = %+v, %v; want finished", got, err)
+	}
+}
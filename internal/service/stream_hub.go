@@ -3,29 +3,104 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
 	"go.uber.org/zap"
 )
 
-// PeerRole is client (stream source) or operator (stream viewer).
+// PeerRole is client (stream source), operator (stream viewer), packager (a server-side consumer of the
+// client's media, e.g. the HLS packager: it receives what operators do but is not a session participant) or
+// observer (control events only, not a participant either).
 type PeerRole string
 
 const (
 	PeerRoleClient   PeerRole = "client"
 	PeerRoleOperator PeerRole = "operator"
+	PeerRolePackager PeerRole = "packager"
+	PeerRoleObserver PeerRole = "observer"
 )
 
-// Peer represents a WebSocket connection in a session.
+// peerSendQueue is the per-peer outbound buffer size.
+const peerSendQueue = 256
+
+// Peer transports.
+const (
+	TransportWebSocket = "websocket"
+	TransportHLS       = "hls"  // the session's HLS packager, see Package
+	TransportRTMP      = "rtmp" // an RTMP publisher, see Publish
+	TransportWHIP      = "whip" // a WHIP publisher (WebRTC media), see Publish
+	TransportWHEP      = "whep" // a WHEP viewer (WebRTC media), see SubscribeControl
+	TransportSSE       = "sse"  // a Server-Sent Events viewer (control events), see Observe
+	TransportHTTP      = "http" // a chunked HTTP viewer (media frames), see Subscribe
+)
+
+// Message is a frame queued for a peer; Type is a websocket message type (TextMessage, BinaryMessage).
+// Frame annotates the client's binary frames when the hub has a FrameInspector (recording index, smart
+// dropping, see Peer.admit); Track is the track ID of a track frame (0 when the client declared no tracks).
+// Timed: Data starts with a timed (version 2) header, whose egress time Peer.Write stamps.
+type Message struct {
+	Type  int
+	Data  []byte
+	Frame FrameInfo
+	Track uint8
+	Timed bool
+}
+
+// Peer represents a connection in a session: a WebSocket, or a connection-less subscriber (Conn is nil)
+// that reads the relayed frames from Send.
 type Peer struct {
-	SessionID string
-	UserID    string
-	Role      PeerRole
-	Conn      *websocket.Conn
-	Send      chan []byte
-	sendOnce  sync.Once
+	SessionID   string
+	UserID      string
+	Role        PeerRole
+	Transport   string
+	Conn        *websocket.Conn
+	Send        chan Message
+	RemoteAddr  string
+	ConnectedAt time.Time
+
+	sendMu  sync.Mutex // guards sends to Send against closeSend
+	closed  bool       // Send is closed
+	control bool       // control events only: the client's frames are not relayed to the peer
+
+	trackMu      sync.Mutex
+	unsubscribed map[uint8]bool // tracks the operator opted out of (track_unsubscribe)
+	frames       frameStats     // timed frames of an operator, from its frame_ack receipts
+	acks         seqGaps        // sequence numbers of the receipts; guarded by frames.mu
+	gate         keyGate        // smart dropping of inspected frames
+}
+
+// Write writes msg to the peer's WebSocket. With permessage-deflate negotiated only text frames are
+// compressed: control JSON shrinks well, media frames are compressed by their codec already. A timed frame
+// gets the egress time in a copy of its header; the payload, shared by all operators, is not copied.
+func (p *Peer) Write(msg Message) error {
+	p.Conn.EnableWriteCompression(msg.Type == websocket.TextMessage)
+	if !msg.Timed {
+		return p.Conn.WriteMessage(msg.Type, msg.Data)
+	}
+	var hdr [TimedHeaderSize]byte
+	copy(hdr[:], msg.Data)
+	p.stampEgress(hdr[:])
+	w, err := p.Conn.NextWriter(msg.Type)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Data[TimedHeaderSize:]); err != nil {
+		return err
+	}
+	return w.Close()
 }
 
 // StreamRecorder receives a copy of the client stream for recording (optional).
@@ -34,22 +109,114 @@ type StreamRecorder interface {
 	EndSession(ctx context.Context, sessionID string)
 }
 
+// FrameRecorder is optionally implemented by a StreamRecorder that also keeps each chunk's websocket
+// message type and media annotations (track, keyframe, PTS); the hub then calls WriteFrame instead of WriteChunk.
+type FrameRecorder interface {
+	WriteFrame(ctx context.Context, sessionID string, data []byte, f model.RecordedFrame)
+}
+
+// RecordingStarter is optionally implemented by a StreamRecorder that prepares a session's recording before
+// its first chunk (e.g. resolves the session's sinks); the hub calls StartSession when recording is switched on,
+// outside its locks.
+type RecordingStarter interface {
+	StartSession(ctx context.Context, sessionID string)
+}
+
+// TimelineRecorder stores the per-session control-event timeline next to the recording (optional).
+type TimelineRecorder interface {
+	Append(sessionID string, ev model.TimelineEvent) error
+}
+
 // StreamHubForHandler — интерфейс для WebSocket handler (D: зависимость от абстракции).
 type StreamHubForHandler interface {
-	Register(sessionID, userID string, role PeerRole, conn *websocket.Conn) (*Peer, func())
+	Register(sessionID, userID string, role PeerRole, conn *websocket.Conn) (*Peer, func(), error)
 	Upgrader() *websocket.Upgrader
 	RelayToOperators(sessionID string, messageType int, data []byte)
+	OperatorMessage(sessionID, userID string, messageType int, data []byte)
+	InitRecording(sessionID string, on bool)
+	DeclareTracks(p *Peer, tracks []model.Track) error
+	AckFrame(p *Peer, ack model.FrameAckMessage)
+	SetSnapshot(p *Peer, img []byte)
+	SetTrackSubscription(p *Peer, trackIDs []int, on bool) (model.TrackMessage, error)
+}
+
+// SFU forwards the client's WebRTC media to the session's operators (optional). Signaling travels over the
+// peer's WebSocket, so the session and role checks done on connect apply to WebRTC too.
+type SFU interface {
+	Signal(p *Peer, msg model.SignalMessage)
+	Leave(p *Peer)
+}
+
+// WHIPServer serves WHIP ingest and WHEP playback as HTTP resources (D: handler зависит от абстракции,
+// реализация — sfu.SFU). WHIP publishes p's offer as the session's media, WHEP answers an operator's offer
+// with it; both return the resource ID and the answer SDP. onClose runs once when the resource ends
+// (Delete, failed connection, replaced publisher) or the request fails.
+type WHIPServer interface {
+	WHIP(p *Peer, offer string, onClose func()) (resourceID, answer string, err error)
+	WHEP(p *Peer, offer string, onClose func()) (resourceID, answer string, err error)
+	Resource(resourceID string) (*Peer, bool)
+	Trickle(resourceID, sdpFrag string) error
+	Delete(resourceID string) error
+}
+
+// StreamHubAttacher — интерфейс для WHIP/WHEP, SSE и chunked HTTP handler'ов: участники без WebSocket-соединения.
+type StreamHubAttacher interface {
+	Publish(sessionID, userID, transport string) (*Peer, func(), error)
+	Subscribe(sessionID, userID, transport string) (*Peer, func())
+	SubscribeControl(sessionID, userID, transport string) (*Peer, func())
+	Observe(sessionID, userID, transport string) (*Peer, func())
+}
+
+// HLSPackager serves sessions' client streams as HLS (D: handler зависит от абстракции, реализация — hls.Server).
+type HLSPackager interface {
+	Viewing(sessionID, userID string) bool
+	AddViewer(sessionID, userID string, operator bool)
+	Playlist(ctx context.Context, sessionID string, msn, part int, query string) ([]byte, error)
+	File(sessionID, name string) ([]byte, string, error)
+}
+
+// StreamHubSnapshots — интерфейс для snapshot handler: последний снимок сессии.
+type StreamHubSnapshots interface {
+	Snapshot(sessionID string) (Snapshot, bool)
+}
+
+// Snapshot is the latest still image (a rendered keyframe or a thumbnail) the session client pushed in a
+// snapshot frame (AppendSnapshotFrame).
+type Snapshot struct {
+	Data        []byte
+	ContentType string
+	At          time.Time
+}
+
+// StreamHubAdmin — интерфейс для admin handler: инспекция и вмешательство в живые сессии.
+type StreamHubAdmin interface {
+	Sessions() []model.HubSession
+	Session(sessionID string) (model.HubSession, bool)
+	DisconnectPeer(sessionID, userID, reason string) int
+	Broadcast(sessionID string, v any) int
 }
 
 // StreamHub manages WebSocket connections and relays media per session.
 type StreamHub struct {
 	mu         sync.RWMutex
 	peers      map[string]map[*Peer]struct{} // sessionID -> set of peers
+	tracks     map[string][]model.Track      // sessionID -> tracks declared by the client (replaced, never mutated)
+	snapshots  map[string]Snapshot           // sessionID -> latest snapshot frame of the client
+	timingMu   sync.Mutex
+	timings    map[string]*sessionTiming // sessionID -> ingress of timed frames
 	upgrader   websocket.Upgrader
+	wsOptions  WSOptions
 	maxMsgSize int64
 	log        *zap.Logger
 	recorder   StreamRecorder  // optional: copy of client stream to recording-service
 	ctx        context.Context // app context for recording (shutdown propagation)
+
+	// recMu guards recording and is held (read) across WriteChunk, so EndRecording never races a chunk in flight.
+	recMu     sync.RWMutex
+	recording map[string]bool        // sessionID -> chunks are forwarded to the recorder
+	timeline  TimelineRecorder       // optional: per-session event timeline
+	positions RecordingStateProvider // optional: media position of timeline events
+	inspector FrameInspector         // optional: annotates relayed binary frames
 }
 
 // SetRecorder sets the optional recorder for copying client stream to recording-service.
@@ -66,6 +233,16 @@ func (h *StreamHub) SetRecorder(r StreamRecorder) {
 	h.recorder = r
 }
 
+// SetTimeline sets the optional timeline store; every session's events are logged to it.
+func (h *StreamHub) SetTimeline(t TimelineRecorder) { h.timeline = t }
+
+// SetRecordingStates sets the optional recording state provider; timeline events get the session's media
+// position from it while a recording exists.
+func (h *StreamHub) SetRecordingStates(p RecordingStateProvider) { h.positions = p }
+
+// SetInspector sets the optional frame inspector; set it before the hub is used.
+func (h *StreamHub) SetInspector(i FrameInspector) { h.inspector = i }
+
 // SetContext sets the app context for recording (for shutdown propagation).
 func (h *StreamHub) SetContext(ctx context.Context) { h.ctx = ctx }
 
@@ -73,124 +250,602 @@ func (h *StreamHub) SetContext(ctx context.Context) { h.ctx = ctx }
 func NewStreamHub(maxMessageSize int64, log *zap.Logger) *StreamHub {
 	return &StreamHub{
 		peers:      make(map[string]map[*Peer]struct{}),
+		tracks:     make(map[string][]model.Track),
+		snapshots:  make(map[string]Snapshot),
+		timings:    make(map[string]*sessionTiming),
+		recording:  make(map[string]bool),
 		maxMsgSize: maxMessageSize,
 		log:        log,
-		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024 * 4,
-			WriteBufferSize: 1024 * 4,
-			// Allow all origins for dev; in prod set CheckOrigin.
-		},
+		upgrader:   WSOptions{ReadBufferSize: 4096, WriteBufferSize: 4096}.upgrader(),
 	}
 }
 
+// SetWSOptions configures the WebSocket upgrader; set it before the hub is used.
+func (h *StreamHub) SetWSOptions(o WSOptions) {
+	h.upgrader = o.upgrader()
+	h.wsOptions = o
+}
+
 // SetReadLimit sets max message size for connections.
 func (h *StreamHub) SetReadLimit(n int64) { h.maxMsgSize = n }
 
-// Register adds a peer to a session and returns a cleanup function.
-func (h *StreamHub) Register(sessionID, userID string, role PeerRole, conn *websocket.Conn) (*Peer, func()) {
+// Register adds a peer to a session and returns a cleanup function; errs.ErrClientConnected if role is
+// PeerRoleClient and the session client is already connected over any transport.
+func (h *StreamHub) Register(sessionID, userID string, role PeerRole, conn *websocket.Conn) (*Peer, func(), error) {
 	if h.maxMsgSize > 0 {
 		conn.SetReadLimit(h.maxMsgSize)
 	}
+	if h.wsOptions.Compression {
+		_ = conn.SetCompressionLevel(h.wsOptions.CompressionLevel) // validated in config
+	}
+	p := &Peer{
+		SessionID:   sessionID,
+		UserID:      userID,
+		Role:        role,
+		Transport:   TransportWebSocket,
+		Conn:        conn,
+		Send:        make(chan Message, peerSendQueue),
+		ConnectedAt: time.Now(),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		p.RemoteAddr = addr.String()
+	}
+	cleanup, err := h.add(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cleanup, nil
+}
+
+// Subscribe adds a connection-less operator peer that receives the client's frames and the control events
+// from Send, with the same queue and drop policy as WebSocket operators. Send is closed when the peer is
+// removed (cleanup, session closed — after a session_finished event, admin disconnect); the caller must
+// still call cleanup.
+func (h *StreamHub) Subscribe(sessionID, userID, transport string) (*Peer, func()) {
+	p, cleanup, _ := h.attach(sessionID, userID, PeerRoleOperator, transport, false) // only clients are rejected
+	return p, cleanup
+}
+
+// SubscribeControl adds a connection-less operator peer that receives only the control events, for viewers
+// whose media takes another path (WHEP: the SFU); the client's frames are not relayed to it.
+func (h *StreamHub) SubscribeControl(sessionID, userID, transport string) (*Peer, func()) {
+	p, cleanup, _ := h.attach(sessionID, userID, PeerRoleOperator, transport, true) // only clients are rejected
+	return p, cleanup
+}
+
+// Observe adds a connection-less observer peer: it receives the control events (recording mode, broadcasts,
+// session_finished), no client frames, and is not an operator.
+func (h *StreamHub) Observe(sessionID, userID, transport string) (*Peer, func()) {
+	p, cleanup, _ := h.attach(sessionID, userID, PeerRoleObserver, transport, true) // only clients are rejected
+	return p, cleanup
+}
+
+// Package adds a connection-less packager peer: it receives the client's frames and the control events like
+// Subscribe, but is not an operator (no operator slot, track subscriptions or frame acks).
+func (h *StreamHub) Package(sessionID, userID, transport string) (*Peer, func()) {
+	p, cleanup, _ := h.attach(sessionID, userID, PeerRolePackager, transport, false) // only clients are rejected
+	return p, cleanup
+}
+
+// Publish adds a connection-less client peer for an ingest (RTMP) that relays the client's frames with
+// RelayToOperators. Send receives the control messages a WebSocket client would and is closed when the
+// peer is removed (session closed, admin disconnect): the ingest must then drop its connection.
+// errs.ErrClientConnected if the session client is already connected over any transport.
+func (h *StreamHub) Publish(sessionID, userID, transport string) (*Peer, func(), error) {
+	return h.attach(sessionID, userID, PeerRoleClient, transport, false)
+}
+
+func (h *StreamHub) attach(sessionID, userID string, role PeerRole, transport string, control bool) (*Peer, func(), error) {
 	p := &Peer{
-		SessionID: sessionID,
-		UserID:    userID,
-		Role:      role,
-		Conn:      conn,
-		Send:      make(chan []byte, 256),
+		SessionID:   sessionID,
+		UserID:      userID,
+		Role:        role,
+		Transport:   transport,
+		Send:        make(chan Message, peerSendQueue),
+		ConnectedAt: time.Now(),
+		control:     control,
 	}
+	cleanup, err := h.add(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cleanup, nil
+}
+
+// add registers p and returns its cleanup function. The check for a connected client and the registration
+// happen under one lock, so of two clients connecting at once (e.g. RTMP and WHIP) exactly one gets in.
+func (h *StreamHub) add(p *Peer) (func(), error) {
+	sessionID, userID, role := p.SessionID, p.UserID, p.Role
 	h.mu.Lock()
+	if role == PeerRoleClient && h.hasClient(sessionID) {
+		h.mu.Unlock()
+		h.log.Info("peer rejected: client already connected",
+			zap.String("session_id", sessionID),
+			zap.String("user_id", userID),
+			zap.String("transport", p.Transport))
+		return nil, errs.ErrClientConnected
+	}
 	if h.peers[sessionID] == nil {
 		h.peers[sessionID] = make(map[*Peer]struct{})
 	}
 	h.peers[sessionID][p] = struct{}{}
+	tracks := h.tracks[sessionID]
 	h.mu.Unlock()
+	if tracks != nil {
+		p.SendJSON(model.TrackMessage{Event: model.TrackDeclare, SessionID: sessionID, Tracks: tracks})
+	}
+	h.logTimeline(sessionID, model.TimelineEvent{Type: model.TimelineJoin, UserID: userID, Role: string(role)})
 
 	h.log.Info("peer registered",
 		zap.String("session_id", sessionID),
 		zap.String("user_id", userID),
-		zap.String("role", string(role)))
+		zap.String("role", string(role)),
+		zap.String("transport", p.Transport))
 
-	cleanup := func() {
+	return func() {
 		h.unregister(sessionID, p)
-	}
-	return p, cleanup
+	}, nil
 }
 
-func (p *Peer) closeSend() { p.sendOnce.Do(func() { close(p.Send) }) }
+func (p *Peer) closeSend() {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.Send)
+	}
+}
 
 func (h *StreamHub) unregister(sessionID string, p *Peer) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	last := false
 	if m, ok := h.peers[sessionID]; ok {
 		delete(m, p)
 		if len(m) == 0 {
 			delete(h.peers, sessionID)
+			last = true
 		}
 	}
+	// the declaration goes with the last client connection: a reconnecting client declares again
+	_, declared := h.tracks[sessionID]
+	if declared && p.Role == PeerRoleClient && !h.hasClient(sessionID) {
+		delete(h.tracks, sessionID)
+	} else {
+		declared = false
+	}
 	p.closeSend()
-	h.log.Info("peer unregistered",
+	h.mu.Unlock()
+	h.logTimeline(sessionID, model.TimelineEvent{Type: model.TimelineLeave, UserID: p.UserID, Role: string(p.Role)})
+	if last {
+		h.dropRecordingMode(sessionID)
+	}
+	if declared {
+		h.Broadcast(sessionID, model.TrackMessage{Event: model.TrackDeclare, SessionID: sessionID})
+	}
+	h.log.Info("peer unregistered", append([]zap.Field{
 		zap.String("session_id", sessionID),
-		zap.String("user_id", p.UserID))
+		zap.String("user_id", p.UserID)}, p.frames.fields()...)...)
 }
 
-// RelayToOperators sends data from the client to all operators in the session.
-func (h *StreamHub) RelayToOperators(sessionID string, messageType int, data []byte) {
+// hasClient reports whether a client peer is connected; h.mu must be held.
+func (h *StreamHub) hasClient(sessionID string) bool {
+	for p := range h.peers[sessionID] {
+		if p.Role == PeerRoleClient {
+			return true
+		}
+	}
+	return false
+}
+
+// DeclareTracks sets the tracks of the session client p and sends the declaration to every peer. From then on
+// the client's binary frames must be track frames (ParseTrackFrame) of a declared track; others are dropped.
+// An empty declaration returns the session to plain frames.
+func (h *StreamHub) DeclareTracks(p *Peer, tracks []model.Track) error {
+	if p.Role != PeerRoleClient {
+		return errs.ErrTrackRole
+	}
+	if err := validateTracks(tracks); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	if len(tracks) == 0 {
+		delete(h.tracks, p.SessionID)
+	} else {
+		h.tracks[p.SessionID] = append([]model.Track(nil), tracks...)
+	}
+	h.mu.Unlock()
+	ev := model.TrackMessage{Event: model.TrackDeclare, SessionID: p.SessionID, Tracks: tracks}
+	// in the recording too, so that a recording of track frames can be split into its declared tracks
+	if raw, err := json.Marshal(ev); err == nil {
+		h.record(p.SessionID, Message{Type: websocket.TextMessage, Data: raw})
+	}
+	h.Broadcast(p.SessionID, ev)
+	return nil
+}
+
+// SetTrackSubscription subscribes the operator p to trackIDs again (on) or unsubscribes it; operators receive
+// every track until they unsubscribe. Returns the track_subscription reply: the declared tracks p receives.
+func (h *StreamHub) SetTrackSubscription(p *Peer, trackIDs []int, on bool) (model.TrackMessage, error) {
+	if p.Role != PeerRoleOperator {
+		return model.TrackMessage{}, errs.ErrTrackRole
+	}
+	for _, id := range trackIDs {
+		if id < 1 || id > 255 {
+			return model.TrackMessage{}, fmt.Errorf("%w: track id must be 1..255", errs.ErrInvalidTracks)
+		}
+	}
+	p.trackMu.Lock()
+	for _, n := range trackIDs {
+		id := uint8(n)
+		if on {
+			delete(p.unsubscribed, id)
+		} else {
+			if p.unsubscribed == nil {
+				p.unsubscribed = make(map[uint8]bool)
+			}
+			p.unsubscribed[id] = true
+		}
+	}
+	p.trackMu.Unlock()
+	reply := model.TrackMessage{Event: model.TrackSubscribed, SessionID: p.SessionID}
+	for _, t := range h.Tracks(p.SessionID) {
+		if p.wantsTrack(t.ID) {
+			reply.TrackIDs = append(reply.TrackIDs, int(t.ID))
+		}
+	}
+	return reply, nil
+}
+
+// Tracks returns the tracks declared by the session client; nil if none.
+func (h *StreamHub) Tracks(sessionID string) []model.Track {
 	h.mu.RLock()
-	m, ok := h.peers[sessionID]
-	if !ok {
-		h.mu.RUnlock()
-		return
+	defer h.mu.RUnlock()
+	return h.tracks[sessionID]
+}
+
+func (p *Peer) wantsTrack(id uint8) bool {
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+	return !p.unsubscribed[id]
+}
+
+// unsubscribedTracks returns the tracks the operator opted out of, sorted; nil if none.
+func (p *Peer) unsubscribedTracks() []int {
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+	var ids []int
+	for id := range p.unsubscribed {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// primaryTrack is the track connection-less subscribers (HLS, chunked HTTP) receive: they cannot
+// subscribe or demultiplex, so they get the first video track (else the first track) without its header.
+func primaryTrack(tracks []model.Track) uint8 {
+	for _, t := range tracks {
+		if t.Kind == model.TrackKindVideo {
+			return t.ID
+		}
+	}
+	return tracks[0].ID
+}
+
+// declaredTrack checks a track frame header against the declaration.
+func declaredTrack(tracks []model.Track, th TrackHeader) error {
+	for _, t := range tracks {
+		if t.ID == th.Track {
+			if t.Kind != th.Kind {
+				return fmt.Errorf("track frame: track %d is %s, header says %s", t.ID, t.Kind, th.Kind)
+			}
+			return nil
+		}
 	}
+	return fmt.Errorf("track frame: track %d is not declared", th.Track)
+}
+
+// RelayToOperators sends data from the client to all operators (and packagers) in the session. When the
+// client declared tracks, a binary frame goes to the operators subscribed to its track (header included), and
+// the primary track's payload to connection-less subscribers. The hub keeps data (timed frames get the
+// ingress time written into it): the caller must not reuse it.
+func (h *StreamHub) RelayToOperators(sessionID string, messageType int, data []byte) {
+	h.mu.RLock()
+	tracks := h.tracks[sessionID]
 	// Copy peers so we don't hold lock while writing
-	peers := make([]*Peer, 0, len(m))
-	for p := range m {
-		if p.Role == PeerRoleOperator {
+	peers := make([]*Peer, 0, len(h.peers[sessionID]))
+	for p := range h.peers[sessionID] {
+		if (p.Role == PeerRoleOperator || p.Role == PeerRolePackager) && !p.control {
 			peers = append(peers, p)
 		}
 	}
 	h.mu.RUnlock()
 
+	if messageType == websocket.TextMessage {
+		// client chat and annotations
+		h.logTimeline(sessionID, model.TimelineEvent{Type: model.TimelineClientMessage, Role: string(PeerRoleClient), Data: timelineData(data)})
+	}
+
+	msg := Message{Type: messageType, Data: data}
+	primary := data // the payload for connection-less subscribers; nil: the frame is not for them
+	if messageType == websocket.BinaryMessage {
+		payload := data
+		if tracks != nil || isTimedFrame(data) {
+			th, p, err := ParseTrackFrame(data)
+			if err == nil && tracks != nil {
+				err = declaredTrack(tracks, th)
+			}
+			if err != nil {
+				h.log.Debug("client frame dropped", zap.String("session_id", sessionID), zap.Error(err))
+				return
+			}
+			msg.Track, payload, primary = th.Track, p, nil
+			if tracks == nil || th.Track == primaryTrack(tracks) {
+				primary = p
+			}
+			if th.Timed {
+				h.stampIngress(sessionID, th, data)
+				msg.Timed = true
+			}
+		}
+		if h.inspector != nil {
+			// every frame, also with no operator: the inspector needs the init segment and PSI
+			msg.Frame = h.inspector.Inspect(sessionID, msg.Track, payload)
+		}
+	}
+
 	for _, p := range peers {
-		select {
-		case p.Send <- data:
-		default:
+		out := msg
+		switch {
+		case p.Conn == nil && primary == nil:
+			continue
+		case p.Conn == nil:
+			out.Data, out.Timed = primary, false
+		case msg.Track != 0 && !p.wantsTrack(msg.Track):
+			continue
+		}
+		if !p.admit(out) {
+			continue // undecodable until the next keyframe, or skipped to catch up
+		}
+		if !p.trySend(out) {
+			p.lost(out)
 			h.log.Warn("operator send buffer full", zap.String("user_id", p.UserID))
 		}
 	}
-	if h.recorder != nil && len(data) > 0 {
-		ctx := context.Background()
-		if h.ctx != nil {
-			ctx = h.ctx
+	h.record(sessionID, msg)
+}
+
+// SetSnapshot keeps the image of a snapshot frame (ParseSnapshotFrame) sent by the session client p as the
+// session's snapshot; frames of other peers and images of unknown types are dropped. Snapshot frames are
+// neither relayed nor recorded.
+func (h *StreamHub) SetSnapshot(p *Peer, img []byte) {
+	if p.Role != PeerRoleClient {
+		return
+	}
+	ctype := http.DetectContentType(img)
+	if !strings.HasPrefix(ctype, "image/") {
+		h.log.Debug("snapshot frame dropped: not an image", zap.String("session_id", p.SessionID), zap.String("content_type", ctype))
+		return
+	}
+	snap := Snapshot{Data: append([]byte(nil), img...), ContentType: ctype, At: time.Now().UTC()}
+	h.mu.Lock()
+	h.snapshots[p.SessionID] = snap
+	h.mu.Unlock()
+}
+
+// Snapshot returns the session's latest snapshot; false if the client has not pushed one.
+func (h *StreamHub) Snapshot(sessionID string) (Snapshot, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	snap, ok := h.snapshots[sessionID]
+	return snap, ok
+}
+
+// ExpireSnapshots drops, until ctx is cancelled, the snapshots of sessions nobody is connected to that are older
+// than idle, so a session that was abandoned without being closed does not keep its image in memory.
+func (h *StreamHub) ExpireSnapshots(ctx context.Context, idle time.Duration) {
+	t := time.NewTicker(max(idle/4, time.Second))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			h.sweepSnapshots(now.Add(-idle))
+		}
+	}
+}
+
+// sweepSnapshots drops the snapshots taken before before of sessions without peers.
+func (h *StreamHub) sweepSnapshots(before time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, snap := range h.snapshots {
+		if _, live := h.peers[id]; !live && snap.At.Before(before) {
+			delete(h.snapshots, id)
+		}
+	}
+}
+
+// record forwards a relayed frame to the recorder while the session is being recorded. Text frames (track
+// declarations) only go to a FrameRecorder, which keeps the message type.
+func (h *StreamHub) record(sessionID string, msg Message) {
+	if h.recorder == nil || len(msg.Data) == 0 {
+		return
+	}
+	h.recMu.RLock()
+	defer h.recMu.RUnlock()
+	if !h.recording[sessionID] {
+		return
+	}
+	fr, ok := h.recorder.(FrameRecorder)
+	if !ok {
+		if msg.Type != websocket.BinaryMessage {
+			return // a plain recorder cannot tell a text frame from media
 		}
-		h.recorder.WriteChunk(ctx, sessionID, data)
+		h.recorder.WriteChunk(h.recordingContext(), sessionID, msg.Data)
+		return
 	}
+	fr.WriteFrame(h.recordingContext(), sessionID, msg.Data, model.RecordedFrame{
+		MessageType: msg.Type,
+		Track:       msg.Track,
+		Container:   msg.Frame.Container,
+		Keyframe:    msg.Frame.Keyframe,
+		Init:        msg.Frame.Init,
+		PTS:         msg.Frame.PTS,
+		HasPTS:      msg.Frame.HasPTS,
+	})
 }
 
-// CloseSession closes all connections in the session and removes them.
+// OperatorMessage records a text frame sent by an operator (chat, annotations) in the session timeline.
+// Operator frames are not relayed.
+func (h *StreamHub) OperatorMessage(sessionID, userID string, messageType int, data []byte) {
+	if messageType != websocket.TextMessage {
+		return
+	}
+	h.logTimeline(sessionID, model.TimelineEvent{
+		Type:   model.TimelineOperatorMessage,
+		UserID: userID,
+		Role:   string(PeerRoleOperator),
+		Data:   timelineData(data),
+	})
+}
+
+// logTimeline appends ev to the session timeline, stamping it with the current time and, while the session
+// has a recording, its media position.
+func (h *StreamHub) logTimeline(sessionID string, ev model.TimelineEvent) {
+	if h.timeline == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	if h.positions != nil {
+		if st, ok := h.positions.State(sessionID); ok {
+			ev.Media = &model.TimelineMediaPos{Seq: st.Seq, Offset: st.Offset}
+		}
+	}
+	if err := h.timeline.Append(sessionID, ev); err != nil {
+		h.log.Warn("timeline append failed", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
+
+// timelineData keeps JSON payloads as-is and wraps anything else as a JSON string.
+func timelineData(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	raw, _ := json.Marshal(string(data))
+	return raw
+}
+
+// InitRecording sets whether the session is recorded unless the hub already knows it
+// (the persisted mode is loaded on connect, e.g. after a restart; SetRecording/EndRecording take precedence).
+// Call it after the peer is registered: the mode is dropped when the last peer leaves.
+func (h *StreamHub) InitRecording(sessionID string, on bool) {
+	h.recMu.RLock()
+	_, known := h.recording[sessionID]
+	h.recMu.RUnlock()
+	if known {
+		return
+	}
+	if on {
+		h.startRecording(sessionID)
+	}
+	h.recMu.Lock()
+	defer h.recMu.Unlock()
+	if _, ok := h.recording[sessionID]; !ok {
+		h.recording[sessionID] = on
+	}
+}
+
+// SetRecording switches forwarding of the session's chunks to the recorder (start/pause/resume).
+func (h *StreamHub) SetRecording(sessionID string, on bool) {
+	if on {
+		h.startRecording(sessionID)
+	}
+	h.recMu.Lock()
+	h.recording[sessionID] = on
+	h.recMu.Unlock()
+}
+
+// startRecording lets the recorder prepare the session's recording (RecordingStarter).
+func (h *StreamHub) startRecording(sessionID string) {
+	if st, ok := h.recorder.(RecordingStarter); ok {
+		st.StartSession(h.recordingContext(), sessionID)
+	}
+}
+
+// dropRecordingMode forgets the mode of a session nobody is connected to any more; the next peer loads the
+// persisted one (InitRecording). Without this a peer that connects while the session is being finished would
+// leave an entry behind after CloseSession. Lock order: recMu, then mu (as record via the state broadcast).
+func (h *StreamHub) dropRecordingMode(sessionID string) {
+	h.recMu.Lock()
+	defer h.recMu.Unlock()
+	h.mu.RLock()
+	_, back := h.peers[sessionID]
+	h.mu.RUnlock()
+	if !back {
+		delete(h.recording, sessionID)
+	}
+}
+
+// EndRecording stops forwarding and finalizes the session's current recording; a later SetRecording(true) starts a new one.
+func (h *StreamHub) EndRecording(sessionID string) {
+	h.recMu.Lock()
+	h.recording[sessionID] = false
+	h.recMu.Unlock()
+	if h.recorder != nil {
+		h.recorder.EndSession(h.recordingContext(), sessionID)
+	}
+}
+
+func (h *StreamHub) recordingContext() context.Context {
+	if h.ctx != nil {
+		return h.ctx
+	}
+	return context.Background()
+}
+
+// CloseSession finalizes the session's recording (also when nobody is connected any more),
+// then closes all connections in the session and removes them.
 func (h *StreamHub) CloseSession(sessionID string) {
+	if h.timeline != nil {
+		h.logTimeline(sessionID, model.TimelineEvent{Type: model.TimelineSessionFinished})
+	}
+	h.recMu.Lock()
+	delete(h.recording, sessionID)
+	h.recMu.Unlock()
+	if h.recorder != nil {
+		h.recorder.EndSession(h.recordingContext(), sessionID)
+	}
+	if h.inspector != nil {
+		h.inspector.End(sessionID)
+	}
+
+	h.timingMu.Lock()
+	if t := h.timings[sessionID]; t != nil {
+		h.log.Info("session ingress frame stats", append([]zap.Field{zap.String("session_id", sessionID)}, t.fields()...)...)
+		delete(h.timings, sessionID)
+	}
+	h.timingMu.Unlock()
+
 	h.mu.Lock()
+	delete(h.snapshots, sessionID) // kept after the client left, so even a session without peers has one
 	m, ok := h.peers[sessionID]
 	if !ok {
 		h.mu.Unlock()
 		return
 	}
 	delete(h.peers, sessionID)
+	delete(h.tracks, sessionID)
 	h.mu.Unlock()
 
-	if h.recorder != nil {
-		ctx := context.Background()
-		if h.ctx != nil {
-			ctx = h.ctx
-		}
-		h.recorder.EndSession(ctx, sessionID)
-	}
-	// Send close message then close connections
+	// Queue the close message and close Send: the peer's writer (writePump for a WebSocket, the only goroutine
+	// writing to it) delivers the queued frames and the event, then closes the connection.
 	closeMsg := map[string]string{"event": "session_finished", "session_id": sessionID}
 	raw, _ := json.Marshal(closeMsg)
 	for p := range m {
-		_ = p.Conn.WriteMessage(websocket.TextMessage, raw)
+		p.trySend(Message{Type: websocket.TextMessage, Data: raw})
 		p.closeSend()
-		_ = p.Conn.Close()
 	}
 	h.log.Info("session closed", zap.String("session_id", sessionID))
 }
@@ -206,3 +861,143 @@ func (h *StreamHub) PeerCount(sessionID string) int {
 	defer h.mu.RUnlock()
 	return len(h.peers[sessionID])
 }
+
+// Sessions returns a snapshot of all sessions with live peers, ordered by session ID.
+func (h *StreamHub) Sessions() []model.HubSession {
+	h.mu.RLock()
+	out := make([]model.HubSession, 0, len(h.peers))
+	for id, m := range h.peers {
+		out = append(out, h.hubSession(id, m))
+	}
+	h.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].SessionID < out[j].SessionID })
+	return out
+}
+
+// Session returns a snapshot of one session's live peers; false if nobody is connected.
+func (h *StreamHub) Session(sessionID string) (model.HubSession, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	m, ok := h.peers[sessionID]
+	if !ok {
+		return model.HubSession{}, false
+	}
+	return h.hubSession(sessionID, m), true
+}
+
+// DisconnectPeer closes every connection of userID in the session with a close frame carrying reason.
+// The peer is unregistered by its own read loop once the connection is closed. Returns number of closed connections.
+func (h *StreamHub) DisconnectPeer(sessionID, userID, reason string) int {
+	h.mu.RLock()
+	var targets []*Peer
+	for p := range h.peers[sessionID] {
+		if p.UserID == userID {
+			targets = append(targets, p)
+		}
+	}
+	h.mu.RUnlock()
+
+	// WriteControl and Close are safe to call concurrently with the peer's write pump.
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, truncateCloseReason(reason))
+	for _, p := range targets {
+		if p.Conn == nil {
+			p.closeSend() // the subscriber sees Send closed and cleans up
+			continue
+		}
+		_ = p.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = p.Conn.Close()
+	}
+	return len(targets)
+}
+
+// Broadcast queues v as a JSON text message to every peer in the session. Returns number of peers it was queued for.
+func (h *StreamHub) Broadcast(sessionID string, v any) int {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		h.log.Warn("broadcast marshal failed", zap.String("session_id", sessionID), zap.Error(err))
+		return 0
+	}
+	h.logTimeline(sessionID, model.TimelineEvent{Type: model.TimelineControl, Data: raw})
+	h.mu.RLock()
+	peers := make([]*Peer, 0, len(h.peers[sessionID]))
+	for p := range h.peers[sessionID] {
+		peers = append(peers, p)
+	}
+	h.mu.RUnlock()
+
+	n := 0
+	msg := Message{Type: websocket.TextMessage, Data: raw}
+	for _, p := range peers {
+		if p.trySend(msg) {
+			n++
+		} else {
+			h.log.Warn("peer send buffer full", zap.String("session_id", sessionID), zap.String("user_id", p.UserID))
+		}
+	}
+	return n
+}
+
+// SendJSON queues v as a JSON text message without blocking; false if it was not queued.
+func (p *Peer) SendJSON(v any) bool {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return p.trySend(Message{Type: websocket.TextMessage, Data: raw})
+}
+
+// trySend enqueues msg without blocking; false if the buffer is full or the peer is already closed.
+func (p *Peer) trySend(msg Message) bool {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if p.closed {
+		return false // peer unregistered concurrently
+	}
+	select {
+	case p.Send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// hubSession builds the admin view of a session; h.mu must be held.
+func (h *StreamHub) hubSession(sessionID string, m map[*Peer]struct{}) model.HubSession {
+	hs := model.HubSession{SessionID: sessionID, Tracks: h.tracks[sessionID], Peers: make([]model.HubPeer, 0, len(m))}
+	if snap, ok := h.snapshots[sessionID]; ok {
+		hs.SnapshotAt = &snap.At
+	}
+	h.timingMu.Lock()
+	if t := h.timings[sessionID]; t != nil {
+		hs.Ingress = t.stats()
+	}
+	h.timingMu.Unlock()
+	for p := range m {
+		hs.Peers = append(hs.Peers, model.HubPeer{
+			UserID:       p.UserID,
+			Role:         string(p.Role),
+			Transport:    p.Transport,
+			RemoteAddr:   p.RemoteAddr,
+			ConnectedAt:  p.ConnectedAt,
+			QueueDepth:   len(p.Send),
+			QueueCap:     cap(p.Send),
+			Unsubscribed: p.unsubscribedTracks(),
+			Frames:       p.frames.stats(),
+		})
+	}
+	sort.Slice(hs.Peers, func(i, j int) bool { return hs.Peers[i].ConnectedAt.Before(hs.Peers[j].ConnectedAt) })
+	return hs
+}
+
+// truncateCloseReason keeps the reason within the 123-byte limit of a close frame payload.
+func truncateCloseReason(reason string) string {
+	const max = 123
+	if len(reason) <= max {
+		return reason
+	}
+	r := reason[:max]
+	for !utf8.ValidString(r) {
+		r = r[:len(r)-1]
+	}
+	return r
+}
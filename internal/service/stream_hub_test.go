@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"go.uber.org/zap"
+)
+
+func TestSnapshotsFromClientOnlyAndExpired(t *testing.T) {
+	h := NewStreamHub(0, zap.NewNop())
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+	op, leaveOp := h.Subscribe("s1", "op", TransportHTTP)
+	h.SetSnapshot(op, png)
+	if _, ok := h.Snapshot("s1"); ok {
+		t.Fatal("snapshot of an operator kept")
+	}
+	client, leave, err := h.Publish("s1", "client", TransportRTMP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetSnapshot(client, []byte("not an image"))
+	if _, ok := h.Snapshot("s1"); ok {
+		t.Fatal("snapshot that is not an image kept")
+	}
+	h.SetSnapshot(client, png)
+	if snap, ok := h.Snapshot("s1"); !ok || snap.ContentType != "image/png" {
+		t.Fatalf("snapshot = %+v, %v; want the client's PNG", snap, ok)
+	}
+
+	h.sweepSnapshots(time.Now().Add(time.Hour))
+	if _, ok := h.Snapshot("s1"); !ok {
+		t.Fatal("snapshot of a session with peers expired")
+	}
+	leave()
+	leaveOp()
+	h.sweepSnapshots(time.Now().Add(-time.Hour))
+	if _, ok := h.Snapshot("s1"); !ok {
+		t.Fatal("snapshot expired before the idle timeout")
+	}
+	h.sweepSnapshots(time.Now().Add(time.Hour))
+	if _, ok := h.Snapshot("s1"); ok {
+		t.Fatal("snapshot of an idle session kept")
+	}
+}
+
+func TestCloseSessionQueuesFinishedEvent(t *testing.T) {
+	h := NewStreamHub(0, zap.NewNop())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := h.Upgrader().Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		p, leave, err := h.Register("s1", "op", PeerRoleOperator, conn)
+		if err != nil {
+			return
+		}
+		defer leave()
+		for msg := range p.Send { // the only writer, like the handler's writePump
+			if err := p.Write(msg); err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	for h.PeerCount("s1") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	h.RelayToOperators("s1", websocket.BinaryMessage, []byte{1, 2, 3})
+	h.CloseSession("s1")
+	if _, data, err := conn.ReadMessage(); err != nil || !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Fatalf("queued frame = %v, %v", data, err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || !bytes.Contains(data, []byte(`"session_finished"`)) {
+		t.Fatalf("close event = %s, %v", data, err)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("connection still open after the close event")
+	}
+}
+
+func TestOneClientPerSession(t *testing.T) {
+	h := NewStreamHub(0, zap.NewNop())
+	_, leave, err := h.Publish("s1", "client", TransportRTMP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Publish("s1", "client", TransportWHIP); !errors.Is(err, errs.ErrClientConnected) {
+		t.Fatalf("second client: %v, want ErrClientConnected", err)
+	}
+	_, leaveOp := h.Subscribe("s1", "op", TransportHTTP)
+	defer leaveOp()
+	if n := h.PeerCount("s1"); n != 2 {
+		t.Fatalf("%d peers, want the first client and the operator", n)
+	}
+	leave()
+	_, leave, err = h.Publish("s1", "client", TransportWHIP)
+	if err != nil {
+		t.Fatalf("client after the previous one left: %v", err)
+	}
+	leave()
+
+	// clients connecting at once over different transports: exactly one gets in
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var admitted []func()
+	for _, tr := range []string{TransportRTMP, TransportWHIP, TransportRTMP, TransportWHIP, TransportRTMP, TransportWHIP} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, leave, err := h.Publish("s2", "client", tr); err == nil {
+				mu.Lock()
+				admitted = append(admitted, leave)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(admitted) != 1 {
+		t.Fatalf("%d clients admitted at once, want 1", len(admitted))
+	}
+	admitted[0]()
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+)
+
+// Track frame header, in front of every binary frame of a client that declared tracks (8 bytes, big-endian):
+//
+//	0     version (1)
+//	1     track ID (1..255, declared)
+//	2     kind: 1 video, 2 audio, 3 data (must match the declaration)
+//	3     flags (0)
+//	4..7  payload length
+//
+// The length makes a recording that concatenates frames separable into its tracks. A snapshot frame is this
+// header with track 0 and kind 4, followed by a still image; it is valid whether or not tracks were declared.
+//
+// Version 2 (a timed frame) appends 28 bytes, so gaps and latency can be measured end to end:
+//
+//	8..11   sequence number, per track (wraps)
+//	12..19  capture time, µs since the Unix epoch (client clock)
+//	20..27  ingress time, µs: 0 from the client, stamped by the hub on receipt
+//	28..35  egress time, µs: 0 from the client, stamped by the hub when it writes the frame to an operator
+//
+// A client that declared no tracks may send timed frames too, with track 0 and kind 0.
+const (
+	TrackHeaderSize    = 8
+	TimedHeaderSize    = 36
+	trackHeaderVersion = 1
+	timedHeaderVersion = 2
+	maxTracks          = 16
+	snapshotKind       = 4
+)
+
+var trackKindCodes = map[string]byte{model.TrackKindVideo: 1, model.TrackKindAudio: 2, model.TrackKindData: 3}
+
+// TrackHeader is the parsed track frame header. Seq and the times are set for timed (version 2) frames.
+type TrackHeader struct {
+	Track   uint8
+	Kind    string // "" for a timed frame of track 0
+	Flags   uint8
+	Timed   bool
+	Seq     uint32
+	Capture time.Time // client clock
+	Ingress time.Time // zero until the hub stamped it
+	Egress  time.Time
+}
+
+// ParseTrackFrame splits a track frame (version 1 or 2) into its header and payload.
+func ParseTrackFrame(data []byte) (TrackHeader, []byte, error) {
+	if len(data) < TrackHeaderSize {
+		return TrackHeader{}, nil, errors.New("track frame: short header")
+	}
+	size := TrackHeaderSize
+	switch data[0] {
+	case trackHeaderVersion:
+	case timedHeaderVersion:
+		size = TimedHeaderSize
+		if len(data) < size {
+			return TrackHeader{}, nil, errors.New("track frame: short header")
+		}
+	default:
+		return TrackHeader{}, nil, fmt.Errorf("track frame: unsupported version %d", data[0])
+	}
+	h := TrackHeader{Track: data[1], Flags: data[3], Timed: size == TimedHeaderSize}
+	for kind, code := range trackKindCodes {
+		if code == data[2] {
+			h.Kind = kind
+		}
+	}
+	if h.Kind == "" && !(h.Timed && h.Track == 0 && data[2] == 0) {
+		return TrackHeader{}, nil, fmt.Errorf("track frame: unknown kind %d", data[2])
+	}
+	if n := binary.BigEndian.Uint32(data[4:]); uint64(n) != uint64(len(data)-size) {
+		return TrackHeader{}, nil, fmt.Errorf("track frame: length %d, payload %d bytes", n, len(data)-size)
+	}
+	if h.Timed {
+		h.Seq = binary.BigEndian.Uint32(data[8:])
+		h.Capture, h.Ingress, h.Egress = micros(data[12:]), micros(data[20:]), micros(data[28:])
+	}
+	return h, data[size:], nil
+}
+
+// AppendTrackFrame appends a track frame of payload to dst; a timed frame when h.Timed.
+func AppendTrackFrame(dst []byte, h TrackHeader, payload []byte) []byte {
+	version := byte(trackHeaderVersion)
+	if h.Timed {
+		version = timedHeaderVersion
+	}
+	dst = append(dst, version, h.Track, trackKindCodes[h.Kind], h.Flags)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	if h.Timed {
+		dst = binary.BigEndian.AppendUint32(dst, h.Seq)
+		dst = binary.BigEndian.AppendUint64(dst, uint64(unixMicros(h.Capture)))
+		dst = binary.BigEndian.AppendUint64(dst, uint64(unixMicros(h.Ingress)))
+		dst = binary.BigEndian.AppendUint64(dst, uint64(unixMicros(h.Egress)))
+	}
+	return append(dst, payload...)
+}
+
+// isTimedFrame reports whether data is a well-formed timed frame of track 0 (a client without declared tracks).
+func isTimedFrame(data []byte) bool {
+	if len(data) < TimedHeaderSize || data[0] != timedHeaderVersion || data[1] != 0 || data[2] != 0 {
+		return false
+	}
+	return uint64(binary.BigEndian.Uint32(data[4:])) == uint64(len(data)-TimedHeaderSize)
+}
+
+// micros reads a header time; 0 is the zero time.
+func micros(b []byte) time.Time {
+	us := int64(binary.BigEndian.Uint64(b))
+	if us == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us)
+}
+
+// unixMicros is the header encoding of t; the zero time is 0.
+func unixMicros(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMicro()
+}
+
+// AppendSnapshotFrame appends a snapshot frame of image to dst.
+func AppendSnapshotFrame(dst []byte, image []byte) []byte {
+	dst = append(dst, trackHeaderVersion, 0, snapshotKind, 0)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(image)))
+	return append(dst, image...)
+}
+
+// ParseSnapshotFrame returns the image of a snapshot frame; false if data is not one.
+func ParseSnapshotFrame(data []byte) ([]byte, bool) {
+	if len(data) < TrackHeaderSize || data[0] != trackHeaderVersion || data[1] != 0 || data[2] != snapshotKind {
+		return nil, false
+	}
+	if uint64(binary.BigEndian.Uint32(data[4:])) != uint64(len(data)-TrackHeaderSize) {
+		return nil, false
+	}
+	return data[TrackHeaderSize:], true
+}
+
+// validateTracks checks a declaration: at most maxTracks tracks with distinct IDs 1..255 and known kinds.
+func validateTracks(tracks []model.Track) error {
+	if len(tracks) > maxTracks {
+		return fmt.Errorf("%w: at most %d tracks", errs.ErrInvalidTracks, maxTracks)
+	}
+	seen := make(map[uint8]bool, len(tracks))
+	for _, t := range tracks {
+		switch {
+		case t.ID == 0:
+			return fmt.Errorf("%w: track id must be 1..255", errs.ErrInvalidTracks)
+		case seen[t.ID]:
+			return fmt.Errorf("%w: duplicate track id %d", errs.ErrInvalidTracks, t.ID)
+		case trackKindCodes[t.Kind] == 0:
+			return fmt.Errorf("%w: track %d: kind must be video, audio or data", errs.ErrInvalidTracks, t.ID)
+		}
+		seen[t.ID] = true
+	}
+	return nil
+}
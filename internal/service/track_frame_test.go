@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTrackFrameRoundTrip(t *testing.T) {
+	capture := time.UnixMicro(1_700_000_000_123_456)
+	for _, h := range []TrackHeader{
+		{Track: 1, Kind: "video"},
+		{Track: 255, Kind: "data", Flags: 0},
+		{Track: 2, Kind: "audio", Timed: true, Seq: 1<<32 - 1, Capture: capture},
+		{Track: 0, Timed: true, Seq: 7, Capture: capture, Ingress: capture.Add(time.Millisecond), Egress: capture.Add(2 * time.Millisecond)},
+		{Track: 3, Kind: "video", Timed: true}, // zero times stay zero
+	} {
+		payload := []byte("payload")
+		frame := AppendTrackFrame([]byte("prefix"), h, payload)[len("prefix"):]
+		got, p, err := ParseTrackFrame(frame)
+		if err != nil {
+			t.Fatalf("%+v: %v", h, err)
+		}
+		if !got.Capture.Equal(h.Capture) || !got.Ingress.Equal(h.Ingress) || !got.Egress.Equal(h.Egress) {
+			t.Fatalf("times = %v %v %v, want %v %v %v", got.Capture, got.Ingress, got.Egress, h.Capture, h.Ingress, h.Egress)
+		}
+		got.Capture, got.Ingress, got.Egress = h.Capture, h.Ingress, h.Egress
+		if got != h || !bytes.Equal(p, payload) {
+			t.Fatalf("parsed %+v %q, want %+v %q", got, p, h, payload)
+		}
+		if h.Track == 0 && !isTimedFrame(frame) {
+			t.Fatal("timed frame of track 0 not recognized")
+		}
+	}
+
+	valid := AppendTrackFrame(nil, TrackHeader{Track: 1, Kind: "video", Timed: true}, []byte{1, 2})
+	for name, data := range map[string][]byte{
+		"short":        valid[:5],
+		"short timed":  valid[:TimedHeaderSize-1],
+		"version":      append([]byte{3}, valid[1:]...),
+		"kind":         append([]byte{1, 1, 9, 0}, valid[4:TrackHeaderSize]...),
+		"length":       valid[:len(valid)-1],
+		"kind 0 track": AppendTrackFrame(nil, TrackHeader{Track: 1}, nil),
+	} {
+		if _, _, err := ParseTrackFrame(data); err == nil {
+			t.Fatalf("%s: parsed", name)
+		}
+	}
+
+	img := []byte("\x89PNG")
+	if got, ok := ParseSnapshotFrame(AppendSnapshotFrame(nil, img)); !ok || !bytes.Equal(got, img) {
+		t.Fatalf("snapshot frame = %q, %v", got, ok)
+	}
+	if _, ok := ParseSnapshotFrame(valid); ok {
+		t.Fatal("track frame parsed as a snapshot frame")
+	}
+}
@@ -1,6 +1,15 @@
 package service
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
 
 // WSConfig holds WebSocket URL base for responses.
 type WSConfig struct {
@@ -18,3 +27,52 @@ func (c *WSConfig) WSURL(sessionID, userID string) string {
 	}
 	return fmt.Sprintf("%s/ws/stream/%s/%s", base, sessionID, userID)
 }
+
+// WSOptions configures the stream WebSocket upgrader (WS_* in config).
+type WSOptions struct {
+	ReadBufferSize   int // 0 reuses the HTTP server's buffers
+	WriteBufferSize  int
+	WriteBufferPool  bool // share write buffers between connections that are not writing
+	HandshakeTimeout time.Duration
+	Compression      bool // negotiate permessage-deflate; see Peer.Write
+	CompressionLevel int  // flate level, -2..9
+	// AllowedOrigins lists the origins (scheme://host[:port]) browsers may connect from; "*" allows any.
+	// Same-origin requests and requests without an Origin header (non-browser clients) are always allowed.
+	AllowedOrigins []string
+}
+
+// upgrader builds the websocket.Upgrader for o.
+func (o WSOptions) upgrader() websocket.Upgrader {
+	u := websocket.Upgrader{
+		ReadBufferSize:    o.ReadBufferSize,
+		WriteBufferSize:   o.WriteBufferSize,
+		HandshakeTimeout:  o.HandshakeTimeout,
+		EnableCompression: o.Compression,
+		CheckOrigin:       o.checkOrigin,
+	}
+	if o.WriteBufferPool {
+		u.WriteBufferPool = &sync.Pool{}
+	}
+	return u
+}
+
+// checkOrigin allows requests without Origin, same-origin requests and the allowed origins.
+func (o WSOptions) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
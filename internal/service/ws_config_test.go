@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// wsServer serves the hub's upgrader; every connection is registered as an operator and gets msgs.
+func wsServer(t *testing.T, o WSOptions, msgs ...Message) *httptest.Server {
+	h := NewStreamHub(0, zap.NewNop())
+	h.SetWSOptions(o)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := h.Upgrader().Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		p, leave, err := h.Register("s1", "op", PeerRoleOperator, conn)
+		if err != nil {
+			return
+		}
+		defer leave()
+		for _, msg := range msgs {
+			if err := p.Write(msg); err != nil {
+				return
+			}
+		}
+		_, _, _ = conn.ReadMessage() // until the client closes
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestWSOriginCheck(t *testing.T) {
+	srv := wsServer(t, WSOptions{AllowedOrigins: []string{"https://app.example.com/"}})
+	for _, tc := range []struct {
+		name, origin string
+		ok           bool
+	}{
+		{"allowed", "https://app.example.com", true},
+		{"denied", "https://evil.example.com", false},
+		{"same origin", srv.URL, true},
+		{"no origin", "", true},
+	} {
+		hdr := http.Header{}
+		if tc.origin != "" {
+			hdr.Set("Origin", tc.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL(srv), hdr)
+		if tc.ok {
+			if err != nil {
+				t.Fatalf("%s: dial: %v", tc.name, err)
+			}
+			conn.Close()
+			continue
+		}
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s: err = %v, resp = %v; want 403", tc.name, err, resp)
+		}
+	}
+}
+
+// rawConn keeps what the client reads from the network, to inspect frame headers.
+type rawConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *rawConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	c.buf.Write(b[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+func TestWSCompressesTextFramesOnly(t *testing.T) {
+	text := Message{Type: websocket.TextMessage, Data: []byte(`{"event":"system_message","text":"` + strings.Repeat("a", 64) + `"}`)}
+	binary := Message{Type: websocket.BinaryMessage, Data: bytes.Repeat([]byte{0}, 64)}
+	srv := wsServer(t, WSOptions{Compression: true, CompressionLevel: 1}, text, binary)
+
+	var raw *rawConn
+	d := websocket.Dialer{
+		EnableCompression: true,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			raw = &rawConn{Conn: c}
+			return raw, err
+		},
+	}
+	conn, resp, err := d.Dial(wsURL(srv), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("extensions = %q, want permessage-deflate negotiated", ext)
+	}
+	for _, want := range []Message{text, binary} {
+		mt, data, err := conn.ReadMessage()
+		if err != nil || mt != want.Type || !bytes.Equal(data, want.Data) {
+			t.Fatalf("read = %d %q, %v; want %d %q", mt, data, err, want.Type, want.Data)
+		}
+	}
+
+	raw.mu.Lock()
+	b := raw.buf.Bytes()
+	raw.mu.Unlock()
+	i := bytes.Index(b, []byte("\r\n\r\n"))
+	if i < 0 {
+		t.Fatal("no handshake response")
+	}
+	b = b[i+4:]
+	// unmasked server frames with a 7-bit length: RSV1 (0x40) marks a compressed message
+	for _, want := range []struct {
+		opcode     byte
+		compressed bool
+	}{{websocket.TextMessage, true}, {websocket.BinaryMessage, false}} {
+		if len(b) < 2 || b[1]&0x80 != 0 || int(b[1]) >= 126 || len(b) < 2+int(b[1]) {
+			t.Fatalf("unexpected frame header % x", b[:min(len(b), 2)])
+		}
+		if b[0]&0x0f != want.opcode || (b[0]&0x40 != 0) != want.compressed {
+			t.Fatalf("frame %#x: opcode %d, compressed %v; want %d, %v", b[0], b[0]&0x0f, b[0]&0x40 != 0, want.opcode, want.compressed)
+		}
+		b = b[2+int(b[1]):]
+	}
+}
+
+func TestWSUpgraderOptions(t *testing.T) {
+	h := NewStreamHub(0, zap.NewNop())
+	h.SetWSOptions(WSOptions{ReadBufferSize: 1024, WriteBufferSize: 2048, WriteBufferPool: true, HandshakeTimeout: 3 * time.Second})
+	u := h.Upgrader()
+	if u.ReadBufferSize != 1024 || u.WriteBufferSize != 2048 {
+		t.Fatalf("buffers = %d/%d, want 1024/2048", u.ReadBufferSize, u.WriteBufferSize)
+	}
+	if u.WriteBufferPool == nil {
+		t.Fatal("write buffer pool not set")
+	}
+	if u.HandshakeTimeout != 3*time.Second {
+		t.Fatalf("handshake timeout = %v, want 3s", u.HandshakeTimeout)
+	}
+	if u.EnableCompression {
+		t.Fatal("compression enabled without WS_COMPRESSION")
+	}
+	if u := (WSOptions{}).upgrader(); u.WriteBufferPool != nil || u.HandshakeTimeout != 0 {
+		t.Fatal("write buffer pool or handshake timeout set by default")
+	}
+
+	// the pooled write buffer still carries messages larger than the buffer
+	big := Message{Type: websocket.BinaryMessage, Data: bytes.Repeat([]byte{1}, 10000)}
+	srv := wsServer(t, WSOptions{ReadBufferSize: 1024, WriteBufferSize: 2048, WriteBufferPool: true, HandshakeTimeout: time.Second}, big)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if _, data, err := conn.ReadMessage(); err != nil || !bytes.Equal(data, big.Data) {
+		t.Fatalf("read %d bytes, %v; want %d", len(data), err, len(big.Data))
+	}
+}
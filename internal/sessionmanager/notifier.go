@@ -0,0 +1,298 @@
+// Package sessionmanager links streaming sessions to session-manager: it verifies linked sessions on create
+// and delivers recording results and status changes.
+//
+// Notifier is a durable retry queue: Enqueue/EnqueueStatus write a session_manager_notifications row in the
+// caller's transaction (next to the session update), Run polls due rows, calls SetRecordingUrl or Control and
+// retries with exponential backoff, so nothing is lost when session-manager is briefly unavailable.
+package sessionmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psds-microservice/session-manager-service/pkg/gen/session_manager_service"
+	"github.com/psds-microservice/streaming-service/internal/breaker"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	batchSize    = 20
+	callTimeout  = 10 * time.Second
+	backoffBase  = 5 * time.Second
+	backoffMax   = 10 * time.Minute
+)
+
+// Dial creates a (lazy) gRPC connection to session-manager; opts carry credentials (see grpccreds), plaintext when empty.
+func Dial(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return grpc.NewClient(addr, opts...)
+}
+
+// Notifier stores and delivers session-manager notifications.
+type Notifier struct {
+	db          *gorm.DB
+	sm          session_manager_service.SessionManagerServiceClient // nil: enqueue only (e.g. CLI), delivery runs elsewhere
+	log         *zap.Logger
+	maxAttempts int
+	wake        chan struct{}
+	breaker     *breaker.Breaker // optional, see SetBreaker
+}
+
+// NewNotifier creates a notifier delivering over conn; conn may be nil when the process only enqueues.
+// Call Run in a goroutine to start delivering.
+func NewNotifier(db *gorm.DB, conn grpc.ClientConnInterface, maxAttempts int, log *zap.Logger) *Notifier {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	n := &Notifier{db: db, log: log, maxAttempts: maxAttempts, wake: make(chan struct{}, 1)}
+	if conn != nil {
+		n.sm = session_manager_service.NewSessionManagerServiceClient(conn)
+	}
+	return n
+}
+
+// SetBreaker sets the circuit breaker for session-manager calls. While it is open, due notifications are
+// postponed without using up attempts and VerifySession fails fast with ErrSessionManagerUnavailable.
+func (n *Notifier) SetBreaker(b *breaker.Breaker) { n.breaker = b }
+
+// call runs fn through the breaker, if any.
+func (n *Notifier) call(fn func() error) error {
+	if n.breaker == nil {
+		return fn()
+	}
+	return n.breaker.Do(fn)
+}
+
+// Enqueue queues SetRecordingUrl(sessionID, url) using tx (same transaction as the recording_url update).
+// Call Notify after the transaction commits to deliver without waiting for the next poll.
+func (n *Notifier) Enqueue(tx *gorm.DB, sessionID, url string) error {
+	return tx.Create(&model.SessionManagerNotification{
+		ID:            uuid.New().String(),
+		SessionID:     sessionID,
+		Kind:          model.NotificationKindRecordingURL,
+		RecordingURL:  url,
+		Status:        model.NotificationPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// controlAction maps a streaming session status to the Control action session-manager knows ("active",
+// "finished"); other statuses have no counterpart there.
+func controlAction(st model.SessionStatus) (string, bool) {
+	switch st {
+	case model.SessionStatusActive, model.SessionStatusFinished:
+		return string(st), true
+	}
+	return "", false
+}
+
+// EnqueueStatus queues a status push for a linked session: Control(smSessionID, "active" | "finished");
+// statuses session-manager has no action for are not pushed. Older undelivered status pushes of the session
+// are superseded, so a late retry cannot reorder the lifecycle.
+func (n *Notifier) EnqueueStatus(tx *gorm.DB, sessionID, smSessionID string, sessionStatus model.SessionStatus) error {
+	if _, ok := controlAction(sessionStatus); !ok {
+		return nil
+	}
+	if err := tx.Model(&model.SessionManagerNotification{}).
+		Where("session_id = ? AND kind = ? AND status = ?", sessionID, model.NotificationKindStatus, model.NotificationPending).
+		Update("status", model.NotificationSuperseded).Error; err != nil {
+		return err
+	}
+	st := string(sessionStatus)
+	return tx.Create(&model.SessionManagerNotification{
+		ID:            uuid.New().String(),
+		SessionID:     sessionID,
+		Kind:          model.NotificationKindStatus,
+		TargetID:      &smSessionID,
+		SessionStatus: &st,
+		Status:        model.NotificationPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// VerifySession checks that smSessionID exists in session-manager and is not closed.
+func (n *Notifier) VerifySession(ctx context.Context, smSessionID string) error {
+	if n.sm == nil {
+		return errs.ErrSessionManagerUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	var resp *session_manager_service.SessionResponse
+	err := n.call(func() error {
+		var err error
+		resp, err = n.sm.GetSession(ctx, &session_manager_service.GetSessionRequest{Id: smSessionID})
+		if c := status.Code(err); c == codes.NotFound || c == codes.InvalidArgument {
+			return nil // an answer, not a failure of session-manager
+		}
+		return err
+	})
+	if err == nil && resp == nil {
+		return errs.ErrSessionManagerNotFound
+	}
+	switch status.Code(err) {
+	case codes.OK:
+	default:
+		return fmt.Errorf("%w: %v", errs.ErrSessionManagerUnavailable, err)
+	}
+	switch resp.GetStatus() {
+	case "finished", "closed", "cancelled":
+		return errs.ErrSessionManagerClosed
+	}
+	return nil
+}
+
+// Notify wakes Run.
+func (n *Notifier) Notify() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due notifications until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	if n.sm == nil {
+		return
+	}
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		// A full batch means more rows are probably due: keep draining before waiting.
+		for n.deliverDue(ctx) == batchSize && ctx.Err() == nil {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-n.wake:
+		}
+	}
+}
+
+// deliverDue claims due rows with FOR UPDATE SKIP LOCKED and a lease (several replicas may run), then sends each.
+func (n *Notifier) deliverDue(ctx context.Context) int {
+	var due []model.SessionManagerNotification
+	lease := time.Now().Add(callTimeout + time.Minute)
+	err := n.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.NotificationPending, time.Now()).
+			Order("next_attempt_at").Limit(batchSize).Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		ids := make([]string, len(due))
+		for i := range due {
+			ids[i] = due[i].ID
+		}
+		return tx.Model(&model.SessionManagerNotification{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			n.log.Warn("session-manager: claim notifications failed", zap.Error(err))
+		}
+		return 0
+	}
+	for i := range due {
+		n.attempt(ctx, &due[i])
+	}
+	return len(due)
+}
+
+func (n *Notifier) attempt(ctx context.Context, row *model.SessionManagerNotification) {
+	callCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	sendErr := n.call(func() error { return n.send(callCtx, row) })
+	cancel()
+	if errors.Is(sendErr, breaker.ErrOpen) {
+		// not attempted: release the lease so the row is retried once the circuit may have closed
+		if err := n.db.WithContext(ctx).Model(&model.SessionManagerNotification{}).Where("id = ?", row.ID).
+			Update("next_attempt_at", time.Now().Add(backoffBase)).Error; err != nil {
+			n.log.Warn("session-manager: postpone notification failed", zap.String("notification_id", row.ID), zap.Error(err))
+		}
+		return
+	}
+	attempts := row.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts}
+	if sendErr == nil {
+		updates["status"] = model.NotificationDone
+		updates["done_at"] = time.Now()
+		updates["last_error"] = nil
+	} else {
+		updates["last_error"] = sendErr.Error()
+		if attempts >= n.maxAttempts || terminal(sendErr) {
+			updates["status"] = model.NotificationFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(backoff(attempts))
+		}
+		n.log.Warn("session-manager: notification failed",
+			zap.String("session_id", row.SessionID),
+			zap.String("kind", row.Kind),
+			zap.Int("attempt", attempts),
+			zap.Error(sendErr))
+	}
+	if err := n.db.WithContext(ctx).Model(&model.SessionManagerNotification{}).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+		n.log.Warn("session-manager: record attempt failed", zap.String("notification_id", row.ID), zap.Error(err))
+	}
+}
+
+// send performs the call of one notification.
+func (n *Notifier) send(ctx context.Context, row *model.SessionManagerNotification) error {
+	if row.Kind != model.NotificationKindStatus {
+		_, err := n.sm.SetRecordingUrl(ctx, &session_manager_service.SetRecordingUrlRequest{
+			StreamSessionId: row.SessionID,
+			RecordingUrl:    row.RecordingURL,
+		})
+		return err
+	}
+	if row.TargetID == nil || row.SessionStatus == nil {
+		return errors.New("status notification without target")
+	}
+	action, ok := controlAction(model.SessionStatus(*row.SessionStatus))
+	if !ok {
+		return fmt.Errorf("no session-manager action for status %q", *row.SessionStatus)
+	}
+	resp, err := n.sm.Control(ctx, &session_manager_service.ControlRequest{Id: *row.TargetID, Action: action})
+	if err != nil {
+		return err
+	}
+	if !resp.GetOk() {
+		return errors.New("control rejected")
+	}
+	return nil
+}
+
+// terminal reports whether retrying err cannot help: the session is gone or closed in session-manager
+// (NotFound, FailedPrecondition).
+func terminal(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.FailedPrecondition:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before attempt n+1: exponential from 5s, capped at 10m, with ±20% jitter.
+func backoff(n int) time.Duration {
+	d := backoffBase
+	for i := 1; i < n && d < backoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, backoffMax)
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+}
@@ -0,0 +1,148 @@
+package sessionmanager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/psds-microservice/session-manager-service/pkg/gen/session_manager_service"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSessionManager answers like session-manager: GetSession returns the stored status or NotFound,
+// Control accepts "active" and "finished" on open sessions and answers NotFound for finished ones.
+type fakeSessionManager struct {
+	session_manager_service.UnimplementedSessionManagerServiceServer
+
+	mu       sync.Mutex
+	sessions map[string]string // id -> status
+	actions  []string
+	block    chan struct{} // non-nil: GetSession waits for it or the caller's cancel
+}
+
+func newFakeSessionManager(t *testing.T) (*fakeSessionManager, *Notifier) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSessionManager{sessions: make(map[string]string)}
+	srv := grpc.NewServer()
+	session_manager_service.RegisterSessionManagerServiceServer(srv, f)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+	conn, err := Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return f, NewNotifier(nil, conn, 3, zap.NewNop())
+}
+
+func (f *fakeSessionManager) GetSession(ctx context.Context, req *session_manager_service.GetSessionRequest) (*session_manager_service.SessionResponse, error) {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st, ok := f.sessions[req.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+	return &session_manager_service.SessionResponse{Id: req.GetId(), Status: st}, nil
+}
+
+func (f *fakeSessionManager) Control(_ context.Context, req *session_manager_service.ControlRequest) (*session_manager_service.ControlResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actions = append(f.actions, req.GetAction())
+	st, ok := f.sessions[req.GetId()]
+	if !ok || st == "finished" {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+	if req.GetAction() == "active" || req.GetAction() == "finished" {
+		f.sessions[req.GetId()] = req.GetAction()
+	}
+	return &session_manager_service.ControlResponse{Ok: true}, nil
+}
+
+func TestVerifySession(t *testing.T) {
+	f, n := newFakeSessionManager(t)
+	f.sessions["open"] = "waiting"
+	f.sessions["done"] = "finished"
+
+	for id, want := range map[string]error{
+		"open":    nil,
+		"done":    errs.ErrSessionManagerClosed,
+		"missing": errs.ErrSessionManagerNotFound,
+	} {
+		if err := n.VerifySession(context.Background(), id); !errors.Is(err, want) {
+			t.Errorf("VerifySession(%s) = %v, want %v", id, err, want)
+		}
+	}
+}
+
+func TestVerifySessionUsesCallerContext(t *testing.T) {
+	f, n := newFakeSessionManager(t)
+	f.sessions["open"] = "waiting"
+	f.block = make(chan struct{})
+	defer close(f.block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := n.VerifySession(ctx, "open"); !errors.Is(err, errs.ErrSessionManagerUnavailable) {
+		t.Fatalf("VerifySession with a cancelled request = %v, want unavailable", err)
+	}
+}
+
+func TestSendStatusActions(t *testing.T) {
+	f, n := newFakeSessionManager(t)
+	f.sessions["sm1"] = "waiting"
+	target := "sm1"
+	row := func(st model.SessionStatus) *model.SessionManagerNotification {
+		s := string(st)
+		return &model.SessionManagerNotification{Kind: model.NotificationKindStatus, TargetID: &target, SessionStatus: &s}
+	}
+	ctx := context.Background()
+
+	if err := n.send(ctx, row(model.SessionStatusActive)); err != nil {
+		t.Fatalf("active: %v", err)
+	}
+	if err := n.send(ctx, row(model.SessionStatusFinished)); err != nil {
+		t.Fatalf("finished: %v", err)
+	}
+	if err := n.send(ctx, row(model.SessionStatusWaiting)); err == nil {
+		t.Fatal("waiting was sent, session-manager has no action for it")
+	}
+	if f.actions[0] != "active" || f.actions[1] != "finished" || len(f.actions) != 2 {
+		t.Fatalf("actions = %v, want [active finished]", f.actions)
+	}
+
+	// the session is closed now: retrying cannot help
+	err := n.send(ctx, row(model.SessionStatusFinished))
+	if err == nil || !terminal(err) {
+		t.Fatalf("send to a closed session = %v, want a terminal error", err)
+	}
+	if terminal(status.Error(codes.Unavailable, "down")) || terminal(status.Error(codes.DeadlineExceeded, "slow")) {
+		t.Fatal("transient errors reported as terminal")
+	}
+}
+
+func TestEnqueueStatusSkipsWaiting(t *testing.T) {
+	n := NewNotifier(nil, nil, 1, zap.NewNop())
+	// no session-manager action for waiting: nothing is written, so the transaction is not touched
+	if err := n.EnqueueStatus(nil, "s1", "sm1", model.SessionStatusWaiting); err != nil {
+		t.Fatal(err)
+	}
+}
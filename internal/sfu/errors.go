@@ -0,0 +1,6 @@
+package sfu
+
+import "errors"
+
+// ErrNotCompiled is returned by New when the binary was built without -tags webrtc.
+var ErrNotCompiled = errors.New("webrtc support not compiled in (build with -tags webrtc)")
@@ -0,0 +1,611 @@
+//go:build webrtc
+
+// Package sfu is the WebRTC mode of the stream: a selective forwarding unit (pion) that receives the session
+// client's RTP tracks and forwards them, without transcoding, to every operator that subscribed. Signaling
+// (SDP offers/answers and trickle ICE) travels as JSON text frames over the stream WebSocket, see model.SignalMessage.
+//
+// The client publishes by sending webrtc_offer; an operator sends webrtc_subscribe and answers the offers the
+// service sends whenever the client's tracks change. The same rooms serve WHIP publishers and WHEP viewers
+// (HTTP offer/answer, see whip.go). Built with -tags webrtc; otherwise New returns ErrNotCompiled.
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+var (
+	errPublishRole   = errors.New("only the session client can publish")
+	errSubscribeRole = errors.New("only operators can subscribe")
+	errJoined        = errors.New("already subscribed")
+	errNotJoined     = errors.New("no webrtc connection: send webrtc_offer or webrtc_subscribe first")
+	errNoOffer       = errors.New("no offer to answer")
+)
+
+// rtpBufferSize fits one RTP packet at the usual MTU.
+const rtpBufferSize = 1500
+
+// gatherTimeout bounds the wait for local ICE candidates before a WHIP/WHEP answer is returned.
+const gatherTimeout = 5 * time.Second
+
+// SFU forwards each session's published tracks to its subscribers.
+type SFU struct {
+	api    *webrtc.API
+	config webrtc.Configuration
+	log    *zap.Logger
+
+	mu        sync.Mutex
+	rooms     map[string]*room        // sessionID -> room
+	conns     map[*service.Peer]*conn // hub peer -> its peer connection
+	resources map[string]*conn        // WHIP/WHEP resource ID -> connection
+}
+
+// room is the WebRTC side of one session: at most one publisher (the client) and any number of subscribers.
+type room struct {
+	id          string
+	publisher   *conn
+	tracks      map[*track]struct{}
+	subscribers map[*conn]struct{}
+}
+
+// track is a published track and the local track its packets are copied to for the subscribers.
+type track struct {
+	local *webrtc.TrackLocalStaticRTP
+	ssrc  webrtc.SSRC // publisher's SSRC, for keyframe requests
+	from  *conn
+	ended atomic.Bool
+}
+
+// conn is the peer connection of one hub peer: a WebSocket peer, or a WHIP publisher / WHEP viewer.
+type conn struct {
+	peer *service.Peer
+	pc   *webrtc.PeerConnection
+	room *room
+	log  *zap.Logger
+
+	id      string // WHIP/WHEP resource ID; "" when signaling over the WebSocket
+	whep    bool   // cannot renegotiate: new tracks replace ended ones on the negotiated senders
+	onClose func()
+	closed  sync.Once
+
+	mu          sync.Mutex // serializes negotiation
+	candidates  []webrtc.ICECandidateInit
+	renegotiate bool // tracks changed while an offer was outstanding
+	senders     map[*track]*webrtc.RTPSender
+}
+
+// New creates the SFU from the WEBRTC_* settings.
+func New(cfg *config.Config, log *zap.Logger) (*SFU, error) {
+	var se webrtc.SettingEngine
+	if cfg.WebRTCUDPPortMin > 0 {
+		if err := se.SetEphemeralUDPPortRange(uint16(cfg.WebRTCUDPPortMin), uint16(cfg.WebRTCUDPPortMax)); err != nil {
+			return nil, fmt.Errorf("udp port range: %w", err)
+		}
+	}
+	if ips := cfg.WebRTCNAT1To1IPList(); len(ips) > 0 {
+		se.SetNAT1To1IPs(ips, webrtc.ICECandidateTypeHost)
+	}
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	ir := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, ir); err != nil {
+		return nil, err
+	}
+	var rc webrtc.Configuration
+	if urls := cfg.WebRTCICEServerList(); len(urls) > 0 {
+		rc.ICEServers = []webrtc.ICEServer{{URLs: urls, Username: cfg.WebRTCICEUsername, Credential: cfg.WebRTCICECredential}}
+	}
+	return &SFU{
+		api:       webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(ir), webrtc.WithSettingEngine(se)),
+		config:    rc,
+		log:       log,
+		rooms:     make(map[string]*room),
+		conns:     make(map[*service.Peer]*conn),
+		resources: make(map[string]*conn),
+	}, nil
+}
+
+// Signal handles a signaling message of a WebSocket peer; failures are reported to the peer as webrtc_error.
+func (s *SFU) Signal(p *service.Peer, msg model.SignalMessage) {
+	var err error
+	switch msg.Event {
+	case model.SignalOffer:
+		err = s.publish(p, msg.SDP)
+	case model.SignalSubscribe:
+		err = s.subscribe(p)
+	case model.SignalAnswer:
+		err = s.answer(p, msg.SDP)
+	case model.SignalCandidate:
+		err = s.candidate(p, msg.Candidate)
+	}
+	if err != nil {
+		s.log.Debug("webrtc signal rejected",
+			zap.String("session_id", p.SessionID),
+			zap.String("user_id", p.UserID),
+			zap.String("event", msg.Event),
+			zap.Error(err))
+		p.SendJSON(model.SignalMessage{Event: model.SignalError, SessionID: p.SessionID, Error: err.Error()})
+	}
+}
+
+// Leave closes the peer's connection; called when its WebSocket closes.
+func (s *SFU) Leave(p *service.Peer) {
+	s.mu.Lock()
+	c := s.conns[p]
+	s.mu.Unlock()
+	if c != nil {
+		s.drop(c)
+	}
+}
+
+// Close closes every peer connection.
+func (s *SFU) Close() error {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		s.drop(c)
+	}
+	return nil
+}
+
+// publish answers the client's offer; a new offer on the same socket renegotiates, a new socket replaces
+// the previous publisher of the session.
+func (s *SFU) publish(p *service.Peer, sdp string) error {
+	if p.Role != service.PeerRoleClient {
+		return errPublishRole
+	}
+	s.mu.Lock()
+	c := s.conns[p]
+	s.mu.Unlock()
+	if c == nil {
+		var err error
+		if c, err = s.newConn(p, ""); err != nil {
+			return err
+		}
+		s.setPublisher(c)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.setOffer(sdp); err != nil {
+		return err
+	}
+	answer, err := c.createAnswer(false)
+	if err != nil {
+		return err
+	}
+	c.peer.SendJSON(model.SignalMessage{Event: model.SignalAnswer, SessionID: p.SessionID, SDP: answer})
+	return nil
+}
+
+// setPublisher makes c the publisher of its session, dropping the previous one.
+func (s *SFU) setPublisher(c *conn) {
+	c.pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) { s.forward(c, remote) })
+	s.mu.Lock()
+	r := s.room(c.peer.SessionID)
+	old := r.publisher
+	r.publisher, c.room = c, r
+	s.conns[c.peer] = c
+	if c.id != "" {
+		s.resources[c.id] = c
+	}
+	s.mu.Unlock()
+	if old != nil {
+		s.drop(old)
+	}
+}
+
+// subscribe connects an operator to the session's current and future tracks; the service sends the offers.
+func (s *SFU) subscribe(p *service.Peer) error {
+	if p.Role != service.PeerRoleOperator {
+		return errSubscribeRole
+	}
+	s.mu.Lock()
+	joined := s.conns[p] != nil
+	s.mu.Unlock()
+	if joined {
+		return errJoined
+	}
+	c, err := s.newConn(p, "")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	r := s.room(p.SessionID)
+	c.room = r
+	r.subscribers[c] = struct{}{}
+	s.conns[p] = c
+	// snapshot under s.mu: tracks published after this point are added by forward
+	tracks := make([]*track, 0, len(r.tracks))
+	for t := range r.tracks {
+		tracks = append(tracks, t)
+	}
+	s.mu.Unlock()
+	for _, t := range tracks {
+		c.addTrack(t)
+	}
+	return c.negotiate()
+}
+
+// answer applies an operator's answer to the last offer, then offers again if the tracks changed meanwhile.
+func (s *SFU) answer(p *service.Peer, sdp string) error {
+	s.mu.Lock()
+	c := s.conns[p]
+	s.mu.Unlock()
+	if c == nil || p.Role != service.PeerRoleOperator {
+		return errNoOffer
+	}
+	c.mu.Lock()
+	if c.pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		c.mu.Unlock()
+		return errNoOffer
+	}
+	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdp}); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.flushCandidates()
+	again := c.renegotiate
+	c.renegotiate = false
+	c.mu.Unlock()
+	if again {
+		return c.negotiate()
+	}
+	return nil
+}
+
+// candidate adds a remote ICE candidate; candidates arriving before the remote description are queued.
+func (s *SFU) candidate(p *service.Peer, cand *model.ICECandidate) error {
+	if cand == nil {
+		return nil
+	}
+	s.mu.Lock()
+	c := s.conns[p]
+	s.mu.Unlock()
+	if c == nil {
+		return errNotJoined
+	}
+	init := webrtc.ICECandidateInit{
+		Candidate:        cand.Candidate,
+		SDPMid:           cand.SDPMid,
+		SDPMLineIndex:    cand.SDPMLineIndex,
+		UsernameFragment: cand.UsernameFragment,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pc.RemoteDescription() == nil {
+		c.candidates = append(c.candidates, init)
+		return nil
+	}
+	return c.pc.AddICECandidate(init)
+}
+
+// newConn creates the peer connection of p; id is the WHIP/WHEP resource ID, whose local candidates
+// go into the answer instead of being trickled over the WebSocket.
+func (s *SFU) newConn(p *service.Peer, id string) (*conn, error) {
+	pc, err := s.api.NewPeerConnection(s.config)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{peer: p, pc: pc, log: s.log, id: id, senders: make(map[*track]*webrtc.RTPSender)}
+	pc.OnICECandidate(func(cand *webrtc.ICECandidate) {
+		if cand == nil || id != "" {
+			return
+		}
+		init := cand.ToJSON()
+		p.SendJSON(model.SignalMessage{Event: model.SignalCandidate, SessionID: p.SessionID, Candidate: &model.ICECandidate{
+			Candidate:        init.Candidate,
+			SDPMid:           init.SDPMid,
+			SDPMLineIndex:    init.SDPMLineIndex,
+			UsernameFragment: init.UsernameFragment,
+		}})
+	})
+	pc.OnConnectionStateChange(func(st webrtc.PeerConnectionState) {
+		s.log.Debug("webrtc connection state",
+			zap.String("session_id", p.SessionID),
+			zap.String("user_id", p.UserID),
+			zap.String("state", st.String()))
+		switch st {
+		case webrtc.PeerConnectionStateConnected:
+			if p.Role == service.PeerRoleOperator {
+				go c.requestKeyframes()
+			}
+		case webrtc.PeerConnectionStateFailed:
+			s.drop(c)
+		}
+	})
+	return c, nil
+}
+
+// room returns the session's room, creating it; s.mu must be held.
+func (s *SFU) room(sessionID string) *room {
+	r := s.rooms[sessionID]
+	if r == nil {
+		r = &room{id: sessionID, tracks: make(map[*track]struct{}), subscribers: make(map[*conn]struct{})}
+		s.rooms[sessionID] = r
+	}
+	return r
+}
+
+// drop unregisters and closes c. Closing a publisher ends its tracks, which forward then removes from the subscribers.
+func (s *SFU) drop(c *conn) {
+	s.mu.Lock()
+	if s.conns[c.peer] == c {
+		delete(s.conns, c.peer)
+	}
+	if c.id != "" && s.resources[c.id] == c {
+		delete(s.resources, c.id)
+	}
+	if r := c.room; r != nil {
+		if r.publisher == c {
+			r.publisher = nil
+		}
+		delete(r.subscribers, c)
+		if r.publisher == nil && len(r.subscribers) == 0 && len(r.tracks) == 0 && s.rooms[r.id] == r {
+			delete(s.rooms, r.id)
+		}
+	}
+	s.mu.Unlock()
+	if err := c.pc.Close(); err != nil {
+		s.log.Debug("webrtc close", zap.String("session_id", c.peer.SessionID), zap.Error(err))
+	}
+	if c.onClose != nil {
+		c.closed.Do(c.onClose)
+	}
+}
+
+// forward copies the packets of a published track to its local track until the track ends.
+func (s *SFU) forward(pub *conn, remote *webrtc.TrackRemote) {
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), remote.StreamID())
+	if err != nil {
+		s.log.Warn("webrtc: forward track", zap.String("session_id", pub.peer.SessionID), zap.Error(err))
+		return
+	}
+	t := &track{local: local, ssrc: remote.SSRC(), from: pub}
+	s.mu.Lock()
+	r := pub.room
+	if r.publisher != pub {
+		s.mu.Unlock()
+		return
+	}
+	r.tracks[t] = struct{}{}
+	subs := r.subscriberList()
+	s.mu.Unlock()
+	s.log.Info("webrtc track published",
+		zap.String("session_id", r.id),
+		zap.String("kind", remote.Kind().String()),
+		zap.String("codec", remote.Codec().MimeType))
+	for _, sub := range subs {
+		if sub.whep {
+			sub.replaceTrack(t)
+			continue
+		}
+		sub.addTrack(t)
+		if err := sub.negotiate(); err != nil {
+			sub.log.Warn("webrtc: renegotiate", zap.String("user_id", sub.peer.UserID), zap.Error(err))
+		}
+	}
+
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := remote.Read(buf)
+		if err != nil {
+			break
+		}
+		// ErrClosedPipe: a subscriber went away between reads, the others still get the packet
+		if _, err := local.Write(buf[:n]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			break
+		}
+	}
+
+	t.ended.Store(true)
+	s.mu.Lock()
+	delete(r.tracks, t)
+	subs = r.subscriberList()
+	if r.publisher == nil && len(r.subscribers) == 0 && len(r.tracks) == 0 && s.rooms[r.id] == r {
+		delete(s.rooms, r.id)
+	}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		if sub.whep {
+			continue // the sender stays negotiated for a republished track
+		}
+		if sub.removeTrack(t) {
+			if err := sub.negotiate(); err != nil {
+				sub.log.Debug("webrtc: renegotiate", zap.String("user_id", sub.peer.UserID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// subscriberList copies the subscribers; s.mu must be held.
+func (r *room) subscriberList() []*conn {
+	out := make([]*conn, 0, len(r.subscribers))
+	for c := range r.subscribers {
+		out = append(out, c)
+	}
+	return out
+}
+
+// addTrack sends t to the subscriber (takes effect with the next offer).
+func (c *conn) addTrack(t *track) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.senders[t]; ok || t.ended.Load() {
+		return
+	}
+	sender, err := c.pc.AddTrack(t.local)
+	if err != nil {
+		c.log.Warn("webrtc: add track", zap.String("user_id", c.peer.UserID), zap.Error(err))
+		return
+	}
+	c.senders[t] = sender
+	go c.readRTCP(sender)
+}
+
+// replaceTrack moves a WHEP viewer's sender of an ended track of the same kind to t. WHEP cannot
+// renegotiate, so a republished stream continues on the transceivers negotiated at the start.
+func (c *conn) replaceTrack(t *track) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for old, sender := range c.senders {
+		if !old.ended.Load() || old.local.Kind() != t.local.Kind() {
+			continue
+		}
+		if err := sender.ReplaceTrack(t.local); err != nil {
+			c.log.Debug("webrtc: replace track", zap.String("user_id", c.peer.UserID), zap.Error(err))
+			continue
+		}
+		delete(c.senders, old)
+		c.senders[t] = sender
+		go t.requestKeyframe()
+		return
+	}
+}
+
+// removeTrack stops sending t; false if it was not sent.
+func (c *conn) removeTrack(t *track) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sender, ok := c.senders[t]
+	if !ok {
+		return false
+	}
+	delete(c.senders, t)
+	return c.pc.RemoveTrack(sender) == nil
+}
+
+// negotiate sends an offer to the subscriber, or marks renegotiation while the previous offer is unanswered.
+// Nothing is offered before the first track.
+func (c *conn) negotiate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return nil
+	}
+	if len(c.senders) == 0 && c.pc.LocalDescription() == nil {
+		return nil
+	}
+	if c.pc.SignalingState() != webrtc.SignalingStateStable {
+		c.renegotiate = true
+		return nil
+	}
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	c.peer.SendJSON(model.SignalMessage{Event: model.SignalOffer, SessionID: c.peer.SessionID, SDP: offer.SDP})
+	return nil
+}
+
+// setOffer applies a remote offer and the candidates queued before it; c.mu must be held. An offer that
+// does not parse or apply is errs.ErrWebRTCBadOffer.
+func (c *conn) setOffer(sdp string) error {
+	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}); err != nil {
+		return fmt.Errorf("%w: %v", errs.ErrWebRTCBadOffer, err)
+	}
+	c.flushCandidates()
+	return nil
+}
+
+// createAnswer sets and returns the local answer. With gather it returns once ICE gathering completed (or
+// gatherTimeout passed), so the answer carries the local candidates: WHIP/WHEP servers do not trickle.
+// c.mu must be held.
+func (c *conn) createAnswer(gather bool) (string, error) {
+	answer, err := c.pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	done := webrtc.GatheringCompletePromise(c.pc)
+	if err := c.pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	if !gather {
+		return answer.SDP, nil
+	}
+	select {
+	case <-done:
+	case <-time.After(gatherTimeout):
+	}
+	return c.pc.LocalDescription().SDP, nil
+}
+
+// flushCandidates adds the queued remote candidates; c.mu must be held and the remote description set.
+func (c *conn) flushCandidates() {
+	for _, init := range c.candidates {
+		if err := c.pc.AddICECandidate(init); err != nil {
+			c.log.Debug("webrtc: add candidate", zap.String("user_id", c.peer.UserID), zap.Error(err))
+		}
+	}
+	c.candidates = nil
+}
+
+// readRTCP passes the subscriber's keyframe requests on to the publisher of the sender's current track;
+// the rest is handled by the interceptors.
+func (c *conn) readRTCP(sender *webrtc.RTPSender) {
+	for {
+		pkts, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			switch pkt.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				if t := c.sending(sender); t != nil {
+					t.requestKeyframe()
+				}
+			}
+		}
+	}
+}
+
+// sending returns the track sender currently sends.
+func (c *conn) sending(sender *webrtc.RTPSender) *track {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, s := range c.senders {
+		if s == sender {
+			return t
+		}
+	}
+	return nil
+}
+
+// requestKeyframes asks the publisher for a keyframe of every track sent to c, so a new subscriber can start decoding.
+func (c *conn) requestKeyframes() {
+	c.mu.Lock()
+	tracks := make([]*track, 0, len(c.senders))
+	for t := range c.senders {
+		tracks = append(tracks, t)
+	}
+	c.mu.Unlock()
+	for _, t := range tracks {
+		t.requestKeyframe()
+	}
+}
+
+func (t *track) requestKeyframe() {
+	_ = t.from.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(t.ssrc)}})
+}
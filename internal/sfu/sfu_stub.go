@@ -0,0 +1,30 @@
+//go:build !webrtc
+
+package sfu
+
+import (
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// SFU is unavailable in builds without the webrtc tag.
+type SFU struct{}
+
+// New reports that WebRTC support is not compiled in.
+func New(*config.Config, *zap.Logger) (*SFU, error) { return nil, ErrNotCompiled }
+
+func (*SFU) Signal(*service.Peer, model.SignalMessage) {}
+func (*SFU) Leave(*service.Peer)                       {}
+func (*SFU) Close() error                              { return nil }
+
+func (*SFU) WHIP(*service.Peer, string, func()) (string, string, error) {
+	return "", "", ErrNotCompiled
+}
+func (*SFU) WHEP(*service.Peer, string, func()) (string, string, error) {
+	return "", "", ErrNotCompiled
+}
+func (*SFU) Resource(string) (*service.Peer, bool) { return nil, false }
+func (*SFU) Trickle(string, string) error          { return ErrNotCompiled }
+func (*SFU) Delete(string) error                   { return ErrNotCompiled }
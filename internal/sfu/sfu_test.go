@@ -0,0 +1,221 @@
+//go:build webrtc
+
+package sfu
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/psds-microservice/streaming-service/internal/config"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// loopbackAPI gathers host candidates on the loopback interface only, so the peers connect without a network.
+func loopbackAPI(t *testing.T) *webrtc.API {
+	t.Helper()
+	var se webrtc.SettingEngine
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetInterfaceFilter(func(name string) bool { return name == "lo" })
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		t.Fatal(err)
+	}
+	ir := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, ir); err != nil {
+		t.Fatal(err)
+	}
+	return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(ir), webrtc.WithSettingEngine(se))
+}
+
+func newTestSFU(t *testing.T) *SFU {
+	t.Helper()
+	s, err := New(&config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.api = loopbackAPI(t)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func newTestPeer(sessionID, userID string, role service.PeerRole) *service.Peer {
+	return &service.Peer{SessionID: sessionID, UserID: userID, Role: role, Send: make(chan service.Message, 64)}
+}
+
+// remotePeer is the browser side of a hub peer: a pion connection driven by the signals the SFU sends to p.
+type remotePeer struct {
+	t       *testing.T
+	s       *SFU
+	p       *service.Peer
+	pc      *webrtc.PeerConnection
+	pending []webrtc.ICECandidateInit // candidates received before the remote description
+}
+
+func newRemotePeer(t *testing.T, s *SFU, p *service.Peer) *remotePeer {
+	t.Helper()
+	pc, err := loopbackAPI(t).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	// local candidates go in the SDP (gathered before it is sent), so none are trickled to the SFU
+	return &remotePeer{t: t, s: s, p: p, pc: pc}
+}
+
+// localSDP sets desc and returns it once gathering completed.
+func (r *remotePeer) localSDP(desc webrtc.SessionDescription) string {
+	r.t.Helper()
+	done := webrtc.GatheringCompletePromise(r.pc)
+	if err := r.pc.SetLocalDescription(desc); err != nil {
+		r.t.Fatal(err)
+	}
+	<-done
+	return r.pc.LocalDescription().SDP
+}
+
+// serve applies the SFU's signals to the connection: answers to the publish offer, subscription offers
+// (answered over Signal) and trickled candidates.
+func (r *remotePeer) serve() {
+	for msg := range r.p.Send {
+		if r.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return // the test is over; the SFU may still renegotiate as it closes
+		}
+		var sig model.SignalMessage
+		if err := json.Unmarshal(msg.Data, &sig); err != nil {
+			continue
+		}
+		switch sig.Event {
+		case model.SignalAnswer:
+			if err := r.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sig.SDP}); err != nil {
+				r.fail(err)
+				return
+			}
+			r.flush()
+		case model.SignalOffer:
+			if err := r.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sig.SDP}); err != nil {
+				r.fail(err)
+				return
+			}
+			r.flush()
+			answer, err := r.pc.CreateAnswer(nil)
+			if err != nil {
+				r.fail(err)
+				return
+			}
+			done := webrtc.GatheringCompletePromise(r.pc)
+			if err := r.pc.SetLocalDescription(answer); err != nil {
+				r.fail(err)
+				return
+			}
+			<-done
+			r.s.Signal(r.p, model.SignalMessage{Event: model.SignalAnswer, SDP: r.pc.LocalDescription().SDP})
+		case model.SignalCandidate:
+			init := webrtc.ICECandidateInit{Candidate: sig.Candidate.Candidate, SDPMid: sig.Candidate.SDPMid,
+				SDPMLineIndex: sig.Candidate.SDPMLineIndex, UsernameFragment: sig.Candidate.UsernameFragment}
+			if r.pc.RemoteDescription() == nil {
+				r.pending = append(r.pending, init)
+				continue
+			}
+			_ = r.pc.AddICECandidate(init)
+		case model.SignalError:
+			r.t.Errorf("signal rejected for %s: %s", r.p.UserID, sig.Error)
+		}
+	}
+}
+
+// fail reports err unless the connection was closed by the test's cleanup meanwhile.
+func (r *remotePeer) fail(err error) {
+	if r.pc.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		r.t.Error(err)
+	}
+}
+
+func (r *remotePeer) flush() {
+	for _, c := range r.pending {
+		_ = r.pc.AddICECandidate(c)
+	}
+	r.pending = nil
+}
+
+func TestSFUForwardsPublishedTrackToSubscriber(t *testing.T) {
+	s := newTestSFU(t)
+
+	client := newRemotePeer(t, s, newTestPeer("s1", "client", service.PeerRoleClient))
+	video, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.pc.AddTrack(video); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	offer, err := client.pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Signal(client.p, model.SignalMessage{Event: model.SignalOffer, SDP: client.localSDP(offer)})
+
+	operator := newRemotePeer(t, s, newTestPeer("s1", "operator", service.PeerRoleOperator))
+	received := make(chan []byte, 1)
+	operator.pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			pkt, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			case received <- pkt.Payload:
+			default:
+			}
+		}
+	})
+	go operator.serve()
+	s.Signal(operator.p, model.SignalMessage{Event: model.SignalSubscribe})
+
+	payload := []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a} // VP8 keyframe start
+	deadline := time.After(15 * time.Second)
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for seq := uint16(0); ; seq++ {
+		select {
+		case got := <-received:
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("operator received %x, want %x", got, payload)
+			}
+			return
+		case <-deadline:
+			t.Fatalf("no packet forwarded; client %s, operator %s", client.pc.ConnectionState(), operator.pc.ConnectionState())
+		case <-tick.C:
+			_ = video.WriteRTP(&rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: seq, Timestamp: uint32(seq) * 3000, Marker: true},
+				Payload: payload,
+			})
+		}
+	}
+}
+
+func TestSFURejectsWrongRoles(t *testing.T) {
+	s := newTestSFU(t)
+	op := newTestPeer("s1", "operator", service.PeerRoleOperator)
+	s.Signal(op, model.SignalMessage{Event: model.SignalOffer, SDP: "v=0"})
+	client := newTestPeer("s1", "client", service.PeerRoleClient)
+	s.Signal(client, model.SignalMessage{Event: model.SignalSubscribe})
+
+	for p, want := range map[*service.Peer]string{op: errPublishRole.Error(), client: errSubscribeRole.Error()} {
+		var sig model.SignalMessage
+		if err := json.Unmarshal((<-p.Send).Data, &sig); err != nil {
+			t.Fatal(err)
+		}
+		if sig.Event != model.SignalError || sig.Error != want {
+			t.Fatalf("%s got %+v, want webrtc_error %q", p.UserID, sig, want)
+		}
+	}
+}
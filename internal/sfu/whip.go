@@ -0,0 +1,144 @@
+//go:build webrtc
+
+package sfu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/service"
+)
+
+// WHIP publishes a WHIP client's offer as the session's media, replacing the previous publisher.
+func (s *SFU) WHIP(p *service.Peer, offer string, onClose func()) (string, string, error) {
+	c, err := s.newConn(p, uuid.New().String())
+	if err != nil {
+		onClose()
+		return "", "", err
+	}
+	c.onClose = onClose
+	s.setPublisher(c)
+	c.mu.Lock()
+	answer, err := c.accept(offer)
+	c.mu.Unlock()
+	if err != nil {
+		s.drop(c)
+		return "", "", err
+	}
+	return c.id, answer, nil
+}
+
+// WHEP answers an operator's offer with the tracks the session client is publishing. The viewer cannot
+// renegotiate: tracks published later replace ended ones of the same kind.
+func (s *SFU) WHEP(p *service.Peer, offer string, onClose func()) (string, string, error) {
+	if p.Role != service.PeerRoleOperator {
+		onClose()
+		return "", "", errSubscribeRole
+	}
+	s.mu.Lock()
+	var tracks []*track
+	if r := s.rooms[p.SessionID]; r != nil {
+		for t := range r.tracks {
+			tracks = append(tracks, t)
+		}
+	}
+	s.mu.Unlock()
+	if len(tracks) == 0 {
+		onClose()
+		return "", "", errs.ErrWebRTCNotPublishing
+	}
+	c, err := s.newConn(p, uuid.New().String())
+	if err != nil {
+		onClose()
+		return "", "", err
+	}
+	c.whep, c.onClose = true, onClose
+	s.mu.Lock()
+	r := s.room(p.SessionID)
+	c.room = r
+	r.subscribers[c] = struct{}{}
+	s.conns[p] = c
+	s.resources[c.id] = c
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	err = c.setOffer(offer)
+	c.mu.Unlock()
+	if err != nil {
+		s.drop(c)
+		return "", "", err
+	}
+	// after the offer, so the tracks take the viewer's recvonly transceivers
+	for _, t := range tracks {
+		c.addTrack(t)
+	}
+	c.mu.Lock()
+	answer, err := c.createAnswer(true)
+	c.mu.Unlock()
+	if err != nil {
+		s.drop(c)
+		return "", "", err
+	}
+	return c.id, answer, nil
+}
+
+// accept applies an offer and returns the answer with the local candidates; c.mu must be held.
+func (c *conn) accept(offer string) (string, error) {
+	if err := c.setOffer(offer); err != nil {
+		return "", err
+	}
+	return c.createAnswer(true)
+}
+
+// Resource returns the hub peer of a WHIP/WHEP resource, for authorizing PATCH and DELETE.
+func (s *SFU) Resource(id string) (*service.Peer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.resources[id]
+	if c == nil {
+		return nil, false
+	}
+	return c.peer, true
+}
+
+// Trickle adds the remote candidates of an application/trickle-ice-sdpfrag body (a=mid and a=candidate
+// lines). ICE restarts are not supported: the fragment's credentials are ignored.
+func (s *SFU) Trickle(id, frag string) error {
+	s.mu.Lock()
+	c := s.resources[id]
+	s.mu.Unlock()
+	if c == nil {
+		return errs.ErrWebRTCResourceNotFound
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var mid *string
+	for _, line := range strings.Split(frag, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "a=mid:"):
+			m := strings.TrimPrefix(line, "a=mid:")
+			mid = &m
+		case strings.HasPrefix(line, "a=candidate:"):
+			if err := c.pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: line[2:], SDPMid: mid}); err != nil {
+				return fmt.Errorf("%w: %v", errs.ErrWebRTCBadCandidate, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete ends a WHIP/WHEP resource.
+func (s *SFU) Delete(id string) error {
+	s.mu.Lock()
+	c := s.resources[id]
+	s.mu.Unlock()
+	if c == nil {
+		return errs.ErrWebRTCResourceNotFound
+	}
+	s.drop(c)
+	return nil
+}
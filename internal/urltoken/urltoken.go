@@ -0,0 +1,70 @@
+// Package urltoken signs short-lived access tokens carried in URLs, for clients that cannot set headers
+// (HLS players, <img> tags). A token binds one user to one session and one scope (the kind of resource it
+// opens) until it expires: "<user_id>.<expiry unix>.<base64url(HMAC-SHA256)>".
+package urltoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+)
+
+// Scopes of the tokens the service issues.
+const (
+	ScopeHLS      = "hls"
+	ScopeSnapshot = "snapshot"
+)
+
+// Signer issues and verifies tokens with one key; every replica of the service must share it.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+}
+
+// New creates a signer whose tokens are valid for ttl; an empty secret gets a random key, so tokens
+// are only valid on this process until it restarts.
+func New(secret string, ttl time.Duration) *Signer {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &Signer{key: key, ttl: ttl}
+}
+
+// Sign returns a token of userID for the session's scope and its expiry.
+func (s *Signer) Sign(scope, sessionID, userID string, now time.Time) (string, time.Time) {
+	exp := now.Add(s.ttl).Truncate(time.Second)
+	unix := strconv.FormatInt(exp.Unix(), 10)
+	return userID + "." + unix + "." + s.mac(scope, sessionID, userID, unix), exp
+}
+
+// Verify checks the token for the session's scope and returns its user ID; errs.ErrInvalidToken if it
+// is malformed, signed for something else or expired.
+func (s *Signer) Verify(token, scope, sessionID string, now time.Time) (string, error) {
+	userID, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errs.ErrInvalidToken
+	}
+	unix, mac, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(s.mac(scope, sessionID, userID, unix))) {
+		return "", errs.ErrInvalidToken
+	}
+	exp, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return "", errs.ErrInvalidToken
+	}
+	return userID, nil
+}
+
+func (s *Signer) mac(scope, sessionID, userID, unix string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(scope + "\n" + sessionID + "\n" + userID + "\n" + unix))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,34 @@
+package urltoken
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/psds-microservice/streaming-service/internal/errs"
+)
+
+func TestSignVerify(t *testing.T) {
+	s := New("secret", time.Hour)
+	now := time.Unix(1_700_000_000, 0)
+	token, exp := s.Sign(ScopeHLS, "s1", "u1", now)
+	if !exp.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expires %v, want %v", exp, now.Add(time.Hour))
+	}
+	if user, err := s.Verify(token, ScopeHLS, "s1", now.Add(time.Minute)); err != nil || user != "u1" {
+		t.Fatalf("Verify = %q, %v; want u1", user, err)
+	}
+
+	for name, check := range map[string]func() (string, error){
+		"expired":       func() (string, error) { return s.Verify(token, ScopeHLS, "s1", now.Add(2*time.Hour)) },
+		"other session": func() (string, error) { return s.Verify(token, ScopeHLS, "s2", now) },
+		"other scope":   func() (string, error) { return s.Verify(token, ScopeSnapshot, "s1", now) },
+		"other key":     func() (string, error) { return New("other", time.Hour).Verify(token, ScopeHLS, "s1", now) },
+		"other user":    func() (string, error) { return s.Verify("u2"+token[2:], ScopeHLS, "s1", now) },
+		"malformed":     func() (string, error) { return s.Verify("u1", ScopeHLS, "s1", now) },
+	} {
+		if _, err := check(); !errors.Is(err, errs.ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
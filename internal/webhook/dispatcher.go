@@ -0,0 +1,430 @@
+// Package webhook delivers signed session lifecycle events to subscribed HTTP endpoints.
+//
+// Dispatcher is an outbox sink: Publish writes one webhook_deliveries row per matching subscription; Run polls due rows,
+// POSTs the payload with an HMAC signature and retries with exponential backoff. Every
+// attempt is stored in webhook_delivery_attempts, so deliveries can be inspected and replayed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/outbox"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	batchSize    = 20
+	backoffBase  = 10 * time.Second
+	backoffMax   = time.Hour
+)
+
+// Dispatcher stores and delivers webhook events.
+type Dispatcher struct {
+	db          *gorm.DB
+	client      *http.Client
+	log         *zap.Logger
+	maxAttempts int
+	wake        chan struct{}
+}
+
+// NewDispatcher creates a dispatcher. Call Run in a goroutine to start delivering.
+func NewDispatcher(db *gorm.DB, timeout time.Duration, maxAttempts int, log *zap.Logger) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &Dispatcher{
+		db:          db,
+		client:      &http.Client{Timeout: timeout},
+		log:         log,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the signature header value for body: "t=<unix>,v1=<hex(HMAC-SHA256(secret, "<unix>.<body>"))>".
+// Receivers recompute v1 with their copy of the secret and should reject stale timestamps.
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Name implements outbox.Sink.
+func (d *Dispatcher) Name() string { return "webhook" }
+
+// Publish implements outbox.Sink: enqueues msg for every active subscription that listens to its type.
+// Deliveries are unique per (subscription, event), so a message relayed twice is enqueued once.
+func (d *Dispatcher) Publish(ctx context.Context, msg outbox.Message) error {
+	var subs []model.WebhookSubscription
+	if err := d.db.WithContext(ctx).Where("active = ?", true).Find(&subs).Error; err != nil {
+		return err
+	}
+	var sessionID *string
+	if msg.Key != "" {
+		sessionID = &msg.Key
+	}
+	now := time.Now()
+	var rows []model.WebhookDelivery
+	for _, s := range subs {
+		if !slices.Contains(splitEvents(s.Events), msg.Type) {
+			continue
+		}
+		rows = append(rows, model.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: s.ID,
+			EventID:        msg.ID,
+			EventType:      msg.Type,
+			SessionID:      sessionID,
+			Payload:        msg.Payload,
+			Status:         model.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+		return err
+	}
+	d.notify()
+	return nil
+}
+
+// Run delivers due webhooks until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		// A full batch means more rows are probably due: keep draining before waiting.
+		for d.deliverDue(ctx) == batchSize && ctx.Err() == nil {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue claims a batch of due deliveries and attempts each one. Returns number of claimed rows.
+// Rows are claimed with FOR UPDATE SKIP LOCKED and leased by pushing next_attempt_at forward,
+// so several replicas can run dispatchers against the same table.
+func (d *Dispatcher) deliverDue(ctx context.Context) int {
+	var due []model.WebhookDelivery
+	lease := time.Now().Add(d.client.Timeout + time.Minute)
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at").Limit(batchSize).Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		ids := make([]string, len(due))
+		for i := range due {
+			ids[i] = due[i].ID
+		}
+		return tx.Model(&model.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", lease).Error
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Warn("webhook: claim deliveries failed", zap.Error(err))
+		}
+		return 0
+	}
+	for i := range due {
+		d.attempt(ctx, &due[i])
+	}
+	return len(due)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, del *model.WebhookDelivery) {
+	var sub model.WebhookSubscription
+	if err := d.db.WithContext(ctx).Where("id = ?", del.SubscriptionID).First(&sub).Error; err != nil {
+		d.log.Warn("webhook: load subscription failed", zap.String("delivery_id", del.ID), zap.Error(err))
+		return
+	}
+	n := del.Attempts + 1
+	start := time.Now()
+	code, sendErr := d.send(ctx, &sub, del)
+	rec := model.WebhookDeliveryAttempt{
+		ID:          uuid.New().String(),
+		DeliveryID:  del.ID,
+		Attempt:     n,
+		DurationMs:  time.Since(start).Milliseconds(),
+		AttemptedAt: start,
+	}
+	if code != 0 {
+		rec.StatusCode = &code
+	}
+	updates := map[string]interface{}{"attempts": n}
+	if sendErr == nil {
+		updates["status"] = model.WebhookDeliveryDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = nil
+	} else {
+		msg := sendErr.Error()
+		rec.Error = &msg
+		updates["last_error"] = msg
+		if n >= d.maxAttempts || !sub.Active {
+			updates["status"] = model.WebhookDeliveryFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(Backoff(n))
+		}
+		d.log.Warn("webhook: delivery failed",
+			zap.String("delivery_id", del.ID),
+			zap.String("event_type", del.EventType),
+			zap.Int("attempt", n),
+			zap.Error(sendErr))
+	}
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rec).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.WebhookDelivery{}).Where("id = ?", del.ID).Updates(updates).Error
+	})
+	if err != nil {
+		d.log.Warn("webhook: record attempt failed", zap.String("delivery_id", del.ID), zap.Error(err))
+	}
+}
+
+// send POSTs the signed payload; any non-2xx response is an error.
+func (d *Dispatcher) send(ctx context.Context, sub *model.WebhookSubscription, del *model.WebhookDelivery) (int, error) {
+	if !sub.Active {
+		return 0, errors.New("subscription is inactive")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "psds-streaming-service-webhook")
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now(), del.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns the delay before attempt n+1: exponential from 10s, capped at 1h, with ±20% jitter.
+func Backoff(n int) time.Duration {
+	d := backoffBase
+	for i := 1; i < n && d < backoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, backoffMax)
+	jitter := time.Duration(rand.Int64N(int64(d)/5*2+1)) - d/5
+	return d + jitter
+}
+
+// CreateSubscription stores a subscription; a random secret is generated when req.Secret is empty.
+// The returned view contains the secret — it is not shown again.
+func (d *Dispatcher) CreateSubscription(req model.CreateWebhookRequest) (*model.Webhook, error) {
+	for _, e := range req.Events {
+		if !slices.Contains(model.EventTypes, model.EventType(e)) {
+			return nil, fmt.Errorf("%w: %s", errs.ErrUnknownEventType, e)
+		}
+	}
+	secret := req.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := crand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	ent := &model.WebhookSubscription{
+		ID:     uuid.New().String(),
+		URL:    req.URL,
+		Secret: secret,
+		Events: strings.Join(req.Events, ","),
+		Active: true,
+	}
+	if err := d.db.Create(ent).Error; err != nil {
+		return nil, err
+	}
+	v := subscriptionView(ent)
+	v.Secret = secret
+	return v, nil
+}
+
+// ListSubscriptions returns all subscriptions (without secrets).
+func (d *Dispatcher) ListSubscriptions() ([]model.Webhook, error) {
+	var ents []model.WebhookSubscription
+	if err := d.db.Order("created_at").Find(&ents).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.Webhook, 0, len(ents))
+	for i := range ents {
+		out = append(out, *subscriptionView(&ents[i]))
+	}
+	return out, nil
+}
+
+// DeleteSubscription removes a subscription and its deliveries.
+func (d *Dispatcher) DeleteSubscription(id string) error {
+	res := d.db.Where("id = ?", id).Delete(&model.WebhookSubscription{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries, optionally filtered by subscription, session and status.
+func (d *Dispatcher) ListDeliveries(subscriptionID, sessionID, status string, limit int) ([]model.WebhookDeliveryView, error) {
+	q := d.db.Order("created_at DESC").Limit(limit)
+	if subscriptionID != "" {
+		q = q.Where("subscription_id = ?", subscriptionID)
+	}
+	if sessionID != "" {
+		q = q.Where("session_id = ?", sessionID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var ents []model.WebhookDelivery
+	if err := q.Find(&ents).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.WebhookDeliveryView, 0, len(ents))
+	for i := range ents {
+		out = append(out, deliveryView(&ents[i], false))
+	}
+	return out, nil
+}
+
+// GetDelivery returns a delivery with its payload and attempt log in the order attempted (replays restart the numbering).
+func (d *Dispatcher) GetDelivery(id string) (*model.WebhookDeliveryView, error) {
+	var ent model.WebhookDelivery
+	err := d.db.Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("attempted_at, attempt") }).
+		Where("id = ?", id).First(&ent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	v := deliveryView(&ent, true)
+	return &v, nil
+}
+
+// Replay re-queues a delivery for immediate sending, keeping its attempt history.
+// The attempt budget is restarted so a failed delivery gets a full set of retries.
+func (d *Dispatcher) Replay(id string) error {
+	res := d.db.Model(&model.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          model.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs.ErrDeliveryNotFound
+	}
+	d.notify()
+	return nil
+}
+
+func splitEvents(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func subscriptionView(ent *model.WebhookSubscription) *model.Webhook {
+	return &model.Webhook{
+		ID:        ent.ID,
+		URL:       ent.URL,
+		Events:    splitEvents(ent.Events),
+		Active:    ent.Active,
+		CreatedAt: ent.CreatedAt,
+	}
+}
+
+func deliveryView(ent *model.WebhookDelivery, full bool) model.WebhookDeliveryView {
+	v := model.WebhookDeliveryView{
+		ID:             ent.ID,
+		SubscriptionID: ent.SubscriptionID,
+		EventID:        ent.EventID,
+		EventType:      ent.EventType,
+		Status:         ent.Status,
+		Attempts:       ent.Attempts,
+		NextAttemptAt:  ent.NextAttemptAt,
+		CreatedAt:      ent.CreatedAt,
+		DeliveredAt:    ent.DeliveredAt,
+	}
+	if ent.SessionID != nil {
+		v.SessionID = *ent.SessionID
+	}
+	if ent.LastError != nil {
+		v.LastError = *ent.LastError
+	}
+	if !full {
+		return v
+	}
+	_ = json.Unmarshal(ent.Payload, &v.Payload)
+	for _, a := range ent.AttemptLog {
+		av := model.WebhookAttemptView{Attempt: a.Attempt, DurationMs: a.DurationMs, AttemptedAt: a.AttemptedAt}
+		if a.StatusCode != nil {
+			av.StatusCode = *a.StatusCode
+		}
+		if a.Error != nil {
+			av.Error = *a.Error
+		}
+		v.AttemptLog = append(v.AttemptLog, av)
+	}
+	return v
+}
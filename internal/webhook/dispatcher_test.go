@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/psds-microservice/streaming-service/internal/errs"
+	"github.com/psds-microservice/streaming-service/internal/model"
+	"github.com/psds-microservice/streaming-service/internal/outbox"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// schema is the webhook part of the migrations in SQLite terms (no gen_random_uuid, JSONB or timestamptz).
+const schema = `
+CREATE TABLE webhook_subscriptions (
+  id TEXT PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret VARCHAR(128) NOT NULL,
+  events TEXT NOT NULL,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE webhook_deliveries (
+  id TEXT PRIMARY KEY,
+  subscription_id TEXT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL,
+  event_type VARCHAR(64) NOT NULL,
+  session_id TEXT,
+  payload BLOB NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at DATETIME NOT NULL,
+  last_error TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  delivered_at DATETIME
+);
+CREATE UNIQUE INDEX idx_webhook_deliveries_subscription_event ON webhook_deliveries(subscription_id, event_id);
+CREATE TABLE webhook_delivery_attempts (
+  id TEXT PRIMARY KEY,
+  delivery_id TEXT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  attempt INT NOT NULL,
+  status_code INT,
+  error TEXT,
+  duration_ms BIGINT NOT NULL DEFAULT 0,
+  attempted_at DATETIME NOT NULL
+);`
+
+func newTestDispatcher(t *testing.T, maxAttempts int) *Dispatcher {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // one connection: one in-memory database
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.Exec(schema).Error; err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	return NewDispatcher(db, time.Second, maxAttempts, zap.NewNop())
+}
+
+// flakyServer answers 503 to the first fail requests and 200 after that; it verifies every signature.
+func flakyServer(t *testing.T, fail int32) (*httptest.Server, *atomic.Int32) {
+	left := &atomic.Int32{}
+	left.Store(fail)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sig := r.Header.Get(HeaderSignature)
+		ts, _, _ := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || Sign(secret, time.Unix(unix, 0), body) != sig {
+			t.Errorf("signature %q does not verify", sig)
+		}
+		if r.Header.Get(HeaderEvent) != string(model.EventSessionFinished) || r.Header.Get(HeaderDelivery) == "" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if left.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, left
+}
+
+const secret = "whsec-test"
+
+// subscribe creates a subscription to session.finished at url and enqueues one event for it.
+func subscribe(t *testing.T, d *Dispatcher, url string) (deliveryID string) {
+	t.Helper()
+	sub, err := d.CreateSubscription(model.CreateWebhookRequest{URL: url, Events: []string{string(model.EventSessionFinished)}, Secret: secret})
+	if err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	msg := outbox.Message{ID: uuid.New().String(), Type: string(model.EventSessionFinished), Key: "s1", Payload: []byte(`{"type":"session.finished"}`)}
+	for range 2 { // relayed twice: enqueued once
+		if err := d.Publish(context.Background(), msg); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	dels, err := d.ListDeliveries(sub.ID, "s1", "", 10)
+	if err != nil || len(dels) != 1 {
+		t.Fatalf("deliveries = %v, %v; want one", dels, err)
+	}
+	return dels[0].ID
+}
+
+// retryNow makes the delivery due again instead of waiting for its backoff.
+func retryNow(t *testing.T, d *Dispatcher, id string) {
+	t.Helper()
+	if err := d.db.Model(&model.WebhookDelivery{}).Where("id = ?", id).Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("reschedule: %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	body := []byte(`{"a":1}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"a":1}`))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got := Sign("secret", ts, body); got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+	for _, other := range []string{Sign("other", ts, body), Sign("secret", ts.Add(time.Second), body), Sign("secret", ts, []byte(`{"a":2}`))} {
+		if other == want {
+			t.Fatalf("signature %q does not depend on the secret, timestamp and body", other)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		base time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{8, 1280 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{50, time.Hour},
+	} {
+		for range 100 {
+			if d := Backoff(tc.n); d < tc.base*4/5 || d > tc.base*6/5 {
+				t.Fatalf("Backoff(%d) = %v, want %v ±20%%", tc.n, d, tc.base)
+			}
+		}
+	}
+}
+
+// delivery returns the delivery with its attempt log.
+func delivery(t *testing.T, d *Dispatcher, id string) *model.WebhookDeliveryView {
+	t.Helper()
+	v, err := d.GetDelivery(id)
+	if err != nil {
+		t.Fatalf("get delivery: %v", err)
+	}
+	return v
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	d := newTestDispatcher(t, 5)
+	srv, _ := flakyServer(t, 2)
+	id := subscribe(t, d, srv.URL)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if n := d.deliverDue(ctx); n != 1 {
+			t.Fatalf("round %d: %d deliveries claimed, want 1", i, n)
+		}
+		if n := d.deliverDue(ctx); n != 0 {
+			t.Fatalf("round %d: claimed again during the backoff (%d)", i, n)
+		}
+		v := delivery(t, d, id)
+		if v.Attempts != i {
+			t.Fatalf("round %d: attempts = %d", i, v.Attempts)
+		}
+		if i < 3 {
+			if v.Status != model.WebhookDeliveryPending || v.LastError == "" || !v.NextAttemptAt.After(time.Now().Add(5*time.Second)) {
+				t.Fatalf("round %d: %+v; want pending with an error, retried after the backoff", i, v)
+			}
+			retryNow(t, d, id)
+		}
+	}
+
+	v := delivery(t, d, id)
+	if v.Status != model.WebhookDeliveryDelivered || v.DeliveredAt == nil || v.LastError != "" {
+		t.Fatalf("delivery = %+v, want delivered", v)
+	}
+	if v.Payload["type"] != "session.finished" {
+		t.Fatalf("payload = %v", v.Payload)
+	}
+	if len(v.AttemptLog) != 3 {
+		t.Fatalf("attempt log = %+v, want 3 attempts", v.AttemptLog)
+	}
+	for i, a := range v.AttemptLog {
+		code, failed := http.StatusServiceUnavailable, true
+		if i == 2 {
+			code, failed = http.StatusNoContent, false
+		}
+		if a.Attempt != i+1 || a.StatusCode != code || (a.Error != "") != failed {
+			t.Fatalf("attempt %d = %+v, want status %d", i+1, a, code)
+		}
+	}
+}
+
+func TestDispatcherDeadLettersAndReplays(t *testing.T) {
+	d := newTestDispatcher(t, 2)
+	srv, left := flakyServer(t, 1<<20)
+	id := subscribe(t, d, srv.URL)
+	ctx := context.Background()
+
+	d.deliverDue(ctx)
+	retryNow(t, d, id)
+	d.deliverDue(ctx)
+	retryNow(t, d, id)
+	if n := d.deliverDue(ctx); n != 0 {
+		t.Fatalf("failed delivery claimed again (%d)", n)
+	}
+	v := delivery(t, d, id)
+	if v.Status != model.WebhookDeliveryFailed || v.Attempts != 2 || len(v.AttemptLog) != 2 {
+		t.Fatalf("delivery = %+v, want failed after 2 attempts", v)
+	}
+	if dels, err := d.ListDeliveries("", "", model.WebhookDeliveryFailed, 10); err != nil || len(dels) != 1 {
+		t.Fatalf("failed deliveries = %v, %v", dels, err)
+	}
+
+	left.Store(0)
+	if err := d.Replay(id); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if n := d.deliverDue(ctx); n != 1 {
+		t.Fatalf("replayed delivery not claimed (%d)", n)
+	}
+	v = delivery(t, d, id)
+	if v.Status != model.WebhookDeliveryDelivered || v.Attempts != 1 {
+		t.Fatalf("replayed delivery = %+v, want delivered on its first new attempt", v)
+	}
+	if len(v.AttemptLog) != 3 || v.AttemptLog[2].StatusCode != http.StatusNoContent {
+		t.Fatalf("attempt log = %+v, want the history kept and the replay appended", v.AttemptLog)
+	}
+	if err := d.Replay(uuid.New().String()); !errors.Is(err, errs.ErrDeliveryNotFound) {
+		t.Fatalf("replay of an unknown delivery: %v", err)
+	}
+}
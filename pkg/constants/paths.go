@@ -1,8 +1,10 @@
 package constants
 
-// Пути health, ready, swagger (остальные API — по желанию через proto или handler).
+// Пути health, ready, metrics, swagger (остальные API — по желанию через proto или handler).
 const (
 	PathHealth  = "/health"
 	PathReady   = "/ready"
+	PathMetrics = "/metrics"
 	PathSwagger = "/swagger"
+	PathOpenAPI = PathSwagger + "/openapi.json"
 )